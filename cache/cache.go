@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned by Get when the key is absent or has expired.
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores opaque values under string keys for a limited time.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored under key, or ErrMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key until ttl has passed.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the given keys. Absent keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+}
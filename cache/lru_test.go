@@ -0,0 +1,61 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BerryTracer/user-service/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU_GetSet(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(2)
+
+	_, err := c.Get(ctx, "a")
+	assert.ErrorIs(t, err, cache.ErrMiss)
+
+	assert.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	value, err := c.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+}
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(2)
+
+	assert.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	assert.NoError(t, c.Set(ctx, "b", []byte("2"), time.Minute))
+	_, _ = c.Get(ctx, "a")
+	assert.NoError(t, c.Set(ctx, "c", []byte("3"), time.Minute))
+
+	_, err := c.Get(ctx, "b")
+	assert.ErrorIs(t, err, cache.ErrMiss)
+	_, err = c.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestLRU_Expiry(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(2)
+
+	assert.NoError(t, c.Set(ctx, "a", []byte("1"), 0))
+
+	_, err := c.Get(ctx, "a")
+	assert.ErrorIs(t, err, cache.ErrMiss)
+	assert.Zero(t, c.Len())
+}
+
+func TestLRU_Delete(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU(2)
+
+	assert.NoError(t, c.Set(ctx, "a", []byte("1"), time.Minute))
+	assert.NoError(t, c.Delete(ctx, "a", "missing"))
+
+	_, err := c.Get(ctx, "a")
+	assert.ErrorIs(t, err, cache.ErrMiss)
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Cache backed by Redis, shared by every replica of a service so
+// that deletes take effect everywhere at once.
+type Redis struct {
+	Client redis.UniversalClient
+	// Prefix is prepended to every key, to share a Redis between services.
+	Prefix string
+}
+
+// NewRedis returns a new Redis cache.
+func NewRedis(client redis.UniversalClient, prefix string) *Redis {
+	return &Redis{Client: client, Prefix: prefix}
+}
+
+// Get implements Cache.
+func (c *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.Client.Get(ctx, c.Prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+// Set implements Cache.
+func (c *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.Client.Set(ctx, c.Prefix+key, value, ttl).Err()
+}
+
+// Delete implements Cache.
+func (c *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, c.Prefix+key)
+	}
+	return c.Client.Del(ctx, prefixed...).Err()
+}
+
+// Ensure Redis implements the Cache interface
+var _ Cache = &Redis{}
@@ -2,7 +2,10 @@ package database
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -11,13 +14,41 @@ type Database interface {
 	Disconnect() error
 }
 
+// UsernameScope is where usernames must be unique.
+type UsernameScope string
+
+const (
+	// UsernamesGlobal makes usernames unique across all users.
+	UsernamesGlobal UsernameScope = "global"
+	// UsernamesPerOrganization makes usernames unique within each organization,
+	// and across the users that are in none.
+	UsernamesPerOrganization UsernameScope = "organization"
+)
+
+// PublishedEventRetention is how long published events stay in the outbox
+// before they are removed.
+const PublishedEventRetention = 7 * 24 * time.Hour
+
 type UserMongoDatabase struct {
 	Client     *mongo.Client
 	Collection *mongo.Collection
+	// OutboxCollection holds user events until they are published.
+	OutboxCollection *mongo.Collection
+	// RefreshTokenCollection holds refresh token families.
+	RefreshTokenCollection *mongo.Collection
+	// SessionCollection holds the sessions users are shown, one per refresh token family.
+	SessionCollection *mongo.Collection
+	// LoginAttemptCollection counts failed sign-in attempts per user and per client IP.
+	LoginAttemptCollection *mongo.Collection
+	// OrganizationCollection holds organizations. Their members are stored on the users.
+	OrganizationCollection *mongo.Collection
+	// InvitationCollection holds invitations to join organizations.
+	InvitationCollection *mongo.Collection
 }
 
-// NewUserMongoDatabaseConnection returns a new UserMongoDatabase.
-func NewUserMongoDatabaseConnection(connStr, databaseStr, collectionStr string) (*UserMongoDatabase, error) {
+// NewUserMongoDatabaseConnection returns a new UserMongoDatabase, indexing
+// usernames for uniqueness within usernameScope.
+func NewUserMongoDatabaseConnection(connStr, databaseStr, collectionStr string, usernameScope UsernameScope) (*UserMongoDatabase, error) {
 	clientOptions := options.Client().ApplyURI(connStr).SetMaxPoolSize(50)
 	client, err := mongo.Connect(context.Background(), clientOptions)
 	if err != nil {
@@ -27,6 +58,8 @@ func NewUserMongoDatabaseConnection(connStr, databaseStr, collectionStr string)
 	db := client.Database(databaseStr)
 	collection := db.Collection(collectionStr)
 
+	// Soft-deleted users keep their documents, so these indexes keep their
+	// email and username reserved until the user is purged.
 	emailIndexModel := mongo.IndexModel{
 		Keys:    map[string]int{"email": 1},
 		Options: options.Index().SetUnique(true),
@@ -37,7 +70,11 @@ func NewUserMongoDatabaseConnection(connStr, databaseStr, collectionStr string)
 		Options: options.Index().SetUnique(true),
 	}
 
-	_, err = collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{emailIndexModel, usernameIndexModel})
+	indexModels := []mongo.IndexModel{emailIndexModel}
+	if usernameScope != UsernamesPerOrganization {
+		indexModels = append(indexModels, usernameIndexModel)
+	}
+	_, err = collection.Indexes().CreateMany(context.Background(), indexModels)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +87,185 @@ func NewUserMongoDatabaseConnection(connStr, databaseStr, collectionStr string)
 		return nil, err
 	}
 
-	return &UserMongoDatabase{Client: client, Collection: collection}, nil
+	// Uniqueness is enforced on canonical forms, so "Alice" and "alice" cannot
+	// coexist. Users written before canonical forms existed have none until the
+	// backfill reaches them, hence the partial filters.
+	canonicalUsernameIndexModel := mongo.IndexModel{
+		Keys: map[string]int{"username_canonical": 1},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(map[string]interface{}{"username_canonical": map[string]bool{"$exists": true}}),
+	}
+	if usernameScope == UsernamesPerOrganization {
+		if err := dropGlobalUsernameIndexes(collection); err != nil {
+			return nil, err
+		}
+
+		// org_ids is an array, so the index, username_canonical_1_org_ids_1,
+		// holds one entry per organization of a user. Users in no organization
+		// have no org_ids and share the null entry; an empty org_ids would be
+		// indexed apart from it, so users leaving their last organization lose
+		// org_ids, and users left with an empty one by earlier versions are
+		// brought in line first.
+		_, err = collection.UpdateMany(context.Background(),
+			bson.M{"org_ids": bson.M{"$size": 0}}, bson.M{"$unset": bson.M{"org_ids": ""}})
+		if err != nil {
+			return nil, err
+		}
+		canonicalUsernameIndexModel.Keys = bson.D{{Key: "username_canonical", Value: 1}, {Key: "org_ids", Value: 1}}
+	}
+
+	_, err = collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: map[string]int{"email_canonical": 1},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(map[string]interface{}{"email_canonical": map[string]bool{"$exists": true}}),
+		},
+		canonicalUsernameIndexModel,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Members of an organization are listed through it.
+	_, err = collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: map[string]int{"org_ids": 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Verification tokens are looked up by hash; most users have none.
+	_, err = collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    map[string]int{"email_verification.token_hash": 1},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	outboxCollection := db.Collection(collectionStr + "_outbox")
+
+	// The relay polls for unpublished events, oldest first. Published events
+	// are removed once PublishedEventRetention has passed; unpublished ones
+	// have a null published_at, which the partial filter leaves out.
+	_, err = outboxCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "published_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "published_at", Value: 1}},
+			Options: options.Index().
+				SetExpireAfterSeconds(int32(PublishedEventRetention.Seconds())).
+				SetPartialFilterExpression(bson.M{"published_at": bson.M{"$type": "date"}}),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenCollection := db.Collection(collectionStr + "_refresh_tokens")
+
+	// Refresh tokens are looked up by the hash of the current token and, to
+	// detect reuse, of the tokens it replaced. Expired families are removed.
+	_, err = refreshTokenCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: map[string]int{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: map[string]int{"previous_token_hashes": 1}},
+		{Keys: map[string]int{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sessionCollection := db.Collection(collectionStr + "_sessions")
+
+	// Sessions are listed per user, most recently seen first, and removed
+	// along with their refresh token family once expired.
+	_, err = sessionCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}}},
+		{Keys: map[string]int{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	loginAttemptCollection := db.Collection(collectionStr + "_login_attempts")
+
+	// Counts are keyed by _id and forgotten once they expire.
+	_, err = loginAttemptCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    map[string]int{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invitationCollection := db.Collection(collectionStr + "_invitations")
+
+	// Invitations are looked up by the hash of their token and listed per
+	// organization, most recent first. They are kept once concluded, to be listed.
+	_, err = invitationCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: map[string]int{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserMongoDatabase{
+		Client:                 client,
+		Collection:             collection,
+		OutboxCollection:       outboxCollection,
+		RefreshTokenCollection: refreshTokenCollection,
+		SessionCollection:      sessionCollection,
+		LoginAttemptCollection: loginAttemptCollection,
+		OrganizationCollection: db.Collection(collectionStr + "_organizations"),
+		InvitationCollection:   invitationCollection,
+	}, nil
+}
+
+// dropGlobalUsernameIndexes drops the indexes keeping usernames unique across
+// all users, left behind by a deployment that switched to per-organization
+// usernames. Indexes that do not exist are skipped.
+func dropGlobalUsernameIndexes(collection *mongo.Collection) error {
+	for _, name := range []string{"username_1", "username_canonical_1"} {
+		_, err := collection.Indexes().DropOne(context.Background(), name)
+		var commandErr mongo.CommandError
+		if err != nil && !(errors.As(err, &commandErr) && commandErr.Name == "IndexNotFound") {
+			return err
+		}
+	}
+	return nil
+}
+
+// SupportsTransactions reports whether the server is part of a replica set or
+// a sharded cluster, the deployments on which Mongo supports transactions.
+func (d *UserMongoDatabase) SupportsTransactions(ctx context.Context) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+
+	err := d.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, err
+	}
+
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+// WatchUsers opens a change stream on the user collection, starting after the
+// change identified by resumeAfter, or at the current time when it is nil.
+// Updates carry the user as it is when the event is read. Like transactions,
+// change streams need a replica set or a sharded cluster.
+func (d *UserMongoDatabase) WatchUsers(ctx context.Context, resumeAfter bson.Raw) (*mongo.ChangeStream, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: bson.D{
+		{Key: "$in", Value: bson.A{"insert", "update", "replace", "delete"}},
+	}}}}}}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeAfter != nil {
+		opts.SetResumeAfter(resumeAfter)
+	}
+
+	return d.Collection.Watch(ctx, pipeline, opts)
 }
 
 // Disconnect implements Database.
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"context"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher publishes events to a Kafka topic. Events are keyed by user ID,
+// so the events of a user land on one partition and keep their order.
+type KafkaPublisher struct {
+	Writer *kafka.Writer
+}
+
+// NewKafkaPublisher returns a new KafkaPublisher writing to topic. Writes wait
+// for all in-sync replicas to acknowledge them.
+func NewKafkaPublisher(brokers []string, topic string) *KafkaPublisher {
+	return &KafkaPublisher{Writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}}
+}
+
+// Publish implements Publisher.
+func (p *KafkaPublisher) Publish(ctx context.Context, event *model.Event) error {
+	data, err := encode(event)
+	if err != nil {
+		return err
+	}
+
+	return p.Writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.UserID),
+		Value: data,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(event.ID)},
+			{Key: "event-type", Value: []byte(event.Type)},
+		},
+	})
+}
+
+// Close flushes pending writes and closes the writer.
+func (p *KafkaPublisher) Close() error {
+	return p.Writer.Close()
+}
+
+// Ensure KafkaPublisher implements the Publisher interface
+var _ Publisher = &KafkaPublisher{}
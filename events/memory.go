@@ -0,0 +1,53 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/BerryTracer/user-service/model"
+)
+
+// MemoryPublisher keeps published events in memory and hands them to in-process
+// subscribers. It is meant for tests and local development.
+type MemoryPublisher struct {
+	mu          sync.Mutex
+	events      []*model.Event
+	subscribers []func(*model.Event)
+}
+
+// NewMemoryPublisher returns a new MemoryPublisher.
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+// Publish implements Publisher.
+func (p *MemoryPublisher) Publish(ctx context.Context, event *model.Event) error {
+	p.mu.Lock()
+	p.events = append(p.events, event)
+	subscribers := append([]func(*model.Event){}, p.subscribers...)
+	p.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(event)
+	}
+	return nil
+}
+
+// Subscribe registers fn to be called with every event published from now on.
+func (p *MemoryPublisher) Subscribe(fn func(*model.Event)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers = append(p.subscribers, fn)
+}
+
+// Events returns the events published so far, oldest first.
+func (p *MemoryPublisher) Events() []*model.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*model.Event(nil), p.events...)
+}
+
+// Ensure MemoryPublisher implements the Publisher interface
+var _ Publisher = &MemoryPublisher{}
@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSPublisher publishes events to NATS JetStream, on the subject
+// "<SubjectPrefix>.<event type>", e.g. "berrytracer.user.created". A stream
+// must capture these subjects for publishes to be acknowledged.
+type NATSPublisher struct {
+	JetStream     nats.JetStreamContext
+	SubjectPrefix string
+}
+
+// NewNATSPublisher returns a new NATSPublisher using the JetStream context of conn.
+func NewNATSPublisher(conn *nats.Conn, subjectPrefix string) (*NATSPublisher, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return &NATSPublisher{JetStream: js, SubjectPrefix: subjectPrefix}, nil
+}
+
+// Publish implements Publisher. The event ID is used as message ID, so
+// JetStream drops events the relay publishes twice within its duplicate window.
+func (p *NATSPublisher) Publish(ctx context.Context, event *model.Event) error {
+	data, err := encode(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.JetStream.Publish(p.SubjectPrefix+"."+string(event.Type), data, nats.MsgId(event.ID), nats.Context(ctx))
+	return err
+}
+
+// Ensure NATSPublisher implements the Publisher interface
+var _ Publisher = &NATSPublisher{}
@@ -0,0 +1,19 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/BerryTracer/user-service/model"
+)
+
+// Publisher delivers user events to other services. Publish must only return
+// nil once the event is durably accepted, as the relay then never retries it.
+type Publisher interface {
+	Publish(ctx context.Context, event *model.Event) error
+}
+
+// encode returns the wire form of an event, shared by all publishers.
+func encode(event *model.Event) ([]byte, error) {
+	return json.Marshal(event)
+}
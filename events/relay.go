@@ -0,0 +1,120 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/BerryTracer/user-service/repository"
+)
+
+const (
+	// DefaultRelayInterval is how often the relay polls the outbox.
+	DefaultRelayInterval = time.Second
+	// DefaultRelayBatchSize is how many events the relay publishes per poll.
+	DefaultRelayBatchSize = 100
+	// DefaultRelayLease is how long an event is reserved for the relay publishing it.
+	DefaultRelayLease = 30 * time.Second
+	// DefaultRelayMaxBackoff caps the delay between attempts to publish a failing event.
+	DefaultRelayMaxBackoff = 5 * time.Minute
+)
+
+// Relay publishes the events in the outbox. Several relays, e.g. one per
+// replica of this service, can share an outbox: each event is claimed by one
+// relay at a time. Events are delivered at least once and, per user, in the
+// order they were written.
+type Relay struct {
+	Outbox     repository.OutboxRepository
+	Publisher  Publisher
+	Interval   time.Duration
+	BatchSize  int
+	Lease      time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewRelay returns a new Relay with default settings.
+func NewRelay(outbox repository.OutboxRepository, publisher Publisher) *Relay {
+	return &Relay{
+		Outbox:     outbox,
+		Publisher:  publisher,
+		Interval:   DefaultRelayInterval,
+		BatchSize:  DefaultRelayBatchSize,
+		Lease:      DefaultRelayLease,
+		MaxBackoff: DefaultRelayMaxBackoff,
+	}
+}
+
+// Run publishes events until ctx is done. Errors are logged and retried on the next poll.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("failed to relay user events: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes the events that are due and returns how many were
+// published. While an event cannot be claimed, because it is backing off
+// after a failure or another relay holds it, the later events of its user
+// wait. RelayOnce stops at the first event that fails to publish; that event
+// is retried with exponential backoff.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+
+	pending, err := r.Outbox.FetchPending(ctx, r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	heldBack := make(map[string]bool)
+	for _, event := range pending {
+		if heldBack[event.UserID] {
+			continue
+		}
+
+		claimed, err := r.Outbox.Claim(ctx, event.ID, now, now.Add(r.Lease))
+		if err != nil {
+			return published, err
+		}
+		if !claimed {
+			heldBack[event.UserID] = true
+			continue
+		}
+
+		if err := r.Publisher.Publish(ctx, event); err != nil {
+			attempts := event.Attempts + 1
+			log.Printf("failed to publish event %s (attempt %d): %v\n", event.ID, attempts, err)
+			return published, r.Outbox.RecordFailure(ctx, event.ID, attempts, time.Now().UTC().Add(r.backoff(attempts)), err.Error())
+		}
+
+		if err := r.Outbox.MarkPublished(ctx, event.ID, time.Now().UTC()); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	return published, nil
+}
+
+// backoff returns the delay before the next attempt after the given number of
+// failed attempts: one second, doubling per attempt, capped at MaxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.MaxBackoff {
+		delay = r.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,157 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BerryTracer/user-service/events"
+	"github.com/BerryTracer/user-service/model"
+	mockrepository "github.com/BerryTracer/user-service/repository/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(ctx context.Context, event *model.Event) error {
+	return errors.New("broker unavailable")
+}
+
+// TestRelay_RelayOnce tests that due events are published in order and marked as published
+func TestRelay_RelayOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbox := mockrepository.NewMockOutboxRepository(ctrl)
+	publisher := events.NewMemoryPublisher()
+	relay := events.NewRelay(outbox, publisher)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	created := model.NewUserIDEvent(model.EventUserCreated, "user-1", now)
+	deleted := model.NewUserIDEvent(model.EventUserDeleted, "user-1", now)
+
+	outbox.EXPECT().FetchPending(ctx, events.DefaultRelayBatchSize).Return([]*model.Event{created, deleted}, nil)
+	gomock.InOrder(
+		outbox.EXPECT().Claim(ctx, created.ID, gomock.Any(), gomock.Any()).Return(true, nil),
+		outbox.EXPECT().MarkPublished(ctx, created.ID, gomock.Any()).Return(nil),
+		outbox.EXPECT().Claim(ctx, deleted.ID, gomock.Any(), gomock.Any()).Return(true, nil),
+		outbox.EXPECT().MarkPublished(ctx, deleted.ID, gomock.Any()).Return(nil),
+	)
+
+	published, err := relay.RelayOnce(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []*model.Event{created, deleted}, publisher.Events())
+}
+
+// TestRelay_RelayOnce_SkipsClaimedEvents tests that events claimed by another relay are not published twice
+func TestRelay_RelayOnce_SkipsClaimedEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbox := mockrepository.NewMockOutboxRepository(ctrl)
+	publisher := events.NewMemoryPublisher()
+	relay := events.NewRelay(outbox, publisher)
+
+	ctx := context.Background()
+	event := model.NewUserIDEvent(model.EventUserCreated, "user-1", time.Now().UTC())
+
+	outbox.EXPECT().FetchPending(ctx, gomock.Any()).Return([]*model.Event{event}, nil)
+	outbox.EXPECT().Claim(ctx, event.ID, gomock.Any(), gomock.Any()).Return(false, nil)
+
+	published, err := relay.RelayOnce(ctx)
+
+	assert.NoError(t, err)
+	assert.Zero(t, published)
+	assert.Empty(t, publisher.Events())
+}
+
+// TestRelay_RelayOnce_BacksOffFailedEvents tests that a failed event is retried later and holds back later events
+func TestRelay_RelayOnce_BacksOffFailedEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbox := mockrepository.NewMockOutboxRepository(ctrl)
+	relay := events.NewRelay(outbox, failingPublisher{})
+
+	ctx := context.Background()
+	failing := model.NewUserIDEvent(model.EventUserCreated, "user-1", time.Now().UTC())
+	failing.Attempts = 3
+	next := model.NewUserIDEvent(model.EventUserDeleted, "user-1", time.Now().UTC())
+
+	outbox.EXPECT().FetchPending(ctx, gomock.Any()).Return([]*model.Event{failing, next}, nil)
+	outbox.EXPECT().Claim(ctx, failing.ID, gomock.Any(), gomock.Any()).Return(true, nil)
+	outbox.EXPECT().
+		RecordFailure(ctx, failing.ID, 4, gomock.Any(), "broker unavailable").
+		DoAndReturn(func(ctx context.Context, id string, attempts int, nextAttemptAt time.Time, lastError string) error {
+			// The fourth attempt waits 2^3 seconds
+			assert.WithinDuration(t, time.Now().Add(8*time.Second), nextAttemptAt, time.Second)
+			return nil
+		})
+
+	published, err := relay.RelayOnce(ctx)
+
+	assert.NoError(t, err)
+	assert.Zero(t, published)
+}
+
+// failOncePublisher fails its first publish and records the later ones.
+type failOncePublisher struct {
+	*events.MemoryPublisher
+	failed bool
+}
+
+func (p *failOncePublisher) Publish(ctx context.Context, event *model.Event) error {
+	if !p.failed {
+		p.failed = true
+		return errors.New("broker unavailable")
+	}
+	return p.MemoryPublisher.Publish(ctx, event)
+}
+
+// TestRelay_RelayOnce_HoldsBackUserAfterFailure tests that a failed event that is not due yet holds back the later events of its user only
+func TestRelay_RelayOnce_HoldsBackUserAfterFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbox := mockrepository.NewMockOutboxRepository(ctrl)
+	publisher := &failOncePublisher{MemoryPublisher: events.NewMemoryPublisher()}
+	relay := events.NewRelay(outbox, publisher)
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	created := model.NewUserIDEvent(model.EventUserCreated, "user-1", now)
+	deleted := model.NewUserIDEvent(model.EventUserDeleted, "user-1", now)
+	other := model.NewUserIDEvent(model.EventUserCreated, "user-2", now)
+
+	// First poll: the first event fails and backs off
+	gomock.InOrder(
+		outbox.EXPECT().FetchPending(ctx, gomock.Any()).Return([]*model.Event{created, deleted, other}, nil),
+		outbox.EXPECT().Claim(ctx, created.ID, gomock.Any(), gomock.Any()).Return(true, nil),
+		outbox.EXPECT().RecordFailure(ctx, created.ID, 1, gomock.Any(), "broker unavailable").Return(nil),
+	)
+
+	published, err := relay.RelayOnce(ctx)
+
+	assert.NoError(t, err)
+	assert.Zero(t, published)
+
+	// Second poll: the failed event is not due, so it cannot be claimed and
+	// the later event of its user is not even tried
+	gomock.InOrder(
+		outbox.EXPECT().FetchPending(ctx, gomock.Any()).Return([]*model.Event{created, deleted, other}, nil),
+		outbox.EXPECT().Claim(ctx, created.ID, gomock.Any(), gomock.Any()).Return(false, nil),
+		outbox.EXPECT().Claim(ctx, other.ID, gomock.Any(), gomock.Any()).Return(true, nil),
+		outbox.EXPECT().MarkPublished(ctx, other.ID, gomock.Any()).Return(nil),
+	)
+
+	published, err = relay.RelayOnce(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []*model.Event{other}, publisher.Events())
+}
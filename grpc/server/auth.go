@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AuthMethod is how a caller proved its identity.
+type AuthMethod string
+
+const (
+	// AuthMethodCertificate is a client certificate verified during the TLS handshake.
+	AuthMethodCertificate AuthMethod = "certificate"
+	// AuthMethodServiceToken is a service token sent as bearer token.
+	AuthMethodServiceToken AuthMethod = "service_token"
+)
+
+// Caller is the authenticated identity calling an RPC.
+type Caller struct {
+	// Identity is the URI SAN of the client certificate, such as a SPIFFE ID,
+	// or its common name without one. For service tokens, it is the service name.
+	Identity string
+	Method   AuthMethod
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context carrying the authenticated caller.
+func WithCaller(ctx context.Context, caller *Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the authenticated caller of the RPC, if there is one.
+func CallerFromContext(ctx context.Context) (*Caller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(*Caller)
+	return caller, ok
+}
+
+// ServiceTokenVerifier verifies service tokens, returning the name of the
+// service that signed them.
+type ServiceTokenVerifier interface {
+	VerifyServiceToken(serviceToken string) (string, error)
+}
+
+// Authenticator authenticates the callers of every RPC, by their verified
+// client certificate or a service token in the authorization metadata, and
+// refuses unauthenticated calls.
+type Authenticator struct {
+	// ServiceTokens verifies service tokens. Without it, only client
+	// certificates are accepted.
+	ServiceTokens ServiceTokenVerifier
+}
+
+// NewAuthenticator returns a new Authenticator accepting service tokens
+// verified by serviceTokens, which may be nil.
+func NewAuthenticator(serviceTokens ServiceTokenVerifier) *Authenticator {
+	return &Authenticator{ServiceTokens: serviceTokens}
+}
+
+// Authenticate returns the caller of the RPC in ctx. A service token that is
+// presented must be valid, even when the caller also has a certificate.
+func (a *Authenticator) Authenticate(ctx context.Context) (*Caller, error) {
+	if serviceToken, ok := bearerToken(ctx); ok {
+		if a.ServiceTokens == nil {
+			return nil, status.Error(codes.Unauthenticated, "service tokens are not accepted")
+		}
+
+		service, err := a.ServiceTokens.VerifyServiceToken(serviceToken)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return &Caller{Identity: service, Method: AuthMethodServiceToken}, nil
+	}
+
+	if cert, ok := clientCertificate(ctx); ok {
+		if identity := certificateIdentity(cert); identity != "" {
+			return &Caller{Identity: identity, Method: AuthMethodCertificate}, nil
+		}
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "caller is not authenticated")
+}
+
+// UnaryInterceptor authenticates the caller before running a unary RPC.
+func (a *Authenticator) UnaryInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	caller, err := a.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(WithCaller(ctx, caller), req)
+}
+
+// StreamInterceptor authenticates the caller before running a streaming RPC.
+func (a *Authenticator) StreamInterceptor(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	caller, err := a.Authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: stream, ctx: WithCaller(stream.Context(), caller)})
+}
+
+// contextStream is a ServerStream with the context given by an interceptor.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// bearerToken returns the bearer token in the authorization metadata of ctx.
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	for _, authorization := range md.Get("authorization") {
+		scheme, value, found := strings.Cut(authorization, " ")
+		if found && strings.EqualFold(scheme, "bearer") && value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// clientCertificate returns the client certificate verified during the TLS
+// handshake of the connection in ctx.
+func clientCertificate(ctx context.Context) (*x509.Certificate, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return tlsInfo.State.VerifiedChains[0][0], true
+}
+
+func certificateIdentity(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.CommonName
+}
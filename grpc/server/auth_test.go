@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type fakeServiceTokens map[string]string
+
+func (f fakeServiceTokens) VerifyServiceToken(serviceToken string) (string, error) {
+	if service, ok := f[serviceToken]; ok {
+		return service, nil
+	}
+	return "", errors.New("invalid service token")
+}
+
+func withBearer(ctx context.Context, serviceToken string) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+serviceToken))
+}
+
+func withClientCert(ctx context.Context, cert *x509.Certificate) context.Context {
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	spiffeID, err := url.Parse("spiffe://berrytracer/auth-gateway")
+	require.NoError(t, err)
+
+	authenticator := NewAuthenticator(fakeServiceTokens{"valid": "admin-tool"})
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected *Caller
+	}{
+		{
+			name:     "service token",
+			ctx:      withBearer(ctx, "valid"),
+			expected: &Caller{Identity: "admin-tool", Method: AuthMethodServiceToken},
+		},
+		{
+			name:     "certificate URI",
+			ctx:      withClientCert(ctx, &x509.Certificate{URIs: []*url.URL{spiffeID}, Subject: pkix.Name{CommonName: "ignored"}}),
+			expected: &Caller{Identity: "spiffe://berrytracer/auth-gateway", Method: AuthMethodCertificate},
+		},
+		{
+			name:     "certificate common name",
+			ctx:      withClientCert(ctx, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}),
+			expected: &Caller{Identity: "billing", Method: AuthMethodCertificate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller, err := authenticator.Authenticate(tt.ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, caller)
+		})
+	}
+}
+
+func TestAuthenticator_Authenticate_Rejects(t *testing.T) {
+	ctx := context.Background()
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+
+	tests := []struct {
+		name          string
+		authenticator *Authenticator
+		ctx           context.Context
+	}{
+		{name: "no credentials", authenticator: NewAuthenticator(fakeServiceTokens{}), ctx: ctx},
+		{name: "invalid service token", authenticator: NewAuthenticator(fakeServiceTokens{}), ctx: withBearer(ctx, "forged")},
+		{name: "invalid service token with certificate", authenticator: NewAuthenticator(fakeServiceTokens{}), ctx: withBearer(withClientCert(ctx, cert), "forged")},
+		{name: "service tokens not accepted", authenticator: NewAuthenticator(nil), ctx: withBearer(ctx, "valid")},
+		{name: "unverified certificate", authenticator: NewAuthenticator(nil), ctx: peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{}})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.authenticator.Authenticate(tt.ctx)
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		})
+	}
+}
+
+func TestAuthenticator_UnaryInterceptor(t *testing.T) {
+	authenticator := NewAuthenticator(fakeServiceTokens{"valid": "auth-gateway"})
+	isTrustedCaller := TrustedIdentities([]string{"auth-gateway"})
+
+	var trusted bool
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		trusted = isTrustedCaller(ctx)
+		return "ok", nil
+	}
+
+	resp, err := authenticator.UnaryInterceptor(withBearer(context.Background(), "valid"), nil, &grpc.UnaryServerInfo{}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+	assert.True(t, trusted)
+
+	_, err = authenticator.UnaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
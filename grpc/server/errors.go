@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	"github.com/BerryTracer/user-service/service"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// toStatus translates domain errors into gRPC status errors so clients can rely
+// on status codes and details instead of error messages. Errors that already
+// carry a status pass through unchanged; anything unrecognised is logged and
+// reported as Internal without leaking its message.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var validationErr *model.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return invalidArgument(validationErr.Violations...)
+	case errors.Is(err, repository.ErrInvalidCursor):
+		return invalidArgument(model.FieldViolation{Field: "page_token", Description: err.Error()})
+	case errors.Is(err, repository.ErrInvalidPageSize):
+		return invalidArgument(model.FieldViolation{Field: "page_size", Description: err.Error()})
+	case errors.Is(err, repository.ErrInvalidResumeToken):
+		return invalidArgument(model.FieldViolation{Field: "resume_token", Description: err.Error()})
+	case errors.Is(err, repository.ErrResumeTokenExpired):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, repository.ErrUserNotFound), errors.Is(err, repository.ErrSessionNotFound),
+		errors.Is(err, repository.ErrRoleNotAssigned), errors.Is(err, repository.ErrOrganizationNotFound),
+		errors.Is(err, repository.ErrNotMember), errors.Is(err, repository.ErrInvitationNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrEmailTaken), errors.Is(err, repository.ErrUsernameTaken),
+		errors.Is(err, repository.ErrRoleAlreadyAssigned), errors.Is(err, repository.ErrAlreadyMember):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, repository.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, service.ErrAccountLocked):
+		return withRetryInfo(codes.PermissionDenied, err)
+	case errors.Is(err, service.ErrTooManyAttempts):
+		return withRetryInfo(codes.ResourceExhausted, err)
+	case errors.Is(err, service.ErrMFARequired):
+		return withErrorInfo(codes.Unauthenticated, err, "MFA_REQUIRED")
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidToken),
+		errors.Is(err, service.ErrInvalidMFACode):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrAccountDisabled):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrInvalidStatusTransition), errors.Is(err, service.ErrEmailAlreadyVerified),
+		errors.Is(err, service.ErrMFAAlreadyEnabled), errors.Is(err, service.ErrMFANotEnabled),
+		errors.Is(err, service.ErrNoMFAEnrollment), errors.Is(err, service.ErrTenantRequired),
+		errors.Is(err, repository.ErrInvitationNotPending), errors.Is(err, repository.ErrStatusChanged):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, service.ErrInvalidVerificationToken), errors.Is(err, service.ErrInvalidInvitation):
+		return invalidArgument(model.FieldViolation{Field: "token", Description: err.Error()})
+	case errors.Is(err, service.ErrInvitationEmailMismatch):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrEmailVerificationDisabled), errors.Is(err, service.ErrWatchUnavailable),
+		errors.Is(err, service.ErrTokensDisabled), errors.Is(err, service.ErrSessionsDisabled),
+		errors.Is(err, service.ErrMFADisabled), errors.Is(err, service.ErrOrganizationsDisabled),
+		errors.Is(err, service.ErrInvitationsDisabled):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	log.Printf("internal error: %v\n", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// invalidArgument builds an InvalidArgument status carrying a BadRequest detail
+// with one field violation per rejected field.
+func invalidArgument(violations ...model.FieldViolation) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+
+	st, err := status.New(codes.InvalidArgument, (&model.ValidationError{Violations: violations}).Error()).WithDetails(badRequest)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid argument")
+	}
+	return st.Err()
+}
+
+// withErrorInfo builds a status carrying an ErrorInfo detail whose reason
+// clients can act on, such as prompting for an MFA code.
+func withErrorInfo(code codes.Code, err error, reason string) error {
+	st, detailErr := status.New(code, err.Error()).WithDetails(&errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: "user-service",
+	})
+	if detailErr != nil {
+		return status.Error(code, err.Error())
+	}
+	return st.Err()
+}
+
+// withRetryInfo builds a status carrying a RetryInfo detail with when the
+// caller may try again, if err says.
+func withRetryInfo(code codes.Code, err error) error {
+	var retryErr *service.RetryAfterError
+	if !errors.As(err, &retryErr) {
+		return status.Error(code, err.Error())
+	}
+
+	st, detailErr := status.New(code, err.Error()).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(retryErr.RetryAfter),
+	})
+	if detailErr != nil {
+		return status.Error(code, err.Error())
+	}
+	return st.Err()
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestToStatus_Codes tests that domain errors map onto the expected gRPC codes
+func TestToStatus_Codes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{repository.ErrUserNotFound, codes.NotFound},
+		{fmt.Errorf("lookup: %w", repository.ErrUserNotFound), codes.NotFound},
+		{repository.ErrEmailTaken, codes.AlreadyExists},
+		{repository.ErrUsernameTaken, codes.AlreadyExists},
+		{repository.ErrVersionConflict, codes.Aborted},
+		{repository.ErrInvalidCursor, codes.InvalidArgument},
+		{repository.ErrInvalidResumeToken, codes.InvalidArgument},
+		{repository.ErrResumeTokenExpired, codes.OutOfRange},
+		{service.ErrWatchUnavailable, codes.Unimplemented},
+		{service.ErrInvalidToken, codes.Unauthenticated},
+		{service.ErrTokensDisabled, codes.Unimplemented},
+		{service.ErrSessionsDisabled, codes.Unimplemented},
+		{repository.ErrSessionNotFound, codes.NotFound},
+		{service.ErrInvalidCredentials, codes.Unauthenticated},
+		{service.ErrAccountDisabled, codes.PermissionDenied},
+		{service.ErrInvalidStatusTransition, codes.FailedPrecondition},
+		{service.ErrInvalidVerificationToken, codes.InvalidArgument},
+		{service.ErrEmailAlreadyVerified, codes.FailedPrecondition},
+		{service.ErrMFARequired, codes.Unauthenticated},
+		{service.ErrInvalidMFACode, codes.Unauthenticated},
+		{service.ErrMFAAlreadyEnabled, codes.FailedPrecondition},
+		{service.ErrNoMFAEnrollment, codes.FailedPrecondition},
+		{service.ErrMFADisabled, codes.Unimplemented},
+		{service.ErrTooManyAttempts, codes.ResourceExhausted},
+		{service.ErrAccountLocked, codes.PermissionDenied},
+		{repository.ErrRoleAlreadyAssigned, codes.AlreadyExists},
+		{repository.ErrRoleNotAssigned, codes.NotFound},
+		{repository.ErrOrganizationNotFound, codes.NotFound},
+		{repository.ErrAlreadyMember, codes.AlreadyExists},
+		{repository.ErrNotMember, codes.NotFound},
+		{service.ErrOrganizationsDisabled, codes.Unimplemented},
+		{service.ErrTenantRequired, codes.FailedPrecondition},
+		{service.ErrInvitationsDisabled, codes.Unimplemented},
+		{service.ErrInvalidInvitation, codes.InvalidArgument},
+		{service.ErrInvitationEmailMismatch, codes.PermissionDenied},
+		{repository.ErrInvitationNotFound, codes.NotFound},
+		{repository.ErrInvitationNotPending, codes.FailedPrecondition},
+		{repository.ErrStatusChanged, codes.FailedPrecondition},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{status.Error(codes.PermissionDenied, "denied"), codes.PermissionDenied},
+		{errors.New("connection reset"), codes.Internal},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, status.Code(toStatus(tt.err)), tt.err.Error())
+	}
+}
+
+// TestToStatus_InternalHidesMessage tests that unknown errors do not leak their message
+func TestToStatus_InternalHidesMessage(t *testing.T) {
+	st := status.Convert(toStatus(errors.New("mongo: secret connection string")))
+
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.NotContains(t, st.Message(), "secret")
+}
+
+// TestToStatus_FieldViolations tests that validation errors carry BadRequest details
+func TestToStatus_FieldViolations(t *testing.T) {
+	err := (&model.User{Email: "invalid"}).Validate()
+
+	st := status.Convert(toStatus(err))
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	details := st.Details()
+	if assert.Len(t, details, 1) {
+		badRequest, ok := details[0].(*errdetails.BadRequest)
+		if assert.True(t, ok) {
+			fields := make([]string, 0, len(badRequest.GetFieldViolations()))
+			for _, v := range badRequest.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+			assert.ElementsMatch(t, []string{"username", "email", "password"}, fields)
+		}
+	}
+}
+
+// TestToStatus_MFARequired tests that clients can tell a missing MFA code from invalid credentials
+func TestToStatus_MFARequired(t *testing.T) {
+	st := status.Convert(toStatus(service.ErrMFARequired))
+
+	assert.Equal(t, codes.Unauthenticated, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+		if assert.True(t, ok) {
+			assert.Equal(t, "MFA_REQUIRED", info.Reason)
+		}
+	}
+
+	assert.Empty(t, status.Convert(toStatus(service.ErrInvalidCredentials)).Details())
+}
+
+// TestToStatus_RetryInfo tests that refused attempts tell the client when to try again
+func TestToStatus_RetryInfo(t *testing.T) {
+	err := &service.RetryAfterError{Err: service.ErrAccountLocked, RetryAfter: 90 * time.Second}
+	st := status.Convert(toStatus(fmt.Errorf("authenticate: %w", err)))
+
+	assert.Equal(t, codes.PermissionDenied, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		info, ok := st.Details()[0].(*errdetails.RetryInfo)
+		if assert.True(t, ok) {
+			assert.Equal(t, 90*time.Second, info.RetryDelay.AsDuration())
+		}
+	}
+}
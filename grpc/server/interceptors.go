@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/BerryTracer/user-service/service"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ForwardedForMetadataKey is the metadata key in which callers such as the
+// auth gateway forward the IP address of the end user they call on behalf of.
+const ForwardedForMetadataKey = "x-forwarded-for"
+
+// UnaryClientIPInterceptor returns an interceptor passing the IP address of
+// the end user on to the service, which counts failed sign-in attempts under
+// it. Authenticated callers and those isTrustedCaller trusts are services
+// calling on behalf of end users: the address is the last one they forward in
+// ForwardedForMetadataKey, and calls forwarding none have no client IP, so
+// that their own address is never slowed down or locked out. Other callers
+// are end users themselves, identified by the address they connect from.
+func UnaryClientIPInterceptor(isTrustedCaller TrustedCallerFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ip := clientIP(ctx)
+		if _, authenticated := CallerFromContext(ctx); authenticated || isTrustedCaller(ctx) {
+			var err error
+			if ip, err = forwardedIP(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		if ip != "" {
+			ctx = service.WithClientIP(ctx, ip)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// forwardedIP returns the last address in the ForwardedForMetadataKey of ctx,
+// the one added by the caller, or an empty string when there is none.
+func forwardedIP(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(ForwardedForMetadataKey)
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	addresses := strings.Split(values[len(values)-1], ",")
+	ip := net.ParseIP(strings.TrimSpace(addresses[len(addresses)-1]))
+	if ip == nil {
+		return "", status.Errorf(codes.InvalidArgument, "%s must end with an IP address", ForwardedForMetadataKey)
+	}
+	return ip.String(), nil
+}
+
+// UnaryRetryAfterInterceptor sets a retry-after header, in whole seconds, on
+// errors carrying a RetryInfo detail, for clients that do not read details.
+func UnaryRetryAfterInterceptor(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+
+	for _, detail := range status.Convert(err).Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok {
+			seconds := math.Ceil(retryInfo.GetRetryDelay().AsDuration().Seconds())
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(seconds))))
+			break
+		}
+	}
+	return resp, err
+}
+
+// clientIP returns the IP address the caller connects from, or an empty string
+// for callers on other transports.
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	tcpAddr, ok := p.Addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	return tcpAddr.IP.String()
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/BerryTracer/user-service/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientIPInterceptor(t *testing.T) {
+	gateway := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 4711}})
+	authenticated := WithCaller(gateway, &Caller{Identity: "auth-gateway", Method: AuthMethodServiceToken})
+	trustNone := TrustedCallerFunc(DenyAllCallers)
+	trustAll := TrustedCallerFunc(func(context.Context) bool { return true })
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		isTrusted TrustedCallerFunc
+		md        metadata.MD
+		ip        string
+		code      codes.Code
+	}{
+		{name: "untrusted peer", ctx: gateway, isTrusted: trustNone, md: metadata.MD{}, ip: "10.0.0.5"},
+		{name: "untrusted peer forwarding", ctx: gateway, isTrusted: trustNone, md: metadata.Pairs(ForwardedForMetadataKey, "203.0.113.7"), ip: "10.0.0.5"},
+		{name: "trusted peer forwarding", ctx: gateway, isTrusted: trustAll, md: metadata.Pairs(ForwardedForMetadataKey, "203.0.113.7"), ip: "203.0.113.7"},
+		{name: "authenticated caller forwarding", ctx: authenticated, isTrusted: trustNone, md: metadata.Pairs(ForwardedForMetadataKey, "198.51.100.1, 203.0.113.7"), ip: "203.0.113.7"},
+		{name: "authenticated caller not forwarding", ctx: authenticated, isTrusted: trustNone, md: metadata.MD{}},
+		{name: "invalid address", ctx: authenticated, isTrusted: trustNone, md: metadata.Pairs(ForwardedForMetadataKey, "unknown"), code: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(tt.ctx, tt.md)
+
+			var ip string
+			_, err := UnaryClientIPInterceptor(tt.isTrusted)(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+				ip = service.ClientIPFromContext(ctx)
+				return nil, nil
+			})
+
+			if tt.code != codes.OK {
+				require.Error(t, err)
+				assert.Equal(t, tt.code, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ip, ip)
+		})
+	}
+}
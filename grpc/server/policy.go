@@ -0,0 +1,318 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	proto "github.com/BerryTracer/user-service/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AllRPCs grants a role every RPC of UserService, AnyCaller gives roles or
+// tenants to every authenticated caller, and AllTenants lets a caller act for
+// every organization.
+const (
+	AllRPCs    = "*"
+	AnyCaller  = "*"
+	AllTenants = "*"
+)
+
+// Policy decides which callers may call which RPCs of UserService, and for
+// which organizations. Callers have roles, and roles are granted RPCs. Callers
+// scope their calls to one of their tenants with TenantMetadataKey; only those
+// with AllTenants may leave it out to act for every organization at once.
+// Everything not granted is denied.
+//
+// In its JSON form:
+//
+//	{
+//	  "roles": {
+//	    "authenticator": ["AuthenticateUser", "IssueToken", "GetUserCredentials"],
+//	    "admin": ["*"]
+//	  },
+//	  "callers": {
+//	    "spiffe://berrytracer/auth-gateway": ["authenticator"],
+//	    "admin-tool": ["admin"]
+//	  },
+//	  "tenants": {
+//	    "spiffe://berrytracer/auth-gateway": ["*"],
+//	    "admin-tool": ["acme"]
+//	  }
+//	}
+type Policy struct {
+	// Roles maps role names to the names of the RPCs they are granted.
+	Roles map[string][]string `json:"roles"`
+	// Callers maps caller identities to the names of their roles.
+	Callers map[string][]string `json:"callers"`
+	// Tenants maps caller identities to the IDs of the organizations they may
+	// act for, or AllTenants.
+	Tenants map[string][]string `json:"tenants"`
+}
+
+// ParsePolicy parses and validates a policy in JSON form.
+func ParsePolicy(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Validate checks that the policy only grants RPCs of UserService and only
+// gives callers roles it defines, so that typos fail loudly instead of denying.
+func (p *Policy) Validate() error {
+	rpcs := userServiceRPCs()
+	for role, granted := range p.Roles {
+		for _, rpc := range granted {
+			if rpc != AllRPCs && !rpcs[rpc] {
+				return fmt.Errorf("invalid policy: role %q grants unknown RPC %q", role, rpc)
+			}
+		}
+	}
+
+	for identity, roles := range p.Callers {
+		for _, role := range roles {
+			if _, ok := p.Roles[role]; !ok {
+				return fmt.Errorf("invalid policy: caller %q has undefined role %q", identity, role)
+			}
+		}
+	}
+
+	for identity, tenants := range p.Tenants {
+		for _, tenant := range tenants {
+			if tenant == "" {
+				return fmt.Errorf("invalid policy: caller %q has an empty tenant", identity)
+			}
+		}
+	}
+	return nil
+}
+
+// CallerRoles returns the roles of the caller with the given identity, sorted.
+func (p *Policy) CallerRoles(identity string) []string {
+	roles := append(append([]string{}, p.Callers[AnyCaller]...), p.Callers[identity]...)
+	sort.Strings(roles)
+	return roles
+}
+
+// Allows reports whether any of roles is granted rpc.
+func (p *Policy) Allows(roles []string, rpc string) bool {
+	for _, role := range roles {
+		for _, granted := range p.Roles[role] {
+			if granted == AllRPCs || granted == rpc {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CallerTenants returns the tenants of the caller with the given identity, sorted.
+func (p *Policy) CallerTenants(identity string) []string {
+	tenants := append(append([]string{}, p.Tenants[AnyCaller]...), p.Tenants[identity]...)
+	sort.Strings(tenants)
+	return tenants
+}
+
+// AllowsTenant reports whether any of tenants lets a caller act for the
+// organization tenant, or for every organization when tenant is empty.
+func (p *Policy) AllowsTenant(tenants []string, tenant string) bool {
+	for _, allowed := range tenants {
+		if allowed == AllTenants || (tenant != "" && allowed == tenant) {
+			return true
+		}
+	}
+	return false
+}
+
+// userServiceRPCs returns the names of the RPCs of UserService.
+func userServiceRPCs() map[string]bool {
+	rpcs := map[string]bool{}
+	for _, method := range proto.UserService_ServiceDesc.Methods {
+		rpcs[method.MethodName] = true
+	}
+	for _, stream := range proto.UserService_ServiceDesc.Streams {
+		rpcs[stream.StreamName] = true
+	}
+	return rpcs
+}
+
+// Denial describes a call refused by an Authorizer.
+type Denial struct {
+	// Identity is empty for callers that are not authenticated.
+	Identity string
+	Roles    []string
+	Method   string
+	IP       string
+	// Tenant is set for calls refused because of the organization they are
+	// scoped to, or to "*" for refused calls scoped to none.
+	Tenant string
+}
+
+// LogDenial is the default audit of denials, writing them to the log.
+func LogDenial(_ context.Context, denial Denial) {
+	log.Printf("authorization denied: method=%s caller=%q roles=%v tenant=%q ip=%s\n", denial.Method, denial.Identity, denial.Roles, denial.Tenant, denial.IP)
+}
+
+// Authorizer refuses calls to RPCs the policy does not grant the caller,
+// auditing every refusal. Its policy can be replaced while in use.
+type Authorizer struct {
+	// Audit is called with every denied call.
+	Audit func(ctx context.Context, denial Denial)
+
+	mu     sync.RWMutex
+	policy *Policy
+}
+
+// NewAuthorizer returns a new Authorizer enforcing policy, logging denials.
+func NewAuthorizer(policy *Policy) *Authorizer {
+	return &Authorizer{Audit: LogDenial, policy: policy}
+}
+
+// Replace swaps the policy of the authorizer.
+func (a *Authorizer) Replace(policy *Policy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.policy = policy
+}
+
+// Authorize fails with PermissionDenied unless the caller in ctx may call the
+// RPC with the given full method name, such as "/UserService/GetUserById".
+func (a *Authorizer) Authorize(ctx context.Context, fullMethod string) error {
+	a.mu.RLock()
+	policy := a.policy
+	a.mu.RUnlock()
+
+	denial := Denial{Method: fullMethod, IP: clientIP(ctx)}
+	if caller, ok := CallerFromContext(ctx); ok {
+		denial.Identity = caller.Identity
+		denial.Roles = policy.CallerRoles(caller.Identity)
+
+		service, rpc := splitMethod(fullMethod)
+		if service == proto.UserService_ServiceDesc.ServiceName && policy.Allows(denial.Roles, rpc) {
+			return nil
+		}
+	}
+
+	if a.Audit != nil {
+		a.Audit(ctx, denial)
+	}
+	return status.Errorf(codes.PermissionDenied, "caller may not call %s", fullMethod)
+}
+
+// AuthorizeTenant implements TenantCheckFunc. It fails with PermissionDenied
+// unless the policy lets the caller in ctx act for the organization tenant, or
+// for every organization when tenant is empty.
+func (a *Authorizer) AuthorizeTenant(ctx context.Context, tenant string) error {
+	a.mu.RLock()
+	policy := a.policy
+	a.mu.RUnlock()
+
+	fullMethod, _ := grpc.Method(ctx)
+	denial := Denial{Method: fullMethod, IP: clientIP(ctx), Tenant: tenant}
+	if caller, ok := CallerFromContext(ctx); ok {
+		denial.Identity = caller.Identity
+		if policy.AllowsTenant(policy.CallerTenants(caller.Identity), tenant) {
+			return nil
+		}
+	}
+
+	if a.Audit != nil {
+		if tenant == "" {
+			denial.Tenant = AllTenants
+		}
+		a.Audit(ctx, denial)
+	}
+	if tenant == "" {
+		return status.Errorf(codes.PermissionDenied, "caller must scope calls to an organization with %s", TenantMetadataKey)
+	}
+	return status.Errorf(codes.PermissionDenied, "caller may not act for organization %q", tenant)
+}
+
+// UnaryInterceptor authorizes the caller before running a unary RPC. It must
+// run after the caller is authenticated.
+func (a *Authorizer) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := a.Authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor authorizes the caller before running a streaming RPC. It
+// must run after the caller is authenticated.
+func (a *Authorizer) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.Authorize(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// splitMethod splits a full method name into its service and RPC names.
+func splitMethod(fullMethod string) (string, string) {
+	service, rpc, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return service, rpc
+}
+
+// LoadPolicyFile replaces the policy of a with the one in the JSON file at
+// path. An invalid file leaves the policy unchanged.
+func LoadPolicyFile(path string, a *Authorizer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	a.Replace(policy)
+	return nil
+}
+
+// WatchPolicyFile reloads the policy of a from the file at path whenever the
+// file changes, checking every interval until ctx is done. Failed reloads are
+// logged and the previous policy stays in effect.
+func WatchPolicyFile(ctx context.Context, path string, a *Authorizer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Start from the zero time so that a change made since the policy was loaded is not missed.
+	var lastModified time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(lastModified) {
+			continue
+		}
+
+		if err := LoadPolicyFile(path, a); err != nil {
+			log.Printf("failed to reload authorization policy: %v\n", err)
+			continue
+		}
+		lastModified = info.ModTime()
+		log.Printf("reloaded authorization policy from %s\n", path)
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestPolicy() *Policy {
+	return &Policy{
+		Roles: map[string][]string{
+			"authenticator": {"AuthenticateUser", "GetUserCredentials"},
+			"reader":        {"GetUserById"},
+			"admin":         {AllRPCs},
+		},
+		Callers: map[string][]string{
+			"auth-gateway": {"authenticator"},
+			"admin-tool":   {"admin"},
+			AnyCaller:      {"reader"},
+		},
+	}
+}
+
+func withCallerIdentity(identity string) context.Context {
+	return WithCaller(context.Background(), &Caller{Identity: identity, Method: AuthMethodServiceToken})
+}
+
+func TestAuthorizer_Authorize(t *testing.T) {
+	authorizer := NewAuthorizer(newTestPolicy())
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		fullMethod string
+		allowed    bool
+	}{
+		{"granted by role", withCallerIdentity("auth-gateway"), "/UserService/GetUserCredentials", true},
+		{"granted to any caller", withCallerIdentity("billing"), "/UserService/GetUserById", true},
+		{"granted every RPC", withCallerIdentity("admin-tool"), "/UserService/SuspendUser", true},
+		{"not granted", withCallerIdentity("auth-gateway"), "/UserService/SuspendUser", false},
+		{"unknown caller", withCallerIdentity("billing"), "/UserService/GetUserCredentials", false},
+		{"other service", withCallerIdentity("admin-tool"), "/grpc.health.v1.Health/Check", false},
+		{"unauthenticated", context.Background(), "/UserService/GetUserById", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizer.Authorize(tt.ctx, tt.fullMethod)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			}
+		})
+	}
+}
+
+func TestAuthorizer_AuditsDenials(t *testing.T) {
+	authorizer := NewAuthorizer(newTestPolicy())
+	var denials []Denial
+	authorizer.Audit = func(ctx context.Context, denial Denial) {
+		denials = append(denials, denial)
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/SuspendUser"}
+
+	_, err := authorizer.UnaryInterceptor(withCallerIdentity("auth-gateway"), nil, info, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	resp, err := authorizer.UnaryInterceptor(withCallerIdentity("admin-tool"), nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	assert.Equal(t, []Denial{{
+		Identity: "auth-gateway",
+		Roles:    []string{"authenticator", "reader"},
+		Method:   "/UserService/SuspendUser",
+	}}, denials)
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{
+		"roles": {"authenticator": ["AuthenticateUser", "WatchUsers"]},
+		"callers": {"auth-gateway": ["authenticator"]},
+		"tenants": {"auth-gateway": ["acme"]}
+	}`))
+	require.NoError(t, err)
+	assert.True(t, policy.Allows(policy.CallerRoles("auth-gateway"), "WatchUsers"))
+	assert.True(t, policy.AllowsTenant(policy.CallerTenants("auth-gateway"), "acme"))
+	assert.False(t, policy.AllowsTenant(policy.CallerTenants("auth-gateway"), ""))
+
+	invalid := map[string]string{
+		"unknown RPC":    `{"roles": {"authenticator": ["AuthenticateUsers"]}}`,
+		"undefined role": `{"roles": {}, "callers": {"auth-gateway": ["authenticator"]}}`,
+		"unknown field":  `{"role": {}}`,
+		"empty tenant":   `{"tenants": {"auth-gateway": [""]}}`,
+	}
+	for name, data := range invalid {
+		_, err := ParsePolicy([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLoadPolicyFile_KeepsPolicyOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"roles": {"reader": ["GetUserById"]}, "callers": {"billing": ["reader"]}}`), 0o600))
+
+	authorizer := NewAuthorizer(&Policy{})
+	require.NoError(t, LoadPolicyFile(path, authorizer))
+	assert.NoError(t, authorizer.Authorize(withCallerIdentity("billing"), "/UserService/GetUserById"))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"roles": {"reader": ["GetUserByIdd"]}}`), 0o600))
+	assert.Error(t, LoadPolicyFile(path, authorizer))
+	assert.NoError(t, authorizer.Authorize(withCallerIdentity("billing"), "/UserService/GetUserById"))
+}
@@ -2,23 +2,72 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
+	"time"
 
 	proto "github.com/BerryTracer/user-service/grpc/proto"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
 	"github.com/BerryTracer/user-service/service"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type UserGRPCServer struct {
-	UserService service.UserService
+	UserService     service.UserService
+	IsTrustedCaller TrustedCallerFunc
+	// Authorizer, when set, decides who may call privileged RPCs instead of
+	// IsTrustedCaller.
+	Authorizer *Authorizer
 	proto.UnimplementedUserServiceServer
 }
 
-func NewUserGRPCServer(userService service.UserService) *UserGRPCServer {
-	return &UserGRPCServer{
-		UserService: userService,
+// UserGRPCServerOption configures optional behaviour of a UserGRPCServer.
+type UserGRPCServerOption func(*UserGRPCServer)
+
+// WithTrustedCallers sets the check deciding which callers may call privileged
+// RPCs, such as reading internal-only projections, when there is no Authorizer.
+func WithTrustedCallers(isTrustedCaller TrustedCallerFunc) UserGRPCServerOption {
+	return func(s *UserGRPCServer) {
+		s.IsTrustedCaller = isTrustedCaller
+	}
+}
+
+// WithAuthorizer makes the policy of a the only authority on privileged RPCs,
+// which trusted callers may no longer call unless the policy grants them.
+func WithAuthorizer(a *Authorizer) UserGRPCServerOption {
+	return func(s *UserGRPCServer) {
+		s.Authorizer = a
+	}
+}
+
+func NewUserGRPCServer(userService service.UserService, opts ...UserGRPCServerOption) *UserGRPCServer {
+	s := &UserGRPCServer{
+		UserService:     userService,
+		IsTrustedCaller: DenyAllCallers,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
+}
+
+// mayCall reports whether the caller in ctx may call the privileged RPC with
+// the given name. With an Authorizer, its policy decides; without one, only
+// trusted callers may.
+func (s *UserGRPCServer) mayCall(ctx context.Context, rpc string) bool {
+	if s.Authorizer != nil {
+		return s.Authorizer.Authorize(ctx, "/"+proto.UserService_ServiceDesc.ServiceName+"/"+rpc) == nil
+	}
+	return s.IsTrustedCaller(ctx)
 }
 
 func (s *UserGRPCServer) Run(port string) error {
@@ -40,7 +89,7 @@ func (s *UserGRPCServer) Run(port string) error {
 func (s *UserGRPCServer) GetUserById(ctx context.Context, req *proto.GetUserByIdRequest) (*proto.User, error) {
 	user, err := s.UserService.GetUserById(ctx, req.GetId())
 	if err != nil {
-		return nil, err
+		return nil, toStatus(err)
 	}
 
 	return user.ConvertToProto(), nil
@@ -49,7 +98,7 @@ func (s *UserGRPCServer) GetUserById(ctx context.Context, req *proto.GetUserById
 func (s *UserGRPCServer) GetUserByEmail(ctx context.Context, req *proto.GetUserByEmailRequest) (*proto.User, error) {
 	user, err := s.UserService.GetUserByEmail(ctx, req.GetEmail())
 	if err != nil {
-		return nil, err
+		return nil, toStatus(err)
 	}
 
 	return user.ConvertToProto(), nil
@@ -58,17 +107,585 @@ func (s *UserGRPCServer) GetUserByEmail(ctx context.Context, req *proto.GetUserB
 func (s *UserGRPCServer) GetUserByUsername(ctx context.Context, req *proto.GetUserByUsernameRequest) (*proto.User, error) {
 	user, err := s.UserService.GetUserByUsername(ctx, req.GetUsername())
 	if err != nil {
-		return nil, err
+		return nil, toStatus(err)
 	}
 
 	return user.ConvertToProto(), nil
 }
 
 func (s *UserGRPCServer) CreateUser(ctx context.Context, req *proto.CreateUserRequest) (*proto.User, error) {
-	user, err := s.UserService.CreateUser(ctx, req.GetUsername(), req.GetEmail(), req.GetPassword())
+	var user *model.User
+	var err error
+	if req.GetInvitationToken() != "" {
+		user, err = s.UserService.CreateInvitedUser(ctx, req.GetUsername(), req.GetEmail(), req.GetPassword(), req.GetInvitationToken())
+	} else {
+		user, err = s.UserService.CreateUser(ctx, req.GetUsername(), req.GetEmail(), req.GetPassword())
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return user.ConvertToProto(), nil
+}
+
+func (s *UserGRPCServer) AuthenticateUser(ctx context.Context, req *proto.AuthenticateUserRequest) (*proto.User, error) {
+	user, err := s.UserService.AuthenticateUser(ctx, req.GetLogin(), req.GetPassword(), req.GetMfaCode())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return user.ConvertToProto(), nil
+}
+
+func (s *UserGRPCServer) GetUserCredentials(ctx context.Context, req *proto.GetUserCredentialsRequest) (*proto.UserCredentials, error) {
+	if !s.mayCall(ctx, "GetUserCredentials") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not read user credentials")
+	}
+
+	user, err := s.UserService.GetUserById(repository.WithCredentials(ctx), req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return user.ConvertToCredentialsProto(), nil
+}
+
+func (s *UserGRPCServer) UpdateUser(ctx context.Context, req *proto.UpdateUserRequest) (*proto.User, error) {
+	update, err := userUpdateFromMask(req)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	user, err := s.UserService.UpdateUser(ctx, req.GetId(), update, req.GetExpectedVersion())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return user.ConvertToProto(), nil
+}
+
+// userUpdateFromMask builds a UserUpdate containing only the fields named in the request's update mask.
+func userUpdateFromMask(req *proto.UpdateUserRequest) (model.UserUpdate, error) {
+	var update model.UserUpdate
+
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return update, model.NewValidationError("update_mask", "must name at least one field")
+	}
+
+	for _, path := range paths {
+		switch path {
+		case "username":
+			username := req.GetUsername()
+			update.Username = &username
+		case "email":
+			email := req.GetEmail()
+			update.Email = &email
+		default:
+			return update, model.NewValidationError("update_mask", fmt.Sprintf("path %q is not updatable", path))
+		}
+	}
+
+	return update, nil
+}
+
+func (s *UserGRPCServer) ChangePassword(ctx context.Context, req *proto.ChangePasswordRequest) (*emptypb.Empty, error) {
+	if err := s.UserService.ChangePassword(ctx, req.GetId(), req.GetOldPassword(), req.GetNewPassword()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) ResetPassword(ctx context.Context, req *proto.ResetPasswordRequest) (*emptypb.Empty, error) {
+	if !s.mayCall(ctx, "ResetPassword") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not reset passwords")
+	}
+
+	if err := s.UserService.ResetPassword(ctx, req.GetId(), req.GetNewPassword()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) DeleteUser(ctx context.Context, req *proto.DeleteUserRequest) (*emptypb.Empty, error) {
+	if !s.mayCall(ctx, "DeleteUser") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not delete users")
+	}
+
+	if err := s.UserService.DeleteUser(ctx, req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) RestoreUser(ctx context.Context, req *proto.RestoreUserRequest) (*proto.User, error) {
+	if !s.mayCall(ctx, "RestoreUser") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not restore users")
+	}
+
+	user, err := s.UserService.RestoreUser(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return user.ConvertToProto(), nil
+}
+
+func (s *UserGRPCServer) PurgeUser(ctx context.Context, req *proto.PurgeUserRequest) (*emptypb.Empty, error) {
+	if !s.mayCall(ctx, "PurgeUser") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not purge users")
+	}
+
+	if err := s.UserService.PurgeUser(ctx, req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) ListUsers(ctx context.Context, req *proto.ListUsersRequest) (*proto.ListUsersResponse, error) {
+	if !s.mayCall(ctx, "ListUsers") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not list users")
+	}
+
+	query := repository.ListUsersQuery{
+		UsernamePrefix: req.GetUsernamePrefix(),
+		EmailPrefix:    req.GetEmailPrefix(),
+		SortBy:         sortFieldFromProto(req.GetSortBy()),
+		Descending:     req.GetDescending(),
+		PageSize:       int(req.GetPageSize()),
+		Cursor:         req.GetPageToken(),
+	}
+
+	query.Status = model.UserStatusFromProto(req.GetStatus())
+	if req.CreatedAfter != nil {
+		query.CreatedAfter = req.GetCreatedAfter().AsTime()
+	}
+	if req.CreatedBefore != nil {
+		query.CreatedBefore = req.GetCreatedBefore().AsTime()
+	}
+
+	page, err := s.UserService.ListUsers(ctx, query)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &proto.ListUsersResponse{
+		Users:         make([]*proto.User, 0, len(page.Users)),
+		NextPageToken: page.NextCursor,
+	}
+	for _, user := range page.Users {
+		resp.Users = append(resp.Users, user.ConvertToProto())
+	}
+
+	return resp, nil
+}
+
+func sortFieldFromProto(field proto.UserSortField) repository.UserSortField {
+	switch field {
+	case proto.UserSortField_USER_SORT_FIELD_USERNAME:
+		return repository.SortByUsername
+	case proto.UserSortField_USER_SORT_FIELD_EMAIL:
+		return repository.SortByEmail
+	default:
+		return repository.SortByCreatedAt
+	}
+}
+
+func (s *UserGRPCServer) SuspendUser(ctx context.Context, req *proto.SuspendUserRequest) (*proto.User, error) {
+	if !s.mayCall(ctx, "SuspendUser") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not suspend users")
+	}
+
+	user, err := s.UserService.SuspendUser(ctx, req.GetId(), req.GetReason(), req.GetActor())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return user.ConvertToProto(), nil
+}
+
+func (s *UserGRPCServer) ReactivateUser(ctx context.Context, req *proto.ReactivateUserRequest) (*proto.User, error) {
+	if !s.mayCall(ctx, "ReactivateUser") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not reactivate users")
+	}
+
+	user, err := s.UserService.ReactivateUser(ctx, req.GetId(), req.GetReason(), req.GetActor())
 	if err != nil {
-		return nil, err
+		return nil, toStatus(err)
 	}
 
 	return user.ConvertToProto(), nil
 }
+
+func (s *UserGRPCServer) VerifyEmail(ctx context.Context, req *proto.VerifyEmailRequest) (*proto.User, error) {
+	user, err := s.UserService.VerifyEmail(ctx, req.GetToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return user.ConvertToProto(), nil
+}
+
+func (s *UserGRPCServer) ResendVerification(ctx context.Context, req *proto.ResendVerificationRequest) (*emptypb.Empty, error) {
+	if err := s.UserService.ResendVerification(ctx, req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) CheckUsernameAvailability(ctx context.Context, req *proto.CheckUsernameAvailabilityRequest) (*proto.CheckUsernameAvailabilityResponse, error) {
+	availability, err := s.UserService.CheckUsernameAvailability(ctx, req.GetUsername())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &proto.CheckUsernameAvailabilityResponse{
+		Available:   availability.Available,
+		Reasons:     availability.Reasons,
+		Suggestions: availability.Suggestions,
+	}, nil
+}
+
+// WatchUsers streams changes to users until the client disconnects. Changes
+// expose every user's email, so only trusted callers may watch.
+func (s *UserGRPCServer) WatchUsers(req *proto.WatchUsersRequest, stream proto.UserService_WatchUsersServer) error {
+	if !s.mayCall(stream.Context(), "WatchUsers") {
+		return status.Error(codes.PermissionDenied, "caller may not watch users")
+	}
+
+	err := s.UserService.WatchUsers(stream.Context(), req.GetResumeToken(), func(change *model.UserChange) error {
+		return stream.Send(change.ConvertToProto())
+	})
+	return toStatus(err)
+}
+
+func (s *UserGRPCServer) BatchGetUsers(ctx context.Context, req *proto.BatchGetUsersRequest) (*proto.BatchGetUsersResponse, error) {
+	batch, err := s.UserService.BatchGetUsers(ctx, req.GetIds(), req.GetEmails(), req.GetUsernames())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &proto.BatchGetUsersResponse{
+		Ids:       userLookupsToProto(batch.IDs),
+		Emails:    userLookupsToProto(batch.Emails),
+		Usernames: userLookupsToProto(batch.Usernames),
+	}, nil
+}
+
+func userLookupsToProto(results []service.UserLookupResult) []*proto.UserLookup {
+	lookups := make([]*proto.UserLookup, 0, len(results))
+	for _, result := range results {
+		lookup := &proto.UserLookup{Key: result.Key, Found: result.User != nil}
+		if result.User != nil {
+			lookup.User = result.User.ConvertToProto()
+		}
+		lookups = append(lookups, lookup)
+	}
+	return lookups
+}
+
+func (s *UserGRPCServer) IssueToken(ctx context.Context, req *proto.IssueTokenRequest) (*proto.TokenResponse, error) {
+	pair, err := s.UserService.IssueToken(ctx, req.GetLogin(), req.GetPassword(), req.GetMfaCode(), sessionDevice(ctx, req.GetDeviceName()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return tokenPairToProto(pair), nil
+}
+
+func (s *UserGRPCServer) RefreshToken(ctx context.Context, req *proto.RefreshTokenRequest) (*proto.TokenResponse, error) {
+	pair, err := s.UserService.RefreshToken(ctx, req.GetRefreshToken(), sessionDevice(ctx, ""))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return tokenPairToProto(pair), nil
+}
+
+// sessionDevice describes the client calling an RPC, by its user agent and the
+// address of the end user.
+func sessionDevice(ctx context.Context, name string) model.SessionDevice {
+	device := model.SessionDevice{Name: name, IP: service.ClientIPFromContext(ctx)}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if userAgent := md.Get("user-agent"); len(userAgent) > 0 {
+			device.UserAgent = userAgent[0]
+		}
+	}
+
+	return device
+}
+
+func tokenPairToProto(pair *service.TokenPair) *proto.TokenResponse {
+	return &proto.TokenResponse{
+		AccessToken:           pair.AccessToken,
+		TokenType:             "Bearer",
+		AccessTokenExpiresAt:  timestamppb.New(pair.AccessTokenExpiresAt),
+		RefreshToken:          pair.RefreshToken,
+		RefreshTokenExpiresAt: timestamppb.New(pair.RefreshTokenExpiresAt),
+	}
+}
+
+func (s *UserGRPCServer) RevokeToken(ctx context.Context, req *proto.RevokeTokenRequest) (*emptypb.Empty, error) {
+	if err := s.UserService.RevokeToken(ctx, req.GetToken()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// IntrospectToken is meant for services accepting tokens, so only trusted callers may use it.
+func (s *UserGRPCServer) IntrospectToken(ctx context.Context, req *proto.IntrospectTokenRequest) (*proto.IntrospectTokenResponse, error) {
+	if !s.mayCall(ctx, "IntrospectToken") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not introspect tokens")
+	}
+
+	introspection, err := s.UserService.IntrospectToken(ctx, req.GetToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	if !introspection.Active {
+		return &proto.IntrospectTokenResponse{}, nil
+	}
+	return &proto.IntrospectTokenResponse{
+		Active:    true,
+		TokenType: introspection.TokenType,
+		UserId:    introspection.UserID,
+		Username:  introspection.Username,
+		SessionId: introspection.SessionID,
+		IssuedAt:  timestamppb.New(introspection.IssuedAt),
+		ExpiresAt: timestamppb.New(introspection.ExpiresAt),
+	}, nil
+}
+
+func (s *UserGRPCServer) ListSessions(ctx context.Context, req *proto.ListSessionsRequest) (*proto.ListSessionsResponse, error) {
+	if !s.mayCall(ctx, "ListSessions") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not list sessions")
+	}
+
+	sessions, err := s.UserService.ListSessions(ctx, req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &proto.ListSessionsResponse{Sessions: make([]*proto.Session, 0, len(sessions))}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, session.ConvertToProto())
+	}
+	return resp, nil
+}
+
+func (s *UserGRPCServer) RevokeSession(ctx context.Context, req *proto.RevokeSessionRequest) (*emptypb.Empty, error) {
+	if !s.mayCall(ctx, "RevokeSession") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not revoke sessions")
+	}
+
+	if err := s.UserService.RevokeSession(ctx, req.GetUserId(), req.GetSessionId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) RevokeAllSessions(ctx context.Context, req *proto.RevokeAllSessionsRequest) (*proto.RevokeAllSessionsResponse, error) {
+	if !s.mayCall(ctx, "RevokeAllSessions") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not revoke sessions")
+	}
+
+	revoked, err := s.UserService.RevokeAllSessions(ctx, req.GetUserId(), req.GetExceptSessionId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &proto.RevokeAllSessionsResponse{RevokedCount: int32(revoked)}, nil
+}
+
+func (s *UserGRPCServer) BeginTOTPEnrollment(ctx context.Context, req *proto.BeginTOTPEnrollmentRequest) (*proto.BeginTOTPEnrollmentResponse, error) {
+	enrollment, err := s.UserService.BeginTOTPEnrollment(ctx, req.GetUserId(), req.GetPassword())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &proto.BeginTOTPEnrollmentResponse{Secret: enrollment.Secret, OtpauthUri: enrollment.URI}, nil
+}
+
+func (s *UserGRPCServer) ConfirmTOTPEnrollment(ctx context.Context, req *proto.ConfirmTOTPEnrollmentRequest) (*proto.ConfirmTOTPEnrollmentResponse, error) {
+	recoveryCodes, err := s.UserService.ConfirmTOTPEnrollment(ctx, req.GetUserId(), req.GetCode())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &proto.ConfirmTOTPEnrollmentResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *UserGRPCServer) DisableMFA(ctx context.Context, req *proto.DisableMFARequest) (*emptypb.Empty, error) {
+	if err := s.UserService.DisableMFA(ctx, req.GetUserId(), req.GetCode()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) AssignRole(ctx context.Context, req *proto.AssignRoleRequest) (*proto.RoleAssignment, error) {
+	if !s.mayCall(ctx, "AssignRole") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not assign roles")
+	}
+
+	assignment, err := s.UserService.AssignRole(ctx, req.GetUserId(), req.GetRole(), model.ScopeFromProto(req.GetScope()), req.GetActor())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return assignment.ConvertToProto(), nil
+}
+
+func (s *UserGRPCServer) RevokeRole(ctx context.Context, req *proto.RevokeRoleRequest) (*emptypb.Empty, error) {
+	if !s.mayCall(ctx, "RevokeRole") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not revoke roles")
+	}
+
+	if err := s.UserService.RevokeRole(ctx, req.GetUserId(), req.GetRole(), model.ScopeFromProto(req.GetScope()), req.GetActor()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) ListUserRoles(ctx context.Context, req *proto.ListUserRolesRequest) (*proto.ListUserRolesResponse, error) {
+	assignments, err := s.UserService.ListUserRoles(ctx, req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &proto.ListUserRolesResponse{Assignments: make([]*proto.RoleAssignment, 0, len(assignments))}
+	for _, assignment := range assignments {
+		resp.Assignments = append(resp.Assignments, assignment.ConvertToProto())
+	}
+	return resp, nil
+}
+
+func (s *UserGRPCServer) CheckPermission(ctx context.Context, req *proto.CheckPermissionRequest) (*proto.CheckPermissionResponse, error) {
+	allowed, err := s.UserService.CheckPermission(ctx, req.GetUserId(), req.GetPermission(), model.ScopeFromProto(req.GetScope()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &proto.CheckPermissionResponse{Allowed: allowed}, nil
+}
+
+func (s *UserGRPCServer) CreateOrganization(ctx context.Context, req *proto.CreateOrganizationRequest) (*proto.Organization, error) {
+	if !s.mayCall(ctx, "CreateOrganization") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not create organizations")
+	}
+
+	organization, err := s.UserService.CreateOrganization(ctx, req.GetName())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return organization.ConvertToProto(), nil
+}
+
+func (s *UserGRPCServer) AddMember(ctx context.Context, req *proto.AddMemberRequest) (*emptypb.Empty, error) {
+	if !s.mayCall(ctx, "AddMember") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not add members")
+	}
+
+	if err := s.UserService.AddMember(ctx, req.GetOrganizationId(), req.GetUserId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) RemoveMember(ctx context.Context, req *proto.RemoveMemberRequest) (*emptypb.Empty, error) {
+	if !s.mayCall(ctx, "RemoveMember") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not remove members")
+	}
+
+	if err := s.UserService.RemoveMember(ctx, req.GetOrganizationId(), req.GetUserId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserGRPCServer) ListMembers(ctx context.Context, req *proto.ListMembersRequest) (*proto.ListMembersResponse, error) {
+	if !s.mayCall(ctx, "ListMembers") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not list members")
+	}
+
+	page, err := s.UserService.ListMembers(ctx, req.GetOrganizationId(), int(req.GetPageSize()), req.GetPageToken())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &proto.ListMembersResponse{
+		Members:       make([]*proto.User, 0, len(page.Users)),
+		NextPageToken: page.NextCursor,
+	}
+	for _, user := range page.Users {
+		resp.Members = append(resp.Members, user.ConvertToProto())
+	}
+
+	return resp, nil
+}
+
+func (s *UserGRPCServer) InviteMember(ctx context.Context, req *proto.InviteMemberRequest) (*proto.Invitation, error) {
+	if !s.mayCall(ctx, "InviteMember") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not invite members")
+	}
+
+	invitation, err := s.UserService.InviteMember(ctx, req.GetOrganizationId(), req.GetEmail(), req.GetRole(), req.GetInvitedBy())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return invitation.ConvertToProto(time.Now().UTC()), nil
+}
+
+func (s *UserGRPCServer) AcceptInvitation(ctx context.Context, req *proto.AcceptInvitationRequest) (*proto.Invitation, error) {
+	invitation, err := s.UserService.AcceptInvitation(ctx, req.GetToken(), req.GetUserId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return invitation.ConvertToProto(time.Now().UTC()), nil
+}
+
+func (s *UserGRPCServer) ListInvitations(ctx context.Context, req *proto.ListInvitationsRequest) (*proto.ListInvitationsResponse, error) {
+	if !s.mayCall(ctx, "ListInvitations") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not list invitations")
+	}
+
+	invitations, err := s.UserService.ListInvitations(ctx, req.GetOrganizationId(), model.InvitationStatusFromProto(req.GetStatus()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	now := time.Now().UTC()
+	resp := &proto.ListInvitationsResponse{Invitations: make([]*proto.Invitation, 0, len(invitations))}
+	for _, invitation := range invitations {
+		resp.Invitations = append(resp.Invitations, invitation.ConvertToProto(now))
+	}
+	return resp, nil
+}
+
+func (s *UserGRPCServer) RevokeInvitation(ctx context.Context, req *proto.RevokeInvitationRequest) (*proto.Invitation, error) {
+	if !s.mayCall(ctx, "RevokeInvitation") {
+		return nil, status.Error(codes.PermissionDenied, "caller may not revoke invitations")
+	}
+
+	invitation, err := s.UserService.RevokeInvitation(ctx, req.GetOrganizationId(), req.GetInvitationId(), req.GetActor())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return invitation.ConvertToProto(time.Now().UTC()), nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	proto "github.com/BerryTracer/user-service/grpc/proto"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUserGRPCServer_DeleteUser_UntrustedCaller(t *testing.T) {
+	// The service is never reached, so none is needed
+	s := NewUserGRPCServer(nil)
+
+	_, err := s.DeleteUser(context.Background(), &proto.DeleteUserRequest{Id: "12345"})
+
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestUserGRPCServer_GetUserCredentials_UntrustedCaller(t *testing.T) {
+	userService := &stubUserService{}
+	s := NewUserGRPCServer(userService)
+
+	_, err := s.GetUserCredentials(context.Background(), &proto.GetUserCredentialsRequest{Id: "12345"})
+
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Empty(t, userService.read)
+}
+
+func TestUserGRPCServer_GetUserCredentials_PolicyDenied(t *testing.T) {
+	userService := &stubUserService{}
+	trustAll := func(context.Context) bool { return true }
+	s := NewUserGRPCServer(userService, WithTrustedCallers(trustAll), WithAuthorizer(NewAuthorizer(newTestPolicy())))
+
+	// Every caller may read users, but only the auth gateway may read credentials
+	_, err := s.GetUserCredentials(withCallerIdentity("reporting"), &proto.GetUserCredentialsRequest{Id: "12345"})
+
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Empty(t, userService.read)
+}
+
+// stubUserService records the users it is asked to read and suspend. Its
+// other methods are not implemented.
+type stubUserService struct {
+	service.UserService
+	read      []string
+	suspended []string
+}
+
+func (s *stubUserService) GetUserById(_ context.Context, id string) (*model.User, error) {
+	s.read = append(s.read, id)
+	return &model.User{ID: id, HashedPassword: "hashedPassword"}, nil
+}
+
+func (s *stubUserService) SuspendUser(_ context.Context, id, reason, actor string) (*model.User, error) {
+	s.suspended = append(s.suspended, id)
+	return &model.User{ID: id, Status: model.UserStatusSuspended}, nil
+}
+
+func TestUserGRPCServer_SuspendUser_Policy(t *testing.T) {
+	authorizer := NewAuthorizer(newTestPolicy())
+	req := &proto.SuspendUserRequest{Id: "12345", Reason: "abuse", Actor: "admin"}
+
+	t.Run("granted caller that is not trusted", func(t *testing.T) {
+		userService := &stubUserService{}
+		s := NewUserGRPCServer(userService, WithAuthorizer(authorizer))
+
+		user, err := s.SuspendUser(withCallerIdentity("admin-tool"), req)
+
+		require.NoError(t, err)
+		assert.Equal(t, "12345", user.GetId())
+		assert.Equal(t, []string{"12345"}, userService.suspended)
+	})
+
+	t.Run("trusted caller that is not granted", func(t *testing.T) {
+		userService := &stubUserService{}
+		trustAll := func(context.Context) bool { return true }
+		s := NewUserGRPCServer(userService, WithTrustedCallers(trustAll), WithAuthorizer(authorizer))
+
+		_, err := s.SuspendUser(withCallerIdentity("auth-gateway"), req)
+
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		assert.Empty(t, userService.suspended)
+	})
+}
+
+func TestUserGRPCServer_Sessions_UntrustedCaller(t *testing.T) {
+	// The service is never reached, so none is needed
+	s := NewUserGRPCServer(nil)
+	ctx := context.Background()
+
+	_, err := s.ListSessions(ctx, &proto.ListSessionsRequest{UserId: "12345"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = s.RevokeSession(ctx, &proto.RevokeSessionRequest{UserId: "12345", SessionId: "67890"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = s.RevokeAllSessions(ctx, &proto.RevokeAllSessionsRequest{UserId: "12345"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestUserGRPCServer_Sessions_PolicyDenied(t *testing.T) {
+	s := NewUserGRPCServer(nil, WithAuthorizer(NewAuthorizer(newTestPolicy())))
+	ctx := withCallerIdentity("auth-gateway")
+
+	_, err := s.ListSessions(ctx, &proto.ListSessionsRequest{UserId: "12345"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = s.RevokeSession(ctx, &proto.RevokeSessionRequest{UserId: "12345", SessionId: "67890"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = s.RevokeAllSessions(ctx, &proto.RevokeAllSessionsRequest{UserId: "12345"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
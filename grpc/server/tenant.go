@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+
+	"github.com/BerryTracer/user-service/repository"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TenantMetadataKey is the metadata key holding the ID of the organization a
+// call is scoped to. Calls without it see all users, so only callers allowed
+// every organization may leave it out.
+const TenantMetadataKey = "x-tenant-id"
+
+// TenantCheckFunc fails unless the caller in ctx may scope calls to the
+// organization tenant, or make calls seeing every organization when tenant is
+// empty.
+type TenantCheckFunc func(ctx context.Context, tenant string) error
+
+// AnyTenant is the TenantCheckFunc of deployments without an authorization
+// policy: callers may scope calls to any organization, or to none.
+func AnyTenant(context.Context, string) error {
+	return nil
+}
+
+// UnaryTenantInterceptor returns an interceptor scoping unary RPCs to the
+// organization in their metadata, as far as check lets the caller.
+func UnaryTenantInterceptor(check TenantCheckFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := withTenant(ctx, check)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamTenantInterceptor returns an interceptor scoping streaming RPCs to the
+// organization in their metadata, as far as check lets the caller.
+func StreamTenantInterceptor(check TenantCheckFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := withTenant(stream.Context(), check)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// withTenant scopes ctx to the organization in its metadata, if any, once
+// check lets the caller use it.
+func withTenant(ctx context.Context, check TenantCheckFunc) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	switch tenants := md.Get(TenantMetadataKey); len(tenants) {
+	case 0:
+		if err := check(ctx, ""); err != nil {
+			return nil, err
+		}
+		return ctx, nil
+	case 1:
+		if tenants[0] == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "%s must not be empty", TenantMetadataKey)
+		}
+		if err := check(ctx, tenants[0]); err != nil {
+			return nil, err
+		}
+		return repository.WithTenant(ctx, tenants[0]), nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "%s must be given once", TenantMetadataKey)
+	}
+}
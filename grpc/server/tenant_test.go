@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BerryTracer/user-service/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryTenantInterceptor(t *testing.T) {
+	tests := []struct {
+		name   string
+		md     metadata.MD
+		tenant string
+		code   codes.Code
+	}{
+		{name: "no tenant", md: metadata.MD{}},
+		{name: "tenant", md: metadata.Pairs(TenantMetadataKey, "acme"), tenant: "acme"},
+		{name: "empty tenant", md: metadata.Pairs(TenantMetadataKey, ""), code: codes.InvalidArgument},
+		{name: "several tenants", md: metadata.Pairs(TenantMetadataKey, "acme", TenantMetadataKey, "globex"), code: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+
+			var tenant string
+			_, err := UnaryTenantInterceptor(AnyTenant)(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+				tenant, _ = repository.TenantFromContext(ctx)
+				return nil, nil
+			})
+
+			if tt.code != codes.OK {
+				require.Error(t, err)
+				assert.Equal(t, tt.code, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.tenant, tenant)
+		})
+	}
+}
+
+func TestUnaryTenantInterceptor_Policy(t *testing.T) {
+	authorizer := NewAuthorizer(&Policy{
+		Tenants: map[string][]string{
+			"auth-gateway": {AllTenants},
+			"acme-portal":  {"acme"},
+		},
+	})
+	check := TenantCheckFunc(authorizer.AuthorizeTenant)
+
+	tests := []struct {
+		name     string
+		identity string
+		md       metadata.MD
+		tenant   string
+		code     codes.Code
+	}{
+		{name: "every organization, unscoped", identity: "auth-gateway", md: metadata.MD{}},
+		{name: "every organization, scoped", identity: "auth-gateway", md: metadata.Pairs(TenantMetadataKey, "globex"), tenant: "globex"},
+		{name: "own organization", identity: "acme-portal", md: metadata.Pairs(TenantMetadataKey, "acme"), tenant: "acme"},
+		{name: "other organization", identity: "acme-portal", md: metadata.Pairs(TenantMetadataKey, "globex"), code: codes.PermissionDenied},
+		{name: "unscoped", identity: "acme-portal", md: metadata.MD{}, code: codes.PermissionDenied},
+		{name: "no tenants", identity: "billing", md: metadata.Pairs(TenantMetadataKey, "acme"), code: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(withCallerIdentity(tt.identity), tt.md)
+
+			var tenant string
+			_, err := UnaryTenantInterceptor(check)(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+				tenant, _ = repository.TenantFromContext(ctx)
+				return nil, nil
+			})
+
+			if tt.code != codes.OK {
+				require.Error(t, err)
+				assert.Equal(t, tt.code, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.tenant, tenant)
+		})
+	}
+}
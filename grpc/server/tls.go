@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSFiles names the PEM files the server's TLS configuration is loaded from.
+type TLSFiles struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the CAs client certificates are verified against.
+	// Without it, clients are not asked for a certificate.
+	ClientCAFile string
+	// RequireClientCert refuses connections without a valid client
+	// certificate. Otherwise, a certificate is verified if one is presented.
+	RequireClientCert bool
+}
+
+// CertReloader serves the certificate and client CAs loaded from TLSFiles and
+// reloads them when they are rotated on disk. New connections use the files
+// loaded last; established ones are not affected.
+type CertReloader struct {
+	files TLSFiles
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewCertReloader returns a CertReloader holding the files loaded once.
+func NewCertReloader(files TLSFiles) (*CertReloader, error) {
+	if files.RequireClientCert && files.ClientCAFile == "" {
+		return nil, errors.New("client certificates cannot be required without a client CA file")
+	}
+
+	r := &CertReloader{files: files}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files again. When any of them fails to load, the previously
+// loaded ones are kept.
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if r.files.ClientCAFile != "" {
+		data, err := os.ReadFile(r.files.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates in %s", r.files.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	return nil
+}
+
+// Watch reloads the files every interval until ctx is done. Failed reloads
+// are logged.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(); err != nil {
+				log.Printf("failed to reload TLS files: %v\n", err)
+			}
+		}
+	}
+}
+
+// TLSConfig returns a configuration serving the files loaded last to every
+// new connection.
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if r.clientCAs != nil {
+				config.ClientCAs = r.clientCAs
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+				if r.files.RequireClientCert {
+					config.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+			return config, nil
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSignedCert writes a self-signed certificate and its key to dir,
+// returning the certificate.
+func writeSelfSignedCert(t *testing.T, dir, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cert.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	first := writeSelfSignedCert(t, dir, "first")
+	files := TLSFiles{
+		CertFile:          filepath.Join(dir, "cert.pem"),
+		KeyFile:           filepath.Join(dir, "key.pem"),
+		ClientCAFile:      filepath.Join(dir, "cert.pem"),
+		RequireClientCert: true,
+	}
+
+	reloader, err := NewCertReloader(files)
+	require.NoError(t, err)
+
+	config, err := reloader.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, first.Raw, config.Certificates[0].Certificate[0])
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+
+	// Rotate the certificate on disk
+	second := writeSelfSignedCert(t, dir, "second")
+	require.NoError(t, reloader.Reload())
+
+	config, err = reloader.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, second.Raw, config.Certificates[0].Certificate[0])
+
+	// A broken rotation keeps the loaded files
+	require.NoError(t, os.WriteFile(files.KeyFile, []byte("garbage"), 0o600))
+	assert.Error(t, reloader.Reload())
+
+	config, err = reloader.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, second.Raw, config.Certificates[0].Certificate[0])
+}
+
+func TestNewCertReloader_RequireClientCertWithoutCA(t *testing.T) {
+	dir := t.TempDir()
+	writeSelfSignedCert(t, dir, "server")
+
+	_, err := NewCertReloader(TLSFiles{
+		CertFile:          filepath.Join(dir, "cert.pem"),
+		KeyFile:           filepath.Join(dir, "key.pem"),
+		RequireClientCert: true,
+	})
+	assert.Error(t, err)
+}
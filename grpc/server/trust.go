@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/peer"
+)
+
+// TrustedCallerFunc reports whether the caller of an RPC may receive internal-only projections.
+type TrustedCallerFunc func(ctx context.Context) bool
+
+// DenyAllCallers is the default TrustedCallerFunc: no caller is trusted.
+func DenyAllCallers(context.Context) bool {
+	return false
+}
+
+// TrustedNetworks returns a TrustedCallerFunc that trusts callers whose peer
+// address falls inside one of the given CIDR ranges.
+func TrustedNetworks(cidrs []string) (TrustedCallerFunc, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+
+	return func(ctx context.Context) bool {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return false
+		}
+
+		tcpAddr, ok := p.Addr.(*net.TCPAddr)
+		if !ok {
+			return false
+		}
+
+		for _, network := range networks {
+			if network.Contains(tcpAddr.IP) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// TrustedIdentities returns a TrustedCallerFunc that trusts authenticated
+// callers with one of the given identities.
+func TrustedIdentities(identities []string) TrustedCallerFunc {
+	trusted := make(map[string]bool, len(identities))
+	for _, identity := range identities {
+		trusted[strings.TrimSpace(identity)] = true
+	}
+
+	return func(ctx context.Context) bool {
+		caller, ok := CallerFromContext(ctx)
+		return ok && trusted[caller.Identity]
+	}
+}
+
+// AnyTrustedCaller returns a TrustedCallerFunc that trusts callers trusted by
+// any of checks.
+func AnyTrustedCaller(checks ...TrustedCallerFunc) TrustedCallerFunc {
+	return func(ctx context.Context) bool {
+		for _, check := range checks {
+			if check(ctx) {
+				return true
+			}
+		}
+		return false
+	}
+}
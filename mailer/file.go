@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes every message to its own .eml file in Dir instead of sending it.
+type FileMailer struct {
+	Dir  string
+	From string
+	seq  atomic.Uint64
+}
+
+// NewFileMailer returns a new FileMailer, creating dir if needed.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir, From: from}, nil
+}
+
+// Send implements Mailer.
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if msg.From == "" {
+		msg.From = m.From
+	}
+
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.format(), 0o600)
+}
+
+// Ensure FileMailer implements the Mailer interface
+var _ Mailer = &FileMailer{}
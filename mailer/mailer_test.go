@@ -0,0 +1,37 @@
+package mailer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BerryTracer/user-service/mailer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMailer_Send(t *testing.T) {
+	m := mailer.NewMemoryMailer()
+
+	err := m.Send(context.Background(), mailer.Message{To: "testuser@example.com", Subject: "Hello"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []mailer.Message{{To: "testuser@example.com", Subject: "Hello"}}, m.Messages())
+}
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+	m, err := mailer.NewFileMailer(dir, "no-reply@example.com")
+	assert.NoError(t, err)
+
+	err = m.Send(context.Background(), mailer.Message{To: "testuser@example.com", Subject: "Hello", Body: "line one\nline two"})
+	assert.NoError(t, err)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if assert.Len(t, files, 1) {
+		raw, _ := os.ReadFile(files[0])
+		assert.Contains(t, string(raw), "From: no-reply@example.com\r\n")
+		assert.Contains(t, string(raw), "To: testuser@example.com\r\n")
+		assert.Contains(t, string(raw), "\r\n\r\nline one\r\nline two")
+	}
+}
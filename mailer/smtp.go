@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+)
+
+// SMTPMailer sends messages through an SMTP relay.
+type SMTPMailer struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+}
+
+// NewSMTPMailer returns a new SMTPMailer. PLAIN authentication is used when a
+// username is given; net/smtp only allows it over TLS or to localhost.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{Addr: net.JoinHostPort(host, port), From: from}
+	if username != "" {
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send implements Mailer. Messages without a sender are sent from m.From.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if msg.From == "" {
+		msg.From = m.From
+	}
+
+	return smtp.SendMail(m.Addr, m.Auth, msg.From, []string{msg.To}, msg.format())
+}
+
+// Ensure SMTPMailer implements the Mailer interface
+var _ Mailer = &SMTPMailer{}
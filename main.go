@@ -1,27 +1,64 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BerryTracer/common-service/adapter/database/mongodb"
 	"github.com/BerryTracer/common-service/config"
 	"github.com/BerryTracer/common-service/crypto"
+	"github.com/BerryTracer/user-service/cache"
 	"github.com/BerryTracer/user-service/database"
+	"github.com/BerryTracer/user-service/events"
 	user_service "github.com/BerryTracer/user-service/grpc/proto"
 	"github.com/BerryTracer/user-service/grpc/server"
+	"github.com/BerryTracer/user-service/mailer"
+	"github.com/BerryTracer/user-service/mfa"
+	"github.com/BerryTracer/user-service/model"
 	"github.com/BerryTracer/user-service/repository"
 	"github.com/BerryTracer/user-service/service"
+	"github.com/BerryTracer/user-service/token"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
 	// Load environment configurations
 	mongodbURI := getEnvOrPanic("MONGODB_URI")
 	grpcPort := getEnvWithDefaultOrPanic("GRPC_PORT", "50051")
+	trustedNetworks := getOptionalEnv("TRUSTED_CALLER_NETWORKS")
+	usernameScope := loadUsernameScope()
+	normalizer := model.Normalizer{FoldEmailLocalPart: getOptionalBoolEnv("EMAIL_FOLD_LOCAL_PART", true)}
+	serviceOpts := []service.UserServiceOption{
+		service.WithRehashChecker(service.NewBcryptCostChecker(bcrypt.DefaultCost)),
+		service.WithVerificationURL(getOptionalEnv("EMAIL_VERIFICATION_URL")),
+		service.WithPasswordPolicy(loadPasswordPolicy()),
+		service.WithNormalizer(normalizer),
+		service.WithUsernamePolicy(loadUsernamePolicy()),
+		service.WithRoleCatalog(loadRoleCatalog()),
+	}
+	if mail := setupMailer(); mail != nil {
+		serviceOpts = append(serviceOpts, service.WithMailer(mail))
+	}
+	if mfaOpt := setupMFA(); mfaOpt != nil {
+		serviceOpts = append(serviceOpts, mfaOpt)
+	}
+	if usernameScope == database.UsernamesPerOrganization {
+		serviceOpts = append(serviceOpts, service.WithUsernamesPerOrganization())
+	}
 
 	// Initialize the database
-	db := initDatabase(mongodbURI)
+	db := initDatabase(mongodbURI, usernameScope)
 	defer func(db *database.UserMongoDatabase) {
 		err := db.Disconnect()
 		if err != nil {
@@ -29,8 +66,27 @@ func main() {
 		}
 	}(db)
 
+	backfillCanonicalFields(db, normalizer)
+
+	if outbox := setupEvents(db); outbox != nil {
+		serviceOpts = append(serviceOpts, outbox)
+	}
+	if watcher := setupUserWatcher(db); watcher != nil {
+		serviceOpts = append(serviceOpts, watcher)
+	}
+	serviceOpts = append(serviceOpts, setupTokens(db)...)
+	if lockout := setupLockout(db); lockout != nil {
+		serviceOpts = append(serviceOpts, lockout)
+	}
+	serviceOpts = append(serviceOpts, service.WithOrganizations(repository.NewOrganizationMongoRepository(mongodb.NewMongoAdapter(db.OrganizationCollection))))
+	serviceOpts = append(serviceOpts,
+		service.WithInvitations(repository.NewInvitationMongoRepository(mongodb.NewMongoAdapter(db.InvitationCollection))),
+		service.WithInvitationURL(getOptionalEnv("INVITATION_URL")),
+		service.WithInvitationTTL(time.Duration(getOptionalIntEnv("INVITATION_TTL_SECONDS", int(service.DefaultInvitationTTL.Seconds())))*time.Second),
+	)
+
 	// Set up the gRPC server and start listening
-	grpcServer := setupGRPCServer(db)
+	grpcServer := setupGRPCServer(db, trustedNetworks, usernameScope, serviceOpts...)
 	startGRPCServer(grpcServer, grpcPort)
 }
 
@@ -50,28 +106,445 @@ func getEnvWithDefaultOrPanic(key, defaultValue string) string {
 	return value
 }
 
-func initDatabase(mongodbURI string) *database.UserMongoDatabase {
-	db, err := database.NewUserMongoDatabaseConnection(mongodbURI, "user", "user")
+// getOptionalEnv returns the value of key, or an empty string when it is not set.
+func getOptionalEnv(key string) string {
+	value, err := config.LoadEnv(config.NewRealEnvLoader(), key)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// getOptionalIntEnv returns the integer value of key, or defaultValue when it is not set.
+func getOptionalIntEnv(key string, defaultValue int) int {
+	value := getOptionalEnv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", key, err))
+	}
+	return n
+}
+
+// getOptionalBoolEnv returns the boolean value of key, or defaultValue when it is not set.
+func getOptionalBoolEnv(key string, defaultValue bool) bool {
+	value := getOptionalEnv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", key, err))
+	}
+	return b
+}
+
+// loadUsernameScope reads from USERNAME_UNIQUENESS whether usernames are unique
+// across all users ("global", the default) or within each organization
+// ("organization").
+func loadUsernameScope() database.UsernameScope {
+	scope := database.UsernameScope(getEnvWithDefaultOrPanic("USERNAME_UNIQUENESS", string(database.UsernamesGlobal)))
+	if scope != database.UsernamesGlobal && scope != database.UsernamesPerOrganization {
+		panic(fmt.Errorf("USERNAME_UNIQUENESS: unknown scope %q", scope))
+	}
+	return scope
+}
+
+func initDatabase(mongodbURI string, usernameScope database.UsernameScope) *database.UserMongoDatabase {
+	db, err := database.NewUserMongoDatabaseConnection(mongodbURI, "user", "user", usernameScope)
 	if err != nil {
 		panic(err)
 	}
 	return db
 }
 
-func setupGRPCServer(db *database.UserMongoDatabase) *grpc.Server {
+// setupMailer picks the mailer for verification emails: SMTP when MAIL_SMTP_HOST
+// is set, .eml files in MAIL_DIR otherwise, and none when neither is configured.
+func setupMailer() mailer.Mailer {
+	from := getEnvWithDefaultOrPanic("MAIL_FROM", "no-reply@berrytracer.local")
+
+	if host := getOptionalEnv("MAIL_SMTP_HOST"); host != "" {
+		return mailer.NewSMTPMailer(
+			host,
+			getEnvWithDefaultOrPanic("MAIL_SMTP_PORT", "587"),
+			getOptionalEnv("MAIL_SMTP_USERNAME"),
+			getOptionalEnv("MAIL_SMTP_PASSWORD"),
+			from,
+		)
+	}
+
+	if dir := getOptionalEnv("MAIL_DIR"); dir != "" {
+		fileMailer, err := mailer.NewFileMailer(dir, from)
+		if err != nil {
+			panic(err)
+		}
+		return fileMailer
+	}
+
+	log.Println("no mailer configured, email verification is disabled")
+	return nil
+}
+
+// loadPasswordPolicy builds the password policy from the PASSWORD_* variables,
+// starting from service.DefaultPasswordPolicy.
+func loadPasswordPolicy() *service.PasswordPolicy {
+	policy := service.DefaultPasswordPolicy()
+	policy.MinLength = getOptionalIntEnv("PASSWORD_MIN_LENGTH", policy.MinLength)
+	policy.MaxLength = getOptionalIntEnv("PASSWORD_MAX_LENGTH", policy.MaxLength)
+	policy.RequireUpper = getOptionalBoolEnv("PASSWORD_REQUIRE_UPPER", policy.RequireUpper)
+	policy.RequireLower = getOptionalBoolEnv("PASSWORD_REQUIRE_LOWER", policy.RequireLower)
+	policy.RequireDigit = getOptionalBoolEnv("PASSWORD_REQUIRE_DIGIT", policy.RequireDigit)
+	policy.RequireSymbol = getOptionalBoolEnv("PASSWORD_REQUIRE_SYMBOL", policy.RequireSymbol)
+	policy.DisallowUserInfo = !getOptionalBoolEnv("PASSWORD_ALLOW_USER_INFO", !policy.DisallowUserInfo)
+
+	if path := getOptionalEnv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		if err := policy.LoadBlocklist(path); err != nil {
+			panic(err)
+		}
+	}
+
+	return policy
+}
+
+// backfillCanonicalFields stores canonical usernames and emails for users created
+// before they existed. Lookups only find users once they have canonical forms.
+func backfillCanonicalFields(db *database.UserMongoDatabase, normalizer model.Normalizer) {
+	userRepository := repository.NewUserMongoRepository(mongodb.NewMongoAdapter(db.Collection))
+	updated, err := userRepository.BackfillCanonicalFields(context.Background(), normalizer)
+	if err != nil {
+		panic(err)
+	}
+	if updated > 0 {
+		log.Printf("backfilled canonical username and email of %d users\n", updated)
+	}
+}
+
+// loadUsernamePolicy builds the username policy from the USERNAME_* variables,
+// starting from model.DefaultUsernamePolicy. Reserved names listed in
+// RESERVED_NAMES_FILE are reloaded whenever the file changes.
+func loadUsernamePolicy() *model.UsernamePolicy {
+	policy := model.DefaultUsernamePolicy()
+	policy.MinLength = getOptionalIntEnv("USERNAME_MIN_LENGTH", policy.MinLength)
+	policy.MaxLength = getOptionalIntEnv("USERNAME_MAX_LENGTH", policy.MaxLength)
+	policy.AllowUnicode = getOptionalBoolEnv("USERNAME_ALLOW_UNICODE", policy.AllowUnicode)
+	policy.Separators = getEnvWithDefaultOrPanic("USERNAME_SEPARATORS", policy.Separators)
+
+	if path := getOptionalEnv("RESERVED_NAMES_FILE"); path != "" {
+		if err := service.LoadReservedNames(path, policy.Reserved); err != nil {
+			panic(err)
+		}
+
+		interval := time.Duration(getOptionalIntEnv("RESERVED_NAMES_RELOAD_SECONDS", 30)) * time.Second
+		go service.WatchReservedNames(context.Background(), path, policy.Reserved, interval)
+	}
+
+	return policy
+}
+
+// loadRoleCatalog returns the default roles, or those in ROLE_CATALOG_FILE.
+func loadRoleCatalog() *model.RoleCatalog {
+	catalog := model.DefaultRoleCatalog()
+	if path := getOptionalEnv("ROLE_CATALOG_FILE"); path != "" {
+		if err := service.LoadRoleCatalog(path, catalog); err != nil {
+			panic(err)
+		}
+	}
+	return catalog
+}
+
+// setupEvents picks the broker for user events: NATS JetStream when NATS_URL is
+// set, Kafka when KAFKA_BROKERS is set, and none when neither is configured. It
+// starts the relay publishing the outbox and returns the service option that
+// records events in it.
+func setupEvents(db *database.UserMongoDatabase) service.UserServiceOption {
+	var publisher events.Publisher
+	switch {
+	case getOptionalEnv("NATS_URL") != "":
+		conn, err := nats.Connect(getOptionalEnv("NATS_URL"))
+		if err != nil {
+			panic(err)
+		}
+		publisher, err = events.NewNATSPublisher(conn, getEnvWithDefaultOrPanic("NATS_SUBJECT_PREFIX", "berrytracer"))
+		if err != nil {
+			panic(err)
+		}
+	case getOptionalEnv("KAFKA_BROKERS") != "":
+		publisher = events.NewKafkaPublisher(strings.Split(getOptionalEnv("KAFKA_BROKERS"), ","), getEnvWithDefaultOrPanic("KAFKA_TOPIC", "user-events"))
+	default:
+		log.Println("no event broker configured, user events are not published")
+		return nil
+	}
+
+	// Standalone servers, such as the development database, have no
+	// transactions; users and events are then written one after the other.
+	var transactor repository.Transactor = repository.NoTransaction{}
+	supported, err := db.SupportsTransactions(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	if supported {
+		transactor = repository.NewMongoTransactor(db.Client)
+	} else {
+		log.Println("database does not support transactions, user events may be lost on failure")
+	}
+
+	outbox := repository.NewOutboxMongoRepository(mongodb.NewMongoAdapter(db.OutboxCollection))
+	go events.NewRelay(outbox, publisher).Run(context.Background())
+
+	return service.WithOutbox(outbox, transactor)
+}
+
+// setupMFA enables MFA, encrypting TOTP secrets with the base64 AES-256 keys in
+// MFA_ENCRYPTION_KEYS. The first key encrypts; list the previous ones after it
+// until no secret uses them.
+func setupMFA() service.UserServiceOption {
+	encoded := getOptionalEnv("MFA_ENCRYPTION_KEYS")
+	if encoded == "" {
+		log.Println("no MFA encryption keys configured, MFA is disabled")
+		return nil
+	}
+
+	keys, err := mfa.ParseAESKeys(encoded)
+	if err != nil {
+		panic(err)
+	}
+	cipher, err := mfa.NewAESCipher(keys...)
+	if err != nil {
+		panic(err)
+	}
+
+	return service.WithMFA(cipher, getEnvWithDefaultOrPanic("MFA_ISSUER", service.DefaultMFAIssuer))
+}
+
+// setupLockout slows down and eventually locks out repeated failed sign-ins,
+// unless LOGIN_LOCKOUT_ENABLED is false.
+func setupLockout(db *database.UserMongoDatabase) service.UserServiceOption {
+	if !getOptionalBoolEnv("LOGIN_LOCKOUT_ENABLED", true) {
+		log.Println("login lockout is disabled")
+		return nil
+	}
+
+	return service.WithLockout(repository.NewLoginAttemptMongoRepository(mongodb.NewMongoAdapter(db.LoginAttemptCollection)))
+}
+
+// setupUserWatcher enables WatchUsers, which relies on change streams. Like
+// transactions, they are not available on standalone servers.
+func setupUserWatcher(db *database.UserMongoDatabase) service.UserServiceOption {
+	supported, err := db.SupportsTransactions(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	if !supported {
+		log.Println("database does not support change streams, WatchUsers is disabled")
+		return nil
+	}
+
+	return service.WithUserWatcher(repository.NewMongoUserWatcher(db.WatchUsers))
+}
+
+// withUserCache caches user lookups in Redis when REDIS_URL is set, shared by all
+// replicas, and otherwise in an in-process LRU of USER_CACHE_SIZE users. Writes
+// only invalidate the LRU of the replica making them, so it is off by default
+// and only suits deployments running a single replica.
+func withUserCache(userRepository repository.UserRepository) repository.UserRepository {
+	var userCache cache.Cache
+	if redisURL := getOptionalEnv("REDIS_URL"); redisURL != "" {
+		opts, err := redis.ParseURL(redisURL)
+		if err != nil {
+			panic(err)
+		}
+		userCache = cache.NewRedis(redis.NewClient(opts), getEnvWithDefaultOrPanic("REDIS_KEY_PREFIX", "user-service:"))
+	} else if size := getOptionalIntEnv("USER_CACHE_SIZE", 0); size > 0 {
+		userCache = cache.NewLRU(size)
+	} else {
+		return userRepository
+	}
+
+	cached := repository.NewCachedUserRepository(userRepository, userCache)
+	cached.TTL = time.Duration(getOptionalIntEnv("USER_CACHE_TTL_SECONDS", int(cached.TTL.Seconds()))) * time.Second
+	cached.NegativeTTL = time.Duration(getOptionalIntEnv("USER_CACHE_NEGATIVE_TTL_SECONDS", int(cached.NegativeTTL.Seconds()))) * time.Second
+	return cached
+}
+
+// setupTokens enables issuing tokens, signed with the keys in TOKEN_KEY_DIR,
+// and serves their JWKS over HTTP on JWKS_HTTP_PORT. Keys are reloaded every
+// TOKEN_KEY_RELOAD_SECONDS; see token.LoadKeyDir for how they rotate. Every
+// sign-in is recorded as a session.
+func setupTokens(db *database.UserMongoDatabase) []service.UserServiceOption {
+	dir := getOptionalEnv("TOKEN_KEY_DIR")
+	if dir == "" {
+		log.Println("no token keys configured, token issuance is disabled")
+		return nil
+	}
+
+	signingID := getOptionalEnv("TOKEN_SIGNING_KEY_ID")
+	keys := token.NewKeySet()
+	if err := token.LoadKeyDir(dir, signingID, keys); err != nil {
+		panic(err)
+	}
+	interval := time.Duration(getOptionalIntEnv("TOKEN_KEY_RELOAD_SECONDS", 60)) * time.Second
+	go token.WatchKeyDir(context.Background(), dir, signingID, keys, interval)
+
+	issuer := token.NewIssuer(keys, getEnvWithDefaultOrPanic("TOKEN_ISSUER", "berrytracer-user-service"), getOptionalEnv("TOKEN_AUDIENCE"))
+	issuer.AccessTokenTTL = time.Duration(getOptionalIntEnv("TOKEN_ACCESS_TTL_SECONDS", int(issuer.AccessTokenTTL.Seconds()))) * time.Second
+
+	jwksPort := getEnvWithDefaultOrPanic("JWKS_HTTP_PORT", "8080")
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/jwks.json", token.JWKSHandler(keys))
+	go func() {
+		log.Println("JWKS server listening on port " + jwksPort)
+		if err := http.ListenAndServe(":"+jwksPort, mux); err != nil {
+			log.Fatalf("failed to serve JWKS: %v\n", err)
+		}
+	}()
+
+	refreshTokens := repository.NewRefreshTokenMongoRepository(mongodb.NewMongoAdapter(db.RefreshTokenCollection))
+	sessions := repository.NewSessionMongoRepository(mongodb.NewMongoAdapter(db.SessionCollection))
+	refreshTokenTTL := time.Duration(getOptionalIntEnv("TOKEN_REFRESH_TTL_SECONDS", int(service.DefaultRefreshTokenTTL.Seconds()))) * time.Second
+	return []service.UserServiceOption{
+		service.WithTokens(issuer, refreshTokens),
+		service.WithRefreshTokenTTL(refreshTokenTTL),
+		service.WithSessions(sessions),
+	}
+}
+
+func setupGRPCServer(db *database.UserMongoDatabase, trustedNetworks string, usernameScope database.UsernameScope, serviceOpts ...service.UserServiceOption) *grpc.Server {
 	mongoDBAdapter := mongodb.NewMongoAdapter(db.Collection)
-	userRepository := repository.NewUserMongoRepository(mongoDBAdapter)
+	mongoRepository := repository.NewUserMongoRepository(mongoDBAdapter)
+	mongoRepository.UsernamesPerOrganization = usernameScope == database.UsernamesPerOrganization
+	userRepository := withUserCache(mongoRepository)
 	passwordHasher := crypto.NewBcryptHasher()
-	userService := service.NewUserService(userRepository, passwordHasher)
+	userService := service.NewUserService(userRepository, passwordHasher, serviceOpts...)
+
+	var trustedCallers []server.TrustedCallerFunc
+	if trustedNetworks != "" {
+		isTrustedCaller, err := server.TrustedNetworks(strings.Split(trustedNetworks, ","))
+		if err != nil {
+			panic(err)
+		}
+		trustedCallers = append(trustedCallers, isTrustedCaller)
+	}
+	if trustedIdentities := getOptionalEnv("TRUSTED_CALLER_IDENTITIES"); trustedIdentities != "" {
+		trustedCallers = append(trustedCallers, server.TrustedIdentities(strings.Split(trustedIdentities, ",")))
+	}
 
-	gGRPCServer := server.NewUserGRPCServer(userService)
+	var isTrustedCaller server.TrustedCallerFunc = server.DenyAllCallers
+	if len(trustedCallers) > 0 {
+		isTrustedCaller = server.AnyTrustedCaller(trustedCallers...)
+	}
+
+	grpcOpts, authorizer := setupCallerAuthentication(isTrustedCaller)
+	serverOpts := []server.UserGRPCServerOption{server.WithTrustedCallers(isTrustedCaller)}
+	if authorizer != nil {
+		serverOpts = append(serverOpts, server.WithAuthorizer(authorizer))
+	}
+	gGRPCServer := server.NewUserGRPCServer(userService, serverOpts...)
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(grpcOpts...)
 	user_service.RegisterUserServiceServer(grpcServer, gGRPCServer)
 
 	return grpcServer
 }
 
+// setupCallerAuthentication serves TLS with GRPC_TLS_CERT_FILE and
+// GRPC_TLS_KEY_FILE and authenticates every caller, by a client certificate
+// issued by a CA in GRPC_TLS_CLIENT_CA_FILE or by a service token signed with
+// the key of its service in SERVICE_TOKEN_KEY_DIR. Authenticated callers may
+// only call the RPCs the policy in AUTHZ_POLICY_FILE grants them, for the
+// organizations it lets them act for, however much they are trusted otherwise.
+// All of these are required unless GRPC_ALLOW_INSECURE is true, which
+// is meant for local development only. Authenticated callers and those
+// isTrustedCaller trusts forward the IP address of their end users. The
+// authorizer enforcing the policy is returned along with the options, if any.
+func setupCallerAuthentication(isTrustedCaller server.TrustedCallerFunc) ([]grpc.ServerOption, *server.Authorizer) {
+	allowInsecure := getOptionalBoolEnv("GRPC_ALLOW_INSECURE", false)
+	interval := time.Duration(getOptionalIntEnv("GRPC_TLS_RELOAD_SECONDS", 60)) * time.Second
+
+	var opts []grpc.ServerOption
+	clientCAFile := ""
+	if certFile := getOptionalEnv("GRPC_TLS_CERT_FILE"); certFile != "" {
+		clientCAFile = getOptionalEnv("GRPC_TLS_CLIENT_CA_FILE")
+		reloader, err := server.NewCertReloader(server.TLSFiles{
+			CertFile:          certFile,
+			KeyFile:           getEnvOrPanic("GRPC_TLS_KEY_FILE"),
+			ClientCAFile:      clientCAFile,
+			RequireClientCert: getOptionalBoolEnv("GRPC_TLS_REQUIRE_CLIENT_CERT", false),
+		})
+		if err != nil {
+			panic(err)
+		}
+		go reloader.Watch(context.Background(), interval)
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.TLSConfig())))
+	} else if !allowInsecure {
+		panic(errors.New("GRPC_TLS_CERT_FILE is required unless GRPC_ALLOW_INSECURE is true"))
+	} else {
+		log.Println("no TLS certificate configured, gRPC traffic is plaintext")
+	}
+
+	var serviceTokens server.ServiceTokenVerifier
+	if dir := getOptionalEnv("SERVICE_TOKEN_KEY_DIR"); dir != "" {
+		verifier := token.NewServiceVerifier(getEnvWithDefaultOrPanic("SERVICE_TOKEN_AUDIENCE", "berrytracer-user-service"))
+		if err := token.LoadServiceKeyDir(dir, verifier); err != nil {
+			panic(err)
+		}
+		go token.WatchServiceKeyDir(context.Background(), dir, verifier, interval)
+		serviceTokens = verifier
+	}
+
+	// Callers are authenticated and authorized before anything else runs.
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	checkTenant := server.TenantCheckFunc(server.AnyTenant)
+	var authorizer *server.Authorizer
+	if clientCAFile != "" || serviceTokens != nil {
+		authenticator := server.NewAuthenticator(serviceTokens)
+		unary = append(unary, authenticator.UnaryInterceptor)
+		stream = append(stream, authenticator.StreamInterceptor)
+
+		if authorizer = setupAuthorizer(allowInsecure); authorizer != nil {
+			unary = append(unary, authorizer.UnaryInterceptor)
+			stream = append(stream, authorizer.StreamInterceptor)
+			checkTenant = authorizer.AuthorizeTenant
+		}
+	} else if !allowInsecure {
+		panic(errors.New("GRPC_TLS_CLIENT_CA_FILE or SERVICE_TOKEN_KEY_DIR is required unless GRPC_ALLOW_INSECURE is true"))
+	} else {
+		log.Println("no client CA or service keys configured, callers are not authenticated")
+	}
+	unary = append(unary, server.UnaryTenantInterceptor(checkTenant), server.UnaryClientIPInterceptor(isTrustedCaller), server.UnaryRetryAfterInterceptor)
+	stream = append(stream, server.StreamTenantInterceptor(checkTenant))
+
+	return append(opts, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...)), authorizer
+}
+
+// setupAuthorizer loads the authorization policy from AUTHZ_POLICY_FILE and
+// reloads it when the file changes.
+func setupAuthorizer(allowInsecure bool) *server.Authorizer {
+	path := getOptionalEnv("AUTHZ_POLICY_FILE")
+	if path == "" {
+		if !allowInsecure {
+			panic(errors.New("AUTHZ_POLICY_FILE is required unless GRPC_ALLOW_INSECURE is true"))
+		}
+		log.Println("no authorization policy configured, authenticated callers may call every RPC for every organization")
+		return nil
+	}
+
+	authorizer := server.NewAuthorizer(&server.Policy{})
+	if err := server.LoadPolicyFile(path, authorizer); err != nil {
+		panic(err)
+	}
+
+	interval := time.Duration(getOptionalIntEnv("AUTHZ_POLICY_RELOAD_SECONDS", 30)) * time.Second
+	go server.WatchPolicyFile(context.Background(), path, authorizer, interval)
+
+	return authorizer
+}
+
 func startGRPCServer(grpcServer *grpc.Server, grpcPort string) {
 	lis, err := net.Listen("tcp", ":"+grpcPort)
 	if err != nil {
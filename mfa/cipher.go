@@ -0,0 +1,95 @@
+package mfa
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDecrypt is returned when a secret cannot be decrypted with any known key.
+var ErrDecrypt = errors.New("failed to decrypt secret")
+
+// Cipher encrypts TOTP secrets at rest.
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// AESCipher encrypts with AES-256-GCM. Secrets are encrypted with the first of
+// its keys and decrypted with whichever key they were encrypted with, so keys
+// can be rotated by prepending a new one and dropping the old one once no
+// secret uses it.
+type AESCipher struct {
+	aeads []cipher.AEAD
+}
+
+// NewAESCipher returns an AESCipher with the given 32-byte keys, the first of
+// which encrypts.
+func NewAESCipher(keys ...[]byte) (*AESCipher, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption key given")
+	}
+
+	c := &AESCipher{}
+	for i, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %d is %d bytes long, want 32", i, len(key))
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads = append(c.aeads, aead)
+	}
+	return c, nil
+}
+
+// ParseAESKeys decodes a comma-separated list of base64 keys, as accepted by NewAESCipher.
+func ParseAESKeys(s string) ([][]byte, error) {
+	var keys [][]byte
+	for _, encoded := range strings.Split(s, ",") {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Encrypt implements Cipher. The nonce is prepended to the ciphertext.
+func (c *AESCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt implements Cipher.
+func (c *AESCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	for _, aead := range c.aeads {
+		if len(ciphertext) < aead.NonceSize() {
+			return nil, ErrDecrypt
+		}
+
+		nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, sealed, nil); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, ErrDecrypt
+}
+
+// Ensure AESCipher implements the Cipher interface
+var _ Cipher = &AESCipher{}
@@ -0,0 +1,96 @@
+package mfa_test
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/BerryTracer/user-service/mfa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCode tests codes against the SHA1 vectors of RFC 6238, truncated to six digits
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, mfa.Code(secret, mfa.Step(time.Unix(tt.unix, 0))), tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := mfa.GenerateSecret()
+	require.NoError(t, err)
+	now := time.Now()
+
+	previous := mfa.Code(secret, mfa.Step(now)-1)
+	step, ok := mfa.Validate(secret, previous, now)
+	assert.True(t, ok)
+	assert.Equal(t, mfa.Step(now)-1, step)
+
+	_, ok = mfa.Validate(secret, mfa.Code(secret, mfa.Step(now)-2), now)
+	assert.False(t, ok)
+	_, ok = mfa.Validate(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestKeyURI(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	u, err := url.Parse(mfa.KeyURI("BerryTracer", "alice@example.com", secret))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/BerryTracer:alice@example.com", u.Path)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", u.Query().Get("secret"))
+	assert.Equal(t, "BerryTracer", u.Query().Get("issuer"))
+}
+
+// TestAESCipher_Rotation tests that secrets encrypted with a previous key still decrypt
+func TestAESCipher_Rotation(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+
+	oldCipher, err := mfa.NewAESCipher(oldKey)
+	require.NoError(t, err)
+	ciphertext, err := oldCipher.Encrypt([]byte("secret"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "secret")
+
+	rotated, err := mfa.NewAESCipher(newKey, oldKey)
+	require.NoError(t, err)
+	plaintext, err := rotated.Decrypt(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	newOnly, err := mfa.NewAESCipher(newKey)
+	require.NoError(t, err)
+	_, err = newOnly.Decrypt(ciphertext)
+	assert.ErrorIs(t, err, mfa.ErrDecrypt)
+
+	_, err = mfa.NewAESCipher([]byte("too short"))
+	assert.Error(t, err)
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := mfa.GenerateRecoveryCodes()
+	require.NoError(t, err)
+
+	assert.Len(t, codes, mfa.RecoveryCodeCount)
+	for _, code := range codes {
+		assert.Regexp(t, `^[a-z2-9]{5}-[a-z2-9]{5}$`, code)
+		assert.False(t, mfa.IsCode(code))
+	}
+	assert.Equal(t, "abcdefghjk", mfa.NormalizeRecoveryCode(" ABCDE-fghjk"))
+}
@@ -0,0 +1,51 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+const (
+	// RecoveryCodeCount is how many recovery codes are issued on enrollment.
+	RecoveryCodeCount = 10
+	// recoveryCodeLength is the number of characters of a recovery code,
+	// shown in two groups.
+	recoveryCodeLength = 10
+	// recoveryCodeAlphabet leaves out characters that are easily confused.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// GenerateRecoveryCodes returns RecoveryCodeCount random recovery codes, such
+// as "k3h7q-9wd2m". Each of them can replace a TOTP code once.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	for len(codes) < RecoveryCodeCount {
+		var b strings.Builder
+		for i := 0; i < recoveryCodeLength; i++ {
+			if i == recoveryCodeLength/2 {
+				b.WriteByte('-')
+			}
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+		codes = append(codes, b.String())
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode returns the form of a recovery code that is hashed, so
+// that codes match regardless of case, spaces and dashes.
+func NormalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
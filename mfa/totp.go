@@ -0,0 +1,114 @@
+// Package mfa implements time-based one-time passwords (RFC 6238) as a second
+// authentication factor, along with recovery codes and encryption of the
+// secrets at rest.
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+)
+
+const (
+	// Digits is the length of TOTP codes.
+	Digits = 6
+	// Period is how long each TOTP code is valid.
+	Period = 30 * time.Second
+	// Skew is how many periods a code may be off, to allow for clock drift
+	// and for users typing a code as it changes.
+	Skew = 1
+	// secretSize is the length of secrets in bytes, as recommended by RFC 4226.
+	secretSize = 20
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random TOTP secret.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret returns the base32 form of secret that users can type into
+// authenticator apps which cannot scan a key URI.
+func EncodeSecret(secret []byte) string {
+	return secretEncoding.EncodeToString(secret)
+}
+
+// KeyURI returns the otpauth URI that authenticator apps read, usually from a
+// QR code, to set up codes for account at issuer.
+func KeyURI(issuer, account string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// Step returns the time step, the counter TOTP codes are derived from, at time t.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the TOTP code of secret for the given time step.
+func Code(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%uint32(math.Pow10(Digits)))
+}
+
+// Validate checks code against the codes of secret within Skew steps of time
+// now, and returns the step it matched. Callers must reject steps at or before
+// the last one used, so that a code cannot be replayed.
+func Validate(secret []byte, code string, now time.Time) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(now)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(Code(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// IsCode reports whether s has the form of a TOTP code rather than of a recovery code.
+func IsCode(s string) bool {
+	if len(s) != Digits {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
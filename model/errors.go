@@ -0,0 +1,51 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidArgument matches every ValidationError with errors.Is.
+var ErrInvalidArgument = errors.New("invalid argument")
+
+// FieldViolation describes why a single field was rejected.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// ValidationError reports every field that failed validation.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+// NewValidationError returns a ValidationError for a single field.
+func NewValidationError(field, description string) *ValidationError {
+	return &ValidationError{Violations: []FieldViolation{{Field: field, Description: description}}}
+}
+
+// Add records another violation.
+func (e *ValidationError) Add(field, description string) {
+	e.Violations = append(e.Violations, FieldViolation{Field: field, Description: description})
+}
+
+// ErrOrNil returns the ValidationError if it holds any violation, and nil otherwise.
+func (e *ValidationError) ErrOrNil() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Field+": "+v.Description)
+	}
+	return "invalid argument: " + strings.Join(messages, "; ")
+}
+
+// Is makes errors.Is(err, ErrInvalidArgument) hold for validation errors.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventType identifies what happened to a user.
+type EventType string
+
+const (
+	EventUserCreated            EventType = "user.created"
+	EventUserUpdated            EventType = "user.updated"
+	EventUserEmailChanged       EventType = "user.email_changed"
+	EventUserPasswordChanged    EventType = "user.password_changed"
+	EventUserDeleted            EventType = "user.deleted"
+	EventUserRestored           EventType = "user.restored"
+	EventUserPurged             EventType = "user.purged"
+	EventUserStatusChanged      EventType = "user.status_changed"
+	EventUserEmailVerified      EventType = "user.email_verified"
+	EventUserMFAEnabled         EventType = "user.mfa_enabled"
+	EventUserMFADisabled        EventType = "user.mfa_disabled"
+	EventUserRoleAssigned       EventType = "user.role_assigned"
+	EventUserRoleRevoked        EventType = "user.role_revoked"
+	EventUserJoinedOrganization EventType = "user.organization_joined"
+	EventUserLeftOrganization   EventType = "user.organization_left"
+)
+
+// Event is a change to a user, published to other services. Events are
+// delivered at least once, so consumers should deduplicate them by ID.
+type Event struct {
+	ID         string        `json:"id"`
+	Type       EventType     `json:"type"`
+	UserID     string        `json:"user_id"`
+	OccurredAt time.Time     `json:"occurred_at"`
+	User       *UserSnapshot `json:"user,omitempty"`
+
+	// PreviousEmail is set on EventUserEmailChanged.
+	PreviousEmail string `json:"previous_email,omitempty"`
+	// Reason and Actor are set on EventUserStatusChanged. Actor is also set
+	// on role events.
+	Reason string `json:"reason,omitempty"`
+	Actor  string `json:"actor,omitempty"`
+	// Role and Scope are set on EventUserRoleAssigned and EventUserRoleRevoked.
+	Role  string `json:"role,omitempty"`
+	Scope string `json:"scope,omitempty"`
+	// OrganizationID is set on EventUserJoinedOrganization and EventUserLeftOrganization.
+	OrganizationID string `json:"organization_id,omitempty"`
+
+	// Attempts counts failed deliveries. It is not part of the published event.
+	Attempts int `json:"-"`
+}
+
+// UserSnapshot is the public state of a user right after an event. Like the
+// public User proto, it never carries credential material.
+type UserSnapshot struct {
+	Username      string     `json:"username" bson:"username"`
+	Email         string     `json:"email" bson:"email"`
+	Status        UserStatus `json:"status" bson:"status"`
+	Version       int64      `json:"version" bson:"version"`
+	EmailVerified bool       `json:"email_verified" bson:"email_verified"`
+}
+
+// EventDB is the database form of an Event in the outbox, along with its delivery state.
+type EventDB struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	Type           EventType          `bson:"type"`
+	UserID         string             `bson:"user_id"`
+	OccurredAt     time.Time          `bson:"occurred_at"`
+	User           *UserSnapshot      `bson:"user,omitempty"`
+	PreviousEmail  string             `bson:"previous_email,omitempty"`
+	Reason         string             `bson:"reason,omitempty"`
+	Actor          string             `bson:"actor,omitempty"`
+	Role           string             `bson:"role,omitempty"`
+	Scope          string             `bson:"scope,omitempty"`
+	OrganizationID string             `bson:"organization_id,omitempty"`
+	Attempts       int                `bson:"attempts"`
+	NextAttemptAt  time.Time          `bson:"next_attempt_at"`
+	LastError      string             `bson:"last_error,omitempty"`
+	PublishedAt    *time.Time         `bson:"published_at"`
+}
+
+// NewEvent returns an event of the given type about user, with a snapshot of its current state.
+func NewEvent(eventType EventType, user *User, at time.Time) *Event {
+	return &Event{
+		ID:         primitive.NewObjectID().Hex(),
+		Type:       eventType,
+		UserID:     user.ID,
+		OccurredAt: at,
+		User: &UserSnapshot{
+			Username:      user.Username,
+			Email:         user.Email,
+			Status:        user.Status,
+			Version:       user.Version,
+			EmailVerified: user.IsEmailVerified(),
+		},
+	}
+}
+
+// NewUserIDEvent returns an event of the given type about the user with the
+// given ID, for changes after which no snapshot is available.
+func NewUserIDEvent(eventType EventType, userID string, at time.Time) *Event {
+	return &Event{
+		ID:         primitive.NewObjectID().Hex(),
+		Type:       eventType,
+		UserID:     userID,
+		OccurredAt: at,
+	}
+}
+
+// ToEventDB converts an Event to its database form, due for delivery right away.
+func (e *Event) ToEventDB() (*EventDB, error) {
+	id, err := primitive.ObjectIDFromHex(e.ID)
+	if err != nil {
+		return nil, NewValidationError("id", "must be a valid ObjectID")
+	}
+
+	return &EventDB{
+		ID:             id,
+		Type:           e.Type,
+		UserID:         e.UserID,
+		OccurredAt:     e.OccurredAt,
+		User:           e.User,
+		PreviousEmail:  e.PreviousEmail,
+		Reason:         e.Reason,
+		Actor:          e.Actor,
+		Role:           e.Role,
+		Scope:          e.Scope,
+		OrganizationID: e.OrganizationID,
+		Attempts:       e.Attempts,
+		NextAttemptAt:  e.OccurredAt,
+	}, nil
+}
+
+// ToEvent converts an EventDB to an Event.
+func (edb *EventDB) ToEvent() *Event {
+	return &Event{
+		ID:             edb.ID.Hex(),
+		Type:           edb.Type,
+		UserID:         edb.UserID,
+		OccurredAt:     edb.OccurredAt,
+		User:           edb.User,
+		PreviousEmail:  edb.PreviousEmail,
+		Reason:         edb.Reason,
+		Actor:          edb.Actor,
+		Role:           edb.Role,
+		Scope:          edb.Scope,
+		OrganizationID: edb.OrganizationID,
+		Attempts:       edb.Attempts,
+	}
+}
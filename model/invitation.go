@@ -0,0 +1,175 @@
+package model
+
+import (
+	"time"
+
+	userservice "github.com/BerryTracer/user-service/grpc/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// InvitationStatus is where an invitation is in its lifecycle.
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationRevoked  InvitationStatus = "revoked"
+	// InvitationExpired is never stored: pending invitations are expired once
+	// their expiry has passed.
+	InvitationExpired InvitationStatus = "expired"
+)
+
+// Invitation invites an email address to join an organization with a role of
+// the catalog, assigned in the scope of the organization. Only the hash of the
+// token is kept; the token itself is only ever sent to the invited address.
+type Invitation struct {
+	ID             string
+	OrganizationID string
+	Email          string
+	EmailCanonical string
+	Role           string
+	TokenHash      string
+	Status         InvitationStatus
+	InvitedBy      string
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	AcceptedAt     time.Time
+	AcceptedBy     string
+	RevokedAt      time.Time
+	RevokedBy      string
+}
+
+// InvitationDB is the database form of an Invitation.
+type InvitationDB struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	OrganizationID string             `bson:"organization_id"`
+	Email          string             `bson:"email"`
+	EmailCanonical string             `bson:"email_canonical"`
+	Role           string             `bson:"role"`
+	TokenHash      string             `bson:"token_hash"`
+	Status         InvitationStatus   `bson:"status"`
+	InvitedBy      string             `bson:"invited_by"`
+	CreatedAt      time.Time          `bson:"created_at"`
+	ExpiresAt      time.Time          `bson:"expires_at"`
+	AcceptedAt     *time.Time         `bson:"accepted_at,omitempty"`
+	AcceptedBy     string             `bson:"accepted_by,omitempty"`
+	RevokedAt      *time.Time         `bson:"revoked_at,omitempty"`
+	RevokedBy      string             `bson:"revoked_by,omitempty"`
+}
+
+// StatusAt returns the status of the invitation at time now, which is
+// InvitationExpired for pending invitations past their expiry.
+func (i *Invitation) StatusAt(now time.Time) InvitationStatus {
+	if i.Status == InvitationPending && !now.Before(i.ExpiresAt) {
+		return InvitationExpired
+	}
+	return i.Status
+}
+
+// ToInvitationDB converts an Invitation to its database form.
+func (i *Invitation) ToInvitationDB() (*InvitationDB, error) {
+	id, err := primitive.ObjectIDFromHex(i.ID)
+	if err != nil {
+		return nil, NewValidationError("id", "must be a valid ObjectID")
+	}
+
+	return &InvitationDB{
+		ID:             id,
+		OrganizationID: i.OrganizationID,
+		Email:          i.Email,
+		EmailCanonical: i.EmailCanonical,
+		Role:           i.Role,
+		TokenHash:      i.TokenHash,
+		Status:         i.Status,
+		InvitedBy:      i.InvitedBy,
+		CreatedAt:      i.CreatedAt,
+		ExpiresAt:      i.ExpiresAt,
+		AcceptedAt:     timePtr(i.AcceptedAt),
+		AcceptedBy:     i.AcceptedBy,
+		RevokedAt:      timePtr(i.RevokedAt),
+		RevokedBy:      i.RevokedBy,
+	}, nil
+}
+
+// ToInvitation converts an InvitationDB to an Invitation.
+func (idb *InvitationDB) ToInvitation() *Invitation {
+	invitation := &Invitation{
+		ID:             idb.ID.Hex(),
+		OrganizationID: idb.OrganizationID,
+		Email:          idb.Email,
+		EmailCanonical: idb.EmailCanonical,
+		Role:           idb.Role,
+		TokenHash:      idb.TokenHash,
+		Status:         idb.Status,
+		InvitedBy:      idb.InvitedBy,
+		CreatedAt:      idb.CreatedAt,
+		ExpiresAt:      idb.ExpiresAt,
+		AcceptedBy:     idb.AcceptedBy,
+		RevokedBy:      idb.RevokedBy,
+	}
+	if idb.AcceptedAt != nil {
+		invitation.AcceptedAt = *idb.AcceptedAt
+	}
+	if idb.RevokedAt != nil {
+		invitation.RevokedAt = *idb.RevokedAt
+	}
+	return invitation
+}
+
+// ConvertToProto converts an Invitation to its proto form, with its status at
+// time now. The token hash is left out.
+func (i *Invitation) ConvertToProto(now time.Time) *userservice.Invitation {
+	invitation := &userservice.Invitation{
+		Id:             i.ID,
+		OrganizationId: i.OrganizationID,
+		Email:          i.Email,
+		Role:           i.Role,
+		Status:         i.StatusAt(now).ConvertToProto(),
+		InvitedBy:      i.InvitedBy,
+		CreatedAt:      timestamppb.New(i.CreatedAt),
+		ExpiresAt:      timestamppb.New(i.ExpiresAt),
+		AcceptedBy:     i.AcceptedBy,
+		RevokedBy:      i.RevokedBy,
+	}
+	if !i.AcceptedAt.IsZero() {
+		invitation.AcceptedAt = timestamppb.New(i.AcceptedAt)
+	}
+	if !i.RevokedAt.IsZero() {
+		invitation.RevokedAt = timestamppb.New(i.RevokedAt)
+	}
+	return invitation
+}
+
+// ConvertToProto converts an InvitationStatus to its proto enum.
+func (s InvitationStatus) ConvertToProto() userservice.InvitationStatus {
+	switch s {
+	case InvitationPending:
+		return userservice.InvitationStatus_INVITATION_STATUS_PENDING
+	case InvitationAccepted:
+		return userservice.InvitationStatus_INVITATION_STATUS_ACCEPTED
+	case InvitationRevoked:
+		return userservice.InvitationStatus_INVITATION_STATUS_REVOKED
+	case InvitationExpired:
+		return userservice.InvitationStatus_INVITATION_STATUS_EXPIRED
+	default:
+		return userservice.InvitationStatus_INVITATION_STATUS_UNSPECIFIED
+	}
+}
+
+// InvitationStatusFromProto converts a proto InvitationStatus, returning an
+// empty status for INVITATION_STATUS_UNSPECIFIED.
+func InvitationStatusFromProto(s userservice.InvitationStatus) InvitationStatus {
+	switch s {
+	case userservice.InvitationStatus_INVITATION_STATUS_PENDING:
+		return InvitationPending
+	case userservice.InvitationStatus_INVITATION_STATUS_ACCEPTED:
+		return InvitationAccepted
+	case userservice.InvitationStatus_INVITATION_STATUS_REVOKED:
+		return InvitationRevoked
+	case userservice.InvitationStatus_INVITATION_STATUS_EXPIRED:
+		return InvitationExpired
+	default:
+		return ""
+	}
+}
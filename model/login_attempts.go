@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// LoginAttempts counts the failed sign-in attempts recorded under a key, such
+// as a user or the IP address of a client.
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	// BlockedUntil is when attempts under the key are accepted again.
+	BlockedUntil time.Time
+	// ExpiresAt is when the failures are forgotten, unless another one happens before.
+	ExpiresAt time.Time
+}
+
+// LoginAttemptsDB is the database form of LoginAttempts.
+type LoginAttemptsDB struct {
+	Key           string     `bson:"_id"`
+	Failures      int        `bson:"failures"`
+	LastFailureAt time.Time  `bson:"last_failure_at"`
+	BlockedUntil  *time.Time `bson:"blocked_until"`
+	ExpiresAt     time.Time  `bson:"expires_at"`
+}
+
+// IsBlocked reports whether attempts under the key are refused at time now.
+func (a *LoginAttempts) IsBlocked(now time.Time) bool {
+	return now.Before(a.BlockedUntil)
+}
+
+// ToLoginAttempts converts a LoginAttemptsDB to LoginAttempts.
+func (adb *LoginAttemptsDB) ToLoginAttempts() *LoginAttempts {
+	attempts := &LoginAttempts{
+		Key:           adb.Key,
+		Failures:      adb.Failures,
+		LastFailureAt: adb.LastFailureAt,
+		ExpiresAt:     adb.ExpiresAt,
+	}
+	if adb.BlockedUntil != nil {
+		attempts.BlockedUntil = *adb.BlockedUntil
+	}
+	return attempts
+}
@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// MFA is the second authentication factor of a user: a TOTP authenticator and
+// the recovery codes that can stand in for it.
+type MFA struct {
+	// EncryptedSecret is the TOTP secret, encrypted with the service's key.
+	EncryptedSecret []byte
+	// EnabledAt is zero while enrollment waits for the user to confirm a
+	// first code; the secret is not checked on sign-in until then.
+	EnabledAt time.Time
+	// RecoveryCodeHashes are hashes of the unused recovery codes.
+	RecoveryCodeHashes []string
+	// LastUsedStep is the time step of the last TOTP code accepted, so that no
+	// code is accepted twice.
+	LastUsedStep int64
+}
+
+// MFADB is the database form of MFA.
+type MFADB struct {
+	EncryptedSecret    []byte     `bson:"encrypted_secret"`
+	EnabledAt          *time.Time `bson:"enabled_at"`
+	RecoveryCodeHashes []string   `bson:"recovery_code_hashes,omitempty"`
+	LastUsedStep       int64      `bson:"last_used_step"`
+}
+
+// IsEnabled reports whether the user confirmed enrollment.
+func (m *MFA) IsEnabled() bool {
+	return m != nil && !m.EnabledAt.IsZero()
+}
+
+// ToMFADB converts MFA to its database form.
+func (m *MFA) ToMFADB() *MFADB {
+	return &MFADB{
+		EncryptedSecret:    m.EncryptedSecret,
+		EnabledAt:          timePtr(m.EnabledAt),
+		RecoveryCodeHashes: m.RecoveryCodeHashes,
+		LastUsedStep:       m.LastUsedStep,
+	}
+}
+
+// ToMFA converts an MFADB to MFA.
+func (mdb *MFADB) ToMFA() *MFA {
+	m := &MFA{
+		EncryptedSecret:    mdb.EncryptedSecret,
+		RecoveryCodeHashes: mdb.RecoveryCodeHashes,
+		LastUsedStep:       mdb.LastUsedStep,
+	}
+	if mdb.EnabledAt != nil {
+		m.EnabledAt = *mdb.EnabledAt
+	}
+	return m
+}
+
+// HasMFA reports whether the user must give a second factor to sign in.
+func (u *User) HasMFA() bool {
+	return u.MFA.IsEnabled()
+}
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer computes the canonical forms of usernames and emails. Uniqueness
+// and lookups use canonical forms, while users keep seeing what they typed.
+type Normalizer struct {
+	// FoldEmailLocalPart lowercases the part of an email before the @. Strictly
+	// the local part is case-sensitive, but virtually no mail provider treats it so.
+	FoldEmailLocalPart bool
+}
+
+// DefaultNormalizer returns a Normalizer that folds the email local part.
+func DefaultNormalizer() Normalizer {
+	return Normalizer{FoldEmailLocalPart: true}
+}
+
+// Normalize sets the canonical username and email of the user.
+func (n Normalizer) Normalize(u *User) error {
+	email, err := n.Email(u.Email)
+	if err != nil {
+		return err
+	}
+
+	u.UsernameCanonical = n.Username(u.Username)
+	u.EmailCanonical = email
+	return nil
+}
+
+// Username returns the canonical form of a username: NFKC-normalized, case-folded,
+// and with characters that are commonly confused with Latin letters replaced by them.
+func (n Normalizer) Username(username string) string {
+	folded := norm.NFKC.String(cases.Fold().String(norm.NFKC.String(strings.TrimSpace(username))))
+	return strings.Map(func(r rune) rune {
+		if latin, ok := confusables[r]; ok {
+			return latin
+		}
+		return r
+	}, folded)
+}
+
+// Email returns the canonical form of an email: the domain is lowercased and
+// converted to IDNA punycode, and the local part is NFC-normalized and, if
+// configured, lowercased.
+func (n Normalizer) Email(email string) (string, error) {
+	local, domain, ok := splitEmail(strings.TrimSpace(email))
+	if !ok {
+		return "", NewValidationError("email", "invalid email format")
+	}
+
+	asciiDomain, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", NewValidationError("email", "invalid email domain")
+	}
+
+	local = norm.NFC.String(local)
+	if n.FoldEmailLocalPart {
+		local = strings.ToLower(local)
+	}
+
+	return local + "@" + strings.ToLower(asciiDomain), nil
+}
+
+// UsernamePrefix returns the canonical form of a username prefix, for prefix searches.
+func (n Normalizer) UsernamePrefix(prefix string) string {
+	return n.Username(prefix)
+}
+
+// EmailPrefix returns the canonical form of an email prefix, for prefix searches.
+// Only case is folded, as a partial domain cannot be converted to punycode.
+func (n Normalizer) EmailPrefix(prefix string) string {
+	if at := strings.LastIndex(prefix, "@"); at >= 0 {
+		return n.emailLocalPart(prefix[:at]) + strings.ToLower(prefix[at:])
+	}
+	return n.emailLocalPart(prefix)
+}
+
+func (n Normalizer) emailLocalPart(local string) string {
+	local = norm.NFC.String(local)
+	if n.FoldEmailLocalPart {
+		local = strings.ToLower(local)
+	}
+	return local
+}
+
+// splitEmail splits an email at its last @, checking the local part for
+// characters that are never valid in an address.
+func splitEmail(email string) (local, domain string, ok bool) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", "", false
+	}
+
+	local, domain = email[:at], email[at+1:]
+	if len(local) > 64 || strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") || strings.Contains(local, "..") {
+		return "", "", false
+	}
+	for _, r := range local {
+		if r == '@' || r == utf8.RuneError || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return "", "", false
+		}
+	}
+
+	return local, domain, true
+}
+
+// isValidDomain reports whether a punycode domain has at least two labels and
+// ends in an alphabetic or internationalized top-level domain.
+func isValidDomain(domain string) bool {
+	if len(domain) > 253 {
+		return false
+	}
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	tld := labels[len(labels)-1]
+	if strings.HasPrefix(tld, "xn--") {
+		return true
+	}
+	if len(tld) < 2 {
+		return false
+	}
+	for _, r := range tld {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// mixesScripts reports whether s contains letters from more than one of the
+// Latin, Cyrillic and Greek scripts, whose letters are easily confused.
+func mixesScripts(s string) bool {
+	var latin, cyrillic, greek bool
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin = true
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic = true
+		case unicode.Is(unicode.Greek, r):
+			greek = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{latin, cyrillic, greek} {
+		if present {
+			count++
+		}
+	}
+	return count > 1
+}
+
+// confusables maps case-folded Cyrillic and Greek letters to the Latin letters
+// they are visually indistinguishable from.
+var confusables = map[rune]rune{
+	'а': 'a', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'ӏ': 'l',
+	'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'ԝ': 'w', 'х': 'x', 'у': 'y',
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u', 'χ': 'x',
+}
@@ -0,0 +1,79 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizer_Email(t *testing.T) {
+	tests := []struct {
+		email     string
+		canonical string
+	}{
+		{"Alice@Example.COM", "alice@example.com"},
+		{"  bob@example.com ", "bob@example.com"},
+		{"carol@Bücher.example", "carol@xn--bcher-kva.example"},
+		{"dave@museum.technology", "dave@museum.technology"},
+	}
+
+	for _, tt := range tests {
+		canonical, err := model.DefaultNormalizer().Email(tt.email)
+		assert.NoError(t, err, tt.email)
+		assert.Equal(t, tt.canonical, canonical, tt.email)
+	}
+}
+
+func TestNormalizer_Email_KeepsLocalPartCase(t *testing.T) {
+	canonical, err := model.Normalizer{FoldEmailLocalPart: false}.Email("Alice@Example.COM")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice@example.com", canonical)
+}
+
+func TestNormalizer_Email_Invalid(t *testing.T) {
+	for _, email := range []string{"", "alice", "@example.com", "alice@", "al ice@example.com", "alice..smith@example.com"} {
+		_, err := model.DefaultNormalizer().Email(email)
+		assert.ErrorIs(t, err, model.ErrInvalidArgument, email)
+	}
+}
+
+func TestNormalizer_Username(t *testing.T) {
+	n := model.DefaultNormalizer()
+
+	assert.Equal(t, "alice", n.Username("Alice"))
+	// Fullwidth forms are folded by NFKC
+	assert.Equal(t, "alice", n.Username("Ａｌｉｃｅ"))
+	// Case folding handles more than ASCII
+	assert.Equal(t, "strasse", n.Username("STRAßE"))
+	// A Cyrillic "а" collides with the Latin "a"
+	assert.Equal(t, n.Username("admin"), n.Username("аdmin"))
+}
+
+func TestUser_Validate_Email(t *testing.T) {
+	valid := []string{"Alice@Example.COM", "bob@museum.technology", "carol@bücher.example", "dave+tag@example.co.uk"}
+	invalid := []string{"invalidemail", "eve@localhost", "eve@example.c0m", "eve@example.c"}
+
+	for _, email := range valid {
+		user := model.NewUser("testuser", email, "hashedPassword")
+		assert.NoError(t, user.Validate(), email)
+	}
+	for _, email := range invalid {
+		user := model.NewUser("testuser", email, "hashedPassword")
+		assert.ErrorIs(t, user.Validate(), model.ErrInvalidArgument, email)
+	}
+}
+
+func TestUser_Validate_MixedScripts(t *testing.T) {
+	// The first letter is a Cyrillic "а"
+	user := model.NewUser("аdmin", "admin@example.com", "hashedPassword")
+
+	var validationErr *model.ValidationError
+	if assert.ErrorAs(t, user.Validate(), &validationErr) {
+		assert.Equal(t, "username", validationErr.Violations[0].Field)
+	}
+
+	// Single-script non-Latin usernames are fine
+	assert.NoError(t, model.NewUser("иван", "ivan@example.com", "hashedPassword").Validate())
+}
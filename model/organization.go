@@ -0,0 +1,84 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	userservice "github.com/BerryTracer/user-service/grpc/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MaxOrganizationNameLength caps the name of an organization.
+const MaxOrganizationNameLength = 100
+
+// Organization is a customer, or tenant, whose users are kept apart from those
+// of other organizations. Users can be members of several organizations.
+type Organization struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// OrganizationDB is the database form of an Organization.
+type OrganizationDB struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Name      string             `bson:"name"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// NewOrganization returns a new organization with the given name, trimmed.
+func NewOrganization(name string, createdAt time.Time) *Organization {
+	return &Organization{
+		ID:        primitive.NewObjectID().Hex(),
+		Name:      strings.TrimSpace(name),
+		CreatedAt: createdAt,
+	}
+}
+
+// Validate checks that the organization has a name of reasonable length.
+func (o *Organization) Validate() error {
+	switch {
+	case o.Name == "":
+		return NewValidationError("name", "name is required")
+	case utf8.RuneCountInString(o.Name) > MaxOrganizationNameLength:
+		return NewValidationError("name", fmt.Sprintf("must be at most %d characters", MaxOrganizationNameLength))
+	}
+	return nil
+}
+
+// ToOrganizationDB converts an Organization to its database form.
+func (o *Organization) ToOrganizationDB() (*OrganizationDB, error) {
+	id, err := primitive.ObjectIDFromHex(o.ID)
+	if err != nil {
+		return nil, NewValidationError("id", "must be a valid ObjectID")
+	}
+
+	return &OrganizationDB{ID: id, Name: o.Name, CreatedAt: o.CreatedAt}, nil
+}
+
+// ToOrganization converts an OrganizationDB to an Organization.
+func (odb *OrganizationDB) ToOrganization() *Organization {
+	return &Organization{ID: odb.ID.Hex(), Name: odb.Name, CreatedAt: odb.CreatedAt}
+}
+
+// ConvertToProto converts an Organization to its proto form.
+func (o *Organization) ConvertToProto() *userservice.Organization {
+	return &userservice.Organization{
+		Id:        o.ID,
+		Name:      o.Name,
+		CreatedAt: timestamppb.New(o.CreatedAt),
+	}
+}
+
+// IsMember reports whether the user is a member of the organization with the given ID.
+func (u *User) IsMember(organizationID string) bool {
+	for _, id := range u.OrganizationIDs {
+		if id == organizationID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxPreviousTokenHashes is how many replaced refresh tokens of a family are
+// remembered to detect their reuse.
+const MaxPreviousTokenHashes = 20
+
+// RefreshTokenFamily is the chain of refresh tokens issued from one sign-in.
+// Every refresh replaces the current token with a new one. A replaced token
+// being presented again means it leaked, so the whole family is revoked.
+type RefreshTokenFamily struct {
+	ID                  string
+	UserID              string
+	TokenHash           string
+	PreviousTokenHashes []string
+	CreatedAt           time.Time
+	RefreshedAt         time.Time
+	ExpiresAt           time.Time
+	RevokedAt           time.Time
+}
+
+// RefreshTokenFamilyDB is the database form of a RefreshTokenFamily.
+type RefreshTokenFamilyDB struct {
+	ID                  primitive.ObjectID `bson:"_id,omitempty"`
+	UserID              string             `bson:"user_id"`
+	TokenHash           string             `bson:"token_hash"`
+	PreviousTokenHashes []string           `bson:"previous_token_hashes,omitempty"`
+	CreatedAt           time.Time          `bson:"created_at"`
+	RefreshedAt         time.Time          `bson:"refreshed_at"`
+	ExpiresAt           time.Time          `bson:"expires_at"`
+	RevokedAt           *time.Time         `bson:"revoked_at"`
+}
+
+// NewRefreshTokenFamily returns a new family for user, starting with the token
+// with the given hash.
+func NewRefreshTokenFamily(userID, tokenHash string, now time.Time, ttl time.Duration) *RefreshTokenFamily {
+	return &RefreshTokenFamily{
+		ID:          primitive.NewObjectID().Hex(),
+		UserID:      userID,
+		TokenHash:   tokenHash,
+		CreatedAt:   now,
+		RefreshedAt: now,
+		ExpiresAt:   now.Add(ttl),
+	}
+}
+
+// IsActive reports whether the current token of the family can be used at time now.
+func (f *RefreshTokenFamily) IsActive(now time.Time) bool {
+	return f.RevokedAt.IsZero() && now.Before(f.ExpiresAt)
+}
+
+// ToRefreshTokenFamilyDB converts a RefreshTokenFamily to its database form.
+func (f *RefreshTokenFamily) ToRefreshTokenFamilyDB() (*RefreshTokenFamilyDB, error) {
+	id, err := primitive.ObjectIDFromHex(f.ID)
+	if err != nil {
+		return nil, NewValidationError("id", "must be a valid ObjectID")
+	}
+
+	return &RefreshTokenFamilyDB{
+		ID:                  id,
+		UserID:              f.UserID,
+		TokenHash:           f.TokenHash,
+		PreviousTokenHashes: f.PreviousTokenHashes,
+		CreatedAt:           f.CreatedAt,
+		RefreshedAt:         f.RefreshedAt,
+		ExpiresAt:           f.ExpiresAt,
+		RevokedAt:           timePtr(f.RevokedAt),
+	}, nil
+}
+
+// ToRefreshTokenFamily converts a RefreshTokenFamilyDB to a RefreshTokenFamily.
+func (fdb *RefreshTokenFamilyDB) ToRefreshTokenFamily() *RefreshTokenFamily {
+	family := &RefreshTokenFamily{
+		ID:                  fdb.ID.Hex(),
+		UserID:              fdb.UserID,
+		TokenHash:           fdb.TokenHash,
+		PreviousTokenHashes: fdb.PreviousTokenHashes,
+		CreatedAt:           fdb.CreatedAt,
+		RefreshedAt:         fdb.RefreshedAt,
+		ExpiresAt:           fdb.ExpiresAt,
+	}
+	if fdb.RevokedAt != nil {
+		family.RevokedAt = *fdb.RevokedAt
+	}
+	return family
+}
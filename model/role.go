@@ -0,0 +1,223 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	userservice "github.com/BerryTracer/user-service/grpc/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AllPermissions grants every permission. A permission of the form
+// "resource:*" grants every action on the resource.
+const AllPermissions = "*"
+
+// ScopeType is the kind of resource a role is assigned on.
+type ScopeType string
+
+const (
+	ScopeGlobal  ScopeType = ""
+	ScopeTenant  ScopeType = "tenant"
+	ScopeProject ScopeType = "project"
+)
+
+// Scope is what a role assignment applies to. The zero Scope is global.
+type Scope struct {
+	Type ScopeType
+	ID   string
+}
+
+// IsGlobal reports whether the scope applies everywhere.
+func (s Scope) IsGlobal() bool {
+	return s.Type == ScopeGlobal
+}
+
+// Covers reports whether a role assigned on s applies in scope other. Global
+// roles apply everywhere; scoped roles only in their own scope.
+func (s Scope) Covers(other Scope) bool {
+	return s.IsGlobal() || s == other
+}
+
+// String returns the scope as "global" or "<type>:<id>".
+func (s Scope) String() string {
+	if s.IsGlobal() {
+		return "global"
+	}
+	return string(s.Type) + ":" + s.ID
+}
+
+// Validate checks that the scope names a known type, with an ID unless global.
+func (s Scope) Validate() error {
+	switch s.Type {
+	case ScopeGlobal:
+		if s.ID != "" {
+			return NewValidationError("scope.id", "must be empty for the global scope")
+		}
+	case ScopeTenant, ScopeProject:
+		if s.ID == "" {
+			return NewValidationError("scope.id", "is required")
+		}
+	default:
+		return NewValidationError("scope.type", "unknown scope type")
+	}
+	return nil
+}
+
+// ScopeFromProto converts a proto RoleScope, which may be nil for the global scope.
+func ScopeFromProto(scope *userservice.RoleScope) Scope {
+	switch scope.GetType() {
+	case userservice.RoleScopeType_ROLE_SCOPE_TYPE_TENANT:
+		return Scope{Type: ScopeTenant, ID: scope.GetId()}
+	case userservice.RoleScopeType_ROLE_SCOPE_TYPE_PROJECT:
+		return Scope{Type: ScopeProject, ID: scope.GetId()}
+	default:
+		return Scope{ID: scope.GetId()}
+	}
+}
+
+// ConvertToProto converts a Scope to its proto form.
+func (s Scope) ConvertToProto() *userservice.RoleScope {
+	scope := &userservice.RoleScope{Id: s.ID}
+	switch s.Type {
+	case ScopeTenant:
+		scope.Type = userservice.RoleScopeType_ROLE_SCOPE_TYPE_TENANT
+	case ScopeProject:
+		scope.Type = userservice.RoleScopeType_ROLE_SCOPE_TYPE_PROJECT
+	}
+	return scope
+}
+
+// RoleAssignment gives a user a role of the catalog in a scope.
+type RoleAssignment struct {
+	Role       string
+	Scope      Scope
+	AssignedAt time.Time
+	AssignedBy string
+}
+
+// RoleAssignmentDB is the database form of a RoleAssignment. The scope is
+// stored even when global, so that assignments can be matched field by field.
+type RoleAssignmentDB struct {
+	Role       string    `bson:"role" json:"role"`
+	ScopeType  ScopeType `bson:"scope_type" json:"scope_type"`
+	ScopeID    string    `bson:"scope_id" json:"scope_id"`
+	AssignedAt time.Time `bson:"assigned_at" json:"assigned_at"`
+	AssignedBy string    `bson:"assigned_by,omitempty" json:"assigned_by,omitempty"`
+}
+
+// ToRoleAssignmentDB converts a RoleAssignment to its database form.
+func (a RoleAssignment) ToRoleAssignmentDB() RoleAssignmentDB {
+	return RoleAssignmentDB{
+		Role:       a.Role,
+		ScopeType:  a.Scope.Type,
+		ScopeID:    a.Scope.ID,
+		AssignedAt: a.AssignedAt,
+		AssignedBy: a.AssignedBy,
+	}
+}
+
+// ToRoleAssignment converts a RoleAssignmentDB to a RoleAssignment.
+func (adb RoleAssignmentDB) ToRoleAssignment() RoleAssignment {
+	return RoleAssignment{
+		Role:       adb.Role,
+		Scope:      Scope{Type: adb.ScopeType, ID: adb.ScopeID},
+		AssignedAt: adb.AssignedAt,
+		AssignedBy: adb.AssignedBy,
+	}
+}
+
+// ConvertToProto converts a RoleAssignment to its proto form.
+func (a RoleAssignment) ConvertToProto() *userservice.RoleAssignment {
+	return &userservice.RoleAssignment{
+		Role:       a.Role,
+		Scope:      a.Scope.ConvertToProto(),
+		AssignedAt: timestamppb.New(a.AssignedAt),
+		AssignedBy: a.AssignedBy,
+	}
+}
+
+// HasRole reports whether the user has role in exactly scope.
+func (u *User) HasRole(role string, scope Scope) bool {
+	for _, assignment := range u.Roles {
+		if assignment.Role == role && assignment.Scope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleCatalog maps the roles users can be assigned to the permissions they
+// grant. It is safe for concurrent use and can be replaced while in use.
+type RoleCatalog struct {
+	mu    sync.RWMutex
+	roles map[string][]string
+}
+
+// NewRoleCatalog returns a catalog of the given roles and their permissions.
+func NewRoleCatalog(roles map[string][]string) *RoleCatalog {
+	c := &RoleCatalog{}
+	c.Replace(roles)
+	return c
+}
+
+// DefaultRoleCatalog returns the roles every deployment starts with.
+func DefaultRoleCatalog() *RoleCatalog {
+	return NewRoleCatalog(map[string][]string{
+		"admin":        {AllPermissions},
+		"user_manager": {"users:read", "users:write", "users:suspend", "roles:read"},
+		"role_manager": {"roles:read", "roles:write"},
+		"viewer":       {"users:read"},
+	})
+}
+
+// Replace swaps the roles of the catalog.
+func (c *RoleCatalog) Replace(roles map[string][]string) {
+	copied := make(map[string][]string, len(roles))
+	for role, permissions := range roles {
+		copied[role] = append([]string(nil), permissions...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.roles = copied
+}
+
+// Has reports whether role is in the catalog.
+func (c *RoleCatalog) Has(role string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, ok := c.roles[role]
+	return ok
+}
+
+// Roles returns the names of the roles in the catalog, sorted.
+func (c *RoleCatalog) Roles() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	roles := make([]string, 0, len(c.roles))
+	for role := range c.roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Grants reports whether role grants permission. Roles removed from the
+// catalog grant nothing.
+func (c *RoleCatalog) Grants(role, permission string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	resource, _, _ := strings.Cut(permission, ":")
+	for _, granted := range c.roles[role] {
+		if granted == AllPermissions || granted == permission || granted == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCatalog_Grants(t *testing.T) {
+	catalog := model.NewRoleCatalog(map[string][]string{
+		"admin":   {model.AllPermissions},
+		"manager": {"users:*"},
+		"viewer":  {"users:read"},
+	})
+
+	assert.True(t, catalog.Grants("admin", "roles:write"))
+	assert.True(t, catalog.Grants("manager", "users:suspend"))
+	assert.False(t, catalog.Grants("manager", "roles:read"))
+	assert.True(t, catalog.Grants("viewer", "users:read"))
+	assert.False(t, catalog.Grants("viewer", "users:write"))
+	assert.False(t, catalog.Grants("removed", "users:read"))
+}
+
+func TestScope_Covers(t *testing.T) {
+	global := model.Scope{}
+	tenant := model.Scope{Type: model.ScopeTenant, ID: "acme"}
+	project := model.Scope{Type: model.ScopeProject, ID: "acme"}
+
+	assert.True(t, global.Covers(tenant))
+	assert.True(t, global.Covers(global))
+	assert.True(t, tenant.Covers(tenant))
+	assert.False(t, tenant.Covers(global))
+	assert.False(t, tenant.Covers(project))
+	assert.False(t, tenant.Covers(model.Scope{Type: model.ScopeTenant, ID: "globex"}))
+}
+
+func TestScope_Validate(t *testing.T) {
+	assert.NoError(t, model.Scope{}.Validate())
+	assert.NoError(t, model.Scope{Type: model.ScopeProject, ID: "p1"}.Validate())
+	assert.ErrorIs(t, model.Scope{Type: model.ScopeTenant}.Validate(), model.ErrInvalidArgument)
+	assert.ErrorIs(t, model.Scope{ID: "acme"}.Validate(), model.ErrInvalidArgument)
+	assert.ErrorIs(t, model.Scope{Type: "team", ID: "t1"}.Validate(), model.ErrInvalidArgument)
+}
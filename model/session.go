@@ -0,0 +1,142 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	userservice "github.com/BerryTracer/user-service/grpc/proto"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// MaxDeviceNameLength caps the device name a client gives its session.
+	MaxDeviceNameLength = 100
+	// MaxUserAgentLength is how much of a user agent a session keeps.
+	MaxUserAgentLength = 512
+)
+
+// SessionDevice describes the client a session is used from.
+type SessionDevice struct {
+	// Name is chosen by the client, such as "Alice's phone".
+	Name      string
+	UserAgent string
+	IP        string
+}
+
+// Normalize trims the device name and cuts overlong user agents, which clients
+// do not choose themselves, to MaxUserAgentLength.
+func (d SessionDevice) Normalize() SessionDevice {
+	d.Name = strings.TrimSpace(d.Name)
+	if len(d.UserAgent) > MaxUserAgentLength {
+		d.UserAgent = strings.ToValidUTF8(d.UserAgent[:MaxUserAgentLength], "")
+	}
+	return d
+}
+
+// Validate checks the device name given by the client.
+func (d SessionDevice) Validate() error {
+	if utf8.RuneCountInString(d.Name) > MaxDeviceNameLength {
+		return NewValidationError("device_name", fmt.Sprintf("must be at most %d characters", MaxDeviceNameLength))
+	}
+	return nil
+}
+
+// Session is a sign-in of a user on a device, as shown to the user. It shares
+// its ID with the refresh token family issued at sign-in, which is the
+// authority on whether the session can still be used.
+type Session struct {
+	ID         string
+	UserID     string
+	Device     SessionDevice
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  time.Time
+}
+
+// SessionDB is the database form of a Session.
+type SessionDB struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	UserID     string             `bson:"user_id"`
+	DeviceName string             `bson:"device_name,omitempty"`
+	UserAgent  string             `bson:"user_agent,omitempty"`
+	IP         string             `bson:"ip,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at"`
+	LastSeenAt time.Time          `bson:"last_seen_at"`
+	ExpiresAt  time.Time          `bson:"expires_at"`
+	RevokedAt  *time.Time         `bson:"revoked_at"`
+}
+
+// NewSession returns the session of the given refresh token family.
+func NewSession(family *RefreshTokenFamily, device SessionDevice) *Session {
+	return &Session{
+		ID:         family.ID,
+		UserID:     family.UserID,
+		Device:     device,
+		CreatedAt:  family.CreatedAt,
+		LastSeenAt: family.CreatedAt,
+		ExpiresAt:  family.ExpiresAt,
+	}
+}
+
+// IsActive reports whether the session is neither revoked nor expired at time now.
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt.IsZero() && now.Before(s.ExpiresAt)
+}
+
+// ToSessionDB converts a Session to its database form.
+func (s *Session) ToSessionDB() (*SessionDB, error) {
+	id, err := primitive.ObjectIDFromHex(s.ID)
+	if err != nil {
+		return nil, NewValidationError("id", "must be a valid ObjectID")
+	}
+
+	return &SessionDB{
+		ID:         id,
+		UserID:     s.UserID,
+		DeviceName: s.Device.Name,
+		UserAgent:  s.Device.UserAgent,
+		IP:         s.Device.IP,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		RevokedAt:  timePtr(s.RevokedAt),
+	}, nil
+}
+
+// ToSession converts a SessionDB to a Session.
+func (sdb *SessionDB) ToSession() *Session {
+	session := &Session{
+		ID:     sdb.ID.Hex(),
+		UserID: sdb.UserID,
+		Device: SessionDevice{
+			Name:      sdb.DeviceName,
+			UserAgent: sdb.UserAgent,
+			IP:        sdb.IP,
+		},
+		CreatedAt:  sdb.CreatedAt,
+		LastSeenAt: sdb.LastSeenAt,
+		ExpiresAt:  sdb.ExpiresAt,
+	}
+	if sdb.RevokedAt != nil {
+		session.RevokedAt = *sdb.RevokedAt
+	}
+	return session
+}
+
+// ConvertToProto converts a Session to its proto model.
+func (s *Session) ConvertToProto() *userservice.Session {
+	return &userservice.Session{
+		Id:         s.ID,
+		UserId:     s.UserID,
+		DeviceName: s.Device.Name,
+		UserAgent:  s.Device.UserAgent,
+		IpAddress:  s.Device.IP,
+		CreatedAt:  timestamppb.New(s.CreatedAt),
+		LastSeenAt: timestamppb.New(s.LastSeenAt),
+		ExpiresAt:  timestamppb.New(s.ExpiresAt),
+	}
+}
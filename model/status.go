@@ -0,0 +1,94 @@
+package model
+
+import (
+	"time"
+
+	userservice "github.com/BerryTracer/user-service/grpc/proto"
+)
+
+// UserStatus is the lifecycle state of a user account.
+type UserStatus string
+
+const (
+	UserStatusPending   UserStatus = "pending"
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+	UserStatusLocked    UserStatus = "locked"
+	UserStatusDeleted   UserStatus = "deleted"
+)
+
+// statusTransitions lists, for every status, the statuses a user may move to.
+var statusTransitions = map[UserStatus][]UserStatus{
+	UserStatusPending:   {UserStatusActive, UserStatusSuspended, UserStatusDeleted},
+	UserStatusActive:    {UserStatusSuspended, UserStatusLocked, UserStatusDeleted},
+	UserStatusSuspended: {UserStatusActive, UserStatusDeleted},
+	UserStatusLocked:    {UserStatusActive, UserStatusDeleted},
+	UserStatusDeleted:   {UserStatusPending, UserStatusActive, UserStatusSuspended},
+}
+
+// CanTransitionTo reports whether a user in status s may move to status next.
+func (s UserStatus) CanTransitionTo(next UserStatus) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAuthenticate reports whether users in this status may sign in.
+func (s UserStatus) CanAuthenticate() bool {
+	return s == UserStatusPending || s == UserStatusActive
+}
+
+// StatusChange records who moved a user to a new status, when, and why.
+type StatusChange struct {
+	Status UserStatus
+	Reason string
+	Actor  string
+	At     time.Time
+}
+
+// StatusChangeDB is the database form of a StatusChange.
+type StatusChangeDB struct {
+	Reason string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	Actor  string    `bson:"actor,omitempty" json:"actor,omitempty"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// ConvertToProto converts a UserStatus to its proto enum value.
+func (s UserStatus) ConvertToProto() userservice.UserStatus {
+	switch s {
+	case UserStatusPending:
+		return userservice.UserStatus_USER_STATUS_PENDING
+	case UserStatusActive:
+		return userservice.UserStatus_USER_STATUS_ACTIVE
+	case UserStatusSuspended:
+		return userservice.UserStatus_USER_STATUS_SUSPENDED
+	case UserStatusLocked:
+		return userservice.UserStatus_USER_STATUS_LOCKED
+	case UserStatusDeleted:
+		return userservice.UserStatus_USER_STATUS_DELETED
+	default:
+		return userservice.UserStatus_USER_STATUS_UNSPECIFIED
+	}
+}
+
+// UserStatusFromProto converts a proto enum value to a UserStatus. The
+// unspecified value maps to the empty status.
+func UserStatusFromProto(s userservice.UserStatus) UserStatus {
+	switch s {
+	case userservice.UserStatus_USER_STATUS_PENDING:
+		return UserStatusPending
+	case userservice.UserStatus_USER_STATUS_ACTIVE:
+		return UserStatusActive
+	case userservice.UserStatus_USER_STATUS_SUSPENDED:
+		return UserStatusSuspended
+	case userservice.UserStatus_USER_STATUS_LOCKED:
+		return UserStatusLocked
+	case userservice.UserStatus_USER_STATUS_DELETED:
+		return UserStatusDeleted
+	default:
+		return ""
+	}
+}
@@ -1,25 +1,59 @@
 package model
 
 import (
-	"errors"
-	"regexp"
+	"strings"
+	"time"
 
 	userservice "github.com/BerryTracer/user-service/grpc/proto"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type User struct {
-	ID             string
-	Username       string
-	Email          string
-	HashedPassword string
+	ID                string
+	Username          string
+	Email             string
+	UsernameCanonical string
+	EmailCanonical    string
+	HashedPassword    string
+	Version           int64
+	PasswordChangedAt time.Time
+	DeletedAt         time.Time
+	Status            UserStatus
+	LastStatusChange  *StatusChange
+	// StatusBeforeDeletion is the status a soft-deleted user held when deleted.
+	StatusBeforeDeletion UserStatus
+	EmailVerifiedAt      time.Time
+	EmailVerification    *EmailVerification
+	MFA                  *MFA
+	Roles                []RoleAssignment
+	OrganizationIDs      []string
 }
 
 type UserDB struct {
-	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Username       string             `bson:"username" json:"username"`
-	Email          string             `bson:"email" json:"email"`
-	HashedPassword string             `bson:"hashed_password" json:"hashed_password"`
+	ID                   primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Username             string               `bson:"username" json:"username"`
+	Email                string               `bson:"email" json:"email"`
+	UsernameCanonical    string               `bson:"username_canonical,omitempty" json:"username_canonical,omitempty"`
+	EmailCanonical       string               `bson:"email_canonical,omitempty" json:"email_canonical,omitempty"`
+	HashedPassword       string               `bson:"hashed_password" json:"hashed_password"`
+	Version              int64                `bson:"version" json:"version"`
+	PasswordChangedAt    *time.Time           `bson:"password_changed_at,omitempty" json:"password_changed_at,omitempty"`
+	DeletedAt            *time.Time           `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	Status               UserStatus           `bson:"status,omitempty" json:"status,omitempty"`
+	LastStatusChange     *StatusChangeDB      `bson:"last_status_change,omitempty" json:"last_status_change,omitempty"`
+	StatusBeforeDeletion UserStatus           `bson:"status_before_deletion,omitempty" json:"status_before_deletion,omitempty"`
+	EmailVerifiedAt      *time.Time           `bson:"email_verified_at,omitempty" json:"email_verified_at,omitempty"`
+	EmailVerification    *EmailVerificationDB `bson:"email_verification,omitempty" json:"-"`
+	MFA                  *MFADB               `bson:"mfa,omitempty" json:"-"`
+	Roles                []RoleAssignmentDB   `bson:"roles,omitempty" json:"roles,omitempty"`
+	OrganizationIDs      []string             `bson:"org_ids,omitempty" json:"org_ids,omitempty"`
+}
+
+// UserUpdate describes a partial update of a user. Nil fields are left unchanged.
+type UserUpdate struct {
+	Username *string
+	Email    *string
 }
 
 // NewUser creates a new User instance.
@@ -29,6 +63,8 @@ func NewUser(username, email, hashedPassword string) *User {
 		Username:       username,
 		Email:          email,
 		HashedPassword: hashedPassword,
+		Version:        1,
+		Status:         UserStatusPending,
 	}
 }
 
@@ -40,31 +76,157 @@ func (u *User) ToUserDB() (*UserDB, error) {
 	if u.ID != "" {
 		id, err = primitive.ObjectIDFromHex(u.ID)
 		if err != nil {
-			return nil, err
+			return nil, NewValidationError("id", "must be a valid ObjectID")
 		}
 	}
 
-	return &UserDB{
-		ID:             id,
-		Username:       u.Username,
-		Email:          u.Email,
-		HashedPassword: u.HashedPassword,
-	}, nil
+	userDB := &UserDB{
+		ID:                   id,
+		Username:             u.Username,
+		Email:                u.Email,
+		UsernameCanonical:    u.UsernameCanonical,
+		EmailCanonical:       u.EmailCanonical,
+		HashedPassword:       u.HashedPassword,
+		Version:              u.Version,
+		PasswordChangedAt:    timePtr(u.PasswordChangedAt),
+		DeletedAt:            timePtr(u.DeletedAt),
+		Status:               u.Status,
+		StatusBeforeDeletion: u.StatusBeforeDeletion,
+		EmailVerifiedAt:      timePtr(u.EmailVerifiedAt),
+		OrganizationIDs:      u.OrganizationIDs,
+	}
+
+	if c := u.LastStatusChange; c != nil {
+		userDB.LastStatusChange = &StatusChangeDB{Reason: c.Reason, Actor: c.Actor, At: c.At}
+	}
+	if v := u.EmailVerification; v != nil {
+		userDB.EmailVerification = &EmailVerificationDB{TokenHash: v.TokenHash, ExpiresAt: v.ExpiresAt}
+	}
+	if u.MFA != nil {
+		userDB.MFA = u.MFA.ToMFADB()
+	}
+	for _, assignment := range u.Roles {
+		userDB.Roles = append(userDB.Roles, assignment.ToRoleAssignmentDB())
+	}
+
+	return userDB, nil
 }
 
 // ToUser converts a UserDB database model to a User domain model.
 func (udb *UserDB) ToUser() *User {
-	return &User{
-		ID:             udb.ID.Hex(),
-		Username:       udb.Username,
-		Email:          udb.Email,
-		HashedPassword: udb.HashedPassword,
+	user := &User{
+		ID:                   udb.ID.Hex(),
+		Username:             udb.Username,
+		Email:                udb.Email,
+		UsernameCanonical:    udb.UsernameCanonical,
+		EmailCanonical:       udb.EmailCanonical,
+		HashedPassword:       udb.HashedPassword,
+		Version:              udb.Version,
+		StatusBeforeDeletion: udb.StatusBeforeDeletion,
+		OrganizationIDs:      udb.OrganizationIDs,
+	}
+
+	if udb.PasswordChangedAt != nil {
+		user.PasswordChangedAt = *udb.PasswordChangedAt
+	}
+	if udb.DeletedAt != nil {
+		user.DeletedAt = *udb.DeletedAt
 	}
+	if udb.EmailVerifiedAt != nil {
+		user.EmailVerifiedAt = *udb.EmailVerifiedAt
+	}
+	if v := udb.EmailVerification; v != nil {
+		user.EmailVerification = &EmailVerification{TokenHash: v.TokenHash, ExpiresAt: v.ExpiresAt}
+	}
+	if udb.MFA != nil {
+		user.MFA = udb.MFA.ToMFA()
+	}
+	for _, assignment := range udb.Roles {
+		user.Roles = append(user.Roles, assignment.ToRoleAssignment())
+	}
+
+	// Documents written before statuses existed have none and were active.
+	user.Status = udb.Status
+	if user.Status == "" {
+		user.Status = UserStatusActive
+		if user.IsDeleted() {
+			user.Status = UserStatusDeleted
+		}
+	}
+
+	if c := udb.LastStatusChange; c != nil {
+		user.LastStatusChange = &StatusChange{Status: user.Status, Reason: c.Reason, Actor: c.Actor, At: c.At}
+	}
+
+	return user
+}
+
+// timePtr returns nil for the zero time so optional timestamps are omitted from documents.
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// IsDeleted reports whether the user has been soft-deleted.
+func (u *User) IsDeleted() bool {
+	return !u.DeletedAt.IsZero()
 }
 
-// ConvertToProto converts a User domain model to a User proto model.
+// RestoredStatus returns the status a soft-deleted user goes back to when
+// restored, which is the one held before deletion. Locks are temporary, so
+// users deleted while locked come back active, as do users deleted before
+// the status held was recorded.
+func (u *User) RestoredStatus() UserStatus {
+	switch u.StatusBeforeDeletion {
+	case "", UserStatusLocked:
+		return UserStatusActive
+	default:
+		return u.StatusBeforeDeletion
+	}
+}
+
+// IsEmailVerified reports whether the user has verified their current email address.
+func (u *User) IsEmailVerified() bool {
+	return !u.EmailVerifiedAt.IsZero()
+}
+
+// CreatedAt returns the creation time embedded in the user's ObjectID.
+func (u *User) CreatedAt() time.Time {
+	id, err := primitive.ObjectIDFromHex(u.ID)
+	if err != nil {
+		return time.Time{}
+	}
+	return id.Timestamp()
+}
+
+// ConvertToProto converts a User domain model to the public User proto model.
+// Credential material is deliberately left out.
 func (u *User) ConvertToProto() *userservice.User {
-	return &userservice.User{
+	user := &userservice.User{
+		Id:              u.ID,
+		Username:        u.Username,
+		Email:           u.Email,
+		Version:         u.Version,
+		Status:          u.Status.ConvertToProto(),
+		MfaEnabled:      u.HasMFA(),
+		OrganizationIds: u.OrganizationIDs,
+	}
+
+	if createdAt := u.CreatedAt(); !createdAt.IsZero() {
+		user.CreatedAt = timestamppb.New(createdAt)
+	}
+	if u.IsEmailVerified() {
+		user.EmailVerifiedAt = timestamppb.New(u.EmailVerifiedAt)
+	}
+
+	return user
+}
+
+// ConvertToCredentialsProto converts a User domain model to the internal-only UserCredentials proto model.
+func (u *User) ConvertToCredentialsProto() *userservice.UserCredentials {
+	return &userservice.UserCredentials{
 		Id:             u.ID,
 		Username:       u.Username,
 		Email:          u.Email,
@@ -72,26 +234,65 @@ func (u *User) ConvertToProto() *userservice.User {
 	}
 }
 
-// Validate checks if the user's fields meet basic requirements.
+// Apply copies the fields set in the update onto the user.
+func (u *User) Apply(update UserUpdate) {
+	if update.Username != nil {
+		u.Username = *update.Username
+	}
+	if update.Email != nil {
+		u.Email = *update.Email
+	}
+}
+
+// Validate checks if the user's fields meet basic requirements. Every failing
+// field is reported in the returned ValidationError.
 func (u *User) Validate() error {
-	if u.Username == "" {
-		return errors.New("username is required")
+	return u.ValidateWith(nil)
+}
+
+// ValidateWith checks the same requirements as Validate and, unless policy is
+// nil, that the username follows the username policy.
+func (u *User) ValidateWith(policy *UsernamePolicy) error {
+	violations := &ValidationError{}
+
+	for _, description := range UsernameViolations(u.Username, policy) {
+		violations.Add("username", description)
 	}
 	if u.Email == "" {
-		return errors.New("email is required")
-	}
-	if !isValidEmail(u.Email) {
-		return errors.New("invalid email format")
+		violations.Add("email", "email is required")
+	} else if !isValidEmail(u.Email) {
+		violations.Add("email", "invalid email format")
 	}
 	if u.HashedPassword == "" {
-		return errors.New("hashed password is required")
+		violations.Add("password", "hashed password is required")
 	}
 	// Further validation logic goes here...
-	return nil
+	return violations.ErrOrNil()
 }
 
-// isValidEmail validates the email format
+// UsernameViolations returns a description of every requirement the username
+// breaks, including those of policy unless it is nil.
+func UsernameViolations(username string, policy *UsernamePolicy) []string {
+	if username == "" {
+		return []string{"username is required"}
+	}
+
+	var violations []string
+	if mixesScripts(username) {
+		violations = append(violations, "must not mix Latin, Cyrillic and Greek letters")
+	}
+	if policy != nil {
+		violations = append(violations, policy.Violations(username)...)
+	}
+	return violations
+}
+
+// isValidEmail validates the email format. Internationalized domains are
+// checked in their punycode form.
 func isValidEmail(email string) bool {
-	emailRegex := regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
-	return emailRegex.MatchString(email)
+	canonical, err := Normalizer{}.Email(email)
+	if err != nil {
+		return false
+	}
+	return isValidDomain(canonical[strings.LastIndex(canonical, "@")+1:])
 }
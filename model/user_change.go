@@ -0,0 +1,102 @@
+package model
+
+import (
+	"time"
+
+	userservice "github.com/BerryTracer/user-service/grpc/proto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// UserChangeType identifies how a user document changed.
+type UserChangeType string
+
+const (
+	UserChangeCreated UserChangeType = "created"
+	// UserChangeUpdated covers every write to an existing user, including soft
+	// deletes and restores.
+	UserChangeUpdated UserChangeType = "updated"
+	UserChangePurged  UserChangeType = "purged"
+)
+
+// UserChange is a change to a user document, as observed on the change stream.
+type UserChange struct {
+	Type   UserChangeType
+	UserID string
+	// User is the state of the user after the change. It is nil once the user
+	// is purged, including when an update is observed after a later purge.
+	User *User
+	// ResumeToken identifies the position of the change in the stream.
+	ResumeToken string
+	ChangedAt   time.Time
+}
+
+// UserChangeDB is a change stream event on the user collection.
+type UserChangeDB struct {
+	ID            bson.Raw            `bson:"_id"`
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *UserDB `bson:"fullDocument"`
+}
+
+// ToUserChange converts a change stream event to a UserChange. It reports false
+// for operations that do not change a single user, such as collection drops.
+// The resume token is left to the caller, as its encoding belongs to the stream.
+func (cdb *UserChangeDB) ToUserChange() (*UserChange, bool) {
+	change := &UserChange{
+		UserID:    cdb.DocumentKey.ID.Hex(),
+		ChangedAt: time.Unix(int64(cdb.ClusterTime.T), 0).UTC(),
+	}
+
+	switch cdb.OperationType {
+	case "insert":
+		change.Type = UserChangeCreated
+	case "update", "replace":
+		change.Type = UserChangeUpdated
+	case "delete":
+		change.Type = UserChangePurged
+	default:
+		return nil, false
+	}
+
+	if cdb.FullDocument != nil && change.Type != UserChangePurged {
+		change.User = cdb.FullDocument.ToUser()
+	}
+
+	return change, true
+}
+
+// ConvertToProto converts a UserChangeType to its proto enum value.
+func (t UserChangeType) ConvertToProto() userservice.UserChangeType {
+	switch t {
+	case UserChangeCreated:
+		return userservice.UserChangeType_USER_CHANGE_TYPE_CREATED
+	case UserChangeUpdated:
+		return userservice.UserChangeType_USER_CHANGE_TYPE_UPDATED
+	case UserChangePurged:
+		return userservice.UserChangeType_USER_CHANGE_TYPE_PURGED
+	default:
+		return userservice.UserChangeType_USER_CHANGE_TYPE_UNSPECIFIED
+	}
+}
+
+// ConvertToProto converts a UserChange to its proto model. Like ConvertToProto
+// on User, it never carries credential material.
+func (c *UserChange) ConvertToProto() *userservice.UserChange {
+	change := &userservice.UserChange{
+		Type:        c.Type.ConvertToProto(),
+		UserId:      c.UserID,
+		ResumeToken: c.ResumeToken,
+		ChangedAt:   timestamppb.New(c.ChangedAt),
+	}
+
+	if c.User != nil {
+		change.User = c.User.ConvertToProto()
+	}
+
+	return change
+}
@@ -0,0 +1,57 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	userservice "github.com/BerryTracer/user-service/grpc/proto"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserChangeDB_ToUserChange(t *testing.T) {
+	id := primitive.NewObjectID()
+	event := bson.M{
+		"_id":           bson.M{"_data": "8263"},
+		"operationType": "update",
+		"clusterTime":   primitive.Timestamp{T: 1700000000, I: 1},
+		"documentKey":   bson.M{"_id": id},
+		"fullDocument":  bson.M{"_id": id, "username": "alice", "email": "alice@example.com", "hashed_password": "secret", "status": "suspended"},
+	}
+	data, err := bson.Marshal(event)
+	assert.NoError(t, err)
+
+	var changeDB model.UserChangeDB
+	assert.NoError(t, bson.Unmarshal(data, &changeDB))
+
+	change, ok := changeDB.ToUserChange()
+	if assert.True(t, ok) {
+		assert.Equal(t, model.UserChangeUpdated, change.Type)
+		assert.Equal(t, id.Hex(), change.UserID)
+		assert.Equal(t, time.Unix(1700000000, 0).UTC(), change.ChangedAt)
+		assert.Equal(t, model.UserStatusSuspended, change.User.Status)
+
+		msg := change.ConvertToProto()
+		assert.Equal(t, userservice.UserChangeType_USER_CHANGE_TYPE_UPDATED, msg.GetType())
+		assert.Equal(t, "alice", msg.GetUser().GetUsername())
+	}
+}
+
+func TestUserChangeDB_ToUserChange_Purge(t *testing.T) {
+	changeDB := model.UserChangeDB{OperationType: "delete"}
+	changeDB.DocumentKey.ID = primitive.NewObjectID()
+
+	change, ok := changeDB.ToUserChange()
+	if assert.True(t, ok) {
+		assert.Equal(t, model.UserChangePurged, change.Type)
+		assert.Nil(t, change.User)
+		assert.Nil(t, change.ConvertToProto().GetUser())
+	}
+}
+
+func TestUserChangeDB_ToUserChange_IgnoresCollectionEvents(t *testing.T) {
+	_, ok := (&model.UserChangeDB{OperationType: "invalidate"}).ToUserChange()
+	assert.False(t, ok)
+}
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultReservedNames are always reserved, whatever else is configured.
+var DefaultReservedNames = []string{
+	"admin", "administrator", "root", "support", "system", "security", "abuse",
+	"help", "info", "postmaster", "webmaster", "hostmaster", "noreply", "no-reply",
+	"berrytracer", "berry-tracer",
+}
+
+// UsernamePolicy decides which usernames users may choose. Lengths are counted in characters.
+type UsernamePolicy struct {
+	MinLength int
+	MaxLength int
+	// AllowUnicode allows letters and digits beyond ASCII.
+	AllowUnicode bool
+	// Separators are the non-alphanumeric characters allowed between letters and digits.
+	Separators string
+	Reserved   *ReservedNames
+}
+
+// DefaultUsernamePolicy returns the policy used unless configured otherwise:
+// 3 to 32 letters, digits and ".", "_" or "-" separators, and none of DefaultReservedNames.
+func DefaultUsernamePolicy() *UsernamePolicy {
+	return &UsernamePolicy{
+		MinLength:    3,
+		MaxLength:    32,
+		AllowUnicode: true,
+		Separators:   "._-",
+		Reserved:     NewReservedNames(),
+	}
+}
+
+// Violations returns a description of every rule the username breaks. It
+// returns nil for acceptable usernames.
+func (p *UsernamePolicy) Violations(username string) []string {
+	var violations []string
+
+	length := utf8.RuneCountInString(username)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+
+	for _, r := range username {
+		if !p.isAlphanumeric(r) && !p.isSeparator(r) {
+			violations = append(violations, p.charsetDescription())
+			break
+		}
+	}
+
+	first, _ := utf8.DecodeRuneInString(username)
+	last, _ := utf8.DecodeLastRuneInString(username)
+	if p.isSeparator(first) || p.isSeparator(last) {
+		violations = append(violations, "must not start or end with a separator")
+	}
+	if p.hasConsecutiveSeparators(username) {
+		violations = append(violations, "must not contain consecutive separators")
+	}
+
+	if p.Reserved != nil && p.Reserved.Contains(username) {
+		violations = append(violations, "is reserved")
+	}
+
+	return violations
+}
+
+// Sanitize drops the characters of username the policy does not allow, along
+// with leading, trailing and repeated separators. It is used to derive suggestions.
+func (p *UsernamePolicy) Sanitize(username string) string {
+	var b strings.Builder
+	var lastSeparator bool
+	for _, r := range username {
+		switch {
+		case p.isAlphanumeric(r):
+			b.WriteRune(r)
+			lastSeparator = false
+		case p.isSeparator(r) && b.Len() > 0 && !lastSeparator:
+			b.WriteRune(r)
+			lastSeparator = true
+		}
+	}
+
+	sanitized := strings.TrimRightFunc(b.String(), p.isSeparator)
+	if p.MaxLength > 0 && utf8.RuneCountInString(sanitized) > p.MaxLength {
+		sanitized = strings.TrimRightFunc(string([]rune(sanitized)[:p.MaxLength]), p.isSeparator)
+	}
+	return sanitized
+}
+
+func (p *UsernamePolicy) isAlphanumeric(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+	}
+	return p.AllowUnicode && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func (p *UsernamePolicy) isSeparator(r rune) bool {
+	return r != utf8.RuneError && strings.ContainsRune(p.Separators, r)
+}
+
+func (p *UsernamePolicy) hasConsecutiveSeparators(username string) bool {
+	var previous bool
+	for _, r := range username {
+		current := p.isSeparator(r)
+		if current && previous {
+			return true
+		}
+		previous = current
+	}
+	return false
+}
+
+func (p *UsernamePolicy) charsetDescription() string {
+	letters := "letters and digits"
+	if !p.AllowUnicode {
+		letters = "ASCII letters and digits"
+	}
+	if p.Separators == "" {
+		return "may only contain " + letters
+	}
+	return fmt.Sprintf("may only contain %s and the separators %q", letters, p.Separators)
+}
+
+// ReservedNames is a set of usernames nobody may register. Names are compared by
+// canonical form with separators removed, so "Ad-Min" is as reserved as "admin".
+// It is safe for concurrent use, so the set can be replaced while in use.
+type ReservedNames struct {
+	mu    sync.RWMutex
+	names map[string]struct{}
+}
+
+// NewReservedNames returns a set holding DefaultReservedNames and the given names.
+func NewReservedNames(names ...string) *ReservedNames {
+	r := &ReservedNames{}
+	r.Replace(names)
+	return r
+}
+
+// Replace swaps the configured names for the given ones. DefaultReservedNames stay reserved.
+func (r *ReservedNames) Replace(names []string) {
+	set := make(map[string]struct{}, len(DefaultReservedNames)+len(names))
+	for _, name := range DefaultReservedNames {
+		set[reservedKey(name)] = struct{}{}
+	}
+	for _, name := range names {
+		if key := reservedKey(name); key != "" {
+			set[key] = struct{}{}
+		}
+	}
+
+	r.mu.Lock()
+	r.names = set
+	r.mu.Unlock()
+}
+
+// Contains reports whether the username is reserved.
+func (r *ReservedNames) Contains(username string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.names[reservedKey(username)]
+	return ok
+}
+
+// Len returns the number of reserved names.
+func (r *ReservedNames) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.names)
+}
+
+func reservedKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, DefaultNormalizer().Username(name))
+}
@@ -0,0 +1,57 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsernamePolicy_Violations(t *testing.T) {
+	policy := model.DefaultUsernamePolicy()
+
+	tests := []struct {
+		username   string
+		violations []string
+	}{
+		{"alice", nil},
+		{"alice.smith-99", nil},
+		{"Łukasz", nil},
+		{"al", []string{"must be at least 3 characters long"}},
+		{"alice smith", []string{`may only contain letters and digits and the separators "._-"`}},
+		{"_alice", []string{"must not start or end with a separator"}},
+		{"alice__smith", []string{"must not contain consecutive separators"}},
+		{"Admin", []string{"is reserved"}},
+		{"ad.min", []string{"is reserved"}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.violations, policy.Violations(tt.username), tt.username)
+	}
+}
+
+func TestUsernamePolicy_Violations_ASCIIOnly(t *testing.T) {
+	policy := model.DefaultUsernamePolicy()
+	policy.AllowUnicode = false
+
+	assert.Equal(t, []string{`may only contain ASCII letters and digits and the separators "._-"`}, policy.Violations("Łukasz"))
+}
+
+func TestUsernamePolicy_Sanitize(t *testing.T) {
+	policy := model.DefaultUsernamePolicy()
+
+	assert.Equal(t, "alice.smith", policy.Sanitize("..alice..smith!!"))
+	assert.Equal(t, "alice", policy.Sanitize("alice-"))
+}
+
+func TestReservedNames_Replace(t *testing.T) {
+	names := model.NewReservedNames("BerryCloud")
+	assert.True(t, names.Contains("berry_cloud"))
+	assert.True(t, names.Contains("root"))
+
+	// Replacing drops configured names but keeps the defaults
+	names.Replace([]string{"berryhub"})
+	assert.False(t, names.Contains("berrycloud"))
+	assert.True(t, names.Contains("BerryHub"))
+	assert.True(t, names.Contains("root"))
+}
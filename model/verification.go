@@ -0,0 +1,37 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// EmailVerification is an outstanding email verification. Only the hash of the
+// token is kept; the token itself is only ever sent to the user.
+type EmailVerification struct {
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+// EmailVerificationDB is the database form of an EmailVerification.
+type EmailVerificationDB struct {
+	TokenHash string    `bson:"token_hash" json:"token_hash"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// HashVerificationToken returns the hash under which a verification token is stored.
+func HashVerificationToken(token string) string {
+	return HashToken(token)
+}
+
+// HashToken returns the hash under which a random, high-entropy token is
+// stored. Such tokens cannot be guessed, so a fast unsalted hash suffices.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsExpired reports whether the verification can no longer be used at time now.
+func (v *EmailVerification) IsExpired(now time.Time) bool {
+	return !now.Before(v.ExpiresAt)
+}
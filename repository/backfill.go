@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"log"
+
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BackfillCanonicalFields sets the canonical username and email of users written
+// before they were stored, and returns how many users were updated. Users whose
+// canonical form collides with another user's, or whose email cannot be
+// normalized, are logged and skipped so they can be resolved by hand.
+func (r *UserMongoRepository) BackfillCanonicalFields(ctx context.Context, normalizer model.Normalizer) (int, error) {
+	filter := primitive.M{"$or": primitive.A{
+		primitive.M{"username_canonical": primitive.M{"$exists": false}},
+		primitive.M{"email_canonical": primitive.M{"$exists": false}},
+	}}
+
+	cursor, err := r.Collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var userDB model.UserDB
+		if err := cursor.Decode(&userDB); err != nil {
+			return updated, err
+		}
+
+		user := userDB.ToUser()
+		if err := normalizer.Normalize(user); err != nil {
+			log.Printf("skipping canonical backfill of user %s: %v\n", user.ID, err)
+			continue
+		}
+
+		update := primitive.M{"$set": primitive.M{
+			"username_canonical": user.UsernameCanonical,
+			"email_canonical":    user.EmailCanonical,
+		}}
+		if _, err := r.Collection.UpdateOne(ctx, primitive.M{"_id": userDB.ID}, update); err != nil {
+			if err := translateError(err); err == ErrEmailTaken || err == ErrUsernameTaken {
+				log.Printf("skipping canonical backfill of user %s: %v\n", user.ID, err)
+				continue
+			}
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, cursor.Err()
+}
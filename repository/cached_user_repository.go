@@ -0,0 +1,468 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/BerryTracer/user-service/cache"
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultCacheTTL is how long a cached user is served before it is read again.
+	DefaultCacheTTL = time.Minute
+	// DefaultNegativeCacheTTL is how long a lookup that found no user is remembered.
+	DefaultNegativeCacheTTL = 5 * time.Second
+)
+
+// CachedUserRepository is a UserRepository caching lookups of single users by
+// ID, email and username. Writes through it invalidate the users they change.
+//
+// Users are cached by ID only; email and username entries hold the ID of the
+// matching user and are checked against it on every hit, so that they never
+// outlive a change of email or username. Writes made in a transaction drop
+// their entries again once it commits, as lookups in between still read the
+// user as it was; see AfterCommit. A lookup racing with a write may still cache
+// the user as it was before the write, until TTL has passed.
+//
+// Entries keyed by ID hold the user whatever the tenant in the context of the
+// lookup, which only sees the user if it is a member. Entries keyed by email or
+// username are kept per tenant, as lookups by them are scoped to it.
+//
+// Credentials are never cached: users are served without their password hash,
+// MFA secret, recovery codes or email verification. Lookups that need them
+// must use a context from WithCredentials, which bypasses the cache.
+type CachedUserRepository struct {
+	Repository  UserRepository
+	Cache       cache.Cache
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	// group collapses concurrent misses on the same key into one lookup.
+	group singleflight.Group
+}
+
+// cacheEntry is the cached form of a lookup. An entry with neither field set
+// records that no user matched.
+type cacheEntry struct {
+	// User is set on entries keyed by ID.
+	User *model.UserDB `bson:"user,omitempty"`
+	// UserID is set on entries keyed by email or username.
+	UserID string `bson:"user_id,omitempty"`
+}
+
+func (e *cacheEntry) notFound() bool {
+	return e.User == nil && e.UserID == ""
+}
+
+type credentialsKey struct{}
+
+// WithCredentials returns a context whose user lookups need the credentials of
+// the user, so that a CachedUserRepository reads them from the repository it
+// wraps rather than from the cache.
+func WithCredentials(ctx context.Context) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, true)
+}
+
+// needsCredentials reports whether user lookups in ctx need the credentials of the user.
+func needsCredentials(ctx context.Context) bool {
+	needed, _ := ctx.Value(credentialsKey{}).(bool)
+	return needed
+}
+
+// NewCachedUserRepository returns a new CachedUserRepository with the default TTLs.
+func NewCachedUserRepository(userRepository UserRepository, c cache.Cache) *CachedUserRepository {
+	return &CachedUserRepository{
+		Repository:  userRepository,
+		Cache:       c,
+		TTL:         DefaultCacheTTL,
+		NegativeTTL: DefaultNegativeCacheTTL,
+	}
+}
+
+func userIDKey(id string) string {
+	return "user:id:" + id
+}
+
+func userEmailKey(email string) string {
+	return "user:email:" + email
+}
+
+func userUsernameKey(username string) string {
+	return "user:username:" + username
+}
+
+// scopedKey returns key as seen by lookups scoped to the tenant in ctx.
+func scopedKey(ctx context.Context, key string) string {
+	if organizationID, ok := TenantFromContext(ctx); ok {
+		return "tenant:" + organizationID + ":" + key
+	}
+	return key
+}
+
+// GetUserById implements UserRepository.
+func (r *CachedUserRepository) GetUserById(ctx context.Context, id string) (*model.User, error) {
+	if needsCredentials(ctx) {
+		return r.Repository.GetUserById(ctx, id)
+	}
+
+	entry, err := r.load(ctx, userIDKey(id), func() (*cacheEntry, error) {
+		user, err := r.Repository.GetUserById(withoutTenant(ctx), id)
+		if err != nil {
+			return nil, err
+		}
+		return r.userEntry(user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.notFound() {
+		return nil, ErrUserNotFound
+	}
+
+	user := entry.User.ToUser()
+	if organizationID, ok := TenantFromContext(ctx); ok && !user.IsMember(organizationID) {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// GetUserByEmail implements UserRepository.
+func (r *CachedUserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.getUserByKey(ctx, scopedKey(ctx, userEmailKey(email)), r.Repository.GetUserByEmail, email, func(user *model.User) bool {
+		return user.EmailCanonical == email
+	})
+}
+
+// GetUserByUsername implements UserRepository.
+func (r *CachedUserRepository) GetUserByUsername(ctx context.Context, name string) (*model.User, error) {
+	return r.getUserByKey(ctx, scopedKey(ctx, userUsernameKey(name)), r.Repository.GetUserByUsername, name, func(user *model.User) bool {
+		return user.UsernameCanonical == name
+	})
+}
+
+// getUserByKey looks a user up through an entry holding its ID. If the user no
+// longer matches, the entry is dropped and the lookup goes to the repository.
+func (r *CachedUserRepository) getUserByKey(ctx context.Context, key string, lookup func(context.Context, string) (*model.User, error), value string, matches func(*model.User) bool) (*model.User, error) {
+	if needsCredentials(ctx) {
+		return lookup(ctx, value)
+	}
+
+	entry, err := r.load(ctx, key, func() (*cacheEntry, error) {
+		user, err := lookup(ctx, value)
+		if err != nil {
+			return nil, err
+		}
+
+		// Warm the ID entry, which the lookup below reads next.
+		if idEntry, err := r.userEntry(user); err == nil {
+			r.store(ctx, userIDKey(user.ID), idEntry)
+		}
+		return &cacheEntry{UserID: user.ID}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.notFound() {
+		return nil, ErrUserNotFound
+	}
+
+	user, err := r.GetUserById(ctx, entry.UserID)
+	if err == nil && matches(user) {
+		return user, nil
+	}
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	r.invalidate(ctx, key)
+	return lookup(ctx, value)
+}
+
+// userEntry returns the entry caching user, without its credentials.
+func (r *CachedUserRepository) userEntry(user *model.User) (*cacheEntry, error) {
+	userDB, err := user.ToUserDB()
+	if err != nil {
+		return nil, err
+	}
+
+	userDB.HashedPassword = ""
+	userDB.EmailVerification = nil
+	if userDB.MFA != nil {
+		// Keep what tells whether MFA is enabled.
+		userDB.MFA.EncryptedSecret = nil
+		userDB.MFA.RecoveryCodeHashes = nil
+	}
+	return &cacheEntry{User: userDB}, nil
+}
+
+// load returns the entry cached under key, or caches the one returned by fetch.
+// ErrUserNotFound from fetch is cached as a negative entry. Cache failures are
+// logged and fall back to fetch, so that the cache never makes lookups fail.
+func (r *CachedUserRepository) load(ctx context.Context, key string, fetch func() (*cacheEntry, error)) (*cacheEntry, error) {
+	data, err := r.Cache.Get(ctx, key)
+	if err == nil {
+		var entry cacheEntry
+		if err := bson.Unmarshal(data, &entry); err == nil {
+			return &entry, nil
+		}
+		log.Printf("failed to decode cached %s, reloading it\n", key)
+	} else if !errors.Is(err, cache.ErrMiss) {
+		log.Printf("failed to read %s from the cache: %v\n", key, err)
+	}
+
+	// Callers sharing a lookup get the encoded entry and decode their own
+	// copy, so none of them can change the user seen by the others.
+	shared, err, _ := r.group.Do(key, func() (interface{}, error) {
+		entry, err := fetch()
+		if errors.Is(err, ErrUserNotFound) {
+			entry, err = &cacheEntry{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return r.store(ctx, key, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var entry cacheEntry
+	if err := bson.Unmarshal(shared.([]byte), &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// store caches entry under key and returns its encoded form.
+func (r *CachedUserRepository) store(ctx context.Context, key string, entry *cacheEntry) ([]byte, error) {
+	data, err := bson.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := r.TTL
+	if entry.notFound() {
+		ttl = r.NegativeTTL
+	}
+	if err := r.Cache.Set(ctx, key, data, ttl); err != nil {
+		log.Printf("failed to write %s to the cache: %v\n", key, err)
+	}
+
+	return data, nil
+}
+
+// invalidate drops the given keys, and again once the transaction of ctx, if
+// any, has committed. Failures are logged rather than returned, as the write
+// that caused them has already succeeded; entries then expire with their TTL.
+func (r *CachedUserRepository) invalidate(ctx context.Context, keys ...string) {
+	r.drop(ctx, keys...)
+	AfterCommit(ctx, func() {
+		r.drop(ctx, keys...)
+	})
+}
+
+// drop deletes the given keys from the cache.
+func (r *CachedUserRepository) drop(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		r.group.Forget(key)
+	}
+
+	if err := r.Cache.Delete(ctx, keys...); err != nil {
+		log.Printf("failed to invalidate %v in the cache: %v\n", keys, err)
+	}
+}
+
+// invalidateUser drops the entries of user, including negative entries for its
+// email and username, which it may have just taken, in every organization it
+// is a member of.
+func (r *CachedUserRepository) invalidateUser(ctx context.Context, user *model.User) {
+	keys := []string{userIDKey(user.ID), userEmailKey(user.EmailCanonical), userUsernameKey(user.UsernameCanonical)}
+	for _, organizationID := range user.OrganizationIDs {
+		tenantCtx := WithTenant(ctx, organizationID)
+		keys = append(keys, scopedKey(tenantCtx, userEmailKey(user.EmailCanonical)), scopedKey(tenantCtx, userUsernameKey(user.UsernameCanonical)))
+	}
+	r.invalidate(ctx, keys...)
+}
+
+// CreateUser implements UserRepository.
+func (r *CachedUserRepository) CreateUser(ctx context.Context, user *model.User) error {
+	if err := r.Repository.CreateUser(ctx, user); err != nil {
+		return err
+	}
+
+	r.invalidateUser(ctx, user)
+	return nil
+}
+
+// UpdateUser implements UserRepository.
+func (r *CachedUserRepository) UpdateUser(ctx context.Context, user *model.User, expectedVersion int64, emailChanged bool) error {
+	if err := r.Repository.UpdateUser(ctx, user, expectedVersion, emailChanged); err != nil {
+		return err
+	}
+
+	r.invalidateUser(ctx, user)
+	return nil
+}
+
+// UpdateHashedPassword implements UserRepository.
+func (r *CachedUserRepository) UpdateHashedPassword(ctx context.Context, id string, hashedPassword string) error {
+	return r.invalidateAfter(ctx, id, r.Repository.UpdateHashedPassword(ctx, id, hashedPassword))
+}
+
+// UpdatePassword implements UserRepository.
+func (r *CachedUserRepository) UpdatePassword(ctx context.Context, id string, hashedPassword string, changedAt time.Time) error {
+	return r.invalidateAfter(ctx, id, r.Repository.UpdatePassword(ctx, id, hashedPassword, changedAt))
+}
+
+// DeleteUser implements UserRepository.
+func (r *CachedUserRepository) DeleteUser(ctx context.Context, id string, deletedAt time.Time) error {
+	return r.invalidateAfter(ctx, id, r.Repository.DeleteUser(ctx, id, deletedAt))
+}
+
+// GetDeletedUser implements UserRepository. Deleted users are not cached.
+func (r *CachedUserRepository) GetDeletedUser(ctx context.Context, id string) (*model.User, error) {
+	return r.Repository.GetDeletedUser(ctx, id)
+}
+
+// RestoreUser implements UserRepository. Lookups by email or username may have
+// cached that no user matched while the user was deleted, so those entries are
+// dropped as well.
+func (r *CachedUserRepository) RestoreUser(ctx context.Context, id string, status model.UserStatus, restoredAt time.Time) error {
+	if err := r.Repository.RestoreUser(ctx, id, status, restoredAt); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, userIDKey(id))
+
+	user, err := r.Repository.GetUserById(withoutTenant(ctx), id)
+	if err != nil {
+		log.Printf("failed to invalidate restored user %s in the cache: %v\n", id, err)
+		return nil
+	}
+	r.invalidateUser(ctx, user)
+	return nil
+}
+
+// PurgeUser implements UserRepository.
+func (r *CachedUserRepository) PurgeUser(ctx context.Context, id string) error {
+	return r.invalidateAfter(ctx, id, r.Repository.PurgeUser(ctx, id))
+}
+
+// UpdateStatus implements UserRepository.
+func (r *CachedUserRepository) UpdateStatus(ctx context.Context, id string, from model.UserStatus, change model.StatusChange) error {
+	return r.invalidateAfter(ctx, id, r.Repository.UpdateStatus(ctx, id, from, change))
+}
+
+// SetEmailVerification implements UserRepository.
+func (r *CachedUserRepository) SetEmailVerification(ctx context.Context, id string, verification model.EmailVerification) error {
+	return r.invalidateAfter(ctx, id, r.Repository.SetEmailVerification(ctx, id, verification))
+}
+
+// MarkEmailVerified implements UserRepository.
+func (r *CachedUserRepository) MarkEmailVerified(ctx context.Context, id string, tokenHash string, verifiedAt time.Time, status model.UserStatus) error {
+	return r.invalidateAfter(ctx, id, r.Repository.MarkEmailVerified(ctx, id, tokenHash, verifiedAt, status))
+}
+
+// StartMFAEnrollment implements UserRepository.
+func (r *CachedUserRepository) StartMFAEnrollment(ctx context.Context, id string, encryptedSecret []byte) error {
+	return r.invalidateAfter(ctx, id, r.Repository.StartMFAEnrollment(ctx, id, encryptedSecret))
+}
+
+// EnableMFA implements UserRepository.
+func (r *CachedUserRepository) EnableMFA(ctx context.Context, id string, encryptedSecret []byte, recoveryCodeHashes []string, enabledAt time.Time, step int64) error {
+	return r.invalidateAfter(ctx, id, r.Repository.EnableMFA(ctx, id, encryptedSecret, recoveryCodeHashes, enabledAt, step))
+}
+
+// DisableMFA implements UserRepository.
+func (r *CachedUserRepository) DisableMFA(ctx context.Context, id string) error {
+	return r.invalidateAfter(ctx, id, r.Repository.DisableMFA(ctx, id))
+}
+
+// UseTOTPStep implements UserRepository.
+func (r *CachedUserRepository) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	return r.invalidateAfter(ctx, id, r.Repository.UseTOTPStep(ctx, id, step))
+}
+
+// UseRecoveryCode implements UserRepository.
+func (r *CachedUserRepository) UseRecoveryCode(ctx context.Context, id string, codeHash string) error {
+	return r.invalidateAfter(ctx, id, r.Repository.UseRecoveryCode(ctx, id, codeHash))
+}
+
+// ListUsers implements UserRepository. Pages are not cached.
+func (r *CachedUserRepository) ListUsers(ctx context.Context, query ListUsersQuery) (*UserPage, error) {
+	return r.Repository.ListUsers(ctx, query)
+}
+
+// GetUserByVerificationToken implements UserRepository. Tokens are looked up
+// once, so they are not cached.
+func (r *CachedUserRepository) GetUserByVerificationToken(ctx context.Context, tokenHash string) (*model.User, error) {
+	return r.Repository.GetUserByVerificationToken(ctx, tokenHash)
+}
+
+// FindTakenUsernames implements UserRepository. It is not cached, as it must
+// see usernames taken an instant ago.
+func (r *CachedUserRepository) FindTakenUsernames(ctx context.Context, usernames []string) ([]string, error) {
+	return r.Repository.FindTakenUsernames(ctx, usernames)
+}
+
+// BatchGetUsers implements UserRepository. Batches go to the repository in one
+// query rather than through the cache.
+func (r *CachedUserRepository) BatchGetUsers(ctx context.Context, ids, emails, usernames []string) ([]*model.User, error) {
+	return r.Repository.BatchGetUsers(ctx, ids, emails, usernames)
+}
+
+// invalidateAfter drops the user with the given ID unless the write changing it failed.
+func (r *CachedUserRepository) invalidateAfter(ctx context.Context, id string, err error) error {
+	if err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, userIDKey(id))
+	return nil
+}
+
+// AddRoleAssignment implements UserRepository.
+func (r *CachedUserRepository) AddRoleAssignment(ctx context.Context, id string, assignment model.RoleAssignment) error {
+	return r.invalidateAfter(ctx, id, r.Repository.AddRoleAssignment(ctx, id, assignment))
+}
+
+// RemoveRoleAssignment implements UserRepository.
+func (r *CachedUserRepository) RemoveRoleAssignment(ctx context.Context, id string, role string, scope model.Scope) error {
+	return r.invalidateAfter(ctx, id, r.Repository.RemoveRoleAssignment(ctx, id, role, scope))
+}
+
+// AddMembership implements UserRepository. Lookups scoped to the organization
+// may have cached that no user matched before the user joined, so those
+// entries are dropped as well.
+func (r *CachedUserRepository) AddMembership(ctx context.Context, id string, organizationID string) error {
+	if err := r.Repository.AddMembership(ctx, id, organizationID); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, userIDKey(id))
+
+	user, err := r.Repository.GetUserById(withoutTenant(ctx), id)
+	if err != nil {
+		log.Printf("failed to invalidate user %s in the cache: %v\n", id, err)
+		return nil
+	}
+	r.invalidateUser(ctx, user)
+	return nil
+}
+
+// RemoveMembership implements UserRepository. Entries of other lookups hold
+// the ID of the user, whose membership is checked on every hit.
+func (r *CachedUserRepository) RemoveMembership(ctx context.Context, id string, organizationID string) error {
+	return r.invalidateAfter(ctx, id, r.Repository.RemoveMembership(ctx, id, organizationID))
+}
+
+// Ensure CachedUserRepository implements the UserRepository interface
+var _ UserRepository = &CachedUserRepository{}
@@ -0,0 +1,328 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BerryTracer/user-service/cache"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	mockrepository "github.com/BerryTracer/user-service/repository/mock"
+	"github.com/golang/mock/gomock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newCachedTestUser() *model.User {
+	return &model.User{
+		ID:                primitive.NewObjectID().Hex(),
+		Username:          "Alice",
+		Email:             "alice@example.com",
+		UsernameCanonical: "alice",
+		EmailCanonical:    "alice@example.com",
+		HashedPassword:    "hashedPassword",
+		Version:           1,
+		Status:            model.UserStatusActive,
+	}
+}
+
+// TestCachedUserRepository_GetUserById tests that users are read from the repository once
+func TestCachedUserRepository_GetUserById(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	cachedRepo := repository.NewCachedUserRepository(mockRepo, cache.NewLRU(10))
+
+	ctx := context.Background()
+	user := newCachedTestUser()
+
+	// Setup mock expectations
+	mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+
+	// Call the method
+	first, err := cachedRepo.GetUserById(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	first.Username = "changed by caller"
+	second, err := cachedRepo.GetUserById(ctx, user.ID)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if second.Username != "Alice" || second.Email != user.Email {
+		t.Errorf("expected an unchanged copy of the user, got %+v", second)
+	}
+}
+
+// TestCachedUserRepository_GetUserById_WithoutCredentials tests that credentials are never cached and are read from the repository when needed
+func TestCachedUserRepository_GetUserById_WithoutCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	c := cache.NewLRU(10)
+	cachedRepo := repository.NewCachedUserRepository(mockRepo, c)
+
+	ctx := context.Background()
+	user := newCachedTestUser()
+	user.MFA = &model.MFA{EncryptedSecret: []byte("encryptedSecret"), EnabledAt: time.Now().UTC(), RecoveryCodeHashes: []string{"recoveryCodeHash"}}
+	user.EmailVerification = &model.EmailVerification{TokenHash: "tokenHash", ExpiresAt: time.Now().UTC().Add(time.Hour)}
+
+	// Setup mock expectations
+	mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+	mockRepo.EXPECT().GetUserById(repository.WithCredentials(ctx), user.ID).Return(user, nil).Times(1)
+
+	// Call the method
+	cached, err := cachedRepo.GetUserById(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	withCredentials, err := cachedRepo.GetUserById(repository.WithCredentials(ctx), user.ID)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if cached.HashedPassword != "" || cached.EmailVerification != nil || len(cached.MFA.EncryptedSecret) != 0 || len(cached.MFA.RecoveryCodeHashes) != 0 {
+		t.Errorf("expected a user without credentials, got %+v", cached)
+	}
+	if !cached.HasMFA() {
+		t.Errorf("expected the cached user to have MFA enabled")
+	}
+	data, err := c.Get(ctx, "user:id:"+user.ID)
+	if err != nil {
+		t.Fatalf("expected the user to be cached, got %v", err)
+	}
+	for _, secret := range []string{"hashedPassword", "encryptedSecret", "recoveryCodeHash", "tokenHash"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("expected %s not to be cached", secret)
+		}
+	}
+	if withCredentials.HashedPassword != user.HashedPassword {
+		t.Errorf("expected the user with its credentials, got %+v", withCredentials)
+	}
+}
+
+// TestCachedUserRepository_GetUserById_NotFound tests that missing users are cached as well
+func TestCachedUserRepository_GetUserById_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	cachedRepo := repository.NewCachedUserRepository(mockRepo, cache.NewLRU(10))
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+
+	// Setup mock expectations
+	mockRepo.EXPECT().GetUserById(ctx, testID).Return(nil, repository.ErrUserNotFound).Times(1)
+
+	// Call the method twice
+	for i := 0; i < 2; i++ {
+		_, err := cachedRepo.GetUserById(ctx, testID)
+
+		// Assertions
+		if err != repository.ErrUserNotFound {
+			t.Errorf("expected %v, got %v", repository.ErrUserNotFound, err)
+		}
+	}
+}
+
+// TestCachedUserRepository_GetUserById_CollapsesMisses tests that concurrent misses share one lookup
+func TestCachedUserRepository_GetUserById_CollapsesMisses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	cachedRepo := repository.NewCachedUserRepository(mockRepo, cache.NewLRU(10))
+
+	ctx := context.Background()
+	user := newCachedTestUser()
+	release := make(chan struct{})
+
+	// Setup mock expectations: the lookup blocks until every caller is waiting
+	mockRepo.EXPECT().
+		GetUserById(ctx, user.ID).
+		DoAndReturn(func(ctx context.Context, id string) (*model.User, error) {
+			<-release
+			return user, nil
+		}).
+		Times(1)
+
+	// Call the method concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cachedRepo.GetUserById(ctx, user.ID); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
+
+// TestCachedUserRepository_UpdatePassword_Invalidates tests that writes drop the cached user
+func TestCachedUserRepository_UpdatePassword_Invalidates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	cachedRepo := repository.NewCachedUserRepository(mockRepo, cache.NewLRU(10))
+
+	ctx := context.Background()
+	user := newCachedTestUser()
+	updated := *user
+	updated.HashedPassword = "newHashedPassword"
+	updated.Version = 2
+	changedAt := time.Now().UTC()
+
+	// Setup mock expectations
+	gomock.InOrder(
+		mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil),
+		mockRepo.EXPECT().UpdatePassword(ctx, user.ID, "newHashedPassword", changedAt).Return(nil),
+		mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(&updated, nil),
+	)
+
+	// Call the methods
+	_, _ = cachedRepo.GetUserById(ctx, user.ID)
+	if err := cachedRepo.UpdatePassword(ctx, user.ID, "newHashedPassword", changedAt); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	result, err := cachedRepo.GetUserById(ctx, user.ID)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if result.Version != 2 {
+		t.Errorf("expected the updated user, got %+v", result)
+	}
+}
+
+// TestCachedUserRepository_GetUserByEmail tests that email lookups are served from the cached user
+func TestCachedUserRepository_GetUserByEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	cachedRepo := repository.NewCachedUserRepository(mockRepo, cache.NewLRU(10))
+
+	ctx := context.Background()
+	user := newCachedTestUser()
+
+	// Setup mock expectations: the email lookup also caches the user by ID
+	mockRepo.EXPECT().GetUserByEmail(ctx, "alice@example.com").Return(user, nil).Times(1)
+
+	// Call the methods
+	for i := 0; i < 2; i++ {
+		result, err := cachedRepo.GetUserByEmail(ctx, "alice@example.com")
+		if err != nil || result.ID != user.ID {
+			t.Errorf("expected user %s, got %+v (%v)", user.ID, result, err)
+		}
+	}
+	if _, err := cachedRepo.GetUserById(ctx, user.ID); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestCachedUserRepository_GetUserByEmail_EmailChanged tests that email entries do not outlive an email change
+func TestCachedUserRepository_GetUserByEmail_EmailChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	cachedRepo := repository.NewCachedUserRepository(mockRepo, cache.NewLRU(10))
+
+	ctx := context.Background()
+	user := newCachedTestUser()
+	updated := *user
+	updated.Email, updated.EmailCanonical = "new@example.com", "new@example.com"
+
+	// Setup mock expectations
+	gomock.InOrder(
+		mockRepo.EXPECT().GetUserByEmail(ctx, "alice@example.com").Return(user, nil),
+		mockRepo.EXPECT().UpdateUser(ctx, &updated, int64(1), false).Return(nil),
+		mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(&updated, nil),
+		mockRepo.EXPECT().GetUserByEmail(ctx, "alice@example.com").Return(nil, repository.ErrUserNotFound),
+	)
+
+	// Call the methods
+	_, _ = cachedRepo.GetUserByEmail(ctx, "alice@example.com")
+	if err := cachedRepo.UpdateUser(ctx, &updated, 1, false); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_, err := cachedRepo.GetUserByEmail(ctx, "alice@example.com")
+
+	// Assertions
+	if err != repository.ErrUserNotFound {
+		t.Errorf("expected %v, got %v", repository.ErrUserNotFound, err)
+	}
+}
+
+// TestCachedUserRepository_CreateUser_DropsNegativeEntries tests that a new user is found right after it is created
+func TestCachedUserRepository_CreateUser_DropsNegativeEntries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	cachedRepo := repository.NewCachedUserRepository(mockRepo, cache.NewLRU(10))
+
+	ctx := context.Background()
+	user := newCachedTestUser()
+
+	// Setup mock expectations
+	gomock.InOrder(
+		mockRepo.EXPECT().GetUserByUsername(ctx, "alice").Return(nil, repository.ErrUserNotFound),
+		mockRepo.EXPECT().CreateUser(ctx, user).Return(nil),
+		mockRepo.EXPECT().GetUserByUsername(ctx, "alice").Return(user, nil),
+	)
+
+	// Call the methods
+	_, _ = cachedRepo.GetUserByUsername(ctx, "alice")
+	if err := cachedRepo.CreateUser(ctx, user); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	result, err := cachedRepo.GetUserByUsername(ctx, "alice")
+
+	// Assertions
+	if err != nil || result.ID != user.ID {
+		t.Errorf("expected user %s, got %+v (%v)", user.ID, result, err)
+	}
+}
+
+// TestCachedUserRepository_GetUserById_Tenant tests that cached users are only seen by their organizations
+func TestCachedUserRepository_GetUserById_Tenant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	cachedRepo := repository.NewCachedUserRepository(mockRepo, cache.NewLRU(10))
+
+	ctx := context.Background()
+	user := newCachedTestUser()
+	user.OrganizationIDs = []string{"acme"}
+
+	// Setup mock expectations: the user is read once, whatever the tenant
+	mockRepo.EXPECT().GetUserById(gomock.Any(), user.ID).Return(user, nil).Times(1)
+
+	// Call the method
+	_, memberErr := cachedRepo.GetUserById(repository.WithTenant(ctx, "acme"), user.ID)
+	_, otherErr := cachedRepo.GetUserById(repository.WithTenant(ctx, "globex"), user.ID)
+
+	// Assertions
+	if memberErr != nil {
+		t.Errorf("expected no error for the member's organization, got %v", memberErr)
+	}
+	if otherErr != repository.ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound for another organization, got %v", otherErr)
+	}
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/BerryTracer/user-service/cache"
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// stubUserRepository serves a single user and accepts status changes. The
+// generated mock cannot be used here, as it imports this package.
+type stubUserRepository struct {
+	UserRepository
+	user *model.User
+}
+
+func (r *stubUserRepository) GetUserById(context.Context, string) (*model.User, error) {
+	return r.user, nil
+}
+
+func (r *stubUserRepository) UpdateStatus(context.Context, string, model.UserStatus, model.StatusChange) error {
+	return nil
+}
+
+// TestAfterCommit_OutsideTransaction tests that nothing is registered outside transactions
+func TestAfterCommit_OutsideTransaction(t *testing.T) {
+	if AfterCommit(context.Background(), func() { t.Error("expected the hook not to run") }) {
+		t.Error("expected no hook to be registered")
+	}
+}
+
+// TestCachedUserRepository_InvalidatesAfterCommit tests that a user cached by a
+// lookup racing with a transaction is dropped once the transaction commits
+func TestCachedUserRepository_InvalidatesAfterCommit(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	lru := cache.NewLRU(10)
+	cachedRepo := NewCachedUserRepository(&stubUserRepository{user: &model.User{ID: id, Username: "alice", Status: model.UserStatusActive}}, lru)
+
+	txCtx, hooks := withCommitHooks(context.Background())
+
+	// Call the method, then read the user before the transaction commits
+	if err := cachedRepo.UpdateStatus(txCtx, id, model.UserStatusActive, model.StatusChange{Status: model.UserStatusSuspended, At: time.Now()}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := cachedRepo.GetUserById(context.Background(), id); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	hooks.run()
+
+	// Assertions
+	if lru.Len() != 0 {
+		t.Errorf("expected the stale user to be dropped on commit, got %d entries", lru.Len())
+	}
+}
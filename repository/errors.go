@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrUserNotFound is returned when no (non-deleted) user matches a lookup or write.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailTaken is returned when a write would duplicate another user's email.
+	ErrEmailTaken = errors.New("email is already taken")
+	// ErrUsernameTaken is returned when a write would duplicate another user's username.
+	ErrUsernameTaken = errors.New("username is already taken")
+	// ErrVersionConflict is returned when an update targets a user version that is no longer current.
+	ErrVersionConflict = errors.New("user was modified concurrently")
+	// ErrStatusChanged is returned when a status change expects a status the user no longer has.
+	ErrStatusChanged = errors.New("user status changed meanwhile")
+	// ErrMFACodeUsed is returned when a TOTP or recovery code was already used, or the user's MFA changed meanwhile.
+	ErrMFACodeUsed = errors.New("mfa code already used")
+	// ErrRoleAlreadyAssigned is returned when assigning a role a user already has in the same scope.
+	ErrRoleAlreadyAssigned = errors.New("role is already assigned")
+	// ErrRoleNotAssigned is returned when revoking a role a user does not have in the given scope.
+	ErrRoleNotAssigned = errors.New("role is not assigned")
+	// ErrAlreadyMember is returned when adding a user to an organization they are a member of.
+	ErrAlreadyMember = errors.New("user is already a member of the organization")
+	// ErrNotMember is returned when removing a user from an organization they are not a member of.
+	ErrNotMember = errors.New("user is not a member of the organization")
+	// ErrInvalidCursor is returned when a page cursor cannot be decoded or does not match the query's sort order.
+	ErrInvalidCursor = errors.New("invalid page cursor")
+	// ErrInvalidPageSize is returned when a list query asks for a non-positive number of users.
+	ErrInvalidPageSize = errors.New("page size must be positive")
+	// ErrInvalidResumeToken is returned when a change stream resume token cannot be decoded.
+	ErrInvalidResumeToken = errors.New("invalid resume token")
+	// ErrResumeTokenExpired is returned when a change stream can no longer resume
+	// from a token because the changes after it have left the oplog.
+	ErrResumeTokenExpired = errors.New("resume token has expired")
+)
+
+// parseID converts a user ID into an ObjectID, reporting malformed IDs as invalid arguments.
+func parseID(id string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return objectID, model.NewValidationError("id", "must be a valid ObjectID")
+	}
+	return objectID, nil
+}
+
+// translateError maps driver errors onto the repository's domain errors.
+func translateError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrUserNotFound
+	}
+
+	if mongo.IsDuplicateKeyError(err) {
+		// Unique indexes are named after their first key, e.g. "email_1".
+		message := err.Error()
+		switch {
+		case strings.Contains(message, "index: email"):
+			return ErrEmailTaken
+		case strings.Contains(message, "index: username"):
+			return ErrUsernameTaken
+		}
+	}
+
+	return err
+}
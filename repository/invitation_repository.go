@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BerryTracer/common-service/adapter/database/mongodb"
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrInvitationNotFound is returned when no invitation matches a lookup.
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrInvitationNotPending is returned when accepting or revoking an
+	// invitation that was already accepted or revoked, or has expired.
+	ErrInvitationNotPending = errors.New("invitation is no longer pending")
+)
+
+// InvitationRepository stores invitations to join organizations. Tokens are
+// only ever stored hashed.
+type InvitationRepository interface {
+	CreateInvitation(ctx context.Context, invitation *model.Invitation) error
+	GetInvitation(ctx context.Context, id string) (*model.Invitation, error)
+	GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*model.Invitation, error)
+	ListInvitations(ctx context.Context, organizationID string, status model.InvitationStatus, now time.Time) ([]*model.Invitation, error)
+	AcceptInvitation(ctx context.Context, id, userID string, acceptedAt time.Time) error
+	RevokeInvitation(ctx context.Context, id, actor string, revokedAt time.Time) error
+}
+
+type InvitationMongoRepository struct {
+	Collection mongodb.MongoAdapter
+}
+
+// NewInvitationMongoRepository returns a new InvitationMongoRepository.
+func NewInvitationMongoRepository(collection mongodb.MongoAdapter) *InvitationMongoRepository {
+	return &InvitationMongoRepository{Collection: collection}
+}
+
+// CreateInvitation implements InvitationRepository.
+func (r *InvitationMongoRepository) CreateInvitation(ctx context.Context, invitation *model.Invitation) error {
+	invitationDB, err := invitation.ToInvitationDB()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Collection.InsertOne(ctx, invitationDB)
+	return err
+}
+
+// GetInvitation implements InvitationRepository.
+func (r *InvitationMongoRepository) GetInvitation(ctx context.Context, id string) (*model.Invitation, error) {
+	objectID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.findOne(ctx, primitive.M{"_id": objectID})
+}
+
+// GetInvitationByTokenHash implements InvitationRepository.
+func (r *InvitationMongoRepository) GetInvitationByTokenHash(ctx context.Context, tokenHash string) (*model.Invitation, error) {
+	return r.findOne(ctx, primitive.M{"token_hash": tokenHash})
+}
+
+func (r *InvitationMongoRepository) findOne(ctx context.Context, filter primitive.M) (*model.Invitation, error) {
+	var invitationDB model.InvitationDB
+	if err := r.Collection.FindOne(ctx, filter).Decode(&invitationDB); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+
+	return invitationDB.ToInvitation(), nil
+}
+
+// ListInvitations implements InvitationRepository. It returns the invitations
+// of the organization, most recent first, with the given status at time now,
+// or with any status when status is empty.
+func (r *InvitationMongoRepository) ListInvitations(ctx context.Context, organizationID string, status model.InvitationStatus, now time.Time) ([]*model.Invitation, error) {
+	filter := primitive.M{"organization_id": organizationID}
+	switch status {
+	case "":
+	case model.InvitationPending:
+		filter["status"] = model.InvitationPending
+		filter["expires_at"] = primitive.M{"$gt": now}
+	case model.InvitationExpired:
+		filter["status"] = model.InvitationPending
+		filter["expires_at"] = primitive.M{"$lte": now}
+	default:
+		filter["status"] = status
+	}
+
+	cursor, err := r.Collection.Find(ctx, filter, options.Find().SetSort(primitive.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var invitationsDB []model.InvitationDB
+	if err := cursor.All(ctx, &invitationsDB); err != nil {
+		return nil, err
+	}
+
+	invitations := make([]*model.Invitation, 0, len(invitationsDB))
+	for i := range invitationsDB {
+		invitations = append(invitations, invitationsDB[i].ToInvitation())
+	}
+
+	return invitations, nil
+}
+
+// AcceptInvitation implements InvitationRepository. Only pending invitations
+// that have not expired by acceptedAt can be accepted, checked in the same
+// write, so an invitation is accepted at most once.
+func (r *InvitationMongoRepository) AcceptInvitation(ctx context.Context, id, userID string, acceptedAt time.Time) error {
+	return r.conclude(ctx, id, acceptedAt, primitive.M{
+		"status":      model.InvitationAccepted,
+		"accepted_at": acceptedAt,
+		"accepted_by": userID,
+	})
+}
+
+// RevokeInvitation implements InvitationRepository. Like AcceptInvitation, it
+// only applies to pending invitations that have not expired.
+func (r *InvitationMongoRepository) RevokeInvitation(ctx context.Context, id, actor string, revokedAt time.Time) error {
+	return r.conclude(ctx, id, revokedAt, primitive.M{
+		"status":     model.InvitationRevoked,
+		"revoked_at": revokedAt,
+		"revoked_by": actor,
+	})
+}
+
+// conclude sets the given fields on the invitation if it is still pending at
+// time now, telling a missing invitation apart from one that is not.
+func (r *InvitationMongoRepository) conclude(ctx context.Context, id string, now time.Time, set primitive.M) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := primitive.M{"_id": objectID, "status": model.InvitationPending, "expires_at": primitive.M{"$gt": now}}
+	result, err := r.Collection.UpdateOne(ctx, filter, primitive.M{"$set": set})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if _, err := r.findOne(ctx, primitive.M{"_id": objectID}); err != nil {
+			return err
+		}
+		return ErrInvitationNotPending
+	}
+
+	return nil
+}
+
+// Ensure InvitationMongoRepository implements the InvitationRepository interface
+var _ InvitationRepository = &InvitationMongoRepository{}
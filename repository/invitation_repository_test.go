@@ -0,0 +1,128 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mock "github.com/BerryTracer/common-service/adapter/database/mongodb/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	"github.com/golang/mock/gomock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TestInvitationMongoRepository_AcceptInvitation tests the AcceptInvitation method of the InvitationMongoRepository
+func TestInvitationMongoRepository_AcceptInvitation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	invitationRepo := repository.NewInvitationMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations: only pending invitations that have not expired can be accepted
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "status": model.InvitationPending, "expires_at": primitive.M{"$gt": now}},
+			primitive.M{"$set": primitive.M{"status": model.InvitationAccepted, "accepted_at": now, "accepted_by": "12345"}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := invitationRepo.AcceptInvitation(ctx, testID, "12345", now)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestInvitationMongoRepository_RevokeInvitation_NotPending tests revoking an invitation that is no longer pending
+func TestInvitationMongoRepository_RevokeInvitation_NotPending(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	invitationRepo := repository.NewInvitationMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "status": model.InvitationPending, "expires_at": primitive.M{"$gt": now}},
+			primitive.M{"$set": primitive.M{"status": model.InvitationRevoked, "revoked_at": now, "revoked_by": "admin"}}).
+		Return(&mongo.UpdateResult{MatchedCount: 0}, nil).
+		Times(1)
+
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": objectID}).
+		Return(mockSingleResult).
+		Times(1)
+
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	err := invitationRepo.RevokeInvitation(ctx, testID, "admin", now)
+
+	// Assertions
+	if !errors.Is(err, repository.ErrInvitationNotPending) {
+		t.Errorf("expected ErrInvitationNotPending, got %v", err)
+	}
+}
+
+// TestInvitationMongoRepository_ListInvitations_Expired tests listing expired invitations, which are stored as pending
+func TestInvitationMongoRepository_ListInvitations_Expired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockCursor := mock.NewMockCursor(ctrl)
+	invitationRepo := repository.NewInvitationMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		Find(ctx,
+			primitive.M{"organization_id": "acme", "status": model.InvitationPending, "expires_at": primitive.M{"$lte": now}},
+			gomock.Any()).
+		Return(mockCursor, nil).
+		Times(1)
+
+	mockCursor.EXPECT().
+		All(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, results interface{}) error {
+			*results.(*[]model.InvitationDB) = []model.InvitationDB{
+				{ID: primitive.NewObjectID(), OrganizationID: "acme", Status: model.InvitationPending, ExpiresAt: now.Add(-time.Hour)},
+			}
+			return nil
+		}).
+		Times(1)
+
+	// Call the method
+	invitations, err := invitationRepo.ListInvitations(ctx, "acme", model.InvitationExpired, now)
+
+	// Assertions
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(invitations) != 1 || invitations[0].StatusAt(now) != model.InvitationExpired {
+		t.Errorf("expected one expired invitation, got %v", invitations)
+	}
+}
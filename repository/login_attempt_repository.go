@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BerryTracer/common-service/adapter/database/mongodb"
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptRepository counts failed sign-in attempts. Counts are shared by
+// every replica of the service.
+type LoginAttemptRepository interface {
+	GetAttempts(ctx context.Context, key string, now time.Time) (*model.LoginAttempts, error)
+	RecordAttempt(ctx context.Context, key string, now, expiresAt time.Time, blockedUntil []time.Time) (*model.LoginAttempts, bool, error)
+	RefundAttempt(ctx context.Context, key string) error
+	ResetAttempts(ctx context.Context, key string) error
+}
+
+type LoginAttemptMongoRepository struct {
+	Collection mongodb.MongoAdapter
+}
+
+// NewLoginAttemptMongoRepository returns a new LoginAttemptMongoRepository.
+func NewLoginAttemptMongoRepository(collection mongodb.MongoAdapter) *LoginAttemptMongoRepository {
+	return &LoginAttemptMongoRepository{Collection: collection}
+}
+
+// GetAttempts implements LoginAttemptRepository. Keys without failures, or
+// whose failures expired at time now, have a count of zero.
+func (r *LoginAttemptMongoRepository) GetAttempts(ctx context.Context, key string, now time.Time) (*model.LoginAttempts, error) {
+	var attemptsDB model.LoginAttemptsDB
+	err := r.Collection.FindOne(ctx, primitive.M{"_id": key, "expires_at": primitive.M{"$gt": now}}).Decode(&attemptsDB)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &model.LoginAttempts{Key: key}, nil
+		}
+		return nil, err
+	}
+
+	return attemptsDB.ToLoginAttempts(), nil
+}
+
+// RecordAttempt implements LoginAttemptRepository. Unless attempts under key
+// are refused at time now, it counts the attempt as a failure, starting over
+// if the previous failures expired, and refuses further attempts until
+// blockedUntil[n] for the new count n, or the last entry for higher counts.
+// Checking and counting are a single write, so that concurrent attempts cannot
+// all pass the check before any of them is counted. It reports whether the
+// attempt was counted, along with the attempts as they are read afterwards.
+func (r *LoginAttemptMongoRepository) RecordAttempt(ctx context.Context, key string, now, expiresAt time.Time, blockedUntil []time.Time) (*model.LoginAttempts, bool, error) {
+	// A missing expires_at compares as lower than any date, so new keys start
+	// at one as well, and a missing blocked_until as lower than now.
+	expired := bson.D{{Key: "$lte", Value: bson.A{"$expires_at", now}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "failures", Value: bson.D{{Key: "$cond", Value: bson.A{expired, 1, bson.D{{Key: "$add", Value: bson.A{"$failures", 1}}}}}}},
+			{Key: "last_failure_at", Value: now},
+			{Key: "expires_at", Value: expiresAt},
+		}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "blocked_until", Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{
+				blockedUntil,
+				bson.D{{Key: "$min", Value: bson.A{"$failures", len(blockedUntil) - 1}}},
+			}}}},
+		}}},
+	}
+	filter := primitive.M{"_id": key, "$or": primitive.A{
+		primitive.M{"expires_at": primitive.M{"$lte": now}},
+		primitive.M{"blocked_until": primitive.M{"$not": primitive.M{"$gt": now}}},
+	}}
+
+	counted, err := r.countAttempt(ctx, filter, update)
+	if err != nil {
+		return nil, false, err
+	}
+	attempts, err := r.findAttempts(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The upsert also collides with a key that a concurrent first attempt
+	// created after the filter missed it. That key does not refuse attempts,
+	// so this one is counted against it on a second try.
+	if !counted && !attempts.IsBlocked(now) {
+		if counted, err = r.countAttempt(ctx, filter, update); err != nil {
+			return nil, false, err
+		}
+		if attempts, err = r.findAttempts(ctx, key); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return attempts, counted, nil
+}
+
+// countAttempt runs the conditional upsert of RecordAttempt and reports whether
+// it counted the attempt. A refused key does not match the filter, so the
+// upsert collides with it.
+func (r *LoginAttemptMongoRepository) countAttempt(ctx context.Context, filter primitive.M, update mongo.Pipeline) (bool, error) {
+	if _, err := r.Collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// findAttempts reads the attempts under key.
+func (r *LoginAttemptMongoRepository) findAttempts(ctx context.Context, key string) (*model.LoginAttempts, error) {
+	var attemptsDB model.LoginAttemptsDB
+	if err := r.Collection.FindOne(ctx, primitive.M{"_id": key}).Decode(&attemptsDB); err != nil {
+		return nil, err
+	}
+	return attemptsDB.ToLoginAttempts(), nil
+}
+
+// RefundAttempt implements LoginAttemptRepository. It takes back an attempt
+// counted by RecordAttempt that did not fail. The delay it caused stays in place.
+func (r *LoginAttemptMongoRepository) RefundAttempt(ctx context.Context, key string) error {
+	_, err := r.Collection.UpdateOne(ctx, primitive.M{"_id": key, "failures": primitive.M{"$gt": 0}}, primitive.M{"$inc": primitive.M{"failures": -1}})
+	return err
+}
+
+// ResetAttempts implements LoginAttemptRepository.
+func (r *LoginAttemptMongoRepository) ResetAttempts(ctx context.Context, key string) error {
+	_, err := r.Collection.DeleteOne(ctx, primitive.M{"_id": key})
+	return err
+}
+
+// Ensure LoginAttemptMongoRepository implements the LoginAttemptRepository interface
+var _ LoginAttemptRepository = &LoginAttemptMongoRepository{}
@@ -0,0 +1,208 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mock "github.com/BerryTracer/common-service/adapter/database/mongodb/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	"github.com/golang/mock/gomock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TestLoginAttemptMongoRepository_RecordAttempt tests the RecordAttempt method of the LoginAttemptMongoRepository
+func TestLoginAttemptMongoRepository_RecordAttempt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	attemptRepo := repository.NewLoginAttemptMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+
+	// Setup mock expectations: the attempt is counted in a conditional upsert, then read back
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.AssignableToTypeOf(primitive.M{}), gomock.AssignableToTypeOf(mongo.Pipeline{}), options.Update().SetUpsert(true)).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": "user:12345"}).
+		Return(mockSingleResult).
+		Times(1)
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		SetArg(0, model.LoginAttemptsDB{Key: "user:12345", Failures: 3, LastFailureAt: now, ExpiresAt: expiresAt}).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	attempts, counted, err := attemptRepo.RecordAttempt(ctx, "user:12345", now, expiresAt, []time.Time{now})
+
+	// Assertions
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !counted {
+		t.Errorf("expected the attempt to be counted")
+	}
+	if attempts.Failures != 3 {
+		t.Errorf("expected 3 failures, got %d", attempts.Failures)
+	}
+}
+
+// TestLoginAttemptMongoRepository_RecordAttempt_Refused tests that attempts under a blocked key are not counted
+func TestLoginAttemptMongoRepository_RecordAttempt_Refused(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	attemptRepo := repository.NewLoginAttemptMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	blockedUntil := now.Add(time.Minute)
+
+	// Setup mock expectations: the blocked key does not match, so the upsert collides with it
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}).
+		Times(1)
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": "user:12345"}).
+		Return(mockSingleResult).
+		Times(1)
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		SetArg(0, model.LoginAttemptsDB{Key: "user:12345", Failures: 7, BlockedUntil: &blockedUntil}).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	attempts, counted, err := attemptRepo.RecordAttempt(ctx, "user:12345", now, now.Add(time.Hour), []time.Time{now})
+
+	// Assertions
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if counted {
+		t.Errorf("expected the attempt not to be counted")
+	}
+	if !attempts.IsBlocked(now) {
+		t.Errorf("expected attempts to be blocked")
+	}
+}
+
+// TestLoginAttemptMongoRepository_RecordAttempt_RacingFirstAttempt tests that an attempt colliding with a key created concurrently is counted on a second try
+func TestLoginAttemptMongoRepository_RecordAttempt_RacingFirstAttempt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	attemptRepo := repository.NewLoginAttemptMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+
+	// Setup mock expectations: the first upsert collides with a key that does not refuse attempts, the second one counts
+	gomock.InOrder(
+		mockMongoAdapter.EXPECT().
+			UpdateOne(ctx, gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}),
+		mockMongoAdapter.EXPECT().FindOne(ctx, primitive.M{"_id": "user:12345"}).Return(mockSingleResult),
+		mockSingleResult.EXPECT().
+			Decode(gomock.Any()).
+			SetArg(0, model.LoginAttemptsDB{Key: "user:12345", Failures: 1, LastFailureAt: now, BlockedUntil: &now, ExpiresAt: expiresAt}).
+			Return(nil),
+		mockMongoAdapter.EXPECT().
+			UpdateOne(ctx, gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil),
+		mockMongoAdapter.EXPECT().FindOne(ctx, primitive.M{"_id": "user:12345"}).Return(mockSingleResult),
+		mockSingleResult.EXPECT().
+			Decode(gomock.Any()).
+			SetArg(0, model.LoginAttemptsDB{Key: "user:12345", Failures: 2, LastFailureAt: now, BlockedUntil: &now, ExpiresAt: expiresAt}).
+			Return(nil),
+	)
+
+	// Call the method
+	attempts, counted, err := attemptRepo.RecordAttempt(ctx, "user:12345", now, expiresAt, []time.Time{now})
+
+	// Assertions
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !counted {
+		t.Errorf("expected the attempt to be counted")
+	}
+	if attempts.Failures != 2 {
+		t.Errorf("expected 2 failures, got %d", attempts.Failures)
+	}
+}
+
+// TestLoginAttemptMongoRepository_GetAttempts_None tests that keys without failures have a count of zero
+func TestLoginAttemptMongoRepository_GetAttempts_None(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	attemptRepo := repository.NewLoginAttemptMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations: expired failures are filtered out
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": "ip:203.0.113.7", "expires_at": primitive.M{"$gt": now}}).
+		Return(mockSingleResult).
+		Times(1)
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(mongo.ErrNoDocuments).
+		Times(1)
+
+	// Call the method
+	attempts, err := attemptRepo.GetAttempts(ctx, "ip:203.0.113.7", now)
+
+	// Assertions
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if attempts.Failures != 0 || attempts.IsBlocked(now) {
+		t.Errorf("expected no failures, got %+v", attempts)
+	}
+}
+
+// TestLoginAttemptMongoRepository_RefundAttempt tests that a refund never takes the count below zero
+func TestLoginAttemptMongoRepository_RefundAttempt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	attemptRepo := repository.NewLoginAttemptMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, primitive.M{"_id": "user:12345", "failures": primitive.M{"$gt": 0}}, primitive.M{"$inc": primitive.M{"failures": -1}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := attemptRepo.RefundAttempt(ctx, "user:12345")
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
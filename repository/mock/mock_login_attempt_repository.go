@@ -0,0 +1,96 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: repository/login_attempt_repository.go
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/BerryTracer/user-service/model"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockLoginAttemptRepository is a mock of LoginAttemptRepository interface.
+type MockLoginAttemptRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginAttemptRepositoryMockRecorder
+}
+
+// MockLoginAttemptRepositoryMockRecorder is the mock recorder for MockLoginAttemptRepository.
+type MockLoginAttemptRepositoryMockRecorder struct {
+	mock *MockLoginAttemptRepository
+}
+
+// NewMockLoginAttemptRepository creates a new mock instance.
+func NewMockLoginAttemptRepository(ctrl *gomock.Controller) *MockLoginAttemptRepository {
+	mock := &MockLoginAttemptRepository{ctrl: ctrl}
+	mock.recorder = &MockLoginAttemptRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginAttemptRepository) EXPECT() *MockLoginAttemptRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetAttempts mocks base method.
+func (m *MockLoginAttemptRepository) GetAttempts(ctx context.Context, key string, now time.Time) (*model.LoginAttempts, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttempts", ctx, key, now)
+	ret0, _ := ret[0].(*model.LoginAttempts)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttempts indicates an expected call of GetAttempts.
+func (mr *MockLoginAttemptRepositoryMockRecorder) GetAttempts(ctx, key, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttempts", reflect.TypeOf((*MockLoginAttemptRepository)(nil).GetAttempts), ctx, key, now)
+}
+
+// RecordAttempt mocks base method.
+func (m *MockLoginAttemptRepository) RecordAttempt(ctx context.Context, key string, now, expiresAt time.Time, blockedUntil []time.Time) (*model.LoginAttempts, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordAttempt", ctx, key, now, expiresAt, blockedUntil)
+	ret0, _ := ret[0].(*model.LoginAttempts)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RecordAttempt indicates an expected call of RecordAttempt.
+func (mr *MockLoginAttemptRepositoryMockRecorder) RecordAttempt(ctx, key, now, expiresAt, blockedUntil interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordAttempt", reflect.TypeOf((*MockLoginAttemptRepository)(nil).RecordAttempt), ctx, key, now, expiresAt, blockedUntil)
+}
+
+// RefundAttempt mocks base method.
+func (m *MockLoginAttemptRepository) RefundAttempt(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefundAttempt", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefundAttempt indicates an expected call of RefundAttempt.
+func (mr *MockLoginAttemptRepositoryMockRecorder) RefundAttempt(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefundAttempt", reflect.TypeOf((*MockLoginAttemptRepository)(nil).RefundAttempt), ctx, key)
+}
+
+// ResetAttempts mocks base method.
+func (m *MockLoginAttemptRepository) ResetAttempts(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetAttempts", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetAttempts indicates an expected call of ResetAttempts.
+func (mr *MockLoginAttemptRepositoryMockRecorder) ResetAttempts(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetAttempts", reflect.TypeOf((*MockLoginAttemptRepository)(nil).ResetAttempts), ctx, key)
+}
@@ -0,0 +1,109 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: repository/refresh_token_repository.go
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	model "github.com/BerryTracer/user-service/model"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRefreshTokenRepository is a mock of RefreshTokenRepository interface.
+type MockRefreshTokenRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockRefreshTokenRepositoryMockRecorder
+}
+
+// MockRefreshTokenRepositoryMockRecorder is the mock recorder for MockRefreshTokenRepository.
+type MockRefreshTokenRepositoryMockRecorder struct {
+	mock *MockRefreshTokenRepository
+}
+
+// NewMockRefreshTokenRepository creates a new mock instance.
+func NewMockRefreshTokenRepository(ctrl *gomock.Controller) *MockRefreshTokenRepository {
+	mock := &MockRefreshTokenRepository{ctrl: ctrl}
+	mock.recorder = &MockRefreshTokenRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRefreshTokenRepository) EXPECT() *MockRefreshTokenRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CreateFamily mocks base method.
+func (m *MockRefreshTokenRepository) CreateFamily(ctx context.Context, family *model.RefreshTokenFamily) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateFamily", ctx, family)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateFamily indicates an expected call of CreateFamily.
+func (mr *MockRefreshTokenRepositoryMockRecorder) CreateFamily(ctx, family interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateFamily", reflect.TypeOf((*MockRefreshTokenRepository)(nil).CreateFamily), ctx, family)
+}
+
+// GetFamily mocks base method.
+func (m *MockRefreshTokenRepository) GetFamily(ctx context.Context, id string) (*model.RefreshTokenFamily, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFamily", ctx, id)
+	ret0, _ := ret[0].(*model.RefreshTokenFamily)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFamily indicates an expected call of GetFamily.
+func (mr *MockRefreshTokenRepositoryMockRecorder) GetFamily(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFamily", reflect.TypeOf((*MockRefreshTokenRepository)(nil).GetFamily), ctx, id)
+}
+
+// GetFamilyByTokenHash mocks base method.
+func (m *MockRefreshTokenRepository) GetFamilyByTokenHash(ctx context.Context, tokenHash string) (*model.RefreshTokenFamily, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFamilyByTokenHash", ctx, tokenHash)
+	ret0, _ := ret[0].(*model.RefreshTokenFamily)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFamilyByTokenHash indicates an expected call of GetFamilyByTokenHash.
+func (mr *MockRefreshTokenRepositoryMockRecorder) GetFamilyByTokenHash(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFamilyByTokenHash", reflect.TypeOf((*MockRefreshTokenRepository)(nil).GetFamilyByTokenHash), ctx, tokenHash)
+}
+
+// RevokeFamily mocks base method.
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, id string, revokedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeFamily", ctx, id, revokedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeFamily indicates an expected call of RevokeFamily.
+func (mr *MockRefreshTokenRepositoryMockRecorder) RevokeFamily(ctx, id, revokedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeFamily", reflect.TypeOf((*MockRefreshTokenRepository)(nil).RevokeFamily), ctx, id, revokedAt)
+}
+
+// Rotate mocks base method.
+func (m *MockRefreshTokenRepository) Rotate(ctx context.Context, id, tokenHash, newTokenHash string, refreshedAt, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rotate", ctx, id, tokenHash, newTokenHash, refreshedAt, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rotate indicates an expected call of Rotate.
+func (mr *MockRefreshTokenRepositoryMockRecorder) Rotate(ctx, id, tokenHash, newTokenHash, refreshedAt, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rotate", reflect.TypeOf((*MockRefreshTokenRepository)(nil).Rotate), ctx, id, tokenHash, newTokenHash, refreshedAt, expiresAt)
+}
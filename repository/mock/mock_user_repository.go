@@ -7,8 +7,10 @@ package mock_repository
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	model "github.com/BerryTracer/user-service/model"
+	repository "github.com/BerryTracer/user-service/repository"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -35,6 +37,49 @@ func (m *MockUserRepository) EXPECT() *MockUserRepositoryMockRecorder {
 	return m.recorder
 }
 
+// AddMembership mocks base method.
+func (m *MockUserRepository) AddMembership(ctx context.Context, id, organizationID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddMembership", ctx, id, organizationID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddMembership indicates an expected call of AddMembership.
+func (mr *MockUserRepositoryMockRecorder) AddMembership(ctx, id, organizationID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMembership", reflect.TypeOf((*MockUserRepository)(nil).AddMembership), ctx, id, organizationID)
+}
+
+// AddRoleAssignment mocks base method.
+func (m *MockUserRepository) AddRoleAssignment(ctx context.Context, id string, assignment model.RoleAssignment) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddRoleAssignment", ctx, id, assignment)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddRoleAssignment indicates an expected call of AddRoleAssignment.
+func (mr *MockUserRepositoryMockRecorder) AddRoleAssignment(ctx, id, assignment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRoleAssignment", reflect.TypeOf((*MockUserRepository)(nil).AddRoleAssignment), ctx, id, assignment)
+}
+
+// BatchGetUsers mocks base method.
+func (m *MockUserRepository) BatchGetUsers(ctx context.Context, ids, emails, usernames []string) ([]*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BatchGetUsers", ctx, ids, emails, usernames)
+	ret0, _ := ret[0].([]*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BatchGetUsers indicates an expected call of BatchGetUsers.
+func (mr *MockUserRepositoryMockRecorder) BatchGetUsers(ctx, ids, emails, usernames interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchGetUsers", reflect.TypeOf((*MockUserRepository)(nil).BatchGetUsers), ctx, ids, emails, usernames)
+}
+
 // CreateUser mocks base method.
 func (m *MockUserRepository) CreateUser(ctx context.Context, user *model.User) error {
 	m.ctrl.T.Helper()
@@ -49,6 +94,78 @@ func (mr *MockUserRepositoryMockRecorder) CreateUser(ctx, user interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserRepository)(nil).CreateUser), ctx, user)
 }
 
+// DeleteUser mocks base method.
+func (m *MockUserRepository) DeleteUser(ctx context.Context, id string, deletedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id, deletedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserRepositoryMockRecorder) DeleteUser(ctx, id, deletedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserRepository)(nil).DeleteUser), ctx, id, deletedAt)
+}
+
+// DisableMFA mocks base method.
+func (m *MockUserRepository) DisableMFA(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableMFA", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableMFA indicates an expected call of DisableMFA.
+func (mr *MockUserRepositoryMockRecorder) DisableMFA(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableMFA", reflect.TypeOf((*MockUserRepository)(nil).DisableMFA), ctx, id)
+}
+
+// EnableMFA mocks base method.
+func (m *MockUserRepository) EnableMFA(ctx context.Context, id string, encryptedSecret []byte, recoveryCodeHashes []string, enabledAt time.Time, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableMFA", ctx, id, encryptedSecret, recoveryCodeHashes, enabledAt, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableMFA indicates an expected call of EnableMFA.
+func (mr *MockUserRepositoryMockRecorder) EnableMFA(ctx, id, encryptedSecret, recoveryCodeHashes, enabledAt, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableMFA", reflect.TypeOf((*MockUserRepository)(nil).EnableMFA), ctx, id, encryptedSecret, recoveryCodeHashes, enabledAt, step)
+}
+
+// FindTakenUsernames mocks base method.
+func (m *MockUserRepository) FindTakenUsernames(ctx context.Context, usernames []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindTakenUsernames", ctx, usernames)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindTakenUsernames indicates an expected call of FindTakenUsernames.
+func (mr *MockUserRepositoryMockRecorder) FindTakenUsernames(ctx, usernames interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindTakenUsernames", reflect.TypeOf((*MockUserRepository)(nil).FindTakenUsernames), ctx, usernames)
+}
+
+// GetDeletedUser mocks base method.
+func (m *MockUserRepository) GetDeletedUser(ctx context.Context, id string) (*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeletedUser", ctx, id)
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeletedUser indicates an expected call of GetDeletedUser.
+func (mr *MockUserRepositoryMockRecorder) GetDeletedUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeletedUser", reflect.TypeOf((*MockUserRepository)(nil).GetDeletedUser), ctx, id)
+}
+
 // GetUserByEmail mocks base method.
 func (m *MockUserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	m.ctrl.T.Helper()
@@ -93,3 +210,215 @@ func (mr *MockUserRepositoryMockRecorder) GetUserByUsername(ctx, name interface{
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByUsername", reflect.TypeOf((*MockUserRepository)(nil).GetUserByUsername), ctx, name)
 }
+
+// GetUserByVerificationToken mocks base method.
+func (m *MockUserRepository) GetUserByVerificationToken(ctx context.Context, tokenHash string) (*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByVerificationToken", ctx, tokenHash)
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByVerificationToken indicates an expected call of GetUserByVerificationToken.
+func (mr *MockUserRepositoryMockRecorder) GetUserByVerificationToken(ctx, tokenHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByVerificationToken", reflect.TypeOf((*MockUserRepository)(nil).GetUserByVerificationToken), ctx, tokenHash)
+}
+
+// ListUsers mocks base method.
+func (m *MockUserRepository) ListUsers(ctx context.Context, query repository.ListUsersQuery) (*repository.UserPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, query)
+	ret0, _ := ret[0].(*repository.UserPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockUserRepositoryMockRecorder) ListUsers(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockUserRepository)(nil).ListUsers), ctx, query)
+}
+
+// MarkEmailVerified mocks base method.
+func (m *MockUserRepository) MarkEmailVerified(ctx context.Context, id, tokenHash string, verifiedAt time.Time, status model.UserStatus) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkEmailVerified", ctx, id, tokenHash, verifiedAt, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkEmailVerified indicates an expected call of MarkEmailVerified.
+func (mr *MockUserRepositoryMockRecorder) MarkEmailVerified(ctx, id, tokenHash, verifiedAt, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkEmailVerified", reflect.TypeOf((*MockUserRepository)(nil).MarkEmailVerified), ctx, id, tokenHash, verifiedAt, status)
+}
+
+// PurgeUser mocks base method.
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeUser", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeUser indicates an expected call of PurgeUser.
+func (mr *MockUserRepositoryMockRecorder) PurgeUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeUser", reflect.TypeOf((*MockUserRepository)(nil).PurgeUser), ctx, id)
+}
+
+// RemoveMembership mocks base method.
+func (m *MockUserRepository) RemoveMembership(ctx context.Context, id, organizationID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveMembership", ctx, id, organizationID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveMembership indicates an expected call of RemoveMembership.
+func (mr *MockUserRepositoryMockRecorder) RemoveMembership(ctx, id, organizationID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMembership", reflect.TypeOf((*MockUserRepository)(nil).RemoveMembership), ctx, id, organizationID)
+}
+
+// RemoveRoleAssignment mocks base method.
+func (m *MockUserRepository) RemoveRoleAssignment(ctx context.Context, id, role string, scope model.Scope) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveRoleAssignment", ctx, id, role, scope)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveRoleAssignment indicates an expected call of RemoveRoleAssignment.
+func (mr *MockUserRepositoryMockRecorder) RemoveRoleAssignment(ctx, id, role, scope interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveRoleAssignment", reflect.TypeOf((*MockUserRepository)(nil).RemoveRoleAssignment), ctx, id, role, scope)
+}
+
+// RestoreUser mocks base method.
+func (m *MockUserRepository) RestoreUser(ctx context.Context, id string, status model.UserStatus, restoredAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUser", ctx, id, status, restoredAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreUser indicates an expected call of RestoreUser.
+func (mr *MockUserRepositoryMockRecorder) RestoreUser(ctx, id, status, restoredAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUser", reflect.TypeOf((*MockUserRepository)(nil).RestoreUser), ctx, id, status, restoredAt)
+}
+
+// SetEmailVerification mocks base method.
+func (m *MockUserRepository) SetEmailVerification(ctx context.Context, id string, verification model.EmailVerification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetEmailVerification", ctx, id, verification)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetEmailVerification indicates an expected call of SetEmailVerification.
+func (mr *MockUserRepositoryMockRecorder) SetEmailVerification(ctx, id, verification interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetEmailVerification", reflect.TypeOf((*MockUserRepository)(nil).SetEmailVerification), ctx, id, verification)
+}
+
+// StartMFAEnrollment mocks base method.
+func (m *MockUserRepository) StartMFAEnrollment(ctx context.Context, id string, encryptedSecret []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartMFAEnrollment", ctx, id, encryptedSecret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StartMFAEnrollment indicates an expected call of StartMFAEnrollment.
+func (mr *MockUserRepositoryMockRecorder) StartMFAEnrollment(ctx, id, encryptedSecret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartMFAEnrollment", reflect.TypeOf((*MockUserRepository)(nil).StartMFAEnrollment), ctx, id, encryptedSecret)
+}
+
+// UpdateHashedPassword mocks base method.
+func (m *MockUserRepository) UpdateHashedPassword(ctx context.Context, id, hashedPassword string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateHashedPassword", ctx, id, hashedPassword)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateHashedPassword indicates an expected call of UpdateHashedPassword.
+func (mr *MockUserRepositoryMockRecorder) UpdateHashedPassword(ctx, id, hashedPassword interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateHashedPassword", reflect.TypeOf((*MockUserRepository)(nil).UpdateHashedPassword), ctx, id, hashedPassword)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id, hashedPassword string, changedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, id, hashedPassword, changedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockUserRepositoryMockRecorder) UpdatePassword(ctx, id, hashedPassword, changedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockUserRepository)(nil).UpdatePassword), ctx, id, hashedPassword, changedAt)
+}
+
+// UpdateStatus mocks base method.
+func (m *MockUserRepository) UpdateStatus(ctx context.Context, id string, from model.UserStatus, change model.StatusChange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateStatus", ctx, id, from, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateStatus indicates an expected call of UpdateStatus.
+func (mr *MockUserRepositoryMockRecorder) UpdateStatus(ctx, id, from, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateStatus", reflect.TypeOf((*MockUserRepository)(nil).UpdateStatus), ctx, id, from, change)
+}
+
+// UpdateUser mocks base method.
+func (m *MockUserRepository) UpdateUser(ctx context.Context, user *model.User, expectedVersion int64, emailChanged bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", ctx, user, expectedVersion, emailChanged)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockUserRepositoryMockRecorder) UpdateUser(ctx, user, expectedVersion, emailChanged interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockUserRepository)(nil).UpdateUser), ctx, user, expectedVersion, emailChanged)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockUserRepository) UseRecoveryCode(ctx context.Context, id, codeHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, id, codeHash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockUserRepositoryMockRecorder) UseRecoveryCode(ctx, id, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockUserRepository)(nil).UseRecoveryCode), ctx, id, codeHash)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockUserRepository) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", ctx, id, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockUserRepositoryMockRecorder) UseTOTPStep(ctx, id, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockUserRepository)(nil).UseTOTPStep), ctx, id, step)
+}
@@ -0,0 +1,104 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: repository/user_watcher.go
+
+// Package mock_repository is a generated GoMock package.
+package mock_repository
+
+import (
+	context "context"
+	reflect "reflect"
+
+	model "github.com/BerryTracer/user-service/model"
+	repository "github.com/BerryTracer/user-service/repository"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockUserWatcher is a mock of UserWatcher interface.
+type MockUserWatcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserWatcherMockRecorder
+}
+
+// MockUserWatcherMockRecorder is the mock recorder for MockUserWatcher.
+type MockUserWatcherMockRecorder struct {
+	mock *MockUserWatcher
+}
+
+// NewMockUserWatcher creates a new mock instance.
+func NewMockUserWatcher(ctrl *gomock.Controller) *MockUserWatcher {
+	mock := &MockUserWatcher{ctrl: ctrl}
+	mock.recorder = &MockUserWatcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserWatcher) EXPECT() *MockUserWatcherMockRecorder {
+	return m.recorder
+}
+
+// WatchUsers mocks base method.
+func (m *MockUserWatcher) WatchUsers(ctx context.Context, resumeToken string) (repository.UserChangeStream, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WatchUsers", ctx, resumeToken)
+	ret0, _ := ret[0].(repository.UserChangeStream)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WatchUsers indicates an expected call of WatchUsers.
+func (mr *MockUserWatcherMockRecorder) WatchUsers(ctx, resumeToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WatchUsers", reflect.TypeOf((*MockUserWatcher)(nil).WatchUsers), ctx, resumeToken)
+}
+
+// MockUserChangeStream is a mock of UserChangeStream interface.
+type MockUserChangeStream struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserChangeStreamMockRecorder
+}
+
+// MockUserChangeStreamMockRecorder is the mock recorder for MockUserChangeStream.
+type MockUserChangeStreamMockRecorder struct {
+	mock *MockUserChangeStream
+}
+
+// NewMockUserChangeStream creates a new mock instance.
+func NewMockUserChangeStream(ctrl *gomock.Controller) *MockUserChangeStream {
+	mock := &MockUserChangeStream{ctrl: ctrl}
+	mock.recorder = &MockUserChangeStreamMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserChangeStream) EXPECT() *MockUserChangeStreamMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockUserChangeStream) Close(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockUserChangeStreamMockRecorder) Close(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockUserChangeStream)(nil).Close), ctx)
+}
+
+// Next mocks base method.
+func (m *MockUserChangeStream) Next(ctx context.Context) (*model.UserChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Next", ctx)
+	ret0, _ := ret[0].(*model.UserChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Next indicates an expected call of Next.
+func (mr *MockUserChangeStreamMockRecorder) Next(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Next", reflect.TypeOf((*MockUserChangeStream)(nil).Next), ctx)
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/BerryTracer/common-service/adapter/database/mongodb"
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrOrganizationNotFound is returned when no organization matches a lookup.
+var ErrOrganizationNotFound = errors.New("organization not found")
+
+// OrganizationRepository stores organizations. Their members are stored on
+// the users; see UserRepository.AddMembership.
+type OrganizationRepository interface {
+	CreateOrganization(ctx context.Context, organization *model.Organization) error
+	GetOrganization(ctx context.Context, id string) (*model.Organization, error)
+}
+
+type OrganizationMongoRepository struct {
+	Collection mongodb.MongoAdapter
+}
+
+// NewOrganizationMongoRepository returns a new OrganizationMongoRepository.
+func NewOrganizationMongoRepository(collection mongodb.MongoAdapter) *OrganizationMongoRepository {
+	return &OrganizationMongoRepository{Collection: collection}
+}
+
+// CreateOrganization implements OrganizationRepository.
+func (r *OrganizationMongoRepository) CreateOrganization(ctx context.Context, organization *model.Organization) error {
+	organizationDB, err := organization.ToOrganizationDB()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Collection.InsertOne(ctx, organizationDB)
+	return err
+}
+
+// GetOrganization implements OrganizationRepository. Malformed IDs match no
+// organization, as tenant IDs come from request metadata.
+func (r *OrganizationMongoRepository) GetOrganization(ctx context.Context, id string) (*model.Organization, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrOrganizationNotFound
+	}
+
+	var organizationDB model.OrganizationDB
+	if err := r.Collection.FindOne(ctx, primitive.M{"_id": objectID}).Decode(&organizationDB); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+
+	return organizationDB.ToOrganization(), nil
+}
+
+// Ensure OrganizationMongoRepository implements the OrganizationRepository interface
+var _ OrganizationRepository = &OrganizationMongoRepository{}
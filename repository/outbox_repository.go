@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/BerryTracer/common-service/adapter/database/mongodb"
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OutboxRepository stores user events until they are published. Events are
+// appended in the same transaction as the user writes they describe.
+type OutboxRepository interface {
+	Append(ctx context.Context, events ...*model.Event) error
+	FetchPending(ctx context.Context, limit int) ([]*model.Event, error)
+	Claim(ctx context.Context, id string, now, until time.Time) (bool, error)
+	MarkPublished(ctx context.Context, id string, publishedAt time.Time) error
+	RecordFailure(ctx context.Context, id string, attempts int, nextAttemptAt time.Time, lastError string) error
+}
+
+type OutboxMongoRepository struct {
+	Collection mongodb.MongoAdapter
+}
+
+// NewOutboxMongoRepository returns a new OutboxMongoRepository.
+func NewOutboxMongoRepository(collection mongodb.MongoAdapter) *OutboxMongoRepository {
+	return &OutboxMongoRepository{Collection: collection}
+}
+
+// Append implements OutboxRepository.
+func (r *OutboxMongoRepository) Append(ctx context.Context, events ...*model.Event) error {
+	for _, event := range events {
+		eventDB, err := event.ToEventDB()
+		if err != nil {
+			return err
+		}
+
+		if _, err := r.Collection.InsertOne(ctx, eventDB); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FetchPending implements OutboxRepository. It returns unpublished events,
+// oldest first, whether or not they are due: an event that is not due still
+// holds back the later events of its user.
+func (r *OutboxMongoRepository) FetchPending(ctx context.Context, limit int) ([]*model.Event, error) {
+	filter := primitive.M{"published_at": nil}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := r.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var eventsDB []model.EventDB
+	if err := cursor.All(ctx, &eventsDB); err != nil {
+		return nil, err
+	}
+
+	events := make([]*model.Event, 0, len(eventsDB))
+	for i := range eventsDB {
+		events = append(events, eventsDB[i].ToEvent())
+	}
+
+	return events, nil
+}
+
+// Claim implements OutboxRepository. It leases a due event to the caller until
+// the given time, and reports false if another relay claimed it first. An event
+// whose relay died before publishing it becomes due again once the lease ends.
+func (r *OutboxMongoRepository) Claim(ctx context.Context, id string, now, until time.Time) (bool, error) {
+	objectID, err := parseID(id)
+	if err != nil {
+		return false, err
+	}
+
+	filter := primitive.M{"_id": objectID, "published_at": nil, "next_attempt_at": primitive.M{"$lte": now}}
+	result, err := r.Collection.UpdateOne(ctx, filter, primitive.M{"$set": primitive.M{"next_attempt_at": until}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// MarkPublished implements OutboxRepository. Published events are removed by
+// the TTL index on published_at once their retention has passed.
+func (r *OutboxMongoRepository) MarkPublished(ctx context.Context, id string, publishedAt time.Time) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Collection.UpdateOne(ctx, primitive.M{"_id": objectID}, primitive.M{"$set": primitive.M{"published_at": publishedAt}})
+	return err
+}
+
+// RecordFailure implements OutboxRepository.
+func (r *OutboxMongoRepository) RecordFailure(ctx context.Context, id string, attempts int, nextAttemptAt time.Time, lastError string) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	update := primitive.M{"$set": primitive.M{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}}
+	_, err = r.Collection.UpdateOne(ctx, primitive.M{"_id": objectID}, update)
+	return err
+}
+
+// Ensure OutboxMongoRepository implements the OutboxRepository interface
+var _ OutboxRepository = &OutboxMongoRepository{}
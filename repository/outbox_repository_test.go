@@ -0,0 +1,109 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mock "github.com/BerryTracer/common-service/adapter/database/mongodb/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	"github.com/golang/mock/gomock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TestOutboxMongoRepository_Append tests the Append method of the OutboxMongoRepository
+func TestOutboxMongoRepository_Append(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	outboxRepo := repository.NewOutboxMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := model.NewUserIDEvent(model.EventUserDeleted, primitive.NewObjectID().Hex(), at)
+
+	eventDB, _ := event.ToEventDB()
+
+	// Setup mock expectations: new events are due right away
+	if !eventDB.NextAttemptAt.Equal(at) || eventDB.PublishedAt != nil {
+		t.Errorf("expected a pending event due at %v, got %+v", at, eventDB)
+	}
+	mockMongoAdapter.EXPECT().
+		InsertOne(ctx, eventDB, gomock.Any()).
+		Return(&mongo.InsertOneResult{InsertedID: eventDB.ID}, nil).
+		Times(1)
+
+	// Call the method
+	err := outboxRepo.Append(ctx, event)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestOutboxMongoRepository_Claim tests the Claim method of the OutboxMongoRepository
+func TestOutboxMongoRepository_Claim(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	outboxRepo := repository.NewOutboxMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	until := now.Add(30 * time.Second)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "published_at": nil, "next_attempt_at": primitive.M{"$lte": now}},
+			primitive.M{"$set": primitive.M{"next_attempt_at": until}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	claimed, err := outboxRepo.Claim(ctx, testID, now, until)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if !claimed {
+		t.Errorf("expected the event to be claimed")
+	}
+}
+
+// TestOutboxMongoRepository_Claim_AlreadyClaimed tests the Claim method of the OutboxMongoRepository
+func TestOutboxMongoRepository_Claim_AlreadyClaimed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	outboxRepo := repository.NewOutboxMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations: another relay moved next_attempt_at past now
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+
+	// Call the method
+	claimed, err := outboxRepo.Claim(ctx, primitive.NewObjectID().Hex(), now, now.Add(time.Minute))
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if claimed {
+		t.Errorf("expected the event not to be claimed")
+	}
+}
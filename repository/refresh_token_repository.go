@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BerryTracer/common-service/adapter/database/mongodb"
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrRefreshTokenNotFound is returned when no refresh token family matches a
+// lookup, or a rotation lost the race against a concurrent one.
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// RefreshTokenRepository stores refresh token families. Tokens are only ever
+// stored hashed.
+type RefreshTokenRepository interface {
+	CreateFamily(ctx context.Context, family *model.RefreshTokenFamily) error
+	GetFamily(ctx context.Context, id string) (*model.RefreshTokenFamily, error)
+	GetFamilyByTokenHash(ctx context.Context, tokenHash string) (*model.RefreshTokenFamily, error)
+	Rotate(ctx context.Context, id, tokenHash, newTokenHash string, refreshedAt, expiresAt time.Time) error
+	RevokeFamily(ctx context.Context, id string, revokedAt time.Time) error
+}
+
+type RefreshTokenMongoRepository struct {
+	Collection mongodb.MongoAdapter
+}
+
+// NewRefreshTokenMongoRepository returns a new RefreshTokenMongoRepository.
+func NewRefreshTokenMongoRepository(collection mongodb.MongoAdapter) *RefreshTokenMongoRepository {
+	return &RefreshTokenMongoRepository{Collection: collection}
+}
+
+// CreateFamily implements RefreshTokenRepository.
+func (r *RefreshTokenMongoRepository) CreateFamily(ctx context.Context, family *model.RefreshTokenFamily) error {
+	familyDB, err := family.ToRefreshTokenFamilyDB()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Collection.InsertOne(ctx, familyDB)
+	return err
+}
+
+// GetFamily implements RefreshTokenRepository.
+func (r *RefreshTokenMongoRepository) GetFamily(ctx context.Context, id string) (*model.RefreshTokenFamily, error) {
+	objectID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.findOne(ctx, primitive.M{"_id": objectID})
+}
+
+// GetFamilyByTokenHash implements RefreshTokenRepository. It matches the current
+// token of a family as well as the tokens it replaced, so callers can tell a
+// reused token from an unknown one.
+func (r *RefreshTokenMongoRepository) GetFamilyByTokenHash(ctx context.Context, tokenHash string) (*model.RefreshTokenFamily, error) {
+	return r.findOne(ctx, primitive.M{"$or": primitive.A{
+		primitive.M{"token_hash": tokenHash},
+		primitive.M{"previous_token_hashes": tokenHash},
+	}})
+}
+
+func (r *RefreshTokenMongoRepository) findOne(ctx context.Context, filter primitive.M) (*model.RefreshTokenFamily, error) {
+	var familyDB model.RefreshTokenFamilyDB
+	if err := r.Collection.FindOne(ctx, filter).Decode(&familyDB); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+
+	return familyDB.ToRefreshTokenFamily(), nil
+}
+
+// Rotate implements RefreshTokenRepository. It replaces the current token of
+// the family, provided it is still tokenHash and the family is not revoked.
+func (r *RefreshTokenMongoRepository) Rotate(ctx context.Context, id, tokenHash, newTokenHash string, refreshedAt, expiresAt time.Time) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := primitive.M{"_id": objectID, "token_hash": tokenHash, "revoked_at": nil}
+	update := primitive.M{
+		"$set": primitive.M{"token_hash": newTokenHash, "refreshed_at": refreshedAt, "expires_at": expiresAt},
+		"$push": primitive.M{"previous_token_hashes": primitive.M{
+			"$each":  primitive.A{tokenHash},
+			"$slice": -model.MaxPreviousTokenHashes,
+		}},
+	}
+
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRefreshTokenNotFound
+	}
+
+	return nil
+}
+
+// RevokeFamily implements RefreshTokenRepository. Revoking a revoked family
+// keeps its original revocation time.
+func (r *RefreshTokenMongoRepository) RevokeFamily(ctx context.Context, id string, revokedAt time.Time) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.Collection.UpdateOne(ctx,
+		primitive.M{"_id": objectID, "revoked_at": nil},
+		primitive.M{"$set": primitive.M{"revoked_at": revokedAt}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		// Either the family does not exist or it is already revoked.
+		_, err := r.GetFamily(ctx, id)
+		return err
+	}
+
+	return nil
+}
+
+// Ensure RefreshTokenMongoRepository implements the RefreshTokenRepository interface
+var _ RefreshTokenRepository = &RefreshTokenMongoRepository{}
@@ -0,0 +1,122 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mock "github.com/BerryTracer/common-service/adapter/database/mongodb/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	"github.com/golang/mock/gomock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TestRefreshTokenMongoRepository_Rotate tests the Rotate method of the RefreshTokenMongoRepository
+func TestRefreshTokenMongoRepository_Rotate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	refreshTokenRepo := repository.NewRefreshTokenMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expiresAt := now.Add(24 * time.Hour)
+
+	// Setup mock expectations: only the current token of an unrevoked family rotates
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "token_hash": "old", "revoked_at": nil},
+			primitive.M{
+				"$set": primitive.M{"token_hash": "new", "refreshed_at": now, "expires_at": expiresAt},
+				"$push": primitive.M{"previous_token_hashes": primitive.M{
+					"$each":  primitive.A{"old"},
+					"$slice": -model.MaxPreviousTokenHashes,
+				}},
+			}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := refreshTokenRepo.Rotate(ctx, testID, "old", "new", now, expiresAt)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestRefreshTokenMongoRepository_Rotate_LostRace tests rotating a token that was already replaced
+func TestRefreshTokenMongoRepository_Rotate_LostRace(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	refreshTokenRepo := repository.NewRefreshTokenMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any()).
+		Return(&mongo.UpdateResult{MatchedCount: 0}, nil).
+		Times(1)
+
+	// Call the method
+	err := refreshTokenRepo.Rotate(ctx, primitive.NewObjectID().Hex(), "old", "new", now, now.Add(time.Hour))
+
+	// Assertions
+	if !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		t.Errorf("expected ErrRefreshTokenNotFound, got %v", err)
+	}
+}
+
+// TestRefreshTokenMongoRepository_GetFamilyByTokenHash tests that replaced tokens still find their family
+func TestRefreshTokenMongoRepository_GetFamilyByTokenHash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	refreshTokenRepo := repository.NewRefreshTokenMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	familyDB := model.RefreshTokenFamilyDB{
+		ID:                  primitive.NewObjectID(),
+		UserID:              "12345",
+		TokenHash:           "current",
+		PreviousTokenHashes: []string{"old"},
+	}
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"$or": primitive.A{
+			primitive.M{"token_hash": "old"},
+			primitive.M{"previous_token_hashes": "old"},
+		}}).
+		Return(mockSingleResult).
+		Times(1)
+
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		SetArg(0, familyDB).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	family, err := refreshTokenRepo.GetFamilyByTokenHash(ctx, "old")
+
+	// Assertions
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if family.ID != familyDB.ID.Hex() || family.TokenHash != "current" {
+		t.Errorf("expected family %s with current token, got %+v", familyDB.ID.Hex(), family)
+	}
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BerryTracer/common-service/adapter/database/mongodb"
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrSessionNotFound is returned when no session matches a lookup or write.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRepository stores the sessions of users.
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *model.Session) error
+	GetSession(ctx context.Context, id string) (*model.Session, error)
+	ListSessions(ctx context.Context, userID string, now time.Time) ([]*model.Session, error)
+	TouchSession(ctx context.Context, id string, device model.SessionDevice, seenAt, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, id string, revokedAt time.Time) error
+}
+
+type SessionMongoRepository struct {
+	Collection mongodb.MongoAdapter
+}
+
+// NewSessionMongoRepository returns a new SessionMongoRepository.
+func NewSessionMongoRepository(collection mongodb.MongoAdapter) *SessionMongoRepository {
+	return &SessionMongoRepository{Collection: collection}
+}
+
+// CreateSession implements SessionRepository.
+func (r *SessionMongoRepository) CreateSession(ctx context.Context, session *model.Session) error {
+	sessionDB, err := session.ToSessionDB()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Collection.InsertOne(ctx, sessionDB)
+	return err
+}
+
+// GetSession implements SessionRepository. Revoked and expired sessions are
+// returned as well.
+func (r *SessionMongoRepository) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	objectID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionDB model.SessionDB
+	if err := r.Collection.FindOne(ctx, primitive.M{"_id": objectID}).Decode(&sessionDB); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return sessionDB.ToSession(), nil
+}
+
+// ListSessions implements SessionRepository. It returns the sessions of the
+// user that are active at time now, most recently seen first.
+func (r *SessionMongoRepository) ListSessions(ctx context.Context, userID string, now time.Time) ([]*model.Session, error) {
+	filter := primitive.M{"user_id": userID, "revoked_at": nil, "expires_at": primitive.M{"$gt": now}}
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+
+	cursor, err := r.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionsDB []model.SessionDB
+	if err := cursor.All(ctx, &sessionsDB); err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*model.Session, 0, len(sessionsDB))
+	for i := range sessionsDB {
+		sessions = append(sessions, sessionsDB[i].ToSession())
+	}
+
+	return sessions, nil
+}
+
+// TouchSession implements SessionRepository. It records that the session was
+// used at seenAt from device, whose name is kept from sign-in.
+func (r *SessionMongoRepository) TouchSession(ctx context.Context, id string, device model.SessionDevice, seenAt, expiresAt time.Time) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	set := primitive.M{"last_seen_at": seenAt, "expires_at": expiresAt}
+	if device.UserAgent != "" {
+		set["user_agent"] = device.UserAgent
+	}
+	if device.IP != "" {
+		set["ip"] = device.IP
+	}
+
+	result, err := r.Collection.UpdateOne(ctx, primitive.M{"_id": objectID, "revoked_at": nil}, primitive.M{"$set": set})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeSession implements SessionRepository. Revoking a revoked session keeps
+// its original revocation time.
+func (r *SessionMongoRepository) RevokeSession(ctx context.Context, id string, revokedAt time.Time) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.Collection.UpdateOne(ctx,
+		primitive.M{"_id": objectID, "revoked_at": nil},
+		primitive.M{"$set": primitive.M{"revoked_at": revokedAt}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		// Either the session does not exist or it is already revoked.
+		_, err := r.GetSession(ctx, id)
+		return err
+	}
+
+	return nil
+}
+
+// Ensure SessionMongoRepository implements the SessionRepository interface
+var _ SessionRepository = &SessionMongoRepository{}
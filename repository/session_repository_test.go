@@ -0,0 +1,87 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mock "github.com/BerryTracer/common-service/adapter/database/mongodb/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	"github.com/golang/mock/gomock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TestSessionMongoRepository_TouchSession tests the TouchSession method of the SessionMongoRepository
+func TestSessionMongoRepository_TouchSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	sessionRepo := repository.NewSessionMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	expiresAt := now.Add(24 * time.Hour)
+
+	// Setup mock expectations: the device name is kept, and an unknown user agent does not clear the known one
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "revoked_at": nil},
+			primitive.M{"$set": primitive.M{"last_seen_at": now, "expires_at": expiresAt, "ip": "203.0.113.7"}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := sessionRepo.TouchSession(ctx, testID, model.SessionDevice{Name: "ignored", IP: "203.0.113.7"}, now, expiresAt)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestSessionMongoRepository_RevokeSession_NotFound tests revoking a session that does not exist
+func TestSessionMongoRepository_RevokeSession_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	sessionRepo := repository.NewSessionMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "revoked_at": nil},
+			primitive.M{"$set": primitive.M{"revoked_at": now}}).
+		Return(&mongo.UpdateResult{MatchedCount: 0}, nil).
+		Times(1)
+
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": objectID}).
+		Return(mockSingleResult).
+		Times(1)
+
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(mongo.ErrNoDocuments).
+		Times(1)
+
+	// Call the method
+	err := sessionRepo.RevokeSession(ctx, testID, now)
+
+	// Assertions
+	if !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+}
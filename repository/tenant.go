@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context scoping user queries to the members of the
+// organization with the given ID. An empty ID removes the scope.
+func WithTenant(ctx context.Context, organizationID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, organizationID)
+}
+
+// TenantFromContext returns the organization user queries in ctx are scoped to.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	organizationID, _ := ctx.Value(tenantKey{}).(string)
+	return organizationID, organizationID != ""
+}
+
+// scopeFilter restricts filter to the members of the tenant in ctx, if any.
+func scopeFilter(ctx context.Context, filter primitive.M) primitive.M {
+	if organizationID, ok := TenantFromContext(ctx); ok {
+		filter["org_ids"] = organizationID
+	}
+	return filter
+}
+
+// withoutTenant returns ctx with its tenant scope, if any, removed.
+func withoutTenant(ctx context.Context) context.Context {
+	if _, ok := TenantFromContext(ctx); !ok {
+		return ctx
+	}
+	return WithTenant(ctx, "")
+}
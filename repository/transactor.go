@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactor runs a function inside a database transaction. Repository calls
+// made with the context passed to fn take part in the transaction.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// commitHooksKey is the context key of the hooks of the current transaction.
+type commitHooksKey struct{}
+
+// commitHooks collects the functions to run once a transaction commits.
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// withCommitHooks returns ctx carrying a fresh set of hooks.
+func withCommitHooks(ctx context.Context) (context.Context, *commitHooks) {
+	hooks := &commitHooks{}
+	return context.WithValue(ctx, commitHooksKey{}, hooks), hooks
+}
+
+func (h *commitHooks) run() {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// AfterCommit registers fn to run once the transaction ctx takes part in has
+// committed, and reports whether it did. fn is dropped if the transaction
+// aborts. Nothing is registered when ctx takes part in no transaction.
+func AfterCommit(ctx context.Context, fn func()) bool {
+	hooks, ok := ctx.Value(commitHooksKey{}).(*commitHooks)
+	if !ok {
+		return false
+	}
+
+	hooks.mu.Lock()
+	defer hooks.mu.Unlock()
+	hooks.fns = append(hooks.fns, fn)
+	return true
+}
+
+type MongoTransactor struct {
+	Client *mongo.Client
+}
+
+// NewMongoTransactor returns a new MongoTransactor. Mongo only supports
+// transactions on replica sets and sharded clusters.
+func NewMongoTransactor(client *mongo.Client) *MongoTransactor {
+	return &MongoTransactor{Client: client}
+}
+
+// WithTransaction implements Transactor. The driver retries fn on transient
+// transaction errors, so fn must be safe to run more than once. Only the hooks
+// registered by the attempt that committed are run; see AfterCommit.
+func (t *MongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	var hooks *commitHooks
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		var txCtx context.Context
+		txCtx, hooks = withCommitHooks(sessionCtx)
+		return nil, fn(txCtx)
+	})
+	if err != nil {
+		return err
+	}
+
+	hooks.run()
+	return nil
+}
+
+// NoTransaction runs functions directly, without a transaction. It stands in
+// for a Transactor in tests and against standalone Mongo servers.
+type NoTransaction struct{}
+
+// WithTransaction implements Transactor. Every write is committed as it is
+// made, so AfterCommit registers nothing in fn.
+func (NoTransaction) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// Ensure MongoTransactor and NoTransaction implement the Transactor interface
+var (
+	_ Transactor = &MongoTransactor{}
+	_ Transactor = NoTransaction{}
+)
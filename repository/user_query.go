@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"regexp"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserSortField selects the field users are listed by. Ties are always broken by ID.
+type UserSortField int
+
+const (
+	SortByCreatedAt UserSortField = iota
+	SortByUsername
+	SortByEmail
+)
+
+// ListUsersQuery filters and orders a page of users. Zero-valued filters are
+// ignored, except that deleted users are only listed when Status asks for them.
+// Prefixes are matched against canonical usernames and emails.
+type ListUsersQuery struct {
+	UsernamePrefix string
+	EmailPrefix    string
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	Status         model.UserStatus
+	SortBy         UserSortField
+	Descending     bool
+	PageSize       int
+	Cursor         string
+}
+
+// UserPage is a single page of users. NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []*model.User
+	NextCursor string
+}
+
+// pageCursor is the decoded form of an opaque page cursor. It records the sort
+// key and ID of the last user on the previous page.
+type pageCursor struct {
+	SortBy UserSortField `json:"s"`
+	Key    string        `json:"k,omitempty"`
+	ID     string        `json:"id"`
+}
+
+// sortKey returns the document field the query is ordered by.
+func (q ListUsersQuery) sortKey() string {
+	switch q.SortBy {
+	case SortByUsername:
+		return "username"
+	case SortByEmail:
+		return "email"
+	default:
+		return "_id"
+	}
+}
+
+// filter builds the Mongo filter for the query, including the position of the cursor.
+func (q ListUsersQuery) filter() (primitive.M, error) {
+	conditions := primitive.A{}
+
+	switch q.Status {
+	case model.UserStatusDeleted:
+		conditions = append(conditions, primitive.M{"deleted_at": primitive.M{"$ne": nil}})
+	case "":
+		conditions = append(conditions, primitive.M{"deleted_at": nil})
+	default:
+		conditions = append(conditions, primitive.M{"deleted_at": nil, "status": statusFilter(q.Status)})
+	}
+
+	if q.UsernamePrefix != "" {
+		conditions = append(conditions, primitive.M{"username_canonical": prefixRegex(q.UsernamePrefix)})
+	}
+	if q.EmailPrefix != "" {
+		conditions = append(conditions, primitive.M{"email_canonical": prefixRegex(q.EmailPrefix)})
+	}
+
+	// ObjectIDs embed their creation time, so creation filters are ranges on _id.
+	if !q.CreatedAfter.IsZero() {
+		conditions = append(conditions, primitive.M{"_id": primitive.M{"$gte": objectIDAt(q.CreatedAfter)}})
+	}
+	if !q.CreatedBefore.IsZero() {
+		conditions = append(conditions, primitive.M{"_id": primitive.M{"$lt": objectIDAt(q.CreatedBefore)}})
+	}
+
+	if q.Cursor != "" {
+		condition, err := q.cursorCondition()
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return primitive.M{"$and": conditions}, nil
+}
+
+// cursorCondition matches users strictly after the cursor position in the query's sort order.
+func (q ListUsersQuery) cursorCondition() (primitive.M, error) {
+	cursor, err := decodeCursor(q.Cursor)
+	if err != nil || cursor.SortBy != q.SortBy {
+		return nil, ErrInvalidCursor
+	}
+
+	lastID, err := primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	after := "$gt"
+	if q.Descending {
+		after = "$lt"
+	}
+
+	if q.SortBy == SortByCreatedAt {
+		return primitive.M{"_id": primitive.M{after: lastID}}, nil
+	}
+
+	key := q.sortKey()
+	return primitive.M{"$or": primitive.A{
+		primitive.M{key: primitive.M{after: cursor.Key}},
+		primitive.M{key: cursor.Key, "_id": primitive.M{after: lastID}},
+	}}, nil
+}
+
+// findOptions sorts by the query's sort key with ID as tie-breaker, and fetches
+// one extra document to learn whether another page follows.
+func (q ListUsersQuery) findOptions() *options.FindOptions {
+	direction := 1
+	if q.Descending {
+		direction = -1
+	}
+
+	sort := bson.D{{Key: "_id", Value: direction}}
+	if key := q.sortKey(); key != "_id" {
+		sort = bson.D{{Key: key, Value: direction}, {Key: "_id", Value: direction}}
+	}
+
+	return options.Find().SetSort(sort).SetLimit(int64(q.PageSize) + 1)
+}
+
+// nextCursor encodes the position of the given user, the last one on a page.
+func (q ListUsersQuery) nextCursor(last *model.User) string {
+	cursor := pageCursor{SortBy: q.SortBy, ID: last.ID}
+
+	switch q.SortBy {
+	case SortByUsername:
+		cursor.Key = last.Username
+	case SortByEmail:
+		cursor.Key = last.Email
+	}
+
+	return encodeCursor(cursor)
+}
+
+func encodeCursor(cursor pageCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var cursor pageCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+
+	err = json.Unmarshal(raw, &cursor)
+	return cursor, err
+}
+
+// prefixRegex matches strings starting with the literal prefix.
+func prefixRegex(prefix string) primitive.Regex {
+	return primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)}
+}
+
+// objectIDAt returns the smallest ObjectID created at t, for use as a range boundary.
+// Unlike primitive.NewObjectIDFromTimestamp it leaves the non-timestamp bytes zeroed.
+func objectIDAt(t time.Time) primitive.ObjectID {
+	var id primitive.ObjectID
+	binary.BigEndian.PutUint32(id[0:4], uint32(t.Unix()))
+	return id
+}
@@ -2,10 +2,12 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/BerryTracer/common-service/adapter/database/mongodb"
 	"github.com/BerryTracer/user-service/model"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserRepository interface {
@@ -13,10 +15,38 @@ type UserRepository interface {
 	GetUserById(ctx context.Context, id string) (*model.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
 	GetUserByUsername(ctx context.Context, name string) (*model.User, error)
+	UpdateHashedPassword(ctx context.Context, id string, hashedPassword string) error
+	UpdateUser(ctx context.Context, user *model.User, expectedVersion int64, emailChanged bool) error
+	UpdatePassword(ctx context.Context, id string, hashedPassword string, changedAt time.Time) error
+	DeleteUser(ctx context.Context, id string, deletedAt time.Time) error
+	GetDeletedUser(ctx context.Context, id string) (*model.User, error)
+	RestoreUser(ctx context.Context, id string, status model.UserStatus, restoredAt time.Time) error
+	PurgeUser(ctx context.Context, id string) error
+	ListUsers(ctx context.Context, query ListUsersQuery) (*UserPage, error)
+	UpdateStatus(ctx context.Context, id string, from model.UserStatus, change model.StatusChange) error
+	SetEmailVerification(ctx context.Context, id string, verification model.EmailVerification) error
+	GetUserByVerificationToken(ctx context.Context, tokenHash string) (*model.User, error)
+	MarkEmailVerified(ctx context.Context, id string, tokenHash string, verifiedAt time.Time, status model.UserStatus) error
+	FindTakenUsernames(ctx context.Context, usernames []string) ([]string, error)
+	BatchGetUsers(ctx context.Context, ids, emails, usernames []string) ([]*model.User, error)
+	StartMFAEnrollment(ctx context.Context, id string, encryptedSecret []byte) error
+	EnableMFA(ctx context.Context, id string, encryptedSecret []byte, recoveryCodeHashes []string, enabledAt time.Time, step int64) error
+	DisableMFA(ctx context.Context, id string) error
+	UseTOTPStep(ctx context.Context, id string, step int64) error
+	UseRecoveryCode(ctx context.Context, id string, codeHash string) error
+	AddRoleAssignment(ctx context.Context, id string, assignment model.RoleAssignment) error
+	RemoveRoleAssignment(ctx context.Context, id string, role string, scope model.Scope) error
+	AddMembership(ctx context.Context, id string, organizationID string) error
+	RemoveMembership(ctx context.Context, id string, organizationID string) error
 }
 
+// UserMongoRepository is a UserRepository storing users in MongoDB. Queries are
+// scoped to the members of the tenant in their context, if any; see WithTenant.
 type UserMongoRepository struct {
 	Collection mongodb.MongoAdapter
+	// UsernamesPerOrganization is set when usernames are only unique within an
+	// organization rather than across all users.
+	UsernamesPerOrganization bool
 }
 
 // NewUserMongoRepository returns a new UserMongoRepository.
@@ -35,7 +65,7 @@ func (r *UserMongoRepository) CreateUser(ctx context.Context, user *model.User)
 	_, err = r.Collection.InsertOne(ctx, userDB)
 
 	if err != nil {
-		return err
+		return translateError(err)
 	}
 
 	return nil
@@ -43,41 +73,651 @@ func (r *UserMongoRepository) CreateUser(ctx context.Context, user *model.User)
 
 // GetUserById GetUser implements UserRepository.
 func (r *UserMongoRepository) GetUserById(ctx context.Context, id string) (*model.User, error) {
-	objectID, err := primitive.ObjectIDFromHex(id)
+	objectID, err := parseID(id)
 	if err != nil {
 		return nil, err
 	}
 
 	var userDB model.UserDB
-	err = r.Collection.FindOne(ctx, primitive.M{"_id": objectID}).Decode(&userDB)
+	err = r.Collection.FindOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil})).Decode(&userDB)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return userDB.ToUser(), nil
 }
 
-// GetUserByEmail implements UserRepository.
+// GetUserByEmail implements UserRepository. The email must be in canonical form.
 func (r *UserMongoRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	var userDB model.UserDB
-	err := r.Collection.FindOne(ctx, primitive.M{"email": email}).Decode(&userDB)
+	err := r.Collection.FindOne(ctx, scopeFilter(ctx, primitive.M{"email_canonical": email, "deleted_at": nil})).Decode(&userDB)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return userDB.ToUser(), nil
 }
 
-// GetUserByUsername implements UserRepository.
+// GetUserByUsername implements UserRepository. The username must be in canonical form.
 func (r *UserMongoRepository) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
 	var userDB model.UserDB
-	err := r.Collection.FindOne(ctx, primitive.M{"username": username}).Decode(&userDB)
+	err := r.Collection.FindOne(ctx, scopeFilter(ctx, primitive.M{"username_canonical": username, "deleted_at": nil})).Decode(&userDB)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return userDB.ToUser(), nil
+}
+
+// UpdateHashedPassword implements UserRepository.
+func (r *UserMongoRepository) UpdateHashedPassword(ctx context.Context, id string, hashedPassword string) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.Collection.UpdateOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil}), primitive.M{"$set": primitive.M{"hashed_password": hashedPassword}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UpdatePassword implements UserRepository.
+func (r *UserMongoRepository) UpdatePassword(ctx context.Context, id string, hashedPassword string, changedAt time.Time) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	update := primitive.M{"$set": primitive.M{"hashed_password": hashedPassword, "password_changed_at": changedAt}}
+	result, err := r.Collection.UpdateOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil}), update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UpdateUser implements UserRepository. The write only succeeds when the stored
+// version still equals expectedVersion; on success user.Version is advanced.
+// When emailChanged is set, the new email is unverified: the verified time is
+// cleared and the outstanding verification replaced by user.EmailVerification.
+func (r *UserMongoRepository) UpdateUser(ctx context.Context, user *model.User, expectedVersion int64, emailChanged bool) error {
+	objectID, err := parseID(user.ID)
+	if err != nil {
+		return err
+	}
+
+	filter := scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "version": versionFilter(expectedVersion)})
+	update := primitive.M{
+		"$set": primitive.M{
+			"username":           user.Username,
+			"email":              user.Email,
+			"username_canonical": user.UsernameCanonical,
+			"email_canonical":    user.EmailCanonical,
+		},
+		"$inc": primitive.M{"version": 1},
+	}
+	if emailChanged {
+		unset := primitive.M{"email_verified_at": ""}
+		if v := user.EmailVerification; v != nil {
+			update["$set"].(primitive.M)["email_verification"] = model.EmailVerificationDB{TokenHash: v.TokenHash, ExpiresAt: v.ExpiresAt}
+		} else {
+			unset["email_verification"] = ""
+		}
+		update["$unset"] = unset
+	}
+
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.MatchedCount == 0 {
+		// Tell a missing user apart from a stale version.
+		var userDB model.UserDB
+		if err := r.Collection.FindOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil})).Decode(&userDB); err != nil {
+			return translateError(err)
+		}
+		return ErrVersionConflict
+	}
+
+	user.Version = expectedVersion + 1
+	return nil
+}
+
+// DeleteUser implements UserRepository. The user is only marked as deleted; its
+// username and email stay reserved until the document is purged.
+func (r *UserMongoRepository) DeleteUser(ctx context.Context, id string, deletedAt time.Time) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	// An update pipeline, so that the status held before deletion is recorded
+	// in the same write. Documents written before statuses existed were active.
+	update := primitive.A{primitive.M{"$set": primitive.M{
+		"status_before_deletion": primitive.M{"$ifNull": primitive.A{"$status", model.UserStatusActive}},
+		"deleted_at":             deletedAt,
+		"status":                 model.UserStatusDeleted,
+		"last_status_change":     model.StatusChangeDB{At: deletedAt},
+		"version":                primitive.M{"$add": primitive.A{primitive.M{"$ifNull": primitive.A{"$version", 0}}, 1}},
+	}}}
+	result, err := r.Collection.UpdateOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil}), update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetDeletedUser implements UserRepository. Only soft-deleted users are found.
+func (r *UserMongoRepository) GetDeletedUser(ctx context.Context, id string) (*model.User, error) {
+	objectID, err := parseID(id)
 	if err != nil {
 		return nil, err
 	}
 
+	var userDB model.UserDB
+	err = r.Collection.FindOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": primitive.M{"$ne": nil}})).Decode(&userDB)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return userDB.ToUser(), nil
+}
+
+// RestoreUser implements UserRepository. The user is restored with the given status.
+func (r *UserMongoRepository) RestoreUser(ctx context.Context, id string, status model.UserStatus, restoredAt time.Time) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	update := primitive.M{
+		"$set":   primitive.M{"status": status, "last_status_change": model.StatusChangeDB{At: restoredAt}},
+		"$unset": primitive.M{"deleted_at": "", "status_before_deletion": ""},
+		"$inc":   primitive.M{"version": 1},
+	}
+	result, err := r.Collection.UpdateOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": primitive.M{"$ne": nil}}), update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// PurgeUser implements UserRepository. Only soft-deleted users can be purged.
+func (r *UserMongoRepository) PurgeUser(ctx context.Context, id string) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.Collection.DeleteOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": primitive.M{"$ne": nil}}))
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UpdateStatus implements UserRepository. The change only applies while the user
+// is still in status from, so two concurrent transitions cannot both succeed.
+func (r *UserMongoRepository) UpdateStatus(ctx context.Context, id string, from model.UserStatus, change model.StatusChange) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "status": statusFilter(from)})
+	update := primitive.M{
+		"$set": primitive.M{
+			"status":             change.Status,
+			"last_status_change": model.StatusChangeDB{Reason: change.Reason, Actor: change.Actor, At: change.At},
+		},
+		"$inc": primitive.M{"version": 1},
+	}
+
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.MatchedCount == 0 {
+		var userDB model.UserDB
+		if err := r.Collection.FindOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil})).Decode(&userDB); err != nil {
+			return translateError(err)
+		}
+		return ErrStatusChanged
+	}
+
+	return nil
+}
+
+// SetEmailVerification implements UserRepository. It replaces any outstanding
+// verification, so only the most recently issued token can be used.
+func (r *UserMongoRepository) SetEmailVerification(ctx context.Context, id string, verification model.EmailVerification) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	update := primitive.M{"$set": primitive.M{"email_verification": model.EmailVerificationDB{
+		TokenHash: verification.TokenHash,
+		ExpiresAt: verification.ExpiresAt,
+	}}}
+	result, err := r.Collection.UpdateOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil}), update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetUserByVerificationToken implements UserRepository.
+func (r *UserMongoRepository) GetUserByVerificationToken(ctx context.Context, tokenHash string) (*model.User, error) {
+	var userDB model.UserDB
+	err := r.Collection.FindOne(ctx, scopeFilter(ctx, primitive.M{"email_verification.token_hash": tokenHash, "deleted_at": nil})).Decode(&userDB)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
 	return userDB.ToUser(), nil
 }
 
+// MarkEmailVerified implements UserRepository. The verification is consumed in
+// the same write, so a token can only be used once.
+func (r *UserMongoRepository) MarkEmailVerified(ctx context.Context, id string, tokenHash string, verifiedAt time.Time, status model.UserStatus) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "email_verification.token_hash": tokenHash})
+	update := primitive.M{
+		"$set":   primitive.M{"email_verified_at": verifiedAt, "status": status},
+		"$unset": primitive.M{"email_verification": ""},
+		"$inc":   primitive.M{"version": 1},
+	}
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// FindTakenUsernames implements UserRepository. It returns which of the given
+// canonical usernames belong to a user, including soft-deleted users, whose
+// usernames stay reserved until they are purged. When usernames are unique per
+// organization, only the members of the tenant in ctx are considered.
+func (r *UserMongoRepository) FindTakenUsernames(ctx context.Context, usernames []string) ([]string, error) {
+	filter := primitive.M{"username_canonical": primitive.M{"$in": usernames}}
+	if r.UsernamesPerOrganization {
+		filter = scopeFilter(ctx, filter)
+	}
+
+	cursor, err := r.Collection.Find(ctx, filter, options.Find().SetProjection(primitive.M{"username_canonical": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var usersDB []model.UserDB
+	if err := cursor.All(ctx, &usersDB); err != nil {
+		return nil, err
+	}
+
+	taken := make([]string, 0, len(usersDB))
+	for _, userDB := range usersDB {
+		taken = append(taken, userDB.UsernameCanonical)
+	}
+
+	return taken, nil
+}
+
+// BatchGetUsers implements UserRepository. It returns, in no particular order,
+// the users matching any of the given IDs, canonical emails or canonical
+// usernames, in a single query. Malformed IDs match no user.
+func (r *UserMongoRepository) BatchGetUsers(ctx context.Context, ids, emails, usernames []string) ([]*model.User, error) {
+	var or primitive.A
+
+	objectIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+	if len(objectIDs) > 0 {
+		or = append(or, primitive.M{"_id": primitive.M{"$in": objectIDs}})
+	}
+	if len(emails) > 0 {
+		or = append(or, primitive.M{"email_canonical": primitive.M{"$in": emails}})
+	}
+	if len(usernames) > 0 {
+		or = append(or, primitive.M{"username_canonical": primitive.M{"$in": usernames}})
+	}
+	if len(or) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := r.Collection.Find(ctx, scopeFilter(ctx, primitive.M{"deleted_at": nil, "$or": or}))
+	if err != nil {
+		return nil, err
+	}
+
+	var usersDB []model.UserDB
+	if err := cursor.All(ctx, &usersDB); err != nil {
+		return nil, err
+	}
+
+	users := make([]*model.User, 0, len(usersDB))
+	for i := range usersDB {
+		users = append(users, usersDB[i].ToUser())
+	}
+
+	return users, nil
+}
+
+// ListUsers implements UserRepository.
+func (r *UserMongoRepository) ListUsers(ctx context.Context, query ListUsersQuery) (*UserPage, error) {
+	if query.PageSize <= 0 {
+		return nil, ErrInvalidPageSize
+	}
+
+	filter, err := query.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := r.Collection.Find(ctx, scopeFilter(ctx, filter), query.findOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	var usersDB []model.UserDB
+	if err := cursor.All(ctx, &usersDB); err != nil {
+		return nil, err
+	}
+
+	page := &UserPage{Users: make([]*model.User, 0, len(usersDB))}
+	for i := range usersDB {
+		if i == query.PageSize {
+			page.NextCursor = query.nextCursor(page.Users[i-1])
+			break
+		}
+		page.Users = append(page.Users, usersDB[i].ToUser())
+	}
+
+	return page, nil
+}
+
+// statusFilter matches the given status. Documents written before statuses
+// were introduced have no status field and are treated as active.
+func statusFilter(status model.UserStatus) interface{} {
+	if status == model.UserStatusActive {
+		return primitive.M{"$in": primitive.A{model.UserStatusActive, nil}}
+	}
+	return status
+}
+
+// versionFilter matches the given version. Documents written before versioning
+// was introduced have no version field and are treated as version 0.
+func versionFilter(version int64) interface{} {
+	if version == 0 {
+		return primitive.M{"$in": primitive.A{int64(0), nil}}
+	}
+	return version
+}
+
+// StartMFAEnrollment implements UserRepository. It replaces any enrollment the
+// user did not confirm, but never an enabled MFA.
+func (r *UserMongoRepository) StartMFAEnrollment(ctx context.Context, id string, encryptedSecret []byte) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "mfa.enabled_at": nil})
+	update := primitive.M{"$set": primitive.M{"mfa": model.MFADB{EncryptedSecret: encryptedSecret}}}
+	return r.updateMFA(ctx, objectID, filter, update)
+}
+
+// EnableMFA implements UserRepository. It confirms the enrollment of the given
+// secret, failing with ErrVersionConflict if another enrollment replaced it.
+func (r *UserMongoRepository) EnableMFA(ctx context.Context, id string, encryptedSecret []byte, recoveryCodeHashes []string, enabledAt time.Time, step int64) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "mfa.encrypted_secret": encryptedSecret, "mfa.enabled_at": nil})
+	update := primitive.M{"$set": primitive.M{
+		"mfa.enabled_at":           enabledAt,
+		"mfa.recovery_code_hashes": recoveryCodeHashes,
+		"mfa.last_used_step":       step,
+	}}
+	return r.updateMFA(ctx, objectID, filter, update)
+}
+
+// updateMFA applies a conditional update to the MFA of a user, telling a
+// missing user apart from an MFA that no longer matches.
+func (r *UserMongoRepository) updateMFA(ctx context.Context, objectID primitive.ObjectID, filter, update primitive.M) error {
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		var userDB model.UserDB
+		if err := r.Collection.FindOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil})).Decode(&userDB); err != nil {
+			return translateError(err)
+		}
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// DisableMFA implements UserRepository. It removes the user's MFA along with
+// any unconfirmed enrollment.
+func (r *UserMongoRepository) DisableMFA(ctx context.Context, id string) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.Collection.UpdateOne(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil}), primitive.M{"$unset": primitive.M{"mfa": ""}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// UseTOTPStep implements UserRepository. It records that the TOTP code of the
+// given time step was used, provided no code of that step or a later one was.
+func (r *UserMongoRepository) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := scopeFilter(ctx, primitive.M{
+		"_id":                objectID,
+		"deleted_at":         nil,
+		"mfa.enabled_at":     primitive.M{"$ne": nil},
+		"mfa.last_used_step": primitive.M{"$lt": step},
+	})
+	result, err := r.Collection.UpdateOne(ctx, filter, primitive.M{"$set": primitive.M{"mfa.last_used_step": step}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrMFACodeUsed
+	}
+
+	return nil
+}
+
+// UseRecoveryCode implements UserRepository. The recovery code with the given
+// hash is removed in the same write that finds it, so it can only be used once.
+func (r *UserMongoRepository) UseRecoveryCode(ctx context.Context, id string, codeHash string) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "mfa.recovery_code_hashes": codeHash})
+	result, err := r.Collection.UpdateOne(ctx, filter, primitive.M{"$pull": primitive.M{"mfa.recovery_code_hashes": codeHash}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrMFACodeUsed
+	}
+
+	return nil
+}
+
+// AddRoleAssignment implements UserRepository. A user has a role at most once
+// per scope, checked in the same write that adds it.
+func (r *UserMongoRepository) AddRoleAssignment(ctx context.Context, id string, assignment model.RoleAssignment) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := scopeFilter(ctx, primitive.M{
+		"_id":        objectID,
+		"deleted_at": nil,
+		"roles":      primitive.M{"$not": primitive.M{"$elemMatch": roleFilter(assignment.Role, assignment.Scope)}},
+	})
+	update := primitive.M{"$push": primitive.M{"roles": assignment.ToRoleAssignmentDB()}}
+	return r.updateIf(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil}), filter, update, ErrRoleAlreadyAssigned)
+}
+
+// RemoveRoleAssignment implements UserRepository.
+func (r *UserMongoRepository) RemoveRoleAssignment(ctx context.Context, id string, role string, scope model.Scope) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := scopeFilter(ctx, primitive.M{
+		"_id":        objectID,
+		"deleted_at": nil,
+		"roles":      primitive.M{"$elemMatch": roleFilter(role, scope)},
+	})
+	update := primitive.M{"$pull": primitive.M{"roles": roleFilter(role, scope)}}
+	return r.updateIf(ctx, scopeFilter(ctx, primitive.M{"_id": objectID, "deleted_at": nil}), filter, update, ErrRoleNotAssigned)
+}
+
+// roleFilter matches the assignment of role in scope.
+func roleFilter(role string, scope model.Scope) primitive.M {
+	return primitive.M{"role": role, "scope_type": scope.Type, "scope_id": scope.ID}
+}
+
+// updateIf applies a conditional update to a user, telling a user missing from
+// the exists filter apart from one that does not meet the condition.
+func (r *UserMongoRepository) updateIf(ctx context.Context, exists, filter primitive.M, update interface{}, unmet error) error {
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return translateError(err)
+	}
+
+	if result.MatchedCount == 0 {
+		var userDB model.UserDB
+		if err := r.Collection.FindOne(ctx, exists).Decode(&userDB); err != nil {
+			return translateError(err)
+		}
+		return unmet
+	}
+
+	return nil
+}
+
+// AddMembership implements UserRepository. It is not scoped to the tenant in
+// ctx, as the user is not yet a member of the organization.
+func (r *UserMongoRepository) AddMembership(ctx context.Context, id string, organizationID string) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := primitive.M{"_id": objectID, "deleted_at": nil, "org_ids": primitive.M{"$ne": organizationID}}
+	update := primitive.M{"$push": primitive.M{"org_ids": organizationID}}
+	// When usernames are unique per organization, joining fails with
+	// ErrUsernameTaken if another member has the same username.
+	return r.updateIf(ctx, primitive.M{"_id": objectID, "deleted_at": nil}, filter, update, ErrAlreadyMember)
+}
+
+// RemoveMembership implements UserRepository. The roles the user had in the
+// organization are removed in the same write. Users leaving their last
+// organization lose org_ids altogether, like users who never joined one, as
+// the username index tells a missing org_ids from an empty one.
+func (r *UserMongoRepository) RemoveMembership(ctx context.Context, id string, organizationID string) error {
+	objectID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+
+	filter := primitive.M{"_id": objectID, "deleted_at": nil, "org_ids": organizationID}
+	inOrganization := primitive.M{"$and": primitive.A{
+		primitive.M{"$eq": primitive.A{"$$this.scope_type", model.ScopeTenant}},
+		primitive.M{"$eq": primitive.A{"$$this.scope_id", organizationID}},
+	}}
+	update := primitive.A{
+		primitive.M{"$set": primitive.M{
+			"org_ids": primitive.M{"$filter": primitive.M{"input": "$org_ids", "cond": primitive.M{"$ne": primitive.A{"$$this", organizationID}}}},
+			"roles": primitive.M{"$cond": primitive.A{
+				primitive.M{"$isArray": "$roles"},
+				primitive.M{"$filter": primitive.M{"input": "$roles", "cond": primitive.M{"$not": primitive.A{inOrganization}}}},
+				"$$REMOVE",
+			}},
+		}},
+		primitive.M{"$set": primitive.M{
+			"org_ids": primitive.M{"$cond": primitive.A{primitive.M{"$eq": primitive.A{primitive.M{"$size": "$org_ids"}, 0}}, "$$REMOVE", "$org_ids"}},
+		}},
+	}
+	return r.updateIf(ctx, primitive.M{"_id": objectID, "deleted_at": nil}, filter, update, ErrNotMember)
+}
+
 // Ensure UserMongoRepository implements the UserRepository interface
 var _ UserRepository = &UserMongoRepository{}
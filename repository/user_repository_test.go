@@ -2,7 +2,10 @@ package repository_test
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"testing"
+	"time"
 
 	mock "github.com/BerryTracer/common-service/adapter/database/mongodb/mock"
 	"github.com/BerryTracer/user-service/model"
@@ -10,6 +13,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // TestUserMongoRepository_CreateUser tests the CreateUser method of the UserMongoRepository
@@ -99,7 +103,7 @@ func TestUserMongoRepository_GetUserById(t *testing.T) {
 
 	// Setup mock expectations
 	mockMongoAdapter.EXPECT().
-		FindOne(ctx, primitive.M{"_id": objectID}).
+		FindOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil}).
 		Return(mockSingleResult).
 		Times(1)
 
@@ -169,7 +173,7 @@ func TestUserMongoRepository_GetUserById_FindOne_Error(t *testing.T) {
 
 	// Setup mock expectations
 	mockMongoAdapter.EXPECT().
-		FindOne(ctx, primitive.M{"_id": objectID}).
+		FindOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil}).
 		Return(mockSingleResult).
 		Times(1)
 
@@ -209,7 +213,7 @@ func TestUserMongoRepository_GetUserByEmail(t *testing.T) {
 
 	// Setup mock expectations
 	mockMongoAdapter.EXPECT().
-		FindOne(ctx, primitive.M{"email": testEmail}).
+		FindOne(ctx, primitive.M{"email_canonical": testEmail, "deleted_at": nil}).
 		Return(mockSingleResult).
 		Times(1)
 
@@ -254,7 +258,7 @@ func TestUserMongoRepository_GetUserByEmail_FindOne_Error(t *testing.T) {
 
 	// Setup mock expectations
 	mockMongoAdapter.EXPECT().
-		FindOne(ctx, primitive.M{"email": testEmail}).
+		FindOne(ctx, primitive.M{"email_canonical": testEmail, "deleted_at": nil}).
 		Return(mockSingleResult).
 		Times(1)
 
@@ -294,7 +298,7 @@ func TestUserMongoRepository_GetUserByUsername(t *testing.T) {
 
 	// Setup mock expectations
 	mockMongoAdapter.EXPECT().
-		FindOne(ctx, primitive.M{"username": testUsername}).
+		FindOne(ctx, primitive.M{"username_canonical": testUsername, "deleted_at": nil}).
 		Return(mockSingleResult).
 		Times(1)
 
@@ -339,7 +343,7 @@ func TestUserMongoRepository_GetUserByUsername_FindOne_Error(t *testing.T) {
 
 	// Setup mock expectations
 	mockMongoAdapter.EXPECT().
-		FindOne(ctx, primitive.M{"username": testUsername}).
+		FindOne(ctx, primitive.M{"username_canonical": testUsername, "deleted_at": nil}).
 		Return(mockSingleResult).
 		Times(1)
 
@@ -360,3 +364,1351 @@ func TestUserMongoRepository_GetUserByUsername_FindOne_Error(t *testing.T) {
 		t.Errorf("expected nil user, got %v", resultUser)
 	}
 }
+
+// TestUserMongoRepository_UpdateHashedPassword tests the UpdateHashedPassword method of the UserMongoRepository
+func TestUserMongoRepository_UpdateHashedPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil}, primitive.M{"$set": primitive.M{"hashed_password": "newHash"}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdateHashedPassword(ctx, testID, "newHash")
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestUserMongoRepository_UpdateHashedPassword_InvalidID tests the UpdateHashedPassword method of the UserMongoRepository
+func TestUserMongoRepository_UpdateHashedPassword_InvalidID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	// Call the method
+	err := userRepo.UpdateHashedPassword(context.Background(), "invalid", "newHash")
+
+	// Assertions
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+// TestUserMongoRepository_UpdateHashedPassword_NotFound tests the UpdateHashedPassword method of the UserMongoRepository
+func TestUserMongoRepository_UpdateHashedPassword_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil}, gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdateHashedPassword(ctx, testID, "newHash")
+
+	// Assertions
+	if err != repository.ErrUserNotFound {
+		t.Errorf("expected %v, got %v", repository.ErrUserNotFound, err)
+	}
+}
+
+// TestUserMongoRepository_UpdateUser tests the UpdateUser method of the UserMongoRepository
+func TestUserMongoRepository_UpdateUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	user := model.NewUser("Test", "Test@Mail.com", "test")
+	user.UsernameCanonical = "test"
+	user.EmailCanonical = "test@mail.com"
+	objectID, _ := primitive.ObjectIDFromHex(user.ID)
+
+	// Setup mock expectations: display and canonical forms are written together
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": nil, "version": int64(1)},
+			primitive.M{
+				"$set": primitive.M{
+					"username":           "Test",
+					"email":              "Test@Mail.com",
+					"username_canonical": "test",
+					"email_canonical":    "test@mail.com",
+				},
+				"$inc": primitive.M{"version": 1},
+			}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdateUser(ctx, user, 1, false)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if user.Version != 2 {
+		t.Errorf("expected version 2, got %d", user.Version)
+	}
+}
+
+// TestUserMongoRepository_UpdateUser_EmailChanged tests that a changed email is written unverified
+func TestUserMongoRepository_UpdateUser_EmailChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	user := model.NewUser("test", "new@mail.com", "test")
+	user.UsernameCanonical = "test"
+	user.EmailCanonical = "new@mail.com"
+	expiresAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	user.EmailVerification = &model.EmailVerification{TokenHash: "hash", ExpiresAt: expiresAt}
+	objectID, _ := primitive.ObjectIDFromHex(user.ID)
+
+	// Setup mock expectations: the previous verification is replaced in the same write
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": nil, "version": int64(1)},
+			primitive.M{
+				"$set": primitive.M{
+					"username":           "test",
+					"email":              "new@mail.com",
+					"username_canonical": "test",
+					"email_canonical":    "new@mail.com",
+					"email_verification": model.EmailVerificationDB{TokenHash: "hash", ExpiresAt: expiresAt},
+				},
+				"$unset": primitive.M{"email_verified_at": ""},
+				"$inc":   primitive.M{"version": 1},
+			}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdateUser(ctx, user, 1, true)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestUserMongoRepository_UpdateUser_LegacyDocument tests that version 0 also matches documents without a version field
+func TestUserMongoRepository_UpdateUser_LegacyDocument(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	user := model.NewUser("test", "test@mail.com", "test")
+	user.Version = 0
+	objectID, _ := primitive.ObjectIDFromHex(user.ID)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "version": primitive.M{"$in": primitive.A{int64(0), nil}}}, gomock.Any()).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdateUser(ctx, user, 0, false)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if user.Version != 1 {
+		t.Errorf("expected version 1, got %d", user.Version)
+	}
+}
+
+// TestUserMongoRepository_UpdateUser_VersionConflict tests the UpdateUser method of the UserMongoRepository
+func TestUserMongoRepository_UpdateUser_VersionConflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	user := model.NewUser("test", "test@mail.com", "test")
+	objectID, _ := primitive.ObjectIDFromHex(user.ID)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil}).
+		Return(mockSingleResult).
+		Times(1)
+
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdateUser(ctx, user, 1, false)
+
+	// Assertions
+	if err != repository.ErrVersionConflict {
+		t.Errorf("expected %v, got %v", repository.ErrVersionConflict, err)
+	}
+}
+
+// TestUserMongoRepository_UpdateUser_NotFound tests the UpdateUser method of the UserMongoRepository
+func TestUserMongoRepository_UpdateUser_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	user := model.NewUser("test", "test@mail.com", "test")
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, gomock.Any()).
+		Return(mockSingleResult).
+		Times(1)
+
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(mongo.ErrNoDocuments).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdateUser(ctx, user, 1, false)
+
+	// Assertions
+	if err != repository.ErrUserNotFound {
+		t.Errorf("expected %v, got %v", repository.ErrUserNotFound, err)
+	}
+}
+
+// TestUserMongoRepository_UpdatePassword tests the UpdatePassword method of the UserMongoRepository
+func TestUserMongoRepository_UpdatePassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	changedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": nil},
+			primitive.M{"$set": primitive.M{"hashed_password": "newHash", "password_changed_at": changedAt}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdatePassword(ctx, testID, "newHash", changedAt)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestUserMongoRepository_UpdatePassword_NotFound tests the UpdatePassword method of the UserMongoRepository
+func TestUserMongoRepository_UpdatePassword_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdatePassword(ctx, primitive.NewObjectID().Hex(), "newHash", time.Now())
+
+	// Assertions
+	if err != repository.ErrUserNotFound {
+		t.Errorf("expected %v, got %v", repository.ErrUserNotFound, err)
+	}
+}
+
+// TestUserMongoRepository_DeleteUser tests the DeleteUser method of the UserMongoRepository
+func TestUserMongoRepository_DeleteUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	deletedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": nil},
+			primitive.A{primitive.M{"$set": primitive.M{
+				"status_before_deletion": primitive.M{"$ifNull": primitive.A{"$status", model.UserStatusActive}},
+				"deleted_at":             deletedAt,
+				"status":                 model.UserStatusDeleted,
+				"last_status_change":     model.StatusChangeDB{At: deletedAt},
+				"version":                primitive.M{"$add": primitive.A{primitive.M{"$ifNull": primitive.A{"$version", 0}}, 1}},
+			}}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.DeleteUser(ctx, testID, deletedAt)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestUserMongoRepository_DeleteUser_AlreadyDeleted tests the DeleteUser method of the UserMongoRepository
+func TestUserMongoRepository_DeleteUser_AlreadyDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.DeleteUser(ctx, primitive.NewObjectID().Hex(), time.Now())
+
+	// Assertions
+	if err != repository.ErrUserNotFound {
+		t.Errorf("expected %v, got %v", repository.ErrUserNotFound, err)
+	}
+}
+
+// TestUserMongoRepository_RestoreUser tests the RestoreUser method of the UserMongoRepository
+func TestUserMongoRepository_RestoreUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	restoredAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": primitive.M{"$ne": nil}},
+			primitive.M{
+				"$set":   primitive.M{"status": model.UserStatusSuspended, "last_status_change": model.StatusChangeDB{At: restoredAt}},
+				"$unset": primitive.M{"deleted_at": "", "status_before_deletion": ""},
+				"$inc":   primitive.M{"version": 1},
+			}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.RestoreUser(ctx, testID, model.UserStatusSuspended, restoredAt)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestUserMongoRepository_PurgeUser tests the PurgeUser method of the UserMongoRepository
+func TestUserMongoRepository_PurgeUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		DeleteOne(ctx, primitive.M{"_id": objectID, "deleted_at": primitive.M{"$ne": nil}}).
+		Return(&mongo.DeleteResult{DeletedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.PurgeUser(ctx, testID)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestUserMongoRepository_PurgeUser_NotDeleted tests that active users cannot be purged
+func TestUserMongoRepository_PurgeUser_NotDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		DeleteOne(ctx, gomock.Any()).
+		Return(&mongo.DeleteResult{}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.PurgeUser(ctx, primitive.NewObjectID().Hex())
+
+	// Assertions
+	if err != repository.ErrUserNotFound {
+		t.Errorf("expected %v, got %v", repository.ErrUserNotFound, err)
+	}
+}
+
+// TestUserMongoRepository_ListUsers tests the ListUsers method of the UserMongoRepository
+func TestUserMongoRepository_ListUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockCursor := mock.NewMockCursor(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	usersDB := []model.UserDB{
+		{ID: primitive.NewObjectID(), Username: "alice", Email: "alice@mail.com"},
+		{ID: primitive.NewObjectID(), Username: "alicia", Email: "alicia@mail.com"},
+		{ID: primitive.NewObjectID(), Username: "alina", Email: "alina@mail.com"},
+	}
+
+	expectedFilter := primitive.M{"$and": primitive.A{
+		primitive.M{"deleted_at": nil},
+		primitive.M{"username_canonical": primitive.Regex{Pattern: "^ali"}},
+	}}
+
+	// Setup mock expectations: one extra document signals a further page
+	mockMongoAdapter.EXPECT().
+		Find(ctx, expectedFilter, gomock.Any()).
+		Return(mockCursor, nil).
+		Times(1)
+
+	mockCursor.EXPECT().
+		All(ctx, gomock.Any()).
+		SetArg(1, usersDB).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	page, err := userRepo.ListUsers(ctx, repository.ListUsersQuery{UsernamePrefix: "ali", SortBy: repository.SortByUsername, PageSize: 2})
+
+	// Assertions
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(page.Users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(page.Users))
+	}
+
+	if page.NextCursor == "" {
+		t.Fatalf("expected a next cursor")
+	}
+
+	// The cursor resumes after the last user of the page
+	mockMongoAdapter.EXPECT().
+		Find(ctx, primitive.M{"$and": primitive.A{
+			primitive.M{"deleted_at": nil},
+			primitive.M{"$or": primitive.A{
+				primitive.M{"username": primitive.M{"$gt": "alicia"}},
+				primitive.M{"username": "alicia", "_id": primitive.M{"$gt": usersDB[1].ID}},
+			}},
+		}}, gomock.Any()).
+		Return(mockCursor, nil).
+		Times(1)
+
+	mockCursor.EXPECT().
+		All(ctx, gomock.Any()).
+		SetArg(1, usersDB[2:]).
+		Return(nil).
+		Times(1)
+
+	page, err = userRepo.ListUsers(ctx, repository.ListUsersQuery{SortBy: repository.SortByUsername, PageSize: 2, Cursor: page.NextCursor})
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(page.Users) != 1 || page.Users[0].Username != "alina" {
+		t.Errorf("expected only alina on the last page, got %v", page.Users)
+	}
+
+	if page.NextCursor != "" {
+		t.Errorf("expected no next cursor on the last page, got %s", page.NextCursor)
+	}
+}
+
+// TestUserMongoRepository_ListUsers_CursorSortMismatch tests that a cursor cannot be reused with another sort order
+func TestUserMongoRepository_ListUsers_CursorSortMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockCursor := mock.NewMockCursor(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	usersDB := []model.UserDB{
+		{ID: primitive.NewObjectID(), Username: "alice"},
+		{ID: primitive.NewObjectID(), Username: "bob"},
+	}
+
+	mockMongoAdapter.EXPECT().
+		Find(ctx, gomock.Any(), gomock.Any()).
+		Return(mockCursor, nil).
+		Times(1)
+
+	mockCursor.EXPECT().
+		All(ctx, gomock.Any()).
+		SetArg(1, usersDB).
+		Return(nil).
+		Times(1)
+
+	page, err := userRepo.ListUsers(ctx, repository.ListUsersQuery{SortBy: repository.SortByEmail, PageSize: 1})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Call the method with the cursor and a different sort field
+	_, err = userRepo.ListUsers(ctx, repository.ListUsersQuery{SortBy: repository.SortByUsername, PageSize: 1, Cursor: page.NextCursor})
+
+	// Assertions
+	if err != repository.ErrInvalidCursor {
+		t.Errorf("expected %v, got %v", repository.ErrInvalidCursor, err)
+	}
+}
+
+// TestUserMongoRepository_ListUsers_InvalidCursor tests the ListUsers method of the UserMongoRepository
+func TestUserMongoRepository_ListUsers_InvalidCursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	// Call the method
+	_, err := userRepo.ListUsers(context.Background(), repository.ListUsersQuery{PageSize: 10, Cursor: "not-a-cursor"})
+
+	// Assertions
+	if err != repository.ErrInvalidCursor {
+		t.Errorf("expected %v, got %v", repository.ErrInvalidCursor, err)
+	}
+}
+
+// TestUserMongoRepository_ListUsers_CreatedRange tests that creation filters become _id ranges
+func TestUserMongoRepository_ListUsers_CreatedRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockCursor := mock.NewMockCursor(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	mockMongoAdapter.EXPECT().
+		Find(ctx, primitive.M{"$and": primitive.A{
+			primitive.M{"deleted_at": primitive.M{"$ne": nil}},
+			primitive.M{"_id": primitive.M{"$gte": primitive.ObjectID{0x65, 0x92, 0x00, 0x80}}},
+			primitive.M{"_id": primitive.M{"$lt": primitive.ObjectID{0x65, 0xba, 0xdf, 0x00}}},
+		}}, gomock.Any()).
+		Return(mockCursor, nil).
+		Times(1)
+
+	mockCursor.EXPECT().
+		All(ctx, gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	page, err := userRepo.ListUsers(ctx, repository.ListUsersQuery{
+		Status:        model.UserStatusDeleted,
+		CreatedAfter:  after,
+		CreatedBefore: before,
+		PageSize:      10,
+	})
+
+	// Assertions
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(page.Users) != 0 || page.NextCursor != "" {
+		t.Errorf("expected an empty last page, got %v", page)
+	}
+}
+
+// TestUserMongoRepository_CreateUser_DuplicateEmail tests that duplicate key errors become domain errors
+func TestUserMongoRepository_CreateUser_DuplicateEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAdapter := mock.NewMockMongoAdapter(ctrl)
+	repo := repository.NewUserMongoRepository(mockAdapter)
+
+	ctx := context.Background()
+
+	duplicateKeyError := func(index string) error {
+		return mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+			Code:    11000,
+			Message: "E11000 duplicate key error collection: user.user index: " + index + " dup key: { }",
+		}}}
+	}
+
+	// Setup mock expectations
+	mockAdapter.EXPECT().
+		InsertOne(ctx, gomock.Any(), gomock.Any()).
+		Return(nil, duplicateKeyError("email_1")).
+		Times(1)
+
+	mockAdapter.EXPECT().
+		InsertOne(ctx, gomock.Any(), gomock.Any()).
+		Return(nil, duplicateKeyError("username_1")).
+		Times(1)
+
+	// Call the method
+	err := repo.CreateUser(ctx, model.NewUser("test", "test@mail.com", "test"))
+	if err != repository.ErrEmailTaken {
+		t.Errorf("expected %v, got %v", repository.ErrEmailTaken, err)
+	}
+
+	err = repo.CreateUser(ctx, model.NewUser("test", "test@mail.com", "test"))
+	if err != repository.ErrUsernameTaken {
+		t.Errorf("expected %v, got %v", repository.ErrUsernameTaken, err)
+	}
+}
+
+// TestUserMongoRepository_GetUserById_NotFound tests that missing users are reported as ErrUserNotFound
+func TestUserMongoRepository_GetUserById_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, gomock.Any()).
+		Return(mockSingleResult).
+		Times(1)
+
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(mongo.ErrNoDocuments).
+		Times(1)
+
+	// Call the method
+	_, err := userRepo.GetUserById(ctx, primitive.NewObjectID().Hex())
+
+	// Assertions
+	if err != repository.ErrUserNotFound {
+		t.Errorf("expected %v, got %v", repository.ErrUserNotFound, err)
+	}
+
+	// Malformed IDs are invalid arguments rather than lookups
+	_, err = userRepo.GetUserById(ctx, "invalid")
+	if !errors.Is(err, model.ErrInvalidArgument) {
+		t.Errorf("expected %v, got %v", model.ErrInvalidArgument, err)
+	}
+}
+
+// TestUserMongoRepository_UpdateStatus tests the UpdateStatus method of the UserMongoRepository
+func TestUserMongoRepository_UpdateStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	change := model.StatusChange{Status: model.UserStatusSuspended, Reason: "spam", Actor: "admin", At: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	// Setup mock expectations: active also matches users without a status
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": nil, "status": primitive.M{"$in": primitive.A{model.UserStatusActive, nil}}},
+			primitive.M{
+				"$set": primitive.M{
+					"status":             model.UserStatusSuspended,
+					"last_status_change": model.StatusChangeDB{Reason: "spam", Actor: "admin", At: change.At},
+				},
+				"$inc": primitive.M{"version": 1},
+			}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdateStatus(ctx, testID, model.UserStatusActive, change)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestUserMongoRepository_UpdateStatus_Conflict tests the UpdateStatus method of the UserMongoRepository
+func TestUserMongoRepository_UpdateStatus_Conflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations: the user exists but left the expected status
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "status": model.UserStatusSuspended}, gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil}).
+		Return(mockSingleResult).
+		Times(1)
+
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UpdateStatus(ctx, testID, model.UserStatusSuspended, model.StatusChange{Status: model.UserStatusActive})
+
+	// Assertions
+	if err != repository.ErrStatusChanged {
+		t.Errorf("expected %v, got %v", repository.ErrStatusChanged, err)
+	}
+}
+
+// TestUserMongoRepository_MarkEmailVerified tests the MarkEmailVerified method of the UserMongoRepository
+func TestUserMongoRepository_MarkEmailVerified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	verifiedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Setup mock expectations: the token is consumed by the same write
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": nil, "email_verification.token_hash": "hash"},
+			primitive.M{
+				"$set":   primitive.M{"email_verified_at": verifiedAt, "status": model.UserStatusActive},
+				"$unset": primitive.M{"email_verification": ""},
+				"$inc":   primitive.M{"version": 1},
+			}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.MarkEmailVerified(ctx, testID, "hash", verifiedAt, model.UserStatusActive)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+// TestUserMongoRepository_MarkEmailVerified_TokenUsed tests the MarkEmailVerified method of the UserMongoRepository
+func TestUserMongoRepository_MarkEmailVerified_TokenUsed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.MarkEmailVerified(ctx, testID, "hash", time.Now(), model.UserStatusActive)
+
+	// Assertions
+	if err != repository.ErrUserNotFound {
+		t.Errorf("expected %v, got %v", repository.ErrUserNotFound, err)
+	}
+}
+
+// TestUserMongoRepository_BackfillCanonicalFields tests the BackfillCanonicalFields method of the UserMongoRepository
+func TestUserMongoRepository_BackfillCanonicalFields(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockCursor := mock.NewMockCursor(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	legacy := model.UserDB{ID: primitive.NewObjectID(), Username: "Alice", Email: "Alice@Example.COM"}
+	duplicate := model.UserDB{ID: primitive.NewObjectID(), Username: "alice", Email: "alice@example.com"}
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		Find(ctx, gomock.Any()).
+		Return(mockCursor, nil).
+		Times(1)
+
+	gomock.InOrder(
+		mockCursor.EXPECT().Next(ctx).Return(true),
+		mockCursor.EXPECT().Decode(gomock.Any()).SetArg(0, legacy).Return(nil),
+		mockCursor.EXPECT().Next(ctx).Return(true),
+		mockCursor.EXPECT().Decode(gomock.Any()).SetArg(0, duplicate).Return(nil),
+		mockCursor.EXPECT().Next(ctx).Return(false),
+	)
+	mockCursor.EXPECT().Err().Return(nil)
+	mockCursor.EXPECT().Close(ctx).Return(nil)
+
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": legacy.ID},
+			primitive.M{"$set": primitive.M{"username_canonical": "alice", "email_canonical": "alice@example.com"}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// The second user collides with the first once canonicalized and is skipped
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, primitive.M{"_id": duplicate.ID}, gomock.Any()).
+		Return(nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+			Code:    11000,
+			Message: "E11000 duplicate key error collection: user.user index: username_canonical_1 dup key",
+		}}}).
+		Times(1)
+
+	// Call the method
+	updated, err := userRepo.BackfillCanonicalFields(ctx, model.DefaultNormalizer())
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("expected 1 updated user, got %d", updated)
+	}
+}
+
+// TestUserMongoRepository_FindTakenUsernames tests the FindTakenUsernames method of the UserMongoRepository
+func TestUserMongoRepository_FindTakenUsernames(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockCursor := mock.NewMockCursor(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+
+	// Setup mock expectations: soft-deleted users are not excluded
+	mockMongoAdapter.EXPECT().
+		Find(ctx, primitive.M{"username_canonical": primitive.M{"$in": []string{"alice", "alice1"}}}, gomock.Any()).
+		Return(mockCursor, nil).
+		Times(1)
+
+	mockCursor.EXPECT().
+		All(ctx, gomock.Any()).
+		SetArg(1, []model.UserDB{{UsernameCanonical: "alice"}}).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	taken, err := userRepo.FindTakenUsernames(ctx, []string{"alice", "alice1"})
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(taken) != 1 || taken[0] != "alice" {
+		t.Errorf("expected [alice], got %v", taken)
+	}
+}
+
+// TestUserMongoRepository_BatchGetUsers tests the BatchGetUsers method of the UserMongoRepository
+func TestUserMongoRepository_BatchGetUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockCursor := mock.NewMockCursor(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	objectID := primitive.NewObjectID()
+
+	// Setup mock expectations: one query, skipping the malformed ID
+	mockMongoAdapter.EXPECT().
+		Find(ctx, primitive.M{"deleted_at": nil, "$or": primitive.A{
+			primitive.M{"_id": primitive.M{"$in": []primitive.ObjectID{objectID}}},
+			primitive.M{"username_canonical": primitive.M{"$in": []string{"alice"}}},
+		}}).
+		Return(mockCursor, nil).
+		Times(1)
+
+	mockCursor.EXPECT().
+		All(ctx, gomock.Any()).
+		SetArg(1, []model.UserDB{{ID: objectID, Username: "bob"}}).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	users, err := userRepo.BatchGetUsers(ctx, []string{objectID.Hex(), "not-an-id"}, nil, []string{"alice"})
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(users) != 1 || users[0].ID != objectID.Hex() {
+		t.Errorf("expected user %s, got %v", objectID.Hex(), users)
+	}
+}
+
+// TestUserMongoRepository_BatchGetUsers_Empty tests that an empty batch does not query the database
+func TestUserMongoRepository_BatchGetUsers_Empty(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	// Call the method
+	users, err := userRepo.BatchGetUsers(context.Background(), []string{"not-an-id"}, nil, nil)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("expected no users, got %v", users)
+	}
+}
+
+// TestUserMongoRepository_UseTOTPStep tests that a TOTP step is only recorded once and in order
+func TestUserMongoRepository_UseTOTPStep(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations: no later step was used
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{
+				"_id":                objectID,
+				"deleted_at":         nil,
+				"mfa.enabled_at":     primitive.M{"$ne": nil},
+				"mfa.last_used_step": primitive.M{"$lt": int64(1000)},
+			},
+			primitive.M{"$set": primitive.M{"mfa.last_used_step": int64(1000)}}).
+		Return(&mongo.UpdateResult{MatchedCount: 0}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UseTOTPStep(ctx, testID, 1000)
+
+	// Assertions
+	if !errors.Is(err, repository.ErrMFACodeUsed) {
+		t.Errorf("expected ErrMFACodeUsed, got %v", err)
+	}
+}
+
+// TestUserMongoRepository_UseRecoveryCode tests that a recovery code is removed as it is used
+func TestUserMongoRepository_UseRecoveryCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": nil, "mfa.recovery_code_hashes": "hash"},
+			primitive.M{"$pull": primitive.M{"mfa.recovery_code_hashes": "hash"}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.UseRecoveryCode(ctx, testID, "hash")
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestUserMongoRepository_AddRoleAssignment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	assignment := model.RoleAssignment{
+		Role:       "viewer",
+		Scope:      model.Scope{Type: model.ScopeTenant, ID: "acme"},
+		AssignedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		AssignedBy: "admin-tool",
+	}
+
+	// Setup mock expectations: the role is only added if the user does not have it in the scope yet
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{
+				"_id":        objectID,
+				"deleted_at": nil,
+				"roles":      primitive.M{"$not": primitive.M{"$elemMatch": primitive.M{"role": "viewer", "scope_type": model.ScopeTenant, "scope_id": "acme"}}},
+			},
+			primitive.M{"$push": primitive.M{"roles": assignment.ToRoleAssignmentDB()}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.AddRoleAssignment(ctx, testID, assignment)
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestUserMongoRepository_AddRoleAssignment_AlreadyAssigned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations: nothing matches, but the user exists
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil}).
+		Return(mockSingleResult).
+		Times(1)
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.AddRoleAssignment(ctx, testID, model.RoleAssignment{Role: "admin"})
+
+	// Assertions
+	if !errors.Is(err, repository.ErrRoleAlreadyAssigned) {
+		t.Errorf("expected ErrRoleAlreadyAssigned, got %v", err)
+	}
+}
+
+func TestUserMongoRepository_RemoveRoleAssignment_UserNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+	roleFilter := primitive.M{"role": "admin", "scope_type": model.ScopeGlobal, "scope_id": ""}
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": nil, "roles": primitive.M{"$elemMatch": roleFilter}},
+			primitive.M{"$pull": primitive.M{"roles": roleFilter}}).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil}).
+		Return(mockSingleResult).
+		Times(1)
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(mongo.ErrNoDocuments).
+		Times(1)
+
+	// Call the method
+	err := userRepo.RemoveRoleAssignment(ctx, testID, "admin", model.Scope{})
+
+	// Assertions
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestUserMongoRepository_GetUserById_Tenant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := repository.WithTenant(context.Background(), "acme")
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations: only members of the tenant are found
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "org_ids": "acme"}).
+		Return(mockSingleResult).
+		Times(1)
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(mongo.ErrNoDocuments).
+		Times(1)
+
+	// Call the method
+	_, err := userRepo.GetUserById(ctx, testID)
+
+	// Assertions
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestUserMongoRepository_FindTakenUsernames_PerOrganization(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockCursor := mock.NewMockCursor(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+	userRepo.UsernamesPerOrganization = true
+
+	ctx := repository.WithTenant(context.Background(), "acme")
+
+	// Setup mock expectations: usernames taken in other organizations are free
+	mockMongoAdapter.EXPECT().
+		Find(ctx, primitive.M{"username_canonical": primitive.M{"$in": []string{"alice"}}, "org_ids": "acme"}, gomock.Any()).
+		Return(mockCursor, nil).
+		Times(1)
+	mockCursor.EXPECT().All(ctx, gomock.Any()).Return(nil).Times(1)
+
+	// Call the method
+	taken, err := userRepo.FindTakenUsernames(ctx, []string{"alice"})
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if len(taken) != 0 {
+		t.Errorf("expected no taken usernames, got %v", taken)
+	}
+}
+
+func TestUserMongoRepository_AddMembership(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	// The tenant does not scope the write, as the user is not a member yet
+	ctx := repository.WithTenant(context.Background(), "acme")
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx,
+			primitive.M{"_id": objectID, "deleted_at": nil, "org_ids": primitive.M{"$ne": "acme"}},
+			primitive.M{"$push": primitive.M{"org_ids": "acme"}}).
+		Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.AddMembership(ctx, testID, "acme")
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestUserMongoRepository_AddMembership_AlreadyMember(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	mockSingleResult := mock.NewMockSingleResult(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations: nothing matches, but the user exists
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, gomock.Any(), gomock.Any()).
+		Return(&mongo.UpdateResult{}, nil).
+		Times(1)
+	mockMongoAdapter.EXPECT().
+		FindOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil}).
+		Return(mockSingleResult).
+		Times(1)
+	mockSingleResult.EXPECT().
+		Decode(gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	// Call the method
+	err := userRepo.AddMembership(ctx, testID, "acme")
+
+	// Assertions
+	if !errors.Is(err, repository.ErrAlreadyMember) {
+		t.Errorf("expected ErrAlreadyMember, got %v", err)
+	}
+}
+
+func TestUserMongoRepository_RemoveMembership(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMongoAdapter := mock.NewMockMongoAdapter(ctrl)
+	userRepo := repository.NewUserMongoRepository(mockMongoAdapter)
+
+	ctx := context.Background()
+	testID := primitive.NewObjectID().Hex()
+	objectID, _ := primitive.ObjectIDFromHex(testID)
+
+	// Setup mock expectations: the roles of the user in the organization go
+	// with it, and org_ids once it is empty
+	mockMongoAdapter.EXPECT().
+		UpdateOne(ctx, primitive.M{"_id": objectID, "deleted_at": nil, "org_ids": "acme"}, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+			pipeline, ok := update.(primitive.A)
+			if !ok || len(pipeline) != 2 {
+				t.Fatalf("expected a pipeline of two stages, got %v", update)
+			}
+			orgIDs := pipeline[1].(primitive.M)["$set"].(primitive.M)["org_ids"]
+			if !reflect.DeepEqual(orgIDs, primitive.M{"$cond": primitive.A{primitive.M{"$eq": primitive.A{primitive.M{"$size": "$org_ids"}, 0}}, "$$REMOVE", "$org_ids"}}) {
+				t.Errorf("expected empty org_ids to be removed, got %v", orgIDs)
+			}
+			return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+		}).
+		Times(1)
+
+	// Call the method
+	err := userRepo.RemoveMembership(ctx, testID, "acme")
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
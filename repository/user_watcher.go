@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	"github.com/BerryTracer/user-service/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UserWatcher streams changes to users as they are written.
+type UserWatcher interface {
+	// WatchUsers returns the changes after the one identified by resumeToken,
+	// or from now on when resumeToken is empty.
+	WatchUsers(ctx context.Context, resumeToken string) (UserChangeStream, error)
+}
+
+// UserChangeStream is an open stream of user changes.
+type UserChangeStream interface {
+	// Next blocks until the next change. It returns io.EOF once the stream has
+	// ended, after which the watch can be resumed from the last change.
+	Next(ctx context.Context) (*model.UserChange, error)
+	Close(ctx context.Context) error
+}
+
+// changeStreamHistoryLost is the server error code for resume tokens older than the oplog.
+const changeStreamHistoryLost = 286
+
+// ChangeStreamOpener opens a change stream on the user collection, resuming
+// after resumeAfter unless it is nil.
+type ChangeStreamOpener func(ctx context.Context, resumeAfter bson.Raw) (*mongo.ChangeStream, error)
+
+type MongoUserWatcher struct {
+	Open ChangeStreamOpener
+}
+
+// NewMongoUserWatcher returns a new MongoUserWatcher.
+func NewMongoUserWatcher(open ChangeStreamOpener) *MongoUserWatcher {
+	return &MongoUserWatcher{Open: open}
+}
+
+// WatchUsers implements UserWatcher.
+func (w *MongoUserWatcher) WatchUsers(ctx context.Context, resumeToken string) (UserChangeStream, error) {
+	resumeAfter, err := ParseResumeToken(resumeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := w.Open(ctx, resumeAfter)
+	if err != nil {
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && serverErr.HasErrorCode(changeStreamHistoryLost) {
+			return nil, ErrResumeTokenExpired
+		}
+		return nil, err
+	}
+
+	return &mongoUserChangeStream{stream: stream}, nil
+}
+
+// ParseResumeToken decodes a resume token handed out with a UserChange. The
+// empty token decodes to nil.
+func ParseResumeToken(resumeToken string) (bson.Raw, error) {
+	if resumeToken == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(resumeToken)
+	if err != nil {
+		return nil, ErrInvalidResumeToken
+	}
+
+	raw := bson.Raw(data)
+	if err := raw.Validate(); err != nil {
+		return nil, ErrInvalidResumeToken
+	}
+
+	return raw, nil
+}
+
+// encodeResumeToken encodes the ID of a change stream event as an opaque token.
+func encodeResumeToken(raw bson.Raw) string {
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+type mongoUserChangeStream struct {
+	stream *mongo.ChangeStream
+}
+
+// Next implements UserChangeStream.
+func (s *mongoUserChangeStream) Next(ctx context.Context) (*model.UserChange, error) {
+	for s.stream.Next(ctx) {
+		var changeDB model.UserChangeDB
+		if err := s.stream.Decode(&changeDB); err != nil {
+			return nil, err
+		}
+
+		change, ok := changeDB.ToUserChange()
+		if !ok {
+			continue
+		}
+		change.ResumeToken = encodeResumeToken(changeDB.ID)
+		return change, nil
+	}
+
+	if err := s.stream.Err(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Close implements UserChangeStream.
+func (s *mongoUserChangeStream) Close(ctx context.Context) error {
+	return s.stream.Close(ctx)
+}
+
+// Ensure MongoUserWatcher implements the UserWatcher interface
+var _ UserWatcher = &MongoUserWatcher{}
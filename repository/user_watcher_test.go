@@ -0,0 +1,49 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/BerryTracer/user-service/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TestParseResumeToken tests that resume tokens decode back to the change stream event ID
+func TestParseResumeToken(t *testing.T) {
+	raw, _ := bson.Marshal(bson.M{"_data": "82658f"})
+
+	// Call the method
+	parsed, err := repository.ParseResumeToken(base64.RawURLEncoding.EncodeToString(raw))
+
+	// Assertions
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if parsed.Lookup("_data").StringValue() != "82658f" {
+		t.Errorf("unexpected resume token %v", parsed)
+	}
+}
+
+// TestMongoUserWatcher_WatchUsers_InvalidResumeToken tests that malformed tokens are rejected before opening a stream
+func TestMongoUserWatcher_WatchUsers_InvalidResumeToken(t *testing.T) {
+	opened := false
+	watcher := repository.NewMongoUserWatcher(func(ctx context.Context, resumeAfter bson.Raw) (*mongo.ChangeStream, error) {
+		opened = true
+		return nil, nil
+	})
+
+	for _, token := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("not bson"))} {
+		// Call the method
+		_, err := watcher.WatchUsers(context.Background(), token)
+
+		// Assertions
+		if err != repository.ErrInvalidResumeToken {
+			t.Errorf("expected %v for %q, got %v", repository.ErrInvalidResumeToken, token, err)
+		}
+	}
+	if opened {
+		t.Errorf("expected no change stream to be opened")
+	}
+}
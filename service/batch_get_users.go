@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/BerryTracer/user-service/model"
+)
+
+// MaxBatchSize caps the number of IDs, and separately of emails and of usernames,
+// in one BatchGetUsers request.
+const MaxBatchSize = 500
+
+// UserLookupResult is the outcome of looking up one key of a batch. User is nil
+// when no user matches the key.
+type UserLookupResult struct {
+	Key  string
+	User *model.User
+}
+
+// BatchUsers holds one result per requested ID, email and username, in the
+// order they were requested.
+type BatchUsers struct {
+	IDs       []UserLookupResult
+	Emails    []UserLookupResult
+	Usernames []UserLookupResult
+}
+
+// BatchGetUsers implements UserService. Like the single lookups, emails and
+// usernames match regardless of how they are written.
+func (s *UserServiceImpl) BatchGetUsers(ctx context.Context, ids, emails, usernames []string) (*BatchUsers, error) {
+	violations := &model.ValidationError{}
+	for _, keys := range []struct {
+		field string
+		keys  []string
+	}{{"ids", ids}, {"emails", emails}, {"usernames", usernames}} {
+		if len(keys.keys) > MaxBatchSize {
+			violations.Add(keys.field, "must not have more than "+strconv.Itoa(MaxBatchSize)+" entries")
+		}
+	}
+	if err := violations.ErrOrNil(); err != nil {
+		return nil, err
+	}
+	if len(usernames) > 0 {
+		if err := s.checkUsernameLookup(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Keys that cannot be normalized match no user, so they are not looked up.
+	canonicalEmails := make([]string, len(emails))
+	lookupEmails := make([]string, 0, len(emails))
+	for i, email := range emails {
+		if canonical, err := s.Normalizer.Email(email); err == nil {
+			canonicalEmails[i] = canonical
+			lookupEmails = append(lookupEmails, canonical)
+		}
+	}
+
+	canonicalUsernames := make([]string, len(usernames))
+	lookupUsernames := make([]string, 0, len(usernames))
+	for i, username := range usernames {
+		if canonical := s.Normalizer.Username(username); canonical != "" {
+			canonicalUsernames[i] = canonical
+			lookupUsernames = append(lookupUsernames, canonical)
+		}
+	}
+
+	users, err := s.UserRepository.BatchGetUsers(ctx, ids, lookupEmails, lookupUsernames)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*model.User, len(users))
+	byEmail := make(map[string]*model.User, len(users))
+	byUsername := make(map[string]*model.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+		byEmail[user.EmailCanonical] = user
+		byUsername[user.UsernameCanonical] = user
+	}
+
+	batch := &BatchUsers{
+		IDs:       make([]UserLookupResult, 0, len(ids)),
+		Emails:    make([]UserLookupResult, 0, len(emails)),
+		Usernames: make([]UserLookupResult, 0, len(usernames)),
+	}
+	for _, id := range ids {
+		batch.IDs = append(batch.IDs, UserLookupResult{Key: id, User: byID[id]})
+	}
+	for i, email := range emails {
+		result := UserLookupResult{Key: email}
+		if canonicalEmails[i] != "" {
+			result.User = byEmail[canonicalEmails[i]]
+		}
+		batch.Emails = append(batch.Emails, result)
+	}
+	for i, username := range usernames {
+		result := UserLookupResult{Key: username}
+		if canonicalUsernames[i] != "" {
+			result.User = byUsername[canonicalUsernames[i]]
+		}
+		batch.Usernames = append(batch.Usernames, result)
+	}
+
+	return batch, nil
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/BerryTracer/user-service/mailer"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+)
+
+var (
+	// ErrInvalidVerificationToken is returned when a verification token is unknown, already used or expired.
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	// ErrEmailAlreadyVerified is returned when verification is requested for a verified email.
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	// ErrEmailVerificationDisabled is returned when no mailer is configured to send verification emails.
+	ErrEmailVerificationDisabled = errors.New("email verification is not configured")
+)
+
+// DefaultVerificationTTL is how long a verification token stays valid unless configured otherwise.
+const DefaultVerificationTTL = 24 * time.Hour
+
+// WithMailer enables email verification, sending verification tokens through m.
+func WithMailer(m mailer.Mailer) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.Mailer = m
+	}
+}
+
+// WithVerificationTTL sets how long verification tokens stay valid.
+func WithVerificationTTL(ttl time.Duration) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.VerificationTTL = ttl
+	}
+}
+
+// WithVerificationURL sets the page verification emails link to. The token is
+// appended as the "token" query parameter.
+func WithVerificationURL(verificationURL string) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.VerificationURL = verificationURL
+	}
+}
+
+// VerifyEmail implements UserService. Pending users become active once their
+// email is verified.
+func (s *UserServiceImpl) VerifyEmail(ctx context.Context, token string) (*model.User, error) {
+	if token == "" {
+		return nil, model.NewValidationError("token", "token is required")
+	}
+
+	tokenHash := model.HashVerificationToken(token)
+	user, err := s.UserRepository.GetUserByVerificationToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if user.EmailVerification.IsExpired(now) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	status := user.Status
+	if status == model.UserStatusPending {
+		status = model.UserStatusActive
+	}
+
+	err = s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.MarkEmailVerified(ctx, user.ID, tokenHash, now, status); err != nil {
+			return nil, err
+		}
+
+		verified := *user
+		verified.Status = status
+		verified.EmailVerifiedAt = now
+		return []*model.Event{model.NewEvent(model.EventUserEmailVerified, &verified, now)}, nil
+	})
+
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			// The token was consumed by a concurrent request.
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+
+	user.Status = status
+	user.EmailVerifiedAt = now
+	user.EmailVerification = nil
+	user.Version++
+	return user, nil
+}
+
+// ResendVerification implements UserService. Issuing a new token invalidates the previous one.
+func (s *UserServiceImpl) ResendVerification(ctx context.Context, id string) error {
+	if s.Mailer == nil {
+		return ErrEmailVerificationDisabled
+	}
+
+	user, err := s.UserRepository.GetUserById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if user.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, verification, err := s.newEmailVerification()
+	if err != nil {
+		return err
+	}
+
+	if err := s.UserRepository.SetEmailVerification(ctx, user.ID, verification); err != nil {
+		return err
+	}
+
+	return s.sendVerification(ctx, user, token)
+}
+
+// newEmailVerification generates a random verification token and the verification that stores its hash.
+func (s *UserServiceImpl) newEmailVerification() (string, model.EmailVerification, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", model.EmailVerification{}, err
+	}
+
+	verification := model.EmailVerification{
+		TokenHash: model.HashVerificationToken(token),
+		ExpiresAt: time.Now().UTC().Add(s.VerificationTTL),
+	}
+	return token, verification, nil
+}
+
+// sendVerification mails the verification token to the user.
+func (s *UserServiceImpl) sendVerification(ctx context.Context, user *model.User, token string) error {
+	body := fmt.Sprintf("Hi %s,\n\nUse this code to verify your email address: %s\n", user.Username, token)
+	if s.VerificationURL != "" {
+		link, err := tokenLink(s.VerificationURL, token)
+		if err != nil {
+			return err
+		}
+		body = fmt.Sprintf("Hi %s,\n\nOpen this link to verify your email address:\n%s\n", user.Username, link)
+	}
+	body += fmt.Sprintf("\nIt expires in %s.\n", s.VerificationTTL)
+
+	return s.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    body,
+	})
+}
+
+// randomToken returns a random token for links sent by email.
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// tokenLink appends token to pageURL as the "token" query parameter.
+func tokenLink(pageURL, token string) (string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// startEmailVerification attaches a fresh verification to a user about to be created
+// and returns its token, or an empty token when email verification is disabled.
+func (s *UserServiceImpl) startEmailVerification(user *model.User) (string, error) {
+	if s.Mailer == nil {
+		return "", nil
+	}
+
+	token, verification, err := s.newEmailVerification()
+	if err != nil {
+		return "", err
+	}
+
+	user.EmailVerification = &verification
+	return token, nil
+}
+
+// finishEmailVerification sends the verification email for a newly created user.
+// A failure is only logged: the user exists and can ask for the email again.
+func (s *UserServiceImpl) finishEmailVerification(ctx context.Context, user *model.User, token string) {
+	if token == "" {
+		return
+	}
+
+	if err := s.sendVerification(ctx, user, token); err != nil {
+		log.Printf("failed to send verification email to user %s: %v\n", user.ID, err)
+	}
+}
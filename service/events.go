@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+)
+
+// WithOutbox records an event for every change to a user in outbox, from which
+// a relay publishes them. Changes and their events are written in one
+// transaction of transactor; a nil transactor writes them one after the other.
+func WithOutbox(outbox repository.OutboxRepository, transactor repository.Transactor) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		if transactor == nil {
+			transactor = repository.NoTransaction{}
+		}
+		s.Outbox = outbox
+		s.Transactor = transactor
+	}
+}
+
+// write runs fn, which changes users through the ctx it is given, and appends
+// the events it returns to the outbox in the same transaction. Events are
+// dropped when no outbox is configured.
+func (s *UserServiceImpl) write(ctx context.Context, fn func(ctx context.Context) ([]*model.Event, error)) error {
+	if s.Outbox == nil {
+		_, err := fn(ctx)
+		return err
+	}
+
+	return s.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		events, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		return s.Outbox.Append(ctx, events...)
+	})
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/BerryTracer/user-service/mailer"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvitationsDisabled is returned by invitation operations when
+	// invitations, organizations or the mailer are not configured.
+	ErrInvitationsDisabled = errors.New("invitations are not configured")
+	// ErrInvalidInvitation is returned when an invitation token is unknown, or
+	// its invitation was accepted, revoked or has expired.
+	ErrInvalidInvitation = errors.New("invalid or expired invitation")
+	// ErrInvitationEmailMismatch is returned when a user whose email is not
+	// the invited one tries to accept an invitation.
+	ErrInvitationEmailMismatch = errors.New("invitation was sent to another email address")
+)
+
+// DefaultInvitationTTL is how long an invitation can be accepted unless configured otherwise.
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+// WithInvitations enables invitations to join organizations, which are sent
+// through the mailer. Organizations must be enabled as well.
+func WithInvitations(invitations repository.InvitationRepository) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.Invitations = invitations
+	}
+}
+
+// WithInvitationTTL sets how long invitations can be accepted.
+func WithInvitationTTL(ttl time.Duration) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.InvitationTTL = ttl
+	}
+}
+
+// WithInvitationURL sets the page invitation emails link to. The token is
+// appended as the "token" query parameter.
+func WithInvitationURL(invitationURL string) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.InvitationURL = invitationURL
+	}
+}
+
+// InviteMember implements UserService. The invitation token is mailed to the
+// invited address; the returned invitation only holds its hash.
+func (s *UserServiceImpl) InviteMember(ctx context.Context, organizationID, email, role, invitedBy string) (*model.Invitation, error) {
+	if err := s.checkInvitations(); err != nil {
+		return nil, err
+	}
+
+	violations := &model.ValidationError{}
+	canonicalEmail, err := s.Normalizer.Email(email)
+	if err != nil {
+		violations.Add("email", "invalid email format")
+	}
+	if role == "" {
+		violations.Add("role", "role is required")
+	} else if !s.RoleCatalog.Has(role) {
+		violations.Add("role", "unknown role")
+	}
+	if invitedBy == "" {
+		violations.Add("invited_by", "invited_by is required")
+	}
+	if err := violations.ErrOrNil(); err != nil {
+		return nil, err
+	}
+
+	organization, err := s.getOrganization(ctx, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	invitation := &model.Invitation{
+		ID:             primitive.NewObjectID().Hex(),
+		OrganizationID: organization.ID,
+		Email:          strings.TrimSpace(email),
+		EmailCanonical: canonicalEmail,
+		Role:           role,
+		TokenHash:      model.HashToken(token),
+		Status:         model.InvitationPending,
+		InvitedBy:      invitedBy,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(s.InvitationTTL),
+	}
+	if err := s.Invitations.CreateInvitation(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	if err := s.sendInvitation(ctx, invitation, organization, token); err != nil {
+		// Nobody can accept an invitation that was never delivered.
+		if revokeErr := s.Invitations.RevokeInvitation(ctx, invitation.ID, invitedBy, time.Now().UTC()); revokeErr != nil {
+			log.Printf("failed to revoke undelivered invitation %s: %v\n", invitation.ID, revokeErr)
+		}
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// sendInvitation mails the invitation token to the invited address.
+func (s *UserServiceImpl) sendInvitation(ctx context.Context, invitation *model.Invitation, organization *model.Organization, token string) error {
+	body := fmt.Sprintf("Hi,\n\nYou are invited to join %s as %s. Use this code to accept the invitation: %s\n", organization.Name, invitation.Role, token)
+	if s.InvitationURL != "" {
+		link, err := tokenLink(s.InvitationURL, token)
+		if err != nil {
+			return err
+		}
+		body = fmt.Sprintf("Hi,\n\nYou are invited to join %s as %s. Open this link to accept the invitation:\n%s\n", organization.Name, invitation.Role, link)
+	}
+	body += fmt.Sprintf("\nIt expires in %s.\n", s.InvitationTTL)
+
+	return s.Mailer.Send(ctx, mailer.Message{
+		To:      invitation.Email,
+		Subject: "You are invited to join " + organization.Name,
+		Body:    body,
+	})
+}
+
+// AcceptInvitation implements UserService. The user must have the invited
+// email address; they join the organization and get the role of the invitation.
+func (s *UserServiceImpl) AcceptInvitation(ctx context.Context, token, userID string) (*model.Invitation, error) {
+	invitation, err := s.pendingInvitation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.UserRepository.GetUserById(repository.WithTenant(ctx, ""), userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.EmailCanonical != invitation.EmailCanonical {
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	if err := s.acceptInvitation(ctx, invitation, user); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// CreateInvitedUser implements UserService. It creates a user with the invited
+// email address, who joins the organization and gets the role of the invitation.
+// The invitation is claimed in the same write, before the user is stored, so no
+// user is created for an invitation that was concluded meanwhile. Without an
+// outbox that write is not a transaction, and a user that then fails to be
+// stored, e.g. because the email is taken, leaves the invitation accepted.
+func (s *UserServiceImpl) CreateInvitedUser(ctx context.Context, username, email, password, token string) (*model.User, error) {
+	invitation, err := s.pendingInvitation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if canonicalEmail, err := s.Normalizer.Email(email); err != nil || canonicalEmail != invitation.EmailCanonical {
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	now := time.Now().UTC()
+	scope, assignment := invitationRole(invitation, now)
+	return s.createUser(repository.WithTenant(ctx, invitation.OrganizationID), username, email, password, func(ctx context.Context, user *model.User) ([]*model.Event, error) {
+		if err := s.claimInvitation(ctx, invitation, user.ID, now); err != nil {
+			return nil, err
+		}
+
+		user.Roles = append(user.Roles, assignment)
+		return []*model.Event{roleEvent(model.EventUserRoleAssigned, user, invitation.Role, scope, invitation.InvitedBy, now)}, nil
+	})
+}
+
+// pendingInvitation returns the pending invitation with the given token, as
+// long as ctx may see its organization.
+func (s *UserServiceImpl) pendingInvitation(ctx context.Context, token string) (*model.Invitation, error) {
+	if err := s.checkInvitations(); err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, model.NewValidationError("token", "token is required")
+	}
+
+	invitation, err := s.Invitations.GetInvitationByTokenHash(ctx, model.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvitationNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+	if invitation.StatusAt(time.Now().UTC()) != model.InvitationPending {
+		return nil, ErrInvalidInvitation
+	}
+
+	if _, err := s.getOrganization(ctx, invitation.OrganizationID); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// acceptInvitation marks the invitation accepted by user, who joins its
+// organization with its role. Users who are members already, or have the role
+// already, keep their membership and role. The role is assigned even if it
+// was removed from the catalog meanwhile, in which case it grants nothing.
+func (s *UserServiceImpl) acceptInvitation(ctx context.Context, invitation *model.Invitation, user *model.User) error {
+	now := time.Now().UTC()
+	scope, assignment := invitationRole(invitation, now)
+
+	return s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.claimInvitation(ctx, invitation, user.ID, now); err != nil {
+			return nil, err
+		}
+
+		var events []*model.Event
+		err := s.UserRepository.AddMembership(ctx, user.ID, invitation.OrganizationID)
+		switch {
+		case err == nil:
+			events = append(events, organizationEvent(model.EventUserJoinedOrganization, user, invitation.OrganizationID))
+		case !errors.Is(err, repository.ErrAlreadyMember):
+			return nil, err
+		}
+
+		err = s.UserRepository.AddRoleAssignment(ctx, user.ID, assignment)
+		switch {
+		case err == nil:
+			events = append(events, roleEvent(model.EventUserRoleAssigned, user, invitation.Role, scope, invitation.InvitedBy, now))
+		case !errors.Is(err, repository.ErrRoleAlreadyAssigned):
+			return nil, err
+		}
+		return events, nil
+	})
+}
+
+// claimInvitation marks the invitation accepted by the user with the given ID,
+// as long as it is still pending.
+func (s *UserServiceImpl) claimInvitation(ctx context.Context, invitation *model.Invitation, userID string, now time.Time) error {
+	if err := s.Invitations.AcceptInvitation(ctx, invitation.ID, userID, now); err != nil {
+		if errors.Is(err, repository.ErrInvitationNotPending) {
+			// The invitation was concluded by a concurrent request.
+			return ErrInvalidInvitation
+		}
+		return err
+	}
+
+	invitation.Status = model.InvitationAccepted
+	invitation.AcceptedAt = now
+	invitation.AcceptedBy = userID
+	return nil
+}
+
+// invitationRole returns the scope and the assignment of the role the
+// invitation grants.
+func invitationRole(invitation *model.Invitation, now time.Time) (model.Scope, model.RoleAssignment) {
+	scope := model.Scope{Type: model.ScopeTenant, ID: invitation.OrganizationID}
+	return scope, model.RoleAssignment{Role: invitation.Role, Scope: scope, AssignedAt: now, AssignedBy: invitation.InvitedBy}
+}
+
+// ListInvitations implements UserService. Invitations are listed most recent
+// first, with the given status, or with any status when status is empty.
+func (s *UserServiceImpl) ListInvitations(ctx context.Context, organizationID string, status model.InvitationStatus) ([]*model.Invitation, error) {
+	if err := s.checkInvitations(); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.getOrganization(ctx, organizationID); err != nil {
+		return nil, err
+	}
+
+	return s.Invitations.ListInvitations(ctx, organizationID, status, time.Now().UTC())
+}
+
+// RevokeInvitation implements UserService. Only pending invitations can be revoked.
+func (s *UserServiceImpl) RevokeInvitation(ctx context.Context, organizationID, invitationID, actor string) (*model.Invitation, error) {
+	if err := s.checkInvitations(); err != nil {
+		return nil, err
+	}
+	if actor == "" {
+		return nil, model.NewValidationError("actor", "actor is required")
+	}
+
+	if _, err := s.getOrganization(ctx, organizationID); err != nil {
+		return nil, err
+	}
+
+	invitation, err := s.Invitations.GetInvitation(ctx, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.OrganizationID != organizationID {
+		return nil, repository.ErrInvitationNotFound
+	}
+
+	now := time.Now().UTC()
+	if err := s.Invitations.RevokeInvitation(ctx, invitation.ID, actor, now); err != nil {
+		return nil, err
+	}
+
+	invitation.Status = model.InvitationRevoked
+	invitation.RevokedAt = now
+	invitation.RevokedBy = actor
+	return invitation, nil
+}
+
+// checkInvitations fails unless everything invitations need is configured.
+func (s *UserServiceImpl) checkInvitations() error {
+	if s.Invitations == nil || s.Organizations == nil || s.Mailer == nil {
+		return ErrInvitationsDisabled
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package service_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mockcrypto "github.com/BerryTracer/common-service/crypto/mock"
+	"github.com/BerryTracer/user-service/mailer"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	mockrepository "github.com/BerryTracer/user-service/repository/mock"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserServiceImpl_InviteMember(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockInvitations := mockrepository.NewMockInvitationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	memoryMailer := mailer.NewMemoryMailer()
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithOrganizations(mockOrganizations),
+		service.WithInvitations(mockInvitations),
+		service.WithInvitationURL("https://example.com/invitations"),
+		service.WithMailer(memoryMailer),
+	)
+
+	ctx := context.Background()
+
+	mockOrganizations.EXPECT().GetOrganization(ctx, "acme").Return(&model.Organization{ID: "acme", Name: "Acme"}, nil).Times(1)
+	mockInvitations.EXPECT().CreateInvitation(ctx, gomock.Any()).Return(nil).Times(1)
+
+	invitation, err := userService.InviteMember(ctx, "acme", " New@Example.com ", "viewer", "admin-1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "New@Example.com", invitation.Email)
+	assert.Equal(t, "new@example.com", invitation.EmailCanonical)
+	assert.Equal(t, model.InvitationPending, invitation.Status)
+	assert.Equal(t, service.DefaultInvitationTTL, invitation.ExpiresAt.Sub(invitation.CreatedAt))
+
+	// The token is only mailed, and only its hash is stored
+	messages := memoryMailer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "New@Example.com", messages[0].To)
+	link := messages[0].Body[strings.Index(messages[0].Body, "https://"):]
+	parsed, err := url.Parse(strings.Fields(link)[0])
+	require.NoError(t, err)
+	assert.Equal(t, model.HashToken(parsed.Query().Get("token")), invitation.TokenHash)
+}
+
+func TestUserServiceImpl_InviteMember_UnknownRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockInvitations := mockrepository.NewMockInvitationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithOrganizations(mockOrganizations),
+		service.WithInvitations(mockInvitations),
+		service.WithMailer(mailer.NewMemoryMailer()),
+	)
+
+	_, err := userService.InviteMember(context.Background(), "acme", "new@example.com", "owner", "admin-1")
+	assert.ErrorIs(t, err, model.ErrInvalidArgument)
+}
+
+func TestUserServiceImpl_InviteMember_Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockInvitations := mockrepository.NewMockInvitationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+
+	// Invitations cannot be delivered without a mailer
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithOrganizations(mockOrganizations),
+		service.WithInvitations(mockInvitations),
+	)
+
+	_, err := userService.InviteMember(context.Background(), "acme", "new@example.com", "viewer", "admin-1")
+	assert.ErrorIs(t, err, service.ErrInvitationsDisabled)
+}
+
+func TestUserServiceImpl_AcceptInvitation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockInvitations := mockrepository.NewMockInvitationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithOrganizations(mockOrganizations),
+		service.WithInvitations(mockInvitations),
+		service.WithMailer(mailer.NewMemoryMailer()),
+	)
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", EmailCanonical: "new@example.com", Status: model.UserStatusActive}
+	invitation := &model.Invitation{
+		ID:             "invitation-1",
+		OrganizationID: "acme",
+		EmailCanonical: "new@example.com",
+		Role:           "viewer",
+		Status:         model.InvitationPending,
+		InvitedBy:      "admin-1",
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+
+	mockInvitations.EXPECT().GetInvitationByTokenHash(ctx, model.HashToken("token")).Return(invitation, nil).Times(1)
+	mockOrganizations.EXPECT().GetOrganization(ctx, "acme").Return(&model.Organization{ID: "acme"}, nil).Times(1)
+	mockRepo.EXPECT().GetUserById(gomock.Any(), user.ID).Return(user, nil).Times(1)
+	mockInvitations.EXPECT().AcceptInvitation(gomock.Any(), invitation.ID, user.ID, gomock.Any()).Return(nil).Times(1)
+	mockRepo.EXPECT().AddMembership(gomock.Any(), user.ID, "acme").Return(nil).Times(1)
+	mockRepo.EXPECT().
+		AddRoleAssignment(gomock.Any(), user.ID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, assignment model.RoleAssignment) error {
+			assert.Equal(t, "viewer", assignment.Role)
+			assert.Equal(t, model.Scope{Type: model.ScopeTenant, ID: "acme"}, assignment.Scope)
+			assert.Equal(t, "admin-1", assignment.AssignedBy)
+			return nil
+		}).
+		Times(1)
+
+	accepted, err := userService.AcceptInvitation(ctx, "token", user.ID)
+
+	require.NoError(t, err)
+	assert.Equal(t, model.InvitationAccepted, accepted.Status)
+	assert.Equal(t, user.ID, accepted.AcceptedBy)
+}
+
+func TestUserServiceImpl_AcceptInvitation_EmailMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockInvitations := mockrepository.NewMockInvitationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithOrganizations(mockOrganizations),
+		service.WithInvitations(mockInvitations),
+		service.WithMailer(mailer.NewMemoryMailer()),
+	)
+
+	ctx := context.Background()
+	invitation := &model.Invitation{
+		ID:             "invitation-1",
+		OrganizationID: "acme",
+		EmailCanonical: "new@example.com",
+		Status:         model.InvitationPending,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+
+	mockInvitations.EXPECT().GetInvitationByTokenHash(ctx, model.HashToken("token")).Return(invitation, nil).Times(1)
+	mockOrganizations.EXPECT().GetOrganization(ctx, "acme").Return(&model.Organization{ID: "acme"}, nil).Times(1)
+	mockRepo.EXPECT().GetUserById(gomock.Any(), "12345").Return(&model.User{ID: "12345", EmailCanonical: "other@example.com"}, nil).Times(1)
+
+	_, err := userService.AcceptInvitation(ctx, "token", "12345")
+	assert.ErrorIs(t, err, service.ErrInvitationEmailMismatch)
+}
+
+func TestUserServiceImpl_AcceptInvitation_Expired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockInvitations := mockrepository.NewMockInvitationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithOrganizations(mockOrganizations),
+		service.WithInvitations(mockInvitations),
+		service.WithMailer(mailer.NewMemoryMailer()),
+	)
+
+	ctx := context.Background()
+	invitation := &model.Invitation{ID: "invitation-1", OrganizationID: "acme", Status: model.InvitationPending, ExpiresAt: time.Now().Add(-time.Minute)}
+
+	mockInvitations.EXPECT().GetInvitationByTokenHash(ctx, model.HashToken("token")).Return(invitation, nil).Times(1)
+
+	_, err := userService.AcceptInvitation(ctx, "token", "12345")
+	assert.ErrorIs(t, err, service.ErrInvalidInvitation)
+}
+
+func TestUserServiceImpl_CreateInvitedUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockInvitations := mockrepository.NewMockInvitationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithOrganizations(mockOrganizations),
+		service.WithInvitations(mockInvitations),
+		service.WithMailer(mailer.NewMemoryMailer()),
+	)
+
+	ctx := context.Background()
+	invitation := &model.Invitation{
+		ID:             "invitation-1",
+		OrganizationID: "acme",
+		EmailCanonical: "new@example.com",
+		Role:           "viewer",
+		Status:         model.InvitationPending,
+		InvitedBy:      "admin-1",
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+
+	mockInvitations.EXPECT().GetInvitationByTokenHash(ctx, model.HashToken("token")).Return(invitation, nil).Times(1)
+	mockOrganizations.EXPECT().GetOrganization(gomock.Any(), "acme").Return(&model.Organization{ID: "acme"}, nil).Times(2)
+	mockHasher.EXPECT().HashPassword("correct-horse-battery").Return("hashedPassword", nil).Times(1)
+
+	// The invitation is claimed before the user is stored
+	gomock.InOrder(
+		mockInvitations.EXPECT().AcceptInvitation(gomock.Any(), invitation.ID, gomock.Any(), gomock.Any()).Return(nil).Times(1),
+		mockRepo.EXPECT().
+			CreateUser(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, u *model.User) error {
+				assert.Equal(t, []string{"acme"}, u.OrganizationIDs)
+				require.Len(t, u.Roles, 1)
+				assert.Equal(t, "viewer", u.Roles[0].Role)
+				assert.Equal(t, model.Scope{Type: model.ScopeTenant, ID: "acme"}, u.Roles[0].Scope)
+				return nil
+			}).
+			Times(1),
+	)
+
+	user, err := userService.CreateInvitedUser(ctx, "newuser", "new@example.com", "correct-horse-battery", "token")
+
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, invitation.AcceptedBy)
+}
+
+func TestUserServiceImpl_CreateInvitedUser_ClaimFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockInvitations := mockrepository.NewMockInvitationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithOrganizations(mockOrganizations),
+		service.WithInvitations(mockInvitations),
+		service.WithMailer(mailer.NewMemoryMailer()),
+	)
+
+	ctx := context.Background()
+	invitation := &model.Invitation{
+		ID:             "invitation-1",
+		OrganizationID: "acme",
+		EmailCanonical: "new@example.com",
+		Role:           "viewer",
+		Status:         model.InvitationPending,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+
+	// The invitation is revoked meanwhile, so no user is created
+	mockInvitations.EXPECT().GetInvitationByTokenHash(ctx, model.HashToken("token")).Return(invitation, nil).Times(1)
+	mockOrganizations.EXPECT().GetOrganization(gomock.Any(), "acme").Return(&model.Organization{ID: "acme"}, nil).Times(2)
+	mockHasher.EXPECT().HashPassword("correct-horse-battery").Return("hashedPassword", nil).Times(1)
+	mockInvitations.EXPECT().AcceptInvitation(gomock.Any(), invitation.ID, gomock.Any(), gomock.Any()).Return(repository.ErrInvitationNotPending).Times(1)
+
+	_, err := userService.CreateInvitedUser(ctx, "newuser", "new@example.com", "correct-horse-battery", "token")
+	assert.ErrorIs(t, err, service.ErrInvalidInvitation)
+}
+
+func TestUserServiceImpl_RevokeInvitation_OtherOrganization(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockInvitations := mockrepository.NewMockInvitationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithOrganizations(mockOrganizations),
+		service.WithInvitations(mockInvitations),
+		service.WithMailer(mailer.NewMemoryMailer()),
+	)
+
+	ctx := context.Background()
+
+	// Invitations of another organization are not found through this one
+	mockOrganizations.EXPECT().GetOrganization(ctx, "acme").Return(&model.Organization{ID: "acme"}, nil).Times(1)
+	mockInvitations.EXPECT().GetInvitation(ctx, "invitation-1").Return(&model.Invitation{ID: "invitation-1", OrganizationID: "globex"}, nil).Times(1)
+
+	_, err := userService.RevokeInvitation(ctx, "acme", "invitation-1", "admin-1")
+	assert.ErrorIs(t, err, repository.ErrInvitationNotFound)
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+)
+
+var (
+	// ErrTooManyAttempts is returned while failed attempts from a client or on a user are being slowed down.
+	ErrTooManyAttempts = errors.New("too many failed attempts, try again later")
+	// ErrAccountLocked is returned while a user is locked out after many failed attempts.
+	ErrAccountLocked = errors.New("account is temporarily locked after too many failed attempts")
+)
+
+// RetryAfterError is ErrTooManyAttempts or ErrAccountLocked along with when to try again.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// LockoutPolicy decides how failed attempts under a key slow further attempts down.
+type LockoutPolicy struct {
+	// FreeAttempts is how many failures are allowed before attempts are delayed.
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure beyond FreeAttempts. It
+	// doubles with every further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAttempts is how many failures lock the key out, which is reported
+	// as ErrAccountLocked rather than ErrTooManyAttempts. Zero never locks out.
+	LockoutAttempts int
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// DefaultUserLockoutPolicy returns the policy for failed attempts on a user.
+func DefaultUserLockoutPolicy() *LockoutPolicy {
+	return &LockoutPolicy{
+		FreeAttempts:    5,
+		BaseDelay:       time.Second,
+		MaxDelay:        15 * time.Minute,
+		LockoutAttempts: 10,
+		Window:          time.Hour,
+	}
+}
+
+// DefaultIPLockoutPolicy returns the policy for failed attempts from a client
+// IP, which may be shared by many users behind a NAT.
+func DefaultIPLockoutPolicy() *LockoutPolicy {
+	return &LockoutPolicy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+}
+
+// locksOut reports whether the given number of failures locks the key out.
+func (p *LockoutPolicy) locksOut(failures int) bool {
+	return p.LockoutAttempts > 0 && failures >= p.LockoutAttempts
+}
+
+// blockedUntil returns, for every number of failures, until when attempts are
+// refused after a failure at time now. Numbers past the last entry are refused
+// as long as the last entry says.
+func (p *LockoutPolicy) blockedUntil(now time.Time) []time.Time {
+	var until []time.Time
+	for failures := 0; ; failures++ {
+		delay := p.Delay(failures)
+		until = append(until, now.Add(delay))
+		if failures > p.FreeAttempts && (delay >= p.MaxDelay || delay == p.Delay(failures-1)) {
+			return until
+		}
+	}
+}
+
+// Delay returns how long attempts are refused after the given number of failures.
+func (p *LockoutPolicy) Delay(failures int) time.Duration {
+	excess := failures - p.FreeAttempts
+	if excess <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < excess && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// WithLockout enables counting failed attempts in attempts, slowing down and
+// locking out guessing of passwords and MFA codes.
+func WithLockout(attempts repository.LoginAttemptRepository) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.LoginAttempts = attempts
+	}
+}
+
+// WithLockoutPolicies replaces the default lockout policies for users and client IPs.
+func WithLockoutPolicies(user, ip *LockoutPolicy) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.UserLockoutPolicy = user
+		s.IPLockoutPolicy = ip
+	}
+}
+
+// lockoutActor is the actor recorded when the lockout locks or unlocks a user.
+const lockoutActor = "lockout"
+
+type clientIPKey struct{}
+
+// WithClientIP returns a context carrying the IP address of the client making
+// a request, under which failed attempts are counted as well.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the IP address of the client making the request
+// in ctx, or an empty string when it is unknown.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// attemptKey is a key failed attempts are counted under, with its policy.
+type attemptKey struct {
+	key    string
+	policy *LockoutPolicy
+}
+
+func (s *UserServiceImpl) userAttemptKey(id string) attemptKey {
+	return attemptKey{key: "user:" + id, policy: s.UserLockoutPolicy}
+}
+
+// ipAttemptKeys returns the key of the client IP in ctx, if there is one.
+func (s *UserServiceImpl) ipAttemptKeys(ctx context.Context) []attemptKey {
+	ip := ClientIPFromContext(ctx)
+	if ip == "" {
+		return nil
+	}
+	return []attemptKey{{key: "ip:" + ip, policy: s.IPLockoutPolicy}}
+}
+
+// refusal returns the error refusing attempts under k, as they stand at time now.
+func (k attemptKey) refusal(attempts *model.LoginAttempts, now time.Time) error {
+	err := ErrTooManyAttempts
+	if k.policy.locksOut(attempts.Failures) {
+		err = ErrAccountLocked
+	}
+
+	// A refusal always tells clients to wait, even if its block had ended
+	// by the time it was read back.
+	retryAfter := attempts.BlockedUntil.Sub(now)
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return &RetryAfterError{Err: err, RetryAfter: retryAfter}
+}
+
+// guard runs check, an attempt at proving an identity, unless attempts under
+// any of keys are refused. The attempt is counted as a failure under every key
+// before check runs, and taken back unless check fails with one of failures,
+// so that concurrent attempts cannot get past a limit together. It returns
+// the attempts under each key as counted.
+func (s *UserServiceImpl) guard(ctx context.Context, now time.Time, keys []attemptKey, check func() error, failures ...error) ([]*model.LoginAttempts, error) {
+	if s.LoginAttempts == nil {
+		return nil, check()
+	}
+
+	counted := make([]*model.LoginAttempts, 0, len(keys))
+	for i, k := range keys {
+		attempts, ok, err := s.LoginAttempts.RecordAttempt(ctx, k.key, now, now.Add(k.policy.Window), k.policy.blockedUntil(now))
+		if err == nil && !ok {
+			err = k.refusal(attempts, now)
+		}
+		if err != nil {
+			s.refundAttempts(ctx, keys[:i]...)
+			return nil, err
+		}
+		counted = append(counted, attempts)
+	}
+
+	err := check()
+	for _, failure := range failures {
+		if errors.Is(err, failure) {
+			return counted, err
+		}
+	}
+	s.refundAttempts(ctx, keys...)
+	return counted, err
+}
+
+// refundAttempts takes back an attempt counted under each of keys. Failures
+// to do so are only logged, as they only slow the client down.
+func (s *UserServiceImpl) refundAttempts(ctx context.Context, keys ...attemptKey) {
+	for _, k := range keys {
+		if err := s.LoginAttempts.RefundAttempt(ctx, k.key); err != nil {
+			log.Printf("failed to take back attempt for %s: %v\n", k.key, err)
+		}
+	}
+}
+
+// resetAttempts forgets the failed attempts on a user after a success. Client
+// IPs keep their count, so that one valid account does not let a client
+// guess at others.
+func (s *UserServiceImpl) resetAttempts(ctx context.Context, user *model.User) {
+	if s.LoginAttempts == nil {
+		return
+	}
+
+	if err := s.LoginAttempts.ResetAttempts(ctx, s.userAttemptKey(user.ID).key); err != nil {
+		log.Printf("failed to reset failed attempts of user %s: %v\n", user.ID, err)
+	}
+}
+
+// guardAttempt runs check, an attempt at proving to be user, unless attempts
+// on user or from the client are refused. A failure of check counts against
+// both when it is one of failures. Active users whose failures lock them out
+// are locked until their attempts are accepted again.
+func (s *UserServiceImpl) guardAttempt(ctx context.Context, user *model.User, check func() error, failures ...error) error {
+	now := time.Now().UTC()
+	userKey := s.userAttemptKey(user.ID)
+	if err := s.unlockUser(ctx, user, userKey, now); err != nil {
+		return err
+	}
+
+	counted, err := s.guard(ctx, now, append(s.ipAttemptKeys(ctx), userKey), check, failures...)
+	if err != nil && len(counted) > 0 && userKey.policy.locksOut(counted[len(counted)-1].Failures) {
+		s.lockUser(ctx, user)
+	}
+	return err
+}
+
+// lockUser locks out an active user. A failure is only logged, as their
+// attempts are refused either way.
+func (s *UserServiceImpl) lockUser(ctx context.Context, user *model.User) {
+	if user.Status != model.UserStatusActive {
+		return
+	}
+
+	if _, err := s.changeStatus(ctx, user.ID, model.UserStatusLocked, "too many failed attempts", lockoutActor, model.UserStatusActive); err != nil {
+		log.Printf("failed to lock out user %s: %v\n", user.ID, err)
+	}
+}
+
+// unlockUser reactivates a locked user once attempts on them are accepted
+// again, or refuses the attempt while they are not.
+func (s *UserServiceImpl) unlockUser(ctx context.Context, user *model.User, userKey attemptKey, now time.Time) error {
+	if user.Status != model.UserStatusLocked || s.LoginAttempts == nil {
+		return nil
+	}
+
+	attempts, err := s.LoginAttempts.GetAttempts(ctx, userKey.key, now)
+	if err != nil {
+		return err
+	}
+	if attempts.IsBlocked(now) {
+		return userKey.refusal(attempts, now)
+	}
+
+	unlocked, err := s.changeStatus(ctx, user.ID, model.UserStatusActive, "lockout ended", lockoutActor, model.UserStatusLocked)
+	if err != nil {
+		return err
+	}
+	user.Status = unlocked.Status
+	user.LastStatusChange = unlocked.LastStatusChange
+	user.Version = unlocked.Version
+	return nil
+}
@@ -0,0 +1,270 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mockcrypto "github.com/BerryTracer/common-service/crypto/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	mockrepository "github.com/BerryTracer/user-service/repository/mock"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLockoutUser() *model.User {
+	return &model.User{ID: "12345", Username: "testuser", Email: "test@example.com", HashedPassword: "hashedPassword", Status: model.UserStatusActive}
+}
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	policy := service.DefaultUserLockoutPolicy()
+
+	assert.Equal(t, time.Duration(0), policy.Delay(0))
+	assert.Equal(t, time.Duration(0), policy.Delay(5))
+	assert.Equal(t, time.Second, policy.Delay(6))
+	assert.Equal(t, 2*time.Second, policy.Delay(7))
+	assert.Equal(t, 16*time.Second, policy.Delay(10))
+	assert.Equal(t, 15*time.Minute, policy.Delay(100))
+}
+
+// TestUserServiceImpl_AuthenticateUser_Blocked tests that a blocked user is refused before the password is compared
+func TestUserServiceImpl_AuthenticateUser_Blocked(t *testing.T) {
+	tests := []struct {
+		name           string
+		failures       int
+		blockedFor     time.Duration
+		wantErr        error
+		wantRetryAfter time.Duration
+	}{
+		{name: "delayed", failures: 7, blockedFor: time.Minute, wantErr: service.ErrTooManyAttempts, wantRetryAfter: time.Minute},
+		{name: "locked out", failures: 10, blockedFor: time.Minute, wantErr: service.ErrAccountLocked, wantRetryAfter: time.Minute},
+		{name: "block ended when read back", failures: 7, wantErr: service.ErrTooManyAttempts, wantRetryAfter: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mockrepository.NewMockUserRepository(ctrl)
+			mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+			mockAttempts := mockrepository.NewMockLoginAttemptRepository(ctrl)
+			userService := service.NewUserService(mockRepo, mockHasher, service.WithLockout(mockAttempts))
+
+			ctx := context.Background()
+			user := newLockoutUser()
+
+			mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), user.Username).Return(user, nil).Times(1)
+			mockAttempts.EXPECT().
+				RecordAttempt(ctx, "user:12345", gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, key string, now, expiresAt time.Time, blockedUntil []time.Time) (*model.LoginAttempts, bool, error) {
+					return &model.LoginAttempts{Key: key, Failures: tt.failures, BlockedUntil: now.Add(tt.blockedFor)}, false, nil
+				}).
+				Times(1)
+
+			// The password is never compared, not even a correct one
+			_, err := userService.AuthenticateUser(ctx, user.Username, "correct-horse-battery", "")
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			var retryErr *service.RetryAfterError
+			require.True(t, errors.As(err, &retryErr))
+			assert.Equal(t, tt.wantRetryAfter, retryErr.RetryAfter)
+		})
+	}
+}
+
+// TestUserServiceImpl_AuthenticateUser_RecordsFailure tests that a wrong password counts against the user and the client IP
+func TestUserServiceImpl_AuthenticateUser_RecordsFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockAttempts := mockrepository.NewMockLoginAttemptRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithLockout(mockAttempts))
+
+	ctx := service.WithClientIP(context.Background(), "203.0.113.7")
+	user := newLockoutUser()
+
+	mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), user.Username).Return(user, nil).Times(1)
+
+	// The attempt is counted before the password is compared, and stays counted
+	gomock.InOrder(
+		mockAttempts.EXPECT().
+			RecordAttempt(ctx, "ip:203.0.113.7", gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&model.LoginAttempts{Key: "ip:203.0.113.7", Failures: 6}, true, nil).
+			Times(1),
+		mockAttempts.EXPECT().
+			RecordAttempt(ctx, "user:12345", gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, key string, now, expiresAt time.Time, blockedUntil []time.Time) (*model.LoginAttempts, bool, error) {
+				assert.Equal(t, now.Add(time.Hour), expiresAt)
+				assert.Equal(t, now, blockedUntil[5])
+				assert.Equal(t, now.Add(time.Second), blockedUntil[6])
+				assert.Equal(t, now.Add(15*time.Minute), blockedUntil[len(blockedUntil)-1])
+				return &model.LoginAttempts{Key: key, Failures: 6}, true, nil
+			}).
+			Times(1),
+		mockHasher.EXPECT().ComparePassword("wrong", user.HashedPassword).Return(errors.New("mismatch")).Times(1),
+	)
+
+	_, err := userService.AuthenticateUser(ctx, user.Username, "wrong", "")
+
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+}
+
+// TestUserServiceImpl_AuthenticateUser_ResetsAttempts tests that signing in takes back the attempt and forgets the failed attempts on the user
+func TestUserServiceImpl_AuthenticateUser_ResetsAttempts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockAttempts := mockrepository.NewMockLoginAttemptRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithLockout(mockAttempts))
+
+	ctx := service.WithClientIP(context.Background(), "203.0.113.7")
+	user := newLockoutUser()
+
+	mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), user.Username).Return(user, nil).Times(1)
+	mockAttempts.EXPECT().
+		RecordAttempt(ctx, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, now, expiresAt time.Time, blockedUntil []time.Time) (*model.LoginAttempts, bool, error) {
+			return &model.LoginAttempts{Key: key, Failures: 3}, true, nil
+		}).
+		Times(2)
+	mockHasher.EXPECT().ComparePassword("correct-horse-battery", user.HashedPassword).Return(nil).Times(1)
+	mockAttempts.EXPECT().RefundAttempt(ctx, "ip:203.0.113.7").Return(nil).Times(1)
+	mockAttempts.EXPECT().RefundAttempt(ctx, "user:12345").Return(nil).Times(1)
+	mockAttempts.EXPECT().ResetAttempts(ctx, "user:12345").Return(nil).Times(1)
+
+	authenticated, err := userService.AuthenticateUser(ctx, user.Username, "correct-horse-battery", "")
+
+	require.NoError(t, err)
+	assert.Equal(t, user, authenticated)
+}
+
+// TestUserServiceImpl_AuthenticateUser_LocksOut tests that the failure reaching the lockout locks an active user
+func TestUserServiceImpl_AuthenticateUser_LocksOut(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockAttempts := mockrepository.NewMockLoginAttemptRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithLockout(mockAttempts))
+
+	ctx := context.Background()
+	user := newLockoutUser()
+
+	mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), user.Username).Return(user, nil).Times(1)
+	mockAttempts.EXPECT().
+		RecordAttempt(ctx, "user:12345", gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&model.LoginAttempts{Key: "user:12345", Failures: 10}, true, nil).
+		Times(1)
+	mockHasher.EXPECT().ComparePassword("wrong", user.HashedPassword).Return(errors.New("mismatch")).Times(1)
+	mockRepo.EXPECT().GetUserById(ctx, "12345").Return(newLockoutUser(), nil).Times(1)
+	mockRepo.EXPECT().
+		UpdateStatus(ctx, "12345", model.UserStatusActive, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id string, from model.UserStatus, change model.StatusChange) error {
+			assert.Equal(t, model.UserStatusLocked, change.Status)
+			return nil
+		}).
+		Times(1)
+
+	_, err := userService.AuthenticateUser(ctx, user.Username, "wrong", "")
+
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+}
+
+// TestUserServiceImpl_AuthenticateUser_LockedUser tests that locked users stay locked while blocked and are unlocked afterwards
+func TestUserServiceImpl_AuthenticateUser_LockedUser(t *testing.T) {
+	t.Run("blocked", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRepo := mockrepository.NewMockUserRepository(ctrl)
+		mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+		mockAttempts := mockrepository.NewMockLoginAttemptRepository(ctrl)
+		userService := service.NewUserService(mockRepo, mockHasher, service.WithLockout(mockAttempts))
+
+		ctx := context.Background()
+		user := newLockoutUser()
+		user.Status = model.UserStatusLocked
+
+		mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), user.Username).Return(user, nil).Times(1)
+		mockAttempts.EXPECT().
+			GetAttempts(ctx, "user:12345", gomock.Any()).
+			DoAndReturn(func(ctx context.Context, key string, now time.Time) (*model.LoginAttempts, error) {
+				return &model.LoginAttempts{Key: key, Failures: 10, BlockedUntil: now.Add(time.Minute)}, nil
+			}).
+			Times(1)
+
+		_, err := userService.AuthenticateUser(ctx, user.Username, "correct-horse-battery", "")
+
+		assert.ErrorIs(t, err, service.ErrAccountLocked)
+	})
+
+	t.Run("unlocked", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockRepo := mockrepository.NewMockUserRepository(ctrl)
+		mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+		mockAttempts := mockrepository.NewMockLoginAttemptRepository(ctrl)
+		userService := service.NewUserService(mockRepo, mockHasher, service.WithLockout(mockAttempts))
+
+		ctx := context.Background()
+		user := newLockoutUser()
+		user.Status = model.UserStatusLocked
+		stored := *user
+
+		mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), user.Username).Return(user, nil).Times(1)
+		mockAttempts.EXPECT().
+			GetAttempts(ctx, "user:12345", gomock.Any()).
+			Return(&model.LoginAttempts{Key: "user:12345", Failures: 10}, nil).
+			Times(1)
+		mockRepo.EXPECT().GetUserById(ctx, "12345").Return(&stored, nil).Times(1)
+		mockRepo.EXPECT().UpdateStatus(ctx, "12345", model.UserStatusLocked, gomock.Any()).Return(nil).Times(1)
+		mockAttempts.EXPECT().
+			RecordAttempt(ctx, "user:12345", gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&model.LoginAttempts{Key: "user:12345", Failures: 11}, true, nil).
+			Times(1)
+		mockHasher.EXPECT().ComparePassword("correct-horse-battery", user.HashedPassword).Return(nil).Times(1)
+		mockAttempts.EXPECT().RefundAttempt(ctx, "user:12345").Return(nil).Times(1)
+		mockAttempts.EXPECT().ResetAttempts(ctx, "user:12345").Return(nil).Times(1)
+
+		authenticated, err := userService.AuthenticateUser(ctx, user.Username, "correct-horse-battery", "")
+
+		require.NoError(t, err)
+		assert.Equal(t, model.UserStatusActive, authenticated.Status)
+	})
+}
+
+// TestUserServiceImpl_AuthenticateUser_UnknownLogin tests that guessing at logins counts against the client IP
+func TestUserServiceImpl_AuthenticateUser_UnknownLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockAttempts := mockrepository.NewMockLoginAttemptRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithLockout(mockAttempts))
+
+	ctx := service.WithClientIP(context.Background(), "203.0.113.7")
+
+	mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), "nobody").Return(nil, repository.ErrUserNotFound).Times(1)
+	mockHasher.EXPECT().HashPassword(gomock.Any()).Return("dummyHash", nil).Times(1)
+	mockHasher.EXPECT().ComparePassword("correct-horse-battery", "dummyHash").Return(errors.New("mismatch")).Times(1)
+	mockAttempts.EXPECT().
+		RecordAttempt(ctx, "ip:203.0.113.7", gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&model.LoginAttempts{Key: "ip:203.0.113.7", Failures: 1}, true, nil).
+		Times(1)
+
+	_, err := userService.AuthenticateUser(ctx, "nobody", "correct-horse-battery", "")
+
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+}
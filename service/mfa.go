@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/BerryTracer/user-service/mfa"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+)
+
+var (
+	// ErrMFARequired is returned when valid credentials belong to a user with MFA but no code was given.
+	ErrMFARequired = errors.New("mfa code required")
+	// ErrInvalidMFACode is returned when a TOTP or recovery code is wrong or was already used.
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+	// ErrMFAAlreadyEnabled is returned when enrolling a user whose MFA is enabled.
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+	// ErrMFANotEnabled is returned when disabling MFA of a user without it.
+	ErrMFANotEnabled = errors.New("mfa is not enabled")
+	// ErrNoMFAEnrollment is returned when confirming an enrollment that was never started.
+	ErrNoMFAEnrollment = errors.New("no mfa enrollment in progress")
+	// ErrMFADisabled is returned by MFA operations when no secret cipher is configured.
+	ErrMFADisabled = errors.New("mfa is not configured")
+)
+
+// DefaultMFAIssuer names the service in authenticator apps unless configured otherwise.
+const DefaultMFAIssuer = "BerryTracer"
+
+// TOTPEnrollment is what a user needs to add their account to an authenticator app.
+type TOTPEnrollment struct {
+	// Secret is the base32 secret, for apps that cannot scan URI.
+	Secret string
+	// URI is the otpauth URI, usually shown as a QR code.
+	URI string
+}
+
+// WithMFA enables MFA, encrypting TOTP secrets with cipher. Issuer names the
+// service in authenticator apps.
+func WithMFA(cipher mfa.Cipher, issuer string) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.SecretCipher = cipher
+		s.MFAIssuer = issuer
+	}
+}
+
+// BeginTOTPEnrollment implements UserService. It generates a new secret, which
+// only takes effect once ConfirmTOTPEnrollment is called with a code from it.
+// The current password is required, so that nobody else can enroll a secret
+// they control and lock the user out. Wrong passwords count as failed attempts.
+func (s *UserServiceImpl) BeginTOTPEnrollment(ctx context.Context, userID, password string) (*TOTPEnrollment, error) {
+	if s.SecretCipher == nil {
+		return nil, ErrMFADisabled
+	}
+
+	user, err := s.UserRepository.GetUserById(repository.WithCredentials(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.guardAttempt(ctx, user, func() error {
+		if err := s.PasswordHasher.ComparePassword(password, user.HashedPassword); err != nil {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}, ErrInvalidCredentials)
+	if err != nil {
+		return nil, err
+	}
+	s.resetAttempts(ctx, user)
+
+	if user.HasMFA() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := mfa.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	encryptedSecret, err := s.SecretCipher.Encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.UserRepository.StartMFAEnrollment(ctx, user.ID, encryptedSecret); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: mfa.EncodeSecret(secret),
+		URI:    mfa.KeyURI(s.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment implements UserService. A valid code from the new
+// secret enables MFA. The recovery codes returned are only ever shown here.
+func (s *UserServiceImpl) ConfirmTOTPEnrollment(ctx context.Context, userID, code string) ([]string, error) {
+	if s.SecretCipher == nil {
+		return nil, ErrMFADisabled
+	}
+
+	user, err := s.UserRepository.GetUserById(repository.WithCredentials(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.HasMFA() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFA == nil {
+		return nil, ErrNoMFAEnrollment
+	}
+
+	secret, err := s.SecretCipher.Decrypt(user.MFA.EncryptedSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var step int64
+	err = s.guardAttempt(ctx, user, func() error {
+		var ok bool
+		if step, ok = mfa.Validate(secret, strings.TrimSpace(code), now); !ok {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}, ErrInvalidMFACode)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := mfa.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	recoveryCodeHashes := make([]string, 0, len(recoveryCodes))
+	for _, recoveryCode := range recoveryCodes {
+		hash, err := s.PasswordHasher.HashPassword(mfa.NormalizeRecoveryCode(recoveryCode))
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodeHashes = append(recoveryCodeHashes, hash)
+	}
+
+	err = s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.EnableMFA(ctx, user.ID, user.MFA.EncryptedSecret, recoveryCodeHashes, now, step); err != nil {
+			return nil, err
+		}
+		return []*model.Event{model.NewUserIDEvent(model.EventUserMFAEnabled, user.ID, now)}, nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// Enrollment was confirmed or restarted concurrently.
+			return nil, ErrInvalidMFACode
+		}
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableMFA implements UserService. It takes a TOTP or recovery code, so that
+// a stolen password alone cannot turn MFA off.
+func (s *UserServiceImpl) DisableMFA(ctx context.Context, userID, code string) error {
+	if s.SecretCipher == nil {
+		return ErrMFADisabled
+	}
+
+	user, err := s.UserRepository.GetUserById(repository.WithCredentials(ctx), userID)
+	if err != nil {
+		return err
+	}
+	if !user.HasMFA() {
+		return ErrMFANotEnabled
+	}
+
+	err = s.guardAttempt(ctx, user, func() error {
+		return s.verifyMFACode(ctx, user, code)
+	}, ErrInvalidMFACode)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.DisableMFA(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		return []*model.Event{model.NewUserIDEvent(model.EventUserMFADisabled, user.ID, time.Now().UTC())}, nil
+	})
+}
+
+// checkMFA completes the authentication of user with their second factor, if
+// they have one. Without a cipher, users with MFA cannot sign in rather than
+// sign in without it.
+func (s *UserServiceImpl) checkMFA(ctx context.Context, user *model.User, code string) error {
+	if !user.HasMFA() {
+		return nil
+	}
+
+	if s.SecretCipher == nil {
+		log.Printf("user %s has mfa enabled but mfa is not configured, refusing sign-in\n", user.ID)
+		return ErrMFADisabled
+	}
+	if code == "" {
+		return ErrMFARequired
+	}
+
+	return s.verifyMFACode(ctx, user, code)
+}
+
+// verifyMFACode checks code as a TOTP code or, failing that form, as a
+// recovery code, and uses it up.
+func (s *UserServiceImpl) verifyMFACode(ctx context.Context, user *model.User, code string) error {
+	code = strings.TrimSpace(code)
+
+	if mfa.IsCode(code) {
+		secret, err := s.SecretCipher.Decrypt(user.MFA.EncryptedSecret)
+		if err != nil {
+			return err
+		}
+
+		step, ok := mfa.Validate(secret, code, time.Now().UTC())
+		if !ok || step <= user.MFA.LastUsedStep {
+			return ErrInvalidMFACode
+		}
+		return translateMFAError(s.UserRepository.UseTOTPStep(ctx, user.ID, step))
+	}
+
+	normalized := mfa.NormalizeRecoveryCode(code)
+	for _, hash := range user.MFA.RecoveryCodeHashes {
+		if s.PasswordHasher.ComparePassword(normalized, hash) == nil {
+			return translateMFAError(s.UserRepository.UseRecoveryCode(ctx, user.ID, hash))
+		}
+	}
+	return ErrInvalidMFACode
+}
+
+func translateMFAError(err error) error {
+	if errors.Is(err, repository.ErrMFACodeUsed) {
+		return ErrInvalidMFACode
+	}
+	return err
+}
@@ -0,0 +1,262 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mockcrypto "github.com/BerryTracer/common-service/crypto/mock"
+	"github.com/BerryTracer/user-service/mfa"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	mockrepository "github.com/BerryTracer/user-service/repository/mock"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCipher(t *testing.T) *mfa.AESCipher {
+	cipher, err := mfa.NewAESCipher(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+	return cipher
+}
+
+// newMFAUser returns an active user with MFA enabled for secret.
+func newMFAUser(t *testing.T, cipher mfa.Cipher, secret []byte, recoveryCodeHashes ...string) *model.User {
+	encryptedSecret, err := cipher.Encrypt(secret)
+	require.NoError(t, err)
+
+	return &model.User{
+		ID:             "12345",
+		Username:       "testuser",
+		Email:          "test@example.com",
+		HashedPassword: "hashedPassword",
+		Status:         model.UserStatusActive,
+		MFA: &model.MFA{
+			EncryptedSecret:    encryptedSecret,
+			EnabledAt:          time.Now().UTC().Add(-time.Hour),
+			RecoveryCodeHashes: recoveryCodeHashes,
+		},
+	}
+}
+
+// TestUserServiceImpl_TOTPEnrollment tests enrolling a user and confirming with a code from the new secret
+func TestUserServiceImpl_TOTPEnrollment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	cipher := newTestCipher(t)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithMFA(cipher, "BerryTracer"))
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", Email: "test@example.com", HashedPassword: "hashedPassword", Status: model.UserStatusActive}
+
+	var encryptedSecret []byte
+	mockRepo.EXPECT().GetUserById(repository.WithCredentials(ctx), user.ID).Return(user, nil).Times(1)
+	mockHasher.EXPECT().ComparePassword("correct-horse-battery", user.HashedPassword).Return(nil).Times(1)
+	mockRepo.EXPECT().
+		StartMFAEnrollment(ctx, user.ID, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id string, secret []byte) error {
+			encryptedSecret = secret
+			return nil
+		}).
+		Times(1)
+
+	// Call BeginTOTPEnrollment
+	enrollment, err := userService.BeginTOTPEnrollment(ctx, user.ID, "correct-horse-battery")
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/BerryTracer:test@example.com?")
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	secret, err := cipher.Decrypt(encryptedSecret)
+	require.NoError(t, err)
+	assert.Equal(t, mfa.EncodeSecret(secret), enrollment.Secret)
+
+	// Confirm with the current code
+	pending := *user
+	pending.MFA = &model.MFA{EncryptedSecret: encryptedSecret}
+	now := time.Now()
+
+	mockRepo.EXPECT().GetUserById(repository.WithCredentials(ctx), user.ID).Return(&pending, nil).Times(1)
+	mockHasher.EXPECT().HashPassword(gomock.Any()).Return("hashedCode", nil).Times(mfa.RecoveryCodeCount)
+	mockRepo.EXPECT().
+		EnableMFA(ctx, user.ID, encryptedSecret, gomock.Len(mfa.RecoveryCodeCount), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id string, secret []byte, hashes []string, enabledAt time.Time, step int64) error {
+			assert.Equal(t, mfa.Step(now), step)
+			return nil
+		}).
+		Times(1)
+
+	recoveryCodes, err := userService.ConfirmTOTPEnrollment(ctx, user.ID, mfa.Code(secret, mfa.Step(now)))
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Len(t, recoveryCodes, mfa.RecoveryCodeCount)
+}
+
+// TestUserServiceImpl_BeginTOTPEnrollment_WrongPassword tests that nobody can enroll a secret without the user's password
+func TestUserServiceImpl_BeginTOTPEnrollment_WrongPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithMFA(newTestCipher(t), "BerryTracer"))
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", Email: "test@example.com", HashedPassword: "hashedPassword", Status: model.UserStatusActive}
+
+	// No enrollment is started
+	mockRepo.EXPECT().GetUserById(repository.WithCredentials(ctx), user.ID).Return(user, nil).Times(1)
+	mockHasher.EXPECT().ComparePassword("", user.HashedPassword).Return(errors.New("mismatch")).Times(1)
+
+	// Call BeginTOTPEnrollment
+	_, err := userService.BeginTOTPEnrollment(ctx, user.ID, "")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+}
+
+// TestUserServiceImpl_ConfirmTOTPEnrollment_WrongCode tests that a wrong code leaves MFA disabled
+func TestUserServiceImpl_ConfirmTOTPEnrollment_WrongCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	cipher := newTestCipher(t)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithMFA(cipher, "BerryTracer"))
+
+	ctx := context.Background()
+	secret, _ := mfa.GenerateSecret()
+	user := newMFAUser(t, cipher, secret)
+	user.MFA.EnabledAt = time.Time{}
+
+	mockRepo.EXPECT().GetUserById(repository.WithCredentials(ctx), user.ID).Return(user, nil).Times(1)
+
+	// Call ConfirmTOTPEnrollment
+	wrongCode := mfa.Code(secret, mfa.Step(time.Now())+5)
+	_, err := userService.ConfirmTOTPEnrollment(ctx, user.ID, wrongCode)
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidMFACode)
+}
+
+// TestUserServiceImpl_AuthenticateUser_MFA tests that users with MFA need a valid, unused code to sign in
+func TestUserServiceImpl_AuthenticateUser_MFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	cipher := newTestCipher(t)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithMFA(cipher, "BerryTracer"))
+
+	ctx := context.Background()
+	secret, _ := mfa.GenerateSecret()
+	user := newMFAUser(t, cipher, secret)
+	step := mfa.Step(time.Now())
+	code := mfa.Code(secret, step)
+
+	mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), "testuser").Return(user, nil).Times(3)
+	mockHasher.EXPECT().ComparePassword("correct-horse-battery", "hashedPassword").Return(nil).Times(3)
+
+	// Without a code
+	_, err := userService.AuthenticateUser(ctx, "testuser", "correct-horse-battery", "")
+	assert.ErrorIs(t, err, service.ErrMFARequired)
+
+	// With the current code
+	mockRepo.EXPECT().UseTOTPStep(ctx, user.ID, step).Return(nil).Times(1)
+
+	authenticated, err := userService.AuthenticateUser(ctx, "testuser", "correct-horse-battery", code)
+	assert.NoError(t, err)
+	assert.Equal(t, user, authenticated)
+
+	// Replaying it once another request used it
+	mockRepo.EXPECT().UseTOTPStep(ctx, user.ID, step).Return(repository.ErrMFACodeUsed).Times(1)
+
+	_, err = userService.AuthenticateUser(ctx, "testuser", "correct-horse-battery", code)
+	assert.ErrorIs(t, err, service.ErrInvalidMFACode)
+}
+
+// TestUserServiceImpl_AuthenticateUser_RecoveryCode tests signing in with a recovery code, which is used up
+func TestUserServiceImpl_AuthenticateUser_RecoveryCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	cipher := newTestCipher(t)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithMFA(cipher, "BerryTracer"))
+
+	ctx := context.Background()
+	secret, _ := mfa.GenerateSecret()
+	user := newMFAUser(t, cipher, secret, "hash-1", "hash-2")
+
+	mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), "testuser").Return(user, nil).Times(1)
+	mockHasher.EXPECT().ComparePassword("correct-horse-battery", "hashedPassword").Return(nil).Times(1)
+	mockHasher.EXPECT().ComparePassword("abcdefghjk", "hash-1").Return(assert.AnError).Times(1)
+	mockHasher.EXPECT().ComparePassword("abcdefghjk", "hash-2").Return(nil).Times(1)
+	mockRepo.EXPECT().UseRecoveryCode(ctx, user.ID, "hash-2").Return(nil).Times(1)
+
+	// Call AuthenticateUser
+	_, err := userService.AuthenticateUser(ctx, "testuser", "correct-horse-battery", "ABCDE-FGHJK")
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+// TestUserServiceImpl_AuthenticateUser_MFAUnconfigured tests that users with MFA cannot sign in while MFA is not configured
+func TestUserServiceImpl_AuthenticateUser_MFAUnconfigured(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	secret, _ := mfa.GenerateSecret()
+	user := newMFAUser(t, newTestCipher(t), secret)
+
+	mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), "testuser").Return(user, nil).Times(1)
+	mockHasher.EXPECT().ComparePassword("correct-horse-battery", "hashedPassword").Return(nil).Times(1)
+
+	// Call AuthenticateUser
+	_, err := userService.AuthenticateUser(ctx, "testuser", "correct-horse-battery", mfa.Code(secret, mfa.Step(time.Now())))
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrMFADisabled)
+}
+
+// TestUserServiceImpl_DisableMFA tests that disabling MFA takes a valid code
+func TestUserServiceImpl_DisableMFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	cipher := newTestCipher(t)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithMFA(cipher, "BerryTracer"))
+
+	ctx := context.Background()
+	secret, _ := mfa.GenerateSecret()
+	user := newMFAUser(t, cipher, secret)
+	step := mfa.Step(time.Now())
+
+	mockRepo.EXPECT().GetUserById(repository.WithCredentials(ctx), user.ID).Return(user, nil).Times(2)
+
+	// A wrong code
+	assert.ErrorIs(t, userService.DisableMFA(ctx, user.ID, mfa.Code(secret, step+5)), service.ErrInvalidMFACode)
+
+	// The current code
+	mockRepo.EXPECT().UseTOTPStep(ctx, user.ID, step).Return(nil).Times(1)
+	mockRepo.EXPECT().DisableMFA(ctx, user.ID).Return(nil).Times(1)
+
+	assert.NoError(t, userService.DisableMFA(ctx, user.ID, mfa.Code(secret, step)))
+}
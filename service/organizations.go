@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+)
+
+var (
+	// ErrOrganizationsDisabled is returned by organization operations when no organization repository is configured.
+	ErrOrganizationsDisabled = errors.New("organizations are not configured")
+	// ErrTenantRequired is returned by lookups by username when usernames are
+	// only unique per organization and the call is not scoped to one.
+	ErrTenantRequired = errors.New("usernames are unique per organization, so the call must be scoped to one")
+)
+
+// WithOrganizations enables organizations, whose members are kept apart from
+// those of other organizations.
+func WithOrganizations(organizations repository.OrganizationRepository) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.Organizations = organizations
+	}
+}
+
+// WithUsernamesPerOrganization only requires usernames to be unique within
+// each organization. Lookups by username must then be scoped to a tenant.
+func WithUsernamesPerOrganization() UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.UsernamesPerOrganization = true
+	}
+}
+
+// CreateOrganization implements UserService.
+func (s *UserServiceImpl) CreateOrganization(ctx context.Context, name string) (*model.Organization, error) {
+	if s.Organizations == nil {
+		return nil, ErrOrganizationsDisabled
+	}
+
+	organization := model.NewOrganization(name, time.Now().UTC())
+	if err := organization.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.Organizations.CreateOrganization(ctx, organization); err != nil {
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+// AddMember implements UserService. The user is looked up among all users, as
+// they are not a member of the organization yet.
+func (s *UserServiceImpl) AddMember(ctx context.Context, organizationID, userID string) error {
+	if _, err := s.getOrganization(ctx, organizationID); err != nil {
+		return err
+	}
+
+	ctx = repository.WithTenant(ctx, "")
+	user, err := s.UserRepository.GetUserById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.AddMembership(ctx, user.ID, organizationID); err != nil {
+			return nil, err
+		}
+		return []*model.Event{organizationEvent(model.EventUserJoinedOrganization, user, organizationID)}, nil
+	})
+}
+
+// RemoveMember implements UserService. The roles the user had in the
+// organization are revoked as well.
+func (s *UserServiceImpl) RemoveMember(ctx context.Context, organizationID, userID string) error {
+	if _, err := s.getOrganization(ctx, organizationID); err != nil {
+		return err
+	}
+
+	ctx = repository.WithTenant(ctx, "")
+	user, err := s.UserRepository.GetUserById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.RemoveMembership(ctx, user.ID, organizationID); err != nil {
+			return nil, err
+		}
+		return []*model.Event{organizationEvent(model.EventUserLeftOrganization, user, organizationID)}, nil
+	})
+}
+
+// ListMembers implements UserService. Pages are as in ListUsers.
+func (s *UserServiceImpl) ListMembers(ctx context.Context, organizationID string, pageSize int, cursor string) (*repository.UserPage, error) {
+	if _, err := s.getOrganization(ctx, organizationID); err != nil {
+		return nil, err
+	}
+
+	return s.ListUsers(repository.WithTenant(ctx, organizationID), repository.ListUsersQuery{PageSize: pageSize, Cursor: cursor})
+}
+
+// getOrganization returns the organization with the given ID. Calls scoped to
+// another tenant cannot see it.
+func (s *UserServiceImpl) getOrganization(ctx context.Context, organizationID string) (*model.Organization, error) {
+	if s.Organizations == nil {
+		return nil, ErrOrganizationsDisabled
+	}
+
+	if tenant, ok := repository.TenantFromContext(ctx); ok && tenant != organizationID {
+		return nil, repository.ErrOrganizationNotFound
+	}
+	return s.Organizations.GetOrganization(ctx, organizationID)
+}
+
+// checkUsernameLookup fails unless usernames identify a single user in ctx.
+func (s *UserServiceImpl) checkUsernameLookup(ctx context.Context) error {
+	if _, ok := repository.TenantFromContext(ctx); s.UsernamesPerOrganization && !ok {
+		return ErrTenantRequired
+	}
+	return nil
+}
+
+func organizationEvent(eventType model.EventType, user *model.User, organizationID string) *model.Event {
+	event := model.NewEvent(eventType, user, time.Now().UTC())
+	event.OrganizationID = organizationID
+	return event
+}
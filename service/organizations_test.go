@@ -0,0 +1,129 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	mockcrypto "github.com/BerryTracer/common-service/crypto/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	mockrepository "github.com/BerryTracer/user-service/repository/mock"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserServiceImpl_CreateOrganization(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithOrganizations(mockOrganizations))
+
+	ctx := context.Background()
+
+	mockOrganizations.EXPECT().CreateOrganization(ctx, gomock.Any()).Return(nil).Times(1)
+
+	organization, err := userService.CreateOrganization(ctx, "  Acme  ")
+
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", organization.Name)
+	assert.NotEmpty(t, organization.ID)
+
+	_, err = userService.CreateOrganization(ctx, " ")
+	assert.ErrorIs(t, err, model.ErrInvalidArgument)
+}
+
+func TestUserServiceImpl_AddMember(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithOrganizations(mockOrganizations))
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", Status: model.UserStatusActive}
+
+	mockOrganizations.EXPECT().GetOrganization(gomock.Any(), "acme").Return(&model.Organization{ID: "acme"}, nil).Times(1)
+	mockRepo.EXPECT().GetUserById(gomock.Any(), user.ID).Return(user, nil).Times(1)
+	mockRepo.EXPECT().AddMembership(gomock.Any(), user.ID, "acme").Return(nil).Times(1)
+
+	assert.NoError(t, userService.AddMember(ctx, "acme", user.ID))
+}
+
+func TestUserServiceImpl_AddMember_OtherTenant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithOrganizations(mockOrganizations))
+
+	// Calls scoped to one organization cannot see another
+	ctx := repository.WithTenant(context.Background(), "globex")
+
+	err := userService.AddMember(ctx, "acme", "12345")
+	assert.ErrorIs(t, err, repository.ErrOrganizationNotFound)
+}
+
+func TestUserServiceImpl_ListMembers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOrganizations := mockrepository.NewMockOrganizationRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithOrganizations(mockOrganizations))
+
+	ctx := context.Background()
+
+	mockOrganizations.EXPECT().GetOrganization(ctx, "acme").Return(&model.Organization{ID: "acme"}, nil).Times(1)
+	mockRepo.EXPECT().
+		ListUsers(gomock.Any(), repository.ListUsersQuery{PageSize: service.DefaultPageSize}).
+		DoAndReturn(func(ctx context.Context, query repository.ListUsersQuery) (*repository.UserPage, error) {
+			tenant, ok := repository.TenantFromContext(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, "acme", tenant)
+			return &repository.UserPage{}, nil
+		}).
+		Times(1)
+
+	_, err := userService.ListMembers(ctx, "acme", 0, "")
+	assert.NoError(t, err)
+}
+
+func TestUserServiceImpl_Organizations_Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	_, err := userService.CreateOrganization(context.Background(), "Acme")
+	assert.ErrorIs(t, err, service.ErrOrganizationsDisabled)
+}
+
+func TestUserServiceImpl_GetUserByUsername_TenantRequired(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithUsernamesPerOrganization())
+
+	_, err := userService.GetUserByUsername(context.Background(), "alice")
+	assert.ErrorIs(t, err, service.ErrTenantRequired)
+
+	ctx := repository.WithTenant(context.Background(), "acme")
+	mockRepo.EXPECT().GetUserByUsername(ctx, "alice").Return(&model.User{ID: "12345"}, nil).Times(1)
+
+	_, err = userService.GetUserByUsername(ctx, "alice")
+	assert.NoError(t, err)
+}
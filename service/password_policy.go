@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is the longest input bcrypt uses; anything beyond it is
+// silently ignored, so longer passwords are rejected instead.
+const bcryptMaxBytes = 72
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordPolicy decides which passwords users may choose. Lengths are counted
+// in characters; the zero value of a rule disables it.
+type PasswordPolicy struct {
+	MinLength        int
+	MaxLength        int
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUserInfo bool
+	// Blocklist holds lowercased passwords that are rejected outright.
+	Blocklist map[string]struct{}
+}
+
+// DefaultPasswordPolicy returns the policy used unless configured otherwise:
+// 8 to 64 characters, not derived from the username or email, and not on the
+// built-in list of common passwords. Character classes are not required.
+func DefaultPasswordPolicy() *PasswordPolicy {
+	p := &PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        64,
+		DisallowUserInfo: true,
+		Blocklist:        map[string]struct{}{},
+	}
+	p.addToBlocklist(strings.NewReader(commonPasswords))
+	return p
+}
+
+// LoadBlocklist adds the passwords listed in the file at path, one per line, to
+// the blocklist. Blank lines and lines starting with # are ignored.
+func (p *PasswordPolicy) LoadBlocklist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if p.Blocklist == nil {
+		p.Blocklist = map[string]struct{}{}
+	}
+	return p.addToBlocklist(f)
+}
+
+func (p *PasswordPolicy) addToBlocklist(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.Blocklist[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Violations returns a description of every rule the password breaks for the
+// user with the given username and email. It returns nil for acceptable passwords.
+func (p *PasswordPolicy) Violations(password, username, email string) []string {
+	var violations []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+	if len(password) > bcryptMaxBytes {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", bcryptMaxBytes))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if p.DisallowUserInfo && containsUserInfo(lowered, username, email) {
+		violations = append(violations, "must not contain the username or email")
+	}
+	if _, ok := p.Blocklist[lowered]; ok {
+		violations = append(violations, "is too common")
+	}
+
+	return violations
+}
+
+// containsUserInfo reports whether the lowercased password contains the username,
+// the email or the email's local part. Fragments shorter than 3 characters are ignored.
+func containsUserInfo(password, username, email string) bool {
+	fragments := []string{username, email}
+	if at := strings.LastIndex(email, "@"); at > 0 {
+		fragments = append(fragments, email[:at])
+	}
+
+	for _, fragment := range fragments {
+		fragment = strings.ToLower(fragment)
+		if utf8.RuneCountInString(fragment) >= 3 && strings.Contains(password, fragment) {
+			return true
+		}
+	}
+	return false
+}
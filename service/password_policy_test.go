@@ -0,0 +1,54 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BerryTracer/user-service/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy_Violations(t *testing.T) {
+	policy := service.DefaultPasswordPolicy()
+	policy.RequireUpper = true
+	policy.RequireDigit = true
+
+	tests := []struct {
+		name       string
+		password   string
+		violations []string
+	}{
+		{"acceptable", "Correct-horse-battery-9", nil},
+		{"empty", "", []string{
+			"must be at least 8 characters long",
+			"must contain an uppercase letter",
+			"must contain a digit",
+		}},
+		{"common", "Password1", []string{"is too common"}},
+		{"contains username", "Alice-Rocks-2024", []string{"must not contain the username or email"}},
+		{"contains email local part", "XXalice.smith99", []string{"must not contain the username or email"}},
+		{"too long", strings.Repeat("Aa1", 22), []string{"must be at most 64 characters long"}},
+		// 24 four-byte characters are within 64 characters but beyond bcrypt's 72 bytes
+		{"beyond bcrypt limit", "A1" + strings.Repeat("😀", 24), []string{"must be at most 72 bytes long"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.violations, policy.Violations(tt.password, "alice", "Alice.Smith@example.com"))
+		})
+	}
+}
+
+func TestPasswordPolicy_LoadBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# brand terms\nBerryTracer2024\n\n"), 0o600))
+
+	policy := service.DefaultPasswordPolicy()
+	assert.NoError(t, policy.LoadBlocklist(path))
+
+	assert.Equal(t, []string{"is too common"}, policy.Violations("berrytracer2024", "alice", "alice@example.com"))
+	// The built-in list is kept
+	assert.Equal(t, []string{"is too common"}, policy.Violations("qwerty123", "alice", "alice@example.com"))
+}
@@ -0,0 +1,31 @@
+package service
+
+import "golang.org/x/crypto/bcrypt"
+
+// PasswordRehashChecker reports whether a stored password hash was produced with
+// outdated parameters and should be replaced after the next successful login.
+type PasswordRehashChecker interface {
+	NeedsRehash(hashedPassword string) bool
+}
+
+type BcryptCostChecker struct {
+	Cost int
+}
+
+// NewBcryptCostChecker returns a BcryptCostChecker that flags hashes below the given cost.
+func NewBcryptCostChecker(cost int) *BcryptCostChecker {
+	return &BcryptCostChecker{Cost: cost}
+}
+
+// NeedsRehash implements PasswordRehashChecker.
+func (c *BcryptCostChecker) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	if err != nil {
+		// Not a bcrypt hash we can reason about; leave it untouched.
+		return false
+	}
+	return cost < c.Cost
+}
+
+// Ensure BcryptCostChecker implements PasswordRehashChecker.
+var _ PasswordRehashChecker = &BcryptCostChecker{}
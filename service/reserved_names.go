@@ -0,0 +1,77 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+)
+
+// LoadReservedNames replaces the configured names in names with those listed in
+// the file at path, one per line. Blank lines and lines starting with # are ignored.
+func LoadReservedNames(path string, names *model.ReservedNames) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var list []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list = append(list, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	names.Replace(list)
+	return nil
+}
+
+// WatchReservedNames reloads names from the file at path whenever the file
+// changes, checking every interval until ctx is done. Failed reloads are logged
+// and the previous names stay in effect.
+func WatchReservedNames(ctx context.Context, path string, names *model.ReservedNames, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Start from the zero time so that a change made since names was loaded is not missed.
+	var lastModified time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modified := modTime(path)
+		if modified.Equal(lastModified) {
+			continue
+		}
+
+		if err := LoadReservedNames(path, names); err != nil {
+			log.Printf("failed to reload reserved names from %s: %v\n", path, err)
+			continue
+		}
+		lastModified = modified
+		log.Printf("reloaded %d reserved names from %s\n", names.Len(), path)
+	}
+}
+
+// modTime returns the modification time of the file at path, or the zero time if it cannot be read.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
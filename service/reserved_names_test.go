@@ -0,0 +1,34 @@
+package service_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchReservedNames_ReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reserved.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# brand terms\nberrycloud\n"), 0o600))
+
+	names := model.NewReservedNames()
+	assert.NoError(t, service.LoadReservedNames(path, names))
+	assert.True(t, names.Contains("berrycloud"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.WatchReservedNames(ctx, path, names, 10*time.Millisecond)
+
+	// Make sure the new content gets a different modification time
+	assert.NoError(t, os.WriteFile(path, []byte("berryhub\n"), 0o600))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+
+	assert.Eventually(t, func() bool {
+		return names.Contains("berryhub") && !names.Contains("berrycloud")
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+)
+
+// WithRoleCatalog replaces the default catalog of roles users can be assigned.
+func WithRoleCatalog(catalog *model.RoleCatalog) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.RoleCatalog = catalog
+	}
+}
+
+// LoadRoleCatalog replaces the roles in catalog with those in the JSON file at
+// path, an object mapping role names to the permissions they grant.
+func LoadRoleCatalog(path string, catalog *model.RoleCatalog) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var roles map[string][]string
+	if err := json.Unmarshal(data, &roles); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for role, permissions := range roles {
+		if role == "" || len(permissions) == 0 {
+			return fmt.Errorf("%s: role %q must have a name and permissions", path, role)
+		}
+	}
+
+	catalog.Replace(roles)
+	return nil
+}
+
+// AssignRole implements UserService. The role must be in the catalog.
+func (s *UserServiceImpl) AssignRole(ctx context.Context, userID, role string, scope model.Scope, actor string) (*model.RoleAssignment, error) {
+	violations := roleViolations(role, scope, actor)
+	if role != "" && !s.RoleCatalog.Has(role) {
+		violations.Add("role", "unknown role")
+	}
+	if err := violations.ErrOrNil(); err != nil {
+		return nil, err
+	}
+
+	user, err := s.UserRepository.GetUserById(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	assignment := model.RoleAssignment{Role: role, Scope: scope, AssignedAt: time.Now().UTC(), AssignedBy: actor}
+	err = s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.AddRoleAssignment(ctx, user.ID, assignment); err != nil {
+			return nil, err
+		}
+		return []*model.Event{roleEvent(model.EventUserRoleAssigned, user, role, scope, actor, assignment.AssignedAt)}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &assignment, nil
+}
+
+// RevokeRole implements UserService. Roles that were removed from the catalog
+// can still be revoked.
+func (s *UserServiceImpl) RevokeRole(ctx context.Context, userID, role string, scope model.Scope, actor string) error {
+	if err := roleViolations(role, scope, actor).ErrOrNil(); err != nil {
+		return err
+	}
+
+	user, err := s.UserRepository.GetUserById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.RemoveRoleAssignment(ctx, user.ID, role, scope); err != nil {
+			return nil, err
+		}
+		return []*model.Event{roleEvent(model.EventUserRoleRevoked, user, role, scope, actor, time.Now().UTC())}, nil
+	})
+}
+
+// ListUserRoles implements UserService.
+func (s *UserServiceImpl) ListUserRoles(ctx context.Context, userID string) ([]model.RoleAssignment, error) {
+	user, err := s.UserRepository.GetUserById(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.Roles, nil
+}
+
+// CheckPermission implements UserService. A user has a permission in a scope
+// when one of their roles in that scope, or one of their global roles, grants
+// it. Users who may not sign in have no permissions.
+func (s *UserServiceImpl) CheckPermission(ctx context.Context, userID, permission string, scope model.Scope) (bool, error) {
+	violations := &model.ValidationError{}
+	if permission == "" {
+		violations.Add("permission", "permission is required")
+	}
+	addScopeViolations(violations, scope)
+	if err := violations.ErrOrNil(); err != nil {
+		return false, err
+	}
+
+	user, err := s.UserRepository.GetUserById(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !user.Status.CanAuthenticate() {
+		return false, nil
+	}
+
+	for _, assignment := range user.Roles {
+		if assignment.Scope.Covers(scope) && s.RoleCatalog.Grants(assignment.Role, permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// roleViolations checks the arguments shared by AssignRole and RevokeRole.
+func roleViolations(role string, scope model.Scope, actor string) *model.ValidationError {
+	violations := &model.ValidationError{}
+	if role == "" {
+		violations.Add("role", "role is required")
+	}
+	addScopeViolations(violations, scope)
+	if actor == "" {
+		violations.Add("actor", "actor is required")
+	}
+	return violations
+}
+
+func addScopeViolations(violations *model.ValidationError, scope model.Scope) {
+	var scopeViolations *model.ValidationError
+	if errors.As(scope.Validate(), &scopeViolations) {
+		violations.Violations = append(violations.Violations, scopeViolations.Violations...)
+	}
+}
+
+func roleEvent(eventType model.EventType, user *model.User, role string, scope model.Scope, actor string, at time.Time) *model.Event {
+	event := model.NewEvent(eventType, user, at)
+	event.Role = role
+	event.Scope = scope.String()
+	event.Actor = actor
+	return event
+}
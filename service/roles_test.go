@@ -0,0 +1,141 @@
+package service_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mockcrypto "github.com/BerryTracer/common-service/crypto/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	mockrepository "github.com/BerryTracer/user-service/repository/mock"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserServiceImpl_AssignRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", Status: model.UserStatusActive}
+	scope := model.Scope{Type: model.ScopeTenant, ID: "acme"}
+
+	mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+	mockRepo.EXPECT().
+		AddRoleAssignment(ctx, user.ID, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id string, assignment model.RoleAssignment) error {
+			assert.Equal(t, "viewer", assignment.Role)
+			assert.Equal(t, scope, assignment.Scope)
+			assert.Equal(t, "admin-tool", assignment.AssignedBy)
+			assert.False(t, assignment.AssignedAt.IsZero())
+			return nil
+		}).
+		Times(1)
+
+	assignment, err := userService.AssignRole(ctx, user.ID, "viewer", scope, "admin-tool")
+
+	require.NoError(t, err)
+	assert.Equal(t, "viewer", assignment.Role)
+}
+
+func TestUserServiceImpl_AssignRole_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	_, err := userService.AssignRole(ctx, "12345", "superuser", model.Scope{}, "admin-tool")
+	assert.ErrorIs(t, err, model.ErrInvalidArgument)
+
+	_, err = userService.AssignRole(ctx, "12345", "viewer", model.Scope{Type: model.ScopeProject}, "")
+	var violations *model.ValidationError
+	require.ErrorAs(t, err, &violations)
+	assert.Len(t, violations.Violations, 2)
+}
+
+func TestUserServiceImpl_RevokeRole_NotAssigned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", Status: model.UserStatusActive}
+
+	mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+	mockRepo.EXPECT().RemoveRoleAssignment(ctx, user.ID, "viewer", model.Scope{}).Return(repository.ErrRoleNotAssigned).Times(1)
+
+	err := userService.RevokeRole(ctx, user.ID, "viewer", model.Scope{}, "admin-tool")
+
+	assert.ErrorIs(t, err, repository.ErrRoleNotAssigned)
+}
+
+func TestUserServiceImpl_CheckPermission(t *testing.T) {
+	acme := model.Scope{Type: model.ScopeTenant, ID: "acme"}
+	globex := model.Scope{Type: model.ScopeTenant, ID: "globex"}
+
+	tests := []struct {
+		name       string
+		status     model.UserStatus
+		roles      []model.RoleAssignment
+		permission string
+		scope      model.Scope
+		allowed    bool
+	}{
+		{"global role in a tenant", model.UserStatusActive, []model.RoleAssignment{{Role: "viewer"}}, "users:read", acme, true},
+		{"tenant role in its tenant", model.UserStatusActive, []model.RoleAssignment{{Role: "user_manager", Scope: acme}}, "users:suspend", acme, true},
+		{"tenant role in another tenant", model.UserStatusActive, []model.RoleAssignment{{Role: "user_manager", Scope: acme}}, "users:suspend", globex, false},
+		{"tenant role globally", model.UserStatusActive, []model.RoleAssignment{{Role: "admin", Scope: acme}}, "users:read", model.Scope{}, false},
+		{"permission not granted", model.UserStatusActive, []model.RoleAssignment{{Role: "viewer"}}, "users:write", model.Scope{}, false},
+		{"suspended user", model.UserStatusSuspended, []model.RoleAssignment{{Role: "admin"}}, "users:read", model.Scope{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mockrepository.NewMockUserRepository(ctrl)
+			mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+			userService := service.NewUserService(mockRepo, mockHasher)
+
+			ctx := context.Background()
+			user := &model.User{ID: "12345", Status: tt.status, Roles: tt.roles}
+			mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+
+			allowed, err := userService.CheckPermission(ctx, user.ID, tt.permission, tt.scope)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, allowed)
+		})
+	}
+}
+
+func TestLoadRoleCatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roles.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"support": ["users:read", "sessions:*"]}`), 0o600))
+
+	catalog := model.DefaultRoleCatalog()
+	require.NoError(t, service.LoadRoleCatalog(path, catalog))
+
+	assert.Equal(t, []string{"support"}, catalog.Roles())
+	assert.True(t, catalog.Grants("support", "sessions:revoke"))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"support": []}`), 0o600))
+	assert.Error(t, service.LoadRoleCatalog(path, catalog))
+	assert.Equal(t, []string{"support"}, catalog.Roles())
+}
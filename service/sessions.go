@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+)
+
+// ErrSessionsDisabled is returned by session operations when tokens or sessions are not configured.
+var ErrSessionsDisabled = errors.New("session management is not configured")
+
+// WithSessions records a session for every sign-in with IssueToken, so users
+// can list and revoke them.
+func WithSessions(sessions repository.SessionRepository) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.Sessions = sessions
+	}
+}
+
+// ListSessions implements UserService. Sessions from before the last password
+// change are left out, as they can no longer be used.
+func (s *UserServiceImpl) ListSessions(ctx context.Context, userID string) ([]*model.Session, error) {
+	if s.Tokens == nil || s.Sessions == nil {
+		return nil, ErrSessionsDisabled
+	}
+
+	user, err := s.UserRepository.GetUserById(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.Sessions.ListSessions(ctx, user.ID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	active := sessions[:0]
+	for _, session := range sessions {
+		if !session.CreatedAt.Before(user.PasswordChangedAt) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// RevokeSession implements UserService. Revoking a revoked session succeeds;
+// sessions of other users are reported as not found. Like ListSessions, it
+// only reaches users visible in the tenant of ctx.
+func (s *UserServiceImpl) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if s.Tokens == nil || s.Sessions == nil {
+		return ErrSessionsDisabled
+	}
+
+	if sessionID == "" {
+		return model.NewValidationError("session_id", "session_id is required")
+	}
+
+	user, err := s.UserRepository.GetUserById(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.Sessions.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != user.ID {
+		return repository.ErrSessionNotFound
+	}
+
+	return s.revokeSession(ctx, session.ID, time.Now().UTC())
+}
+
+// RevokeAllSessions implements UserService. It signs the user out everywhere
+// but in the session exceptSessionID, if given, and returns how many sessions
+// it revoked. Like ListSessions, it only reaches users visible in the tenant
+// of ctx.
+func (s *UserServiceImpl) RevokeAllSessions(ctx context.Context, userID, exceptSessionID string) (int, error) {
+	if s.Tokens == nil || s.Sessions == nil {
+		return 0, ErrSessionsDisabled
+	}
+
+	user, err := s.UserRepository.GetUserById(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	sessions, err := s.Sessions.ListSessions(ctx, user.ID, now)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.ID == exceptSessionID {
+			continue
+		}
+		if err := s.revokeSession(ctx, session.ID, now); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// startSession records the session of a new refresh token family. Without a
+// session the user could not see the sign-in, so the family is revoked if
+// recording it fails.
+func (s *UserServiceImpl) startSession(ctx context.Context, family *model.RefreshTokenFamily, device model.SessionDevice) error {
+	if s.Sessions == nil {
+		return nil
+	}
+
+	if err := s.Sessions.CreateSession(ctx, model.NewSession(family, device)); err != nil {
+		if revokeErr := s.RefreshTokens.RevokeFamily(ctx, family.ID, family.CreatedAt); revokeErr != nil {
+			log.Printf("failed to revoke token family %s without a session: %v\n", family.ID, revokeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// touchSession records a refresh of family from device. Families issued before
+// sessions were recorded get their session on their first refresh. Failures
+// are only logged, as the family, not the session, decides whether the
+// refresh is allowed.
+func (s *UserServiceImpl) touchSession(ctx context.Context, family *model.RefreshTokenFamily, device model.SessionDevice, now time.Time) {
+	if s.Sessions == nil {
+		return
+	}
+
+	err := s.Sessions.TouchSession(ctx, family.ID, device, now, family.ExpiresAt)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		session := model.NewSession(family, device)
+		session.LastSeenAt = now
+		err = s.Sessions.CreateSession(ctx, session)
+	}
+	if err != nil {
+		log.Printf("failed to record refresh of session %s: %v\n", family.ID, err)
+	}
+}
+
+// revokeSession revokes the refresh token family of a session, ending it, then
+// the session shown to the user.
+func (s *UserServiceImpl) revokeSession(ctx context.Context, id string, now time.Time) error {
+	err := s.RefreshTokens.RevokeFamily(ctx, id, now)
+	if err != nil && !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return err
+	}
+
+	if s.Sessions == nil {
+		return nil
+	}
+
+	err = s.Sessions.RevokeSession(ctx, id, now)
+	if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	mockcrypto "github.com/BerryTracer/common-service/crypto/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	mockrepository "github.com/BerryTracer/user-service/repository/mock"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUserServiceImpl_IssueToken_RecordsSession tests that signing in records a session for the new token family
+func TestUserServiceImpl_IssueToken_RecordsSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	mockSessions := mockrepository.NewMockSessionRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithTokens(newTestIssuer(t), mockTokens), service.WithSessions(mockSessions))
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", Username: "testuser", HashedPassword: "hashedPassword", Status: model.UserStatusActive}
+	device := model.SessionDevice{Name: "  Work laptop ", UserAgent: strings.Repeat("a", 1000), IP: "203.0.113.7"}
+
+	mockRepo.EXPECT().GetUserByUsername(repository.WithCredentials(ctx), "testuser").Return(user, nil).Times(1)
+	mockHasher.EXPECT().ComparePassword("correct-horse-battery", "hashedPassword").Return(nil).Times(1)
+
+	var family *model.RefreshTokenFamily
+	mockTokens.EXPECT().
+		CreateFamily(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, f *model.RefreshTokenFamily) error {
+			family = f
+			return nil
+		}).
+		Times(1)
+	mockSessions.EXPECT().
+		CreateSession(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, session *model.Session) error {
+			assert.Equal(t, family.ID, session.ID)
+			assert.Equal(t, user.ID, session.UserID)
+			assert.Equal(t, "Work laptop", session.Device.Name)
+			assert.Len(t, session.Device.UserAgent, model.MaxUserAgentLength)
+			assert.Equal(t, "203.0.113.7", session.Device.IP)
+			assert.Equal(t, family.ExpiresAt, session.ExpiresAt)
+			return nil
+		}).
+		Times(1)
+
+	// Call IssueToken
+	_, err := userService.IssueToken(ctx, "testuser", "correct-horse-battery", "", device)
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+// TestUserServiceImpl_RefreshToken_BackfillsSession tests that refreshing a family without a session records one
+func TestUserServiceImpl_RefreshToken_BackfillsSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	mockSessions := mockrepository.NewMockSessionRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithTokens(newTestIssuer(t), mockTokens), service.WithSessions(mockSessions))
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", Status: model.UserStatusActive}
+	tokenHash := model.HashToken("refresh-token")
+	family := model.NewRefreshTokenFamily(user.ID, tokenHash, time.Now().UTC().Add(-time.Hour), service.DefaultRefreshTokenTTL)
+	device := model.SessionDevice{UserAgent: "grpc-go/1.59.0", IP: "203.0.113.7"}
+
+	mockTokens.EXPECT().GetFamilyByTokenHash(ctx, tokenHash).Return(family, nil).Times(1)
+	mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+	mockTokens.EXPECT().Rotate(ctx, family.ID, tokenHash, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	mockSessions.EXPECT().
+		TouchSession(ctx, family.ID, device, gomock.Any(), gomock.Any()).
+		Return(repository.ErrSessionNotFound).
+		Times(1)
+	mockSessions.EXPECT().
+		CreateSession(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, session *model.Session) error {
+			assert.Equal(t, family.ID, session.ID)
+			assert.Equal(t, family.CreatedAt, session.CreatedAt)
+			assert.True(t, session.LastSeenAt.After(session.CreatedAt))
+			assert.Equal(t, device, session.Device)
+			return nil
+		}).
+		Times(1)
+
+	// Call RefreshToken
+	_, err := userService.RefreshToken(ctx, "refresh-token", device)
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+// TestUserServiceImpl_ListSessions tests that sessions from before a password change are not listed
+func TestUserServiceImpl_ListSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	mockSessions := mockrepository.NewMockSessionRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithTokens(newTestIssuer(t), mockTokens), service.WithSessions(mockSessions))
+
+	ctx := context.Background()
+	changedAt := time.Now().UTC().Add(-time.Hour)
+	user := &model.User{ID: "12345", Status: model.UserStatusActive, PasswordChangedAt: changedAt}
+	current := &model.Session{ID: "current", UserID: user.ID, CreatedAt: changedAt.Add(time.Minute)}
+	stale := &model.Session{ID: "stale", UserID: user.ID, CreatedAt: changedAt.Add(-time.Minute)}
+
+	mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+	mockSessions.EXPECT().ListSessions(ctx, user.ID, gomock.Any()).Return([]*model.Session{current, stale}, nil).Times(1)
+
+	// Call ListSessions
+	sessions, err := userService.ListSessions(ctx, user.ID)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.Session{current}, sessions)
+}
+
+// TestUserServiceImpl_RevokeSession tests revoking own sessions and the sessions of other users
+func TestUserServiceImpl_RevokeSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	mockSessions := mockrepository.NewMockSessionRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithTokens(newTestIssuer(t), mockTokens), service.WithSessions(mockSessions))
+
+	ctx := context.Background()
+	session := &model.Session{ID: "session-1", UserID: "12345"}
+
+	mockRepo.EXPECT().GetUserById(ctx, gomock.Any()).DoAndReturn(func(ctx context.Context, id string) (*model.User, error) {
+		return &model.User{ID: id}, nil
+	}).Times(2)
+
+	// Revoking ends the refresh token family first
+	mockSessions.EXPECT().GetSession(ctx, session.ID).Return(session, nil).Times(2)
+	gomock.InOrder(
+		mockTokens.EXPECT().RevokeFamily(ctx, session.ID, gomock.Any()).Return(nil),
+		mockSessions.EXPECT().RevokeSession(ctx, session.ID, gomock.Any()).Return(nil),
+	)
+
+	assert.NoError(t, userService.RevokeSession(ctx, "12345", session.ID))
+	assert.ErrorIs(t, userService.RevokeSession(ctx, "67890", session.ID), repository.ErrSessionNotFound)
+}
+
+// TestUserServiceImpl_RevokeAllSessions tests signing out everywhere but the current session
+func TestUserServiceImpl_RevokeAllSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	mockSessions := mockrepository.NewMockSessionRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithTokens(newTestIssuer(t), mockTokens), service.WithSessions(mockSessions))
+
+	ctx := context.Background()
+	sessions := []*model.Session{{ID: "a", UserID: "12345"}, {ID: "current", UserID: "12345"}, {ID: "b", UserID: "12345"}}
+
+	mockRepo.EXPECT().GetUserById(ctx, "12345").Return(&model.User{ID: "12345"}, nil).Times(1)
+	mockSessions.EXPECT().ListSessions(ctx, "12345", gomock.Any()).Return(sessions, nil).Times(1)
+	for _, id := range []string{"a", "b"} {
+		mockTokens.EXPECT().RevokeFamily(ctx, id, gomock.Any()).Return(nil).Times(1)
+		mockSessions.EXPECT().RevokeSession(ctx, id, gomock.Any()).Return(nil).Times(1)
+	}
+
+	// Call RevokeAllSessions
+	revoked, err := userService.RevokeAllSessions(ctx, "12345", "current")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, 2, revoked)
+}
+
+// TestUserServiceImpl_RevokeSessions_OtherTenant tests that sessions of users outside the tenant cannot be revoked
+func TestUserServiceImpl_RevokeSessions_OtherTenant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	mockSessions := mockrepository.NewMockSessionRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithTokens(newTestIssuer(t), mockTokens), service.WithSessions(mockSessions))
+
+	ctx := repository.WithTenant(context.Background(), "acme")
+
+	// The user is not visible in the tenant, so no session is looked up or revoked
+	mockRepo.EXPECT().GetUserById(ctx, "12345").Return(nil, repository.ErrUserNotFound).Times(2)
+
+	assert.ErrorIs(t, userService.RevokeSession(ctx, "12345", "session-1"), repository.ErrUserNotFound)
+	_, err := userService.RevokeAllSessions(ctx, "12345", "")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+// TestUserServiceImpl_Sessions_Disabled tests session operations without a session repository
+func TestUserServiceImpl_Sessions_Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithTokens(newTestIssuer(t), mockTokens))
+
+	ctx := context.Background()
+
+	_, err := userService.ListSessions(ctx, "12345")
+	assert.ErrorIs(t, err, service.ErrSessionsDisabled)
+	assert.ErrorIs(t, userService.RevokeSession(ctx, "12345", "session-1"), service.ErrSessionsDisabled)
+	_, err = userService.RevokeAllSessions(ctx, "12345", "")
+	assert.ErrorIs(t, err, service.ErrSessionsDisabled)
+}
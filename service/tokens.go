@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	"github.com/BerryTracer/user-service/token"
+)
+
+var (
+	// ErrInvalidToken is returned when a refresh token is unknown, expired or revoked.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokensDisabled is returned by token operations when no token issuer is configured.
+	ErrTokensDisabled = errors.New("token issuance is not configured")
+)
+
+// DefaultRefreshTokenTTL is how long a refresh token can be used. Every refresh
+// issues a new token valid for as long again.
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// TokenPair is issued on sign-in and on every refresh.
+type TokenPair struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+// TokenIntrospection describes a token. All fields but Active are left empty
+// for inactive tokens.
+type TokenIntrospection struct {
+	Active    bool
+	TokenType string
+	UserID    string
+	Username  string
+	SessionID string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// WithTokens enables issuing access tokens with issuer and refresh tokens kept in refreshTokens.
+func WithTokens(issuer *token.Issuer, refreshTokens repository.RefreshTokenRepository) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.Tokens = issuer
+		s.RefreshTokens = refreshTokens
+	}
+}
+
+// WithRefreshTokenTTL replaces DefaultRefreshTokenTTL.
+func WithRefreshTokenTTL(ttl time.Duration) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.RefreshTokenTTL = ttl
+	}
+}
+
+// IssueToken implements UserService. It signs the user in with their
+// credentials on device, starting a new refresh token family and its session.
+func (s *UserServiceImpl) IssueToken(ctx context.Context, login, password, mfaCode string, device model.SessionDevice) (*TokenPair, error) {
+	if s.Tokens == nil {
+		return nil, ErrTokensDisabled
+	}
+
+	device = device.Normalize()
+	if err := device.Validate(); err != nil {
+		return nil, err
+	}
+
+	user, err := s.AuthenticateUser(ctx, login, password, mfaCode)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	family := model.NewRefreshTokenFamily(user.ID, model.HashToken(refreshToken), now, s.RefreshTokenTTL)
+	if err := s.RefreshTokens.CreateFamily(ctx, family); err != nil {
+		return nil, err
+	}
+	if err := s.startSession(ctx, family, device); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokenPair(user, family, refreshToken, now)
+}
+
+// RefreshToken implements UserService. The refresh token is replaced by a new
+// one; presenting a replaced token again revokes every token of its family.
+func (s *UserServiceImpl) RefreshToken(ctx context.Context, refreshToken string, device model.SessionDevice) (*TokenPair, error) {
+	if s.Tokens == nil {
+		return nil, ErrTokensDisabled
+	}
+
+	tokenHash := model.HashToken(refreshToken)
+	family, user, err := s.activeRefreshTokenFamily(ctx, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	newToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	family.ExpiresAt = now.Add(s.RefreshTokenTTL)
+	if err := s.RefreshTokens.Rotate(ctx, family.ID, tokenHash, model.HashToken(newToken), now, family.ExpiresAt); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			// A concurrent refresh with the same token won.
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	s.touchSession(ctx, family, device.Normalize(), now)
+
+	return s.issueTokenPair(user, family, newToken, now)
+}
+
+// RevokeToken implements UserService. Revoking a refresh token, or an access
+// token, ends the session they belong to. As in RFC 7009,
+// unknown and invalid tokens are not an error.
+func (s *UserServiceImpl) RevokeToken(ctx context.Context, t string) error {
+	if s.Tokens == nil {
+		return ErrTokensDisabled
+	}
+
+	var familyID string
+	if isAccessToken(t) {
+		claims, err := s.Tokens.ParseAccessToken(t)
+		if err != nil {
+			return nil
+		}
+		familyID = claims.SessionID
+	} else {
+		family, err := s.RefreshTokens.GetFamilyByTokenHash(ctx, model.HashToken(t))
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		familyID = family.ID
+	}
+
+	if familyID == "" {
+		return nil
+	}
+
+	return s.revokeSession(ctx, familyID, time.Now().UTC())
+}
+
+// IntrospectToken implements UserService. Unlike a verifier checking the
+// signature of an access token, it also reports access tokens as inactive once
+// their refresh token family is revoked or their user can no longer sign in.
+func (s *UserServiceImpl) IntrospectToken(ctx context.Context, t string) (*TokenIntrospection, error) {
+	if s.Tokens == nil {
+		return nil, ErrTokensDisabled
+	}
+
+	if isAccessToken(t) {
+		claims, err := s.Tokens.ParseAccessToken(t)
+		if err != nil {
+			return &TokenIntrospection{}, nil
+		}
+
+		family, err := s.RefreshTokens.GetFamily(ctx, claims.SessionID)
+		if err != nil {
+			return inactiveUnlessFailed(err)
+		}
+		user, err := s.checkRefreshTokenFamily(ctx, family, time.Now().UTC())
+		if err != nil {
+			return inactiveUnlessFailed(err)
+		}
+
+		return &TokenIntrospection{
+			Active:    true,
+			TokenType: TokenTypeAccess,
+			UserID:    user.ID,
+			Username:  user.Username,
+			SessionID: family.ID,
+			IssuedAt:  claims.IssuedAt.Time,
+			ExpiresAt: claims.ExpiresAt.Time,
+		}, nil
+	}
+
+	family, user, err := s.activeRefreshTokenFamily(ctx, model.HashToken(t))
+	if err != nil {
+		return inactiveUnlessFailed(err)
+	}
+
+	return &TokenIntrospection{
+		Active:    true,
+		TokenType: TokenTypeRefresh,
+		UserID:    user.ID,
+		Username:  user.Username,
+		SessionID: family.ID,
+		IssuedAt:  family.RefreshedAt,
+		ExpiresAt: family.ExpiresAt,
+	}, nil
+}
+
+// inactiveUnlessFailed reports a token as inactive if err only says it is
+// invalid, and returns any other error.
+func inactiveUnlessFailed(err error) (*TokenIntrospection, error) {
+	if errors.Is(err, ErrInvalidToken) || errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return &TokenIntrospection{}, nil
+	}
+	return nil, err
+}
+
+// activeRefreshTokenFamily returns the family whose current token has the given
+// hash, along with its user. Finding a replaced token of the family instead
+// revokes the family.
+func (s *UserServiceImpl) activeRefreshTokenFamily(ctx context.Context, tokenHash string) (*model.RefreshTokenFamily, *model.User, error) {
+	family, err := s.RefreshTokens.GetFamilyByTokenHash(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	if family.TokenHash != tokenHash {
+		if family.RevokedAt.IsZero() {
+			log.Printf("refresh token reuse detected, revoking token family %s of user %s\n", family.ID, family.UserID)
+			if err := s.revokeSession(ctx, family.ID, now); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, ErrInvalidToken
+	}
+
+	user, err := s.checkRefreshTokenFamily(ctx, family, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	return family, user, nil
+}
+
+// checkRefreshTokenFamily returns the user of family, provided the family is
+// active and the user can still sign in with it. Changing the password ends
+// every sign-in from before the change.
+func (s *UserServiceImpl) checkRefreshTokenFamily(ctx context.Context, family *model.RefreshTokenFamily, now time.Time) (*model.User, error) {
+	if !family.IsActive(now) {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.UserRepository.GetUserById(ctx, family.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if !user.Status.CanAuthenticate() || family.CreatedAt.Before(user.PasswordChangedAt) {
+		return nil, ErrInvalidToken
+	}
+
+	return user, nil
+}
+
+func (s *UserServiceImpl) issueTokenPair(user *model.User, family *model.RefreshTokenFamily, refreshToken string, now time.Time) (*TokenPair, error) {
+	accessToken, expiresAt, err := s.Tokens.IssueAccessToken(user, family.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  expiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: family.ExpiresAt,
+	}, nil
+}
+
+// newRefreshToken returns a random, URL-safe refresh token.
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// isAccessToken tells access tokens, which are JWTs, from refresh tokens, which
+// never contain dots.
+func isAccessToken(t string) bool {
+	return strings.Count(t, ".") == 2
+}
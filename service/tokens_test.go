@@ -0,0 +1,220 @@
+package service_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	mockcrypto "github.com/BerryTracer/common-service/crypto/mock"
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+	mockrepository "github.com/BerryTracer/user-service/repository/mock"
+	"github.com/BerryTracer/user-service/service"
+	"github.com/BerryTracer/user-service/token"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIssuer(t *testing.T) *token.Issuer {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys := token.NewKeySet(&token.Key{ID: "test", Algorithm: token.AlgorithmEdDSA, Private: private})
+	return token.NewIssuer(keys, "user-service", "")
+}
+
+// TestUserServiceImpl_IssueToken tests signing in for a token pair
+func TestUserServiceImpl_IssueToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	issuer := newTestIssuer(t)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithTokens(issuer, mockTokens))
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", Username: "testuser", Email: "test@example.com", HashedPassword: "hashedPassword", Status: model.UserStatusActive}
+
+	mockRepo.EXPECT().GetUserByEmail(repository.WithCredentials(ctx), user.Email).Return(user, nil).Times(1)
+	mockHasher.EXPECT().ComparePassword("correct-horse-battery", "hashedPassword").Return(nil).Times(1)
+
+	var family *model.RefreshTokenFamily
+	mockTokens.EXPECT().
+		CreateFamily(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, f *model.RefreshTokenFamily) error {
+			family = f
+			return nil
+		}).
+		Times(1)
+
+	// Call IssueToken
+	pair, err := userService.IssueToken(ctx, user.Email, "correct-horse-battery", "", model.SessionDevice{})
+
+	// Assertions
+	if assert.NoError(t, err) {
+		assert.Equal(t, user.ID, family.UserID)
+		assert.Equal(t, model.HashToken(pair.RefreshToken), family.TokenHash)
+		assert.Equal(t, family.ExpiresAt, pair.RefreshTokenExpiresAt)
+
+		claims, err := issuer.ParseAccessToken(pair.AccessToken)
+		if assert.NoError(t, err) {
+			assert.Equal(t, user.ID, claims.Subject)
+			assert.Equal(t, family.ID, claims.SessionID)
+		}
+	}
+}
+
+// TestUserServiceImpl_RefreshToken tests that refreshing replaces the refresh token
+func TestUserServiceImpl_RefreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithTokens(newTestIssuer(t), mockTokens))
+
+	ctx := context.Background()
+	user := &model.User{ID: "12345", Username: "testuser", Status: model.UserStatusActive}
+	tokenHash := model.HashToken("refresh-token")
+	family := model.NewRefreshTokenFamily(user.ID, tokenHash, time.Now().UTC().Add(-time.Hour), service.DefaultRefreshTokenTTL)
+
+	mockTokens.EXPECT().GetFamilyByTokenHash(ctx, tokenHash).Return(family, nil).Times(1)
+	mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+
+	var newTokenHash string
+	mockTokens.EXPECT().
+		Rotate(ctx, family.ID, tokenHash, gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id, tokenHash, newHash string, refreshedAt, expiresAt time.Time) error {
+			newTokenHash = newHash
+			assert.Equal(t, refreshedAt.Add(service.DefaultRefreshTokenTTL), expiresAt)
+			return nil
+		}).
+		Times(1)
+
+	// Call RefreshToken
+	pair, err := userService.RefreshToken(ctx, "refresh-token", model.SessionDevice{})
+
+	// Assertions
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, "refresh-token", pair.RefreshToken)
+		assert.Equal(t, model.HashToken(pair.RefreshToken), newTokenHash)
+	}
+}
+
+// TestUserServiceImpl_RefreshToken_ReuseRevokesFamily tests that presenting a replaced refresh token revokes its family
+func TestUserServiceImpl_RefreshToken_ReuseRevokesFamily(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithTokens(newTestIssuer(t), mockTokens))
+
+	ctx := context.Background()
+	replacedHash := model.HashToken("replaced-token")
+	family := model.NewRefreshTokenFamily("12345", model.HashToken("current-token"), time.Now().UTC(), service.DefaultRefreshTokenTTL)
+	family.PreviousTokenHashes = []string{replacedHash}
+
+	mockTokens.EXPECT().GetFamilyByTokenHash(ctx, replacedHash).Return(family, nil).Times(1)
+	mockTokens.EXPECT().RevokeFamily(ctx, family.ID, gomock.Any()).Return(nil).Times(1)
+
+	// Call RefreshToken
+	pair, err := userService.RefreshToken(ctx, "replaced-token", model.SessionDevice{})
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+	assert.Nil(t, pair)
+}
+
+// TestUserServiceImpl_RefreshToken_PasswordChanged tests that changing the password ends earlier sign-ins
+func TestUserServiceImpl_RefreshToken_PasswordChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithTokens(newTestIssuer(t), mockTokens))
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	user := &model.User{ID: "12345", Status: model.UserStatusActive, PasswordChangedAt: now.Add(-time.Minute)}
+	tokenHash := model.HashToken("refresh-token")
+	family := model.NewRefreshTokenFamily(user.ID, tokenHash, now.Add(-time.Hour), service.DefaultRefreshTokenTTL)
+
+	mockTokens.EXPECT().GetFamilyByTokenHash(ctx, tokenHash).Return(family, nil).Times(1)
+	mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+
+	// Call RefreshToken
+	_, err := userService.RefreshToken(ctx, "refresh-token", model.SessionDevice{})
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+}
+
+// TestUserServiceImpl_IntrospectToken tests introspecting access tokens of active and revoked families
+func TestUserServiceImpl_IntrospectToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockTokens := mockrepository.NewMockRefreshTokenRepository(ctrl)
+	issuer := newTestIssuer(t)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithTokens(issuer, mockTokens))
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	user := &model.User{ID: "12345", Username: "testuser", Status: model.UserStatusActive}
+	family := model.NewRefreshTokenFamily(user.ID, model.HashToken("refresh-token"), now, service.DefaultRefreshTokenTTL)
+	accessToken, _, err := issuer.IssueAccessToken(user, family.ID, now)
+	require.NoError(t, err)
+
+	mockTokens.EXPECT().GetFamily(ctx, family.ID).Return(family, nil).Times(1)
+	mockRepo.EXPECT().GetUserById(ctx, user.ID).Return(user, nil).Times(1)
+
+	// Call IntrospectToken
+	introspection, err := userService.IntrospectToken(ctx, accessToken)
+
+	// Assertions
+	if assert.NoError(t, err) {
+		assert.True(t, introspection.Active)
+		assert.Equal(t, service.TokenTypeAccess, introspection.TokenType)
+		assert.Equal(t, user.Username, introspection.Username)
+		assert.Equal(t, family.ID, introspection.SessionID)
+	}
+
+	// Revoked families make their access tokens inactive
+	mockTokens.EXPECT().GetFamily(ctx, family.ID).Return(nil, repository.ErrRefreshTokenNotFound).Times(1)
+
+	introspection, err = userService.IntrospectToken(ctx, accessToken)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &service.TokenIntrospection{}, introspection)
+	}
+}
+
+// TestUserServiceImpl_Tokens_Disabled tests token operations without a token issuer
+func TestUserServiceImpl_Tokens_Disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	_, err := userService.IssueToken(ctx, "testuser", "correct-horse-battery", "", model.SessionDevice{})
+	assert.ErrorIs(t, err, service.ErrTokensDisabled)
+	_, err = userService.RefreshToken(ctx, "refresh-token", model.SessionDevice{})
+	assert.ErrorIs(t, err, service.ErrTokensDisabled)
+	assert.ErrorIs(t, userService.RevokeToken(ctx, "refresh-token"), service.ErrTokensDisabled)
+	_, err = userService.IntrospectToken(ctx, "refresh-token")
+	assert.ErrorIs(t, err, service.ErrTokensDisabled)
+}
@@ -2,10 +2,34 @@ package service
 
 import (
 	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/BerryTracer/common-service/crypto"
+	"github.com/BerryTracer/user-service/mailer"
+	"github.com/BerryTracer/user-service/mfa"
 	"github.com/BerryTracer/user-service/model"
 	"github.com/BerryTracer/user-service/repository"
+	"github.com/BerryTracer/user-service/token"
+)
+
+var (
+	// ErrInvalidCredentials is returned when a login/password pair does not match a user.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrAccountDisabled is returned when valid credentials belong to a suspended or locked user.
+	ErrAccountDisabled = errors.New("account is disabled")
+	// ErrInvalidStatusTransition is returned when a user cannot move from its current status to the requested one.
+	ErrInvalidStatusTransition = errors.New("invalid status transition")
+)
+
+const (
+	// DefaultPageSize is used when a list request does not specify a page size.
+	DefaultPageSize = 50
+	// MaxPageSize caps the page size of list requests.
+	MaxPageSize = 200
 )
 
 type UserService interface {
@@ -13,25 +37,158 @@ type UserService interface {
 	GetUserById(ctx context.Context, id string) (*model.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
+	AuthenticateUser(ctx context.Context, login, password, mfaCode string) (*model.User, error)
+	UpdateUser(ctx context.Context, id string, update model.UserUpdate, expectedVersion int64) (*model.User, error)
+	ChangePassword(ctx context.Context, id, oldPassword, newPassword string) error
+	ResetPassword(ctx context.Context, id, newPassword string) error
+	DeleteUser(ctx context.Context, id string) error
+	RestoreUser(ctx context.Context, id string) (*model.User, error)
+	PurgeUser(ctx context.Context, id string) error
+	ListUsers(ctx context.Context, query repository.ListUsersQuery) (*repository.UserPage, error)
+	SuspendUser(ctx context.Context, id, reason, actor string) (*model.User, error)
+	ReactivateUser(ctx context.Context, id, reason, actor string) (*model.User, error)
+	VerifyEmail(ctx context.Context, token string) (*model.User, error)
+	ResendVerification(ctx context.Context, id string) error
+	CheckUsernameAvailability(ctx context.Context, username string) (*UsernameAvailability, error)
+	WatchUsers(ctx context.Context, resumeToken string, fn func(*model.UserChange) error) error
+	BatchGetUsers(ctx context.Context, ids, emails, usernames []string) (*BatchUsers, error)
+	IssueToken(ctx context.Context, login, password, mfaCode string, device model.SessionDevice) (*TokenPair, error)
+	RefreshToken(ctx context.Context, refreshToken string, device model.SessionDevice) (*TokenPair, error)
+	RevokeToken(ctx context.Context, token string) error
+	IntrospectToken(ctx context.Context, token string) (*TokenIntrospection, error)
+	ListSessions(ctx context.Context, userID string) ([]*model.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID, exceptSessionID string) (int, error)
+	BeginTOTPEnrollment(ctx context.Context, userID, password string) (*TOTPEnrollment, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID, code string) ([]string, error)
+	DisableMFA(ctx context.Context, userID, code string) error
+	AssignRole(ctx context.Context, userID, role string, scope model.Scope, actor string) (*model.RoleAssignment, error)
+	RevokeRole(ctx context.Context, userID, role string, scope model.Scope, actor string) error
+	ListUserRoles(ctx context.Context, userID string) ([]model.RoleAssignment, error)
+	CheckPermission(ctx context.Context, userID, permission string, scope model.Scope) (bool, error)
+	CreateOrganization(ctx context.Context, name string) (*model.Organization, error)
+	AddMember(ctx context.Context, organizationID, userID string) error
+	RemoveMember(ctx context.Context, organizationID, userID string) error
+	ListMembers(ctx context.Context, organizationID string, pageSize int, cursor string) (*repository.UserPage, error)
+	InviteMember(ctx context.Context, organizationID, email, role, invitedBy string) (*model.Invitation, error)
+	AcceptInvitation(ctx context.Context, token, userID string) (*model.Invitation, error)
+	CreateInvitedUser(ctx context.Context, username, email, password, token string) (*model.User, error)
+	ListInvitations(ctx context.Context, organizationID string, status model.InvitationStatus) ([]*model.Invitation, error)
+	RevokeInvitation(ctx context.Context, organizationID, invitationID, actor string) (*model.Invitation, error)
 }
 
 type UserServiceImpl struct {
 	UserRepository repository.UserRepository
 	PasswordHasher crypto.PasswordHasher
+	RehashChecker  PasswordRehashChecker
+	PasswordPolicy *PasswordPolicy
+	UsernamePolicy *model.UsernamePolicy
+	Normalizer     model.Normalizer
+
+	// Mailer sends verification emails. Email verification is disabled when it is nil.
+	Mailer          mailer.Mailer
+	VerificationTTL time.Duration
+	VerificationURL string
+
+	// Outbox receives an event for every change to a user. No events are recorded when it is nil.
+	Outbox     repository.OutboxRepository
+	Transactor repository.Transactor
+
+	// Watcher streams user changes. WatchUsers is unavailable when it is nil.
+	Watcher repository.UserWatcher
+
+	// Tokens signs access tokens. Token operations are unavailable when it is nil.
+	Tokens          *token.Issuer
+	RefreshTokens   repository.RefreshTokenRepository
+	RefreshTokenTTL time.Duration
+
+	// Sessions records sign-ins for users to review. Session operations are unavailable when it is nil.
+	Sessions repository.SessionRepository
+
+	// SecretCipher encrypts TOTP secrets. MFA operations are unavailable when it is nil.
+	SecretCipher mfa.Cipher
+	MFAIssuer    string
+
+	// LoginAttempts counts failed attempts at passwords and MFA codes. They are not limited when it is nil.
+	LoginAttempts     repository.LoginAttemptRepository
+	UserLockoutPolicy *LockoutPolicy
+	IPLockoutPolicy   *LockoutPolicy
+
+	// RoleCatalog lists the roles users can be assigned and their permissions.
+	RoleCatalog *model.RoleCatalog
+
+	// Organizations stores organizations. Organization operations are unavailable when it is nil.
+	Organizations            repository.OrganizationRepository
+	UsernamesPerOrganization bool
+
+	// Invitations stores invitations to join organizations. Invitation operations are unavailable when it is nil.
+	Invitations   repository.InvitationRepository
+	InvitationTTL time.Duration
+	InvitationURL string
+
+	// dummyHash is compared against for unknown logins; see compareDummyPassword.
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+// UserServiceOption configures optional dependencies of a UserServiceImpl.
+type UserServiceOption func(*UserServiceImpl)
+
+// WithRehashChecker enables transparent rehashing of outdated password hashes on login.
+func WithRehashChecker(checker PasswordRehashChecker) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.RehashChecker = checker
+	}
+}
+
+// WithPasswordPolicy replaces the default policy for passwords chosen by users.
+func WithPasswordPolicy(policy *PasswordPolicy) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.PasswordPolicy = policy
+	}
+}
+
+// WithNormalizer replaces the default normalization of usernames and emails.
+func WithNormalizer(normalizer model.Normalizer) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.Normalizer = normalizer
+	}
 }
 
 // NewUserService returns a new UserServiceImpl.
-func NewUserService(userRepository repository.UserRepository, passwordHasher crypto.PasswordHasher) *UserServiceImpl {
-	return &UserServiceImpl{
-		UserRepository: userRepository,
-		PasswordHasher: passwordHasher,
+func NewUserService(userRepository repository.UserRepository, passwordHasher crypto.PasswordHasher, opts ...UserServiceOption) *UserServiceImpl {
+	s := &UserServiceImpl{
+		UserRepository:    userRepository,
+		PasswordHasher:    passwordHasher,
+		PasswordPolicy:    DefaultPasswordPolicy(),
+		UsernamePolicy:    model.DefaultUsernamePolicy(),
+		Normalizer:        model.DefaultNormalizer(),
+		VerificationTTL:   DefaultVerificationTTL,
+		RefreshTokenTTL:   DefaultRefreshTokenTTL,
+		MFAIssuer:         DefaultMFAIssuer,
+		UserLockoutPolicy: DefaultUserLockoutPolicy(),
+		IPLockoutPolicy:   DefaultIPLockoutPolicy(),
+		RoleCatalog:       model.DefaultRoleCatalog(),
+		InvitationTTL:     DefaultInvitationTTL,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
 }
 
 // CreateUser implements UserService.
 func (s *UserServiceImpl) CreateUser(ctx context.Context, username string, email string, password string) (*model.User, error) {
+	return s.createUser(ctx, username, email, password, nil)
+}
 
-	hashedPassword, err := s.PasswordHasher.HashPassword(password)
+// createUser creates a user. If claim is given, it runs in the same write
+// before the user is stored, and may add to the user and to the events; the
+// user is not created if it fails.
+func (s *UserServiceImpl) createUser(ctx context.Context, username, email, password string, claim func(ctx context.Context, user *model.User) ([]*model.Event, error)) (*model.User, error) {
+	hashedPassword, err := s.hashNewPassword("password", password, username, email)
 
 	if err != nil {
 		return nil, err
@@ -39,16 +196,53 @@ func (s *UserServiceImpl) CreateUser(ctx context.Context, username string, email
 
 	user := model.NewUser(username, email, hashedPassword)
 
-	if err := user.Validate(); err != nil {
+	if err := user.ValidateWith(s.UsernamePolicy); err != nil {
+		return nil, err
+	}
+
+	if err := s.Normalizer.Normalize(user); err != nil {
 		return nil, err
 	}
 
-	err = s.UserRepository.CreateUser(ctx, user)
+	// Users created in the scope of a tenant join its organization.
+	organizationID, inTenant := repository.TenantFromContext(ctx)
+	if inTenant {
+		if _, err := s.getOrganization(ctx, organizationID); err != nil {
+			return nil, err
+		}
+		user.OrganizationIDs = []string{organizationID}
+	}
 
+	token, err := s.startEmailVerification(user)
 	if err != nil {
 		return nil, err
 	}
 
+	err = s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		var claimed []*model.Event
+		if claim != nil {
+			var err error
+			if claimed, err = claim(ctx, user); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := s.UserRepository.CreateUser(ctx, user); err != nil {
+			return nil, err
+		}
+		events := []*model.Event{model.NewEvent(model.EventUserCreated, user, time.Now().UTC())}
+		if inTenant {
+			events = append(events, organizationEvent(model.EventUserJoinedOrganization, user, organizationID))
+		}
+		return append(events, claimed...), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.finishEmailVerification(ctx, user, token)
+
 	return user, nil
 }
 
@@ -57,14 +251,387 @@ func (s *UserServiceImpl) GetUserById(ctx context.Context, id string) (*model.Us
 	return s.UserRepository.GetUserById(ctx, id)
 }
 
-// GetUserByEmail implements UserService.
+// GetUserByEmail implements UserService. Emails match regardless of how they are written.
 func (s *UserServiceImpl) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
-	return s.UserRepository.GetUserByEmail(ctx, email)
+	canonical, err := s.Normalizer.Email(email)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.UserRepository.GetUserByEmail(ctx, canonical)
 }
 
-// GetUserByUsername implements UserService.
+// GetUserByUsername implements UserService. Usernames match regardless of case and Unicode form.
 func (s *UserServiceImpl) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
-	return s.UserRepository.GetUserByUsername(ctx, username)
+	if err := s.checkUsernameLookup(ctx); err != nil {
+		return nil, err
+	}
+	return s.UserRepository.GetUserByUsername(ctx, s.Normalizer.Username(username))
+}
+
+// UpdateUser implements UserService.
+func (s *UserServiceImpl) UpdateUser(ctx context.Context, id string, update model.UserUpdate, expectedVersion int64) (*model.User, error) {
+	// The user is validated whole, so it is read with its credentials.
+	user, err := s.UserRepository.GetUserById(repository.WithCredentials(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Version != expectedVersion {
+		return nil, repository.ErrVersionConflict
+	}
+
+	previousEmail, previousEmailCanonical := user.Email, user.EmailCanonical
+	user.Apply(update)
+
+	// Existing usernames predating the username policy stay valid until they change.
+	var usernamePolicy *model.UsernamePolicy
+	if update.Username != nil {
+		usernamePolicy = s.UsernamePolicy
+	}
+
+	if err := user.ValidateWith(usernamePolicy); err != nil {
+		return nil, err
+	}
+
+	if err := s.Normalizer.Normalize(user); err != nil {
+		return nil, err
+	}
+
+	// A new email address is unverified until its owner verifies it.
+	emailChanged := user.EmailCanonical != previousEmailCanonical
+	var token string
+	if emailChanged {
+		user.EmailVerifiedAt = time.Time{}
+		user.EmailVerification = nil
+		if token, err = s.startEmailVerification(user); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.UpdateUser(ctx, user, expectedVersion, emailChanged); err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		events := []*model.Event{model.NewEvent(model.EventUserUpdated, user, now)}
+		if emailChanged {
+			emailChanged := model.NewEvent(model.EventUserEmailChanged, user, now)
+			emailChanged.PreviousEmail = previousEmail
+			events = append(events, emailChanged)
+		}
+		return events, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.finishEmailVerification(ctx, user, token)
+
+	return user, nil
+}
+
+// ChangePassword implements UserService.
+func (s *UserServiceImpl) ChangePassword(ctx context.Context, id, oldPassword, newPassword string) error {
+	user, err := s.UserRepository.GetUserById(repository.WithCredentials(ctx), id)
+	if err != nil {
+		return err
+	}
+
+	err = s.guardAttempt(ctx, user, func() error {
+		if err := s.PasswordHasher.ComparePassword(oldPassword, user.HashedPassword); err != nil {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}, ErrInvalidCredentials)
+	if err != nil {
+		return err
+	}
+	s.resetAttempts(ctx, user)
+
+	return s.setPassword(ctx, user, newPassword)
+}
+
+// ResetPassword implements UserService. Callers are responsible for making sure
+// only administrators can reach it, as no current password is required.
+func (s *UserServiceImpl) ResetPassword(ctx context.Context, id, newPassword string) error {
+	user, err := s.UserRepository.GetUserById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.setPassword(ctx, user, newPassword)
+}
+
+// setPassword hashes and stores a new password for the user, recording when it changed.
+func (s *UserServiceImpl) setPassword(ctx context.Context, user *model.User, password string) error {
+	hashedPassword, err := s.hashNewPassword("new_password", password, user.Username, user.Email)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		now := time.Now().UTC()
+		if err := s.UserRepository.UpdatePassword(ctx, user.ID, hashedPassword, now); err != nil {
+			return nil, err
+		}
+		return []*model.Event{model.NewUserIDEvent(model.EventUserPasswordChanged, user.ID, now)}, nil
+	})
+}
+
+// hashNewPassword checks a password chosen by a user against the password policy
+// and hashes it. Every flow that sets a password goes through here so they all
+// share the same policy. Policy violations are reported against field.
+func (s *UserServiceImpl) hashNewPassword(field, password, username, email string) (string, error) {
+	if s.PasswordPolicy != nil {
+		violations := &model.ValidationError{}
+		for _, description := range s.PasswordPolicy.Violations(password, username, email) {
+			violations.Add(field, description)
+		}
+		if err := violations.ErrOrNil(); err != nil {
+			return "", err
+		}
+	}
+
+	return s.PasswordHasher.HashPassword(password)
+}
+
+// DeleteUser implements UserService.
+func (s *UserServiceImpl) DeleteUser(ctx context.Context, id string) error {
+	return s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		now := time.Now().UTC()
+		if err := s.UserRepository.DeleteUser(ctx, id, now); err != nil {
+			return nil, err
+		}
+		return []*model.Event{model.NewUserIDEvent(model.EventUserDeleted, id, now)}, nil
+	})
+}
+
+// RestoreUser implements UserService. The user gets back the status held
+// before deletion; see model.User.RestoredStatus.
+func (s *UserServiceImpl) RestoreUser(ctx context.Context, id string) (*model.User, error) {
+	deleted, err := s.UserRepository.GetDeletedUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	status := deleted.RestoredStatus()
+	if !deleted.Status.CanTransitionTo(status) {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	var user *model.User
+	err = s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		now := time.Now().UTC()
+		if err := s.UserRepository.RestoreUser(ctx, id, status, now); err != nil {
+			return nil, err
+		}
+
+		var err error
+		user, err = s.UserRepository.GetUserById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return []*model.Event{model.NewEvent(model.EventUserRestored, user, now)}, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// PurgeUser implements UserService.
+func (s *UserServiceImpl) PurgeUser(ctx context.Context, id string) error {
+	return s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.PurgeUser(ctx, id); err != nil {
+			return nil, err
+		}
+		return []*model.Event{model.NewUserIDEvent(model.EventUserPurged, id, time.Now().UTC())}, nil
+	})
+}
+
+// ListUsers implements UserService. Unset page sizes fall back to DefaultPageSize
+// and oversized ones are capped at MaxPageSize.
+func (s *UserServiceImpl) ListUsers(ctx context.Context, query repository.ListUsersQuery) (*repository.UserPage, error) {
+	switch {
+	case query.PageSize < 0:
+		return nil, repository.ErrInvalidPageSize
+	case query.PageSize == 0:
+		query.PageSize = DefaultPageSize
+	case query.PageSize > MaxPageSize:
+		query.PageSize = MaxPageSize
+	}
+
+	query.UsernamePrefix = s.Normalizer.UsernamePrefix(query.UsernamePrefix)
+	query.EmailPrefix = s.Normalizer.EmailPrefix(query.EmailPrefix)
+
+	return s.UserRepository.ListUsers(ctx, query)
+}
+
+// SuspendUser implements UserService.
+func (s *UserServiceImpl) SuspendUser(ctx context.Context, id, reason, actor string) (*model.User, error) {
+	return s.changeStatus(ctx, id, model.UserStatusSuspended, reason, actor)
+}
+
+// ReactivateUser implements UserService. Only suspended and locked users can be
+// reactivated; pending users become active by verifying their email. Their
+// failed attempts are forgotten, so that locked users can sign in right away.
+func (s *UserServiceImpl) ReactivateUser(ctx context.Context, id, reason, actor string) (*model.User, error) {
+	user, err := s.changeStatus(ctx, id, model.UserStatusActive, reason, actor, model.UserStatusSuspended, model.UserStatusLocked)
+	if err != nil {
+		return nil, err
+	}
+	s.resetAttempts(ctx, user)
+	return user, nil
+}
+
+// changeStatus moves a user to a new status, recording the reason and actor. If
+// from is given, the user must currently be in one of those statuses.
+func (s *UserServiceImpl) changeStatus(ctx context.Context, id string, to model.UserStatus, reason, actor string, from ...model.UserStatus) (*model.User, error) {
+	violations := &model.ValidationError{}
+	if reason == "" {
+		violations.Add("reason", "reason is required")
+	}
+	if actor == "" {
+		violations.Add("actor", "actor is required")
+	}
+	if err := violations.ErrOrNil(); err != nil {
+		return nil, err
+	}
+
+	user, err := s.UserRepository.GetUserById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Status.CanTransitionTo(to) || (len(from) > 0 && !containsStatus(from, user.Status)) {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	change := model.StatusChange{Status: to, Reason: reason, Actor: actor, At: time.Now().UTC()}
+	err = s.write(ctx, func(ctx context.Context) ([]*model.Event, error) {
+		if err := s.UserRepository.UpdateStatus(ctx, id, user.Status, change); err != nil {
+			return nil, err
+		}
+
+		changed := *user
+		changed.Status = to
+		event := model.NewEvent(model.EventUserStatusChanged, &changed, change.At)
+		event.Reason = reason
+		event.Actor = actor
+		return []*model.Event{event}, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	user.Status = to
+	user.LastStatusChange = &change
+	user.Version++
+	return user, nil
+}
+
+func containsStatus(statuses []model.UserStatus, status model.UserStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateUser implements UserService. Users with MFA enabled must also
+// give a TOTP or recovery code. Failed attempts are counted against the user
+// and the client IP; see LockoutPolicy.
+func (s *UserServiceImpl) AuthenticateUser(ctx context.Context, login, password, mfaCode string) (*model.User, error) {
+	user, err := s.getUserByLogin(repository.WithCredentials(ctx), login)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			// Guessing at logins still counts against the client.
+			_, err := s.guard(ctx, time.Now().UTC(), s.ipAttemptKeys(ctx), func() error {
+				s.compareDummyPassword(password)
+				return ErrInvalidCredentials
+			}, ErrInvalidCredentials)
+			return nil, err
+		}
+		return nil, err
+	}
+
+	err = s.guardAttempt(ctx, user, func() error {
+		if err := s.PasswordHasher.ComparePassword(password, user.HashedPassword); err != nil {
+			return ErrInvalidCredentials
+		}
+
+		if !user.Status.CanAuthenticate() {
+			return ErrAccountDisabled
+		}
+
+		return s.checkMFA(ctx, user, mfaCode)
+	}, ErrInvalidCredentials, ErrInvalidMFACode)
+	if err != nil {
+		return nil, err
+	}
+	s.resetAttempts(ctx, user)
+
+	if s.RehashChecker != nil && s.RehashChecker.NeedsRehash(user.HashedPassword) {
+		s.rehashPassword(ctx, user, password)
+	}
+
+	return user, nil
+}
+
+// compareDummyPassword spends as long as comparing a password against a stored
+// hash, so that the response time does not tell unknown logins apart.
+func (s *UserServiceImpl) compareDummyPassword(password string) {
+	s.dummyHashOnce.Do(func() {
+		hash, err := s.PasswordHasher.HashPassword("dummy password for unknown logins")
+		if err != nil {
+			log.Printf("failed to hash dummy password: %v\n", err)
+			return
+		}
+		s.dummyHash = hash
+	})
+	if s.dummyHash != "" {
+		_ = s.PasswordHasher.ComparePassword(password, s.dummyHash)
+	}
+}
+
+// getUserByLogin looks a user up by email when the login looks like one, and by username otherwise.
+func (s *UserServiceImpl) getUserByLogin(ctx context.Context, login string) (*model.User, error) {
+	if strings.Contains(login, "@") {
+		email, err := s.Normalizer.Email(login)
+		if err != nil {
+			// No stored user has an email that cannot be normalized.
+			return nil, repository.ErrUserNotFound
+		}
+		return s.UserRepository.GetUserByEmail(ctx, email)
+	}
+	if err := s.checkUsernameLookup(ctx); err != nil {
+		return nil, err
+	}
+	return s.UserRepository.GetUserByUsername(ctx, s.Normalizer.Username(login))
+}
+
+// rehashPassword replaces the stored hash of an authenticated user. Failures are
+// logged rather than returned so that an outdated hash never blocks a valid login.
+func (s *UserServiceImpl) rehashPassword(ctx context.Context, user *model.User, password string) {
+	hashedPassword, err := s.PasswordHasher.HashPassword(password)
+	if err != nil {
+		log.Printf("failed to rehash password for user %s: %v\n", user.ID, err)
+		return
+	}
+
+	if err := s.UserRepository.UpdateHashedPassword(ctx, user.ID, hashedPassword); err != nil {
+		log.Printf("failed to persist rehashed password for user %s: %v\n", user.ID, err)
+		return
+	}
+
+	user.HashedPassword = hashedPassword
 }
 
 // Ensure UserServiceImpl implements UserService.
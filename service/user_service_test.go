@@ -3,14 +3,24 @@ package service_test
 import (
 	"context"
 	"errors"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	mockcrypto "github.com/BerryTracer/common-service/crypto/mock"
+	userservice "github.com/BerryTracer/user-service/grpc/proto"
+	"github.com/BerryTracer/user-service/mailer"
 	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
 	mockrepository "github.com/BerryTracer/user-service/repository/mock"
 	"github.com/BerryTracer/user-service/service"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 // TestUserServiceImpl_CreateUser tests the CreateUser method of the UserServiceImpl
@@ -25,7 +35,7 @@ func TestUserServiceImpl_CreateUser(t *testing.T) {
 	ctx := context.Background()
 	username := "testuser"
 	email := "testuser@example.com"
-	password := "password"
+	password := "correct-horse-battery"
 
 	// Mock successful creation
 	mockRepo.EXPECT().
@@ -56,6 +66,7 @@ func TestUserServiceImpl_CreateUser(t *testing.T) {
 	assert.Equal(t, username, result.Username)
 	assert.Equal(t, email, result.Email)
 	assert.NotEmpty(t, result.HashedPassword)
+	assertNoCredentialMaterial(t, result.ConvertToProto(), result.HashedPassword)
 }
 
 // TestUserServiceImpl_CreateUser_Validation_Error tests the CreateUser method of the UserServiceImpl
@@ -70,7 +81,7 @@ func TestUserServiceImpl_CreateUser_Repository_Error(t *testing.T) {
 	ctx := context.Background()
 	username := "testuser"
 	email := "testuser@example.com"
-	password := "password"
+	password := "correct-horse-battery"
 
 	// Mock error
 	mockRepo.EXPECT().
@@ -106,7 +117,7 @@ func TestUserServiceImpl_CreateUser_BcryptError(t *testing.T) {
 	ctx := context.Background()
 	username := "testuser"
 	email := "testuser@example.com"
-	password := "password"
+	password := "correct-horse-battery"
 
 	// Mock error
 	mockHasher.EXPECT().
@@ -134,7 +145,7 @@ func TestUserServiceImpl_CreateUser_ValidationFail(t *testing.T) {
 	// Providing invalid data for validation to fail
 	username := ""
 	email := "invalidemail"
-	password := "pwd"
+	password := "correct-horse-battery"
 
 	// Mock successful hashing
 	mockHasher.EXPECT().
@@ -162,7 +173,7 @@ func TestUserServiceImpl_GetUserById(t *testing.T) {
 
 	ctx := context.Background()
 	testID := "12345"
-	expectedUser := &model.User{ID: testID, Username: "testuser", Email: "test@example.com"}
+	expectedUser := &model.User{ID: testID, Username: "testuser", Email: "test@example.com", HashedPassword: "hashedPassword"}
 
 	// Mock successful retrieval
 	mockRepo.EXPECT().
@@ -176,6 +187,7 @@ func TestUserServiceImpl_GetUserById(t *testing.T) {
 	// Assertions
 	assert.NoError(t, err)
 	assert.Equal(t, expectedUser, user)
+	assertNoCredentialMaterial(t, user.ConvertToProto(), expectedUser.HashedPassword)
 }
 
 func TestUserServiceImpl_GetUserById_Fail(t *testing.T) {
@@ -213,7 +225,7 @@ func TestUserServiceImpl_GetUserByEmail(t *testing.T) {
 
 	ctx := context.Background()
 	testEmail := "test@example.com"
-	expectedUser := &model.User{ID: "12345", Username: "testuser", Email: testEmail}
+	expectedUser := &model.User{ID: "12345", Username: "testuser", Email: testEmail, HashedPassword: "hashedPassword"}
 
 	// Mock successful retrieval
 	mockRepo.EXPECT().
@@ -227,6 +239,7 @@ func TestUserServiceImpl_GetUserByEmail(t *testing.T) {
 	// Assertions
 	assert.NoError(t, err)
 	assert.Equal(t, expectedUser, user)
+	assertNoCredentialMaterial(t, user.ConvertToProto(), expectedUser.HashedPassword)
 }
 
 func TestUserServiceImpl_GetUserByEmail_Fail(t *testing.T) {
@@ -264,7 +277,7 @@ func TestUserServiceImpl_GetUserByUsername(t *testing.T) {
 
 	ctx := context.Background()
 	testUsername := "testuser"
-	expectedUser := &model.User{ID: "12345", Username: testUsername, Email: "test@example.com"}
+	expectedUser := &model.User{ID: "12345", Username: testUsername, Email: "test@example.com", HashedPassword: "hashedPassword"}
 
 	// Mock successful retrieval
 	mockRepo.EXPECT().
@@ -278,6 +291,7 @@ func TestUserServiceImpl_GetUserByUsername(t *testing.T) {
 	// Assertions
 	assert.NoError(t, err)
 	assert.Equal(t, expectedUser, user)
+	assertNoCredentialMaterial(t, user.ConvertToProto(), expectedUser.HashedPassword)
 }
 
 func TestUserServiceImpl_GetUserByUsername_Fail(t *testing.T) {
@@ -304,3 +318,1585 @@ func TestUserServiceImpl_GetUserByUsername_Fail(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, user)
 }
+
+func TestUserServiceImpl_AuthenticateUser_ByEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	testEmail := "test@example.com"
+	expectedUser := &model.User{ID: "12345", Username: "testuser", Email: testEmail, HashedPassword: "hashedPassword", Status: model.UserStatusActive}
+
+	// Mock successful retrieval and comparison
+	mockRepo.EXPECT().
+		GetUserByEmail(repository.WithCredentials(ctx), testEmail).
+		Return(expectedUser, nil).
+		Times(1)
+
+	mockHasher.EXPECT().
+		ComparePassword("password", "hashedPassword").
+		Return(nil).
+		Times(1)
+
+	// Call AuthenticateUser
+	user, err := userService.AuthenticateUser(ctx, testEmail, "password", "")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, expectedUser, user)
+	assertNoCredentialMaterial(t, user.ConvertToProto(), expectedUser.HashedPassword)
+}
+
+func TestUserServiceImpl_AuthenticateUser_ByUsername(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	testUsername := "testuser"
+	expectedUser := &model.User{ID: "12345", Username: testUsername, Email: "test@example.com", HashedPassword: "hashedPassword", Status: model.UserStatusActive}
+
+	// Mock successful retrieval and comparison
+	mockRepo.EXPECT().
+		GetUserByUsername(repository.WithCredentials(ctx), testUsername).
+		Return(expectedUser, nil).
+		Times(1)
+
+	mockHasher.EXPECT().
+		ComparePassword("password", "hashedPassword").
+		Return(nil).
+		Times(1)
+
+	// Call AuthenticateUser
+	user, err := userService.AuthenticateUser(ctx, testUsername, "password", "")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, expectedUser, user)
+}
+
+func TestUserServiceImpl_AuthenticateUser_UnknownUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	// Mock missing user
+	mockRepo.EXPECT().
+		GetUserByUsername(repository.WithCredentials(ctx), "nobody").
+		Return(nil, repository.ErrUserNotFound).
+		Times(1)
+
+	// The password is still compared, against a dummy hash computed once
+	mockHasher.EXPECT().HashPassword(gomock.Any()).Return("dummyHash", nil).Times(1)
+	mockHasher.EXPECT().ComparePassword(gomock.Any(), "dummyHash").Return(errors.New("mismatch")).Times(2)
+
+	// Call AuthenticateUser
+	user, err := userService.AuthenticateUser(ctx, "nobody", "password", "")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	assert.Nil(t, user)
+
+	mockRepo.EXPECT().GetUserByEmail(repository.WithCredentials(ctx), "nobody@example.com").Return(nil, repository.ErrUserNotFound).Times(1)
+
+	_, err = userService.AuthenticateUser(ctx, "nobody@example.com", "password", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+}
+
+func TestUserServiceImpl_AuthenticateUser_WrongPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	testUsername := "testuser"
+
+	// Mock retrieval and failed comparison
+	mockRepo.EXPECT().
+		GetUserByUsername(repository.WithCredentials(ctx), testUsername).
+		Return(&model.User{ID: "12345", Username: testUsername, HashedPassword: "hashedPassword", Status: model.UserStatusActive}, nil).
+		Times(1)
+
+	mockHasher.EXPECT().
+		ComparePassword("wrong", "hashedPassword").
+		Return(assert.AnError).
+		Times(1)
+
+	// Call AuthenticateUser
+	user, err := userService.AuthenticateUser(ctx, testUsername, "wrong", "")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	assert.Nil(t, user)
+}
+
+func TestUserServiceImpl_AuthenticateUser_RehashesOutdatedHash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithRehashChecker(service.NewBcryptCostChecker(bcrypt.DefaultCost)))
+
+	ctx := context.Background()
+	testUsername := "testuser"
+	outdatedHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	mockRepo.EXPECT().
+		GetUserByUsername(repository.WithCredentials(ctx), testUsername).
+		Return(&model.User{ID: "12345", Username: testUsername, HashedPassword: string(outdatedHash), Status: model.UserStatusActive}, nil).
+		Times(1)
+
+	mockHasher.EXPECT().
+		ComparePassword("password", string(outdatedHash)).
+		Return(nil).
+		Times(1)
+
+	// Mock rehashing and persisting the new hash
+	mockHasher.EXPECT().
+		HashPassword("password").
+		Return("newHashedPassword", nil).
+		Times(1)
+
+	mockRepo.EXPECT().
+		UpdateHashedPassword(ctx, "12345", "newHashedPassword").
+		Return(nil).
+		Times(1)
+
+	// Call AuthenticateUser
+	user, err := userService.AuthenticateUser(ctx, testUsername, "password", "")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, "newHashedPassword", user.HashedPassword)
+}
+
+func TestUserServiceImpl_AuthenticateUser_RehashFailureDoesNotBlockLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithRehashChecker(service.NewBcryptCostChecker(bcrypt.DefaultCost)))
+
+	ctx := context.Background()
+	testUsername := "testuser"
+	outdatedHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	mockRepo.EXPECT().
+		GetUserByUsername(repository.WithCredentials(ctx), testUsername).
+		Return(&model.User{ID: "12345", Username: testUsername, HashedPassword: string(outdatedHash), Status: model.UserStatusActive}, nil).
+		Times(1)
+
+	mockHasher.EXPECT().
+		ComparePassword("password", string(outdatedHash)).
+		Return(nil).
+		Times(1)
+
+	mockHasher.EXPECT().
+		HashPassword("password").
+		Return("newHashedPassword", nil).
+		Times(1)
+
+	// Mock failure to persist the new hash
+	mockRepo.EXPECT().
+		UpdateHashedPassword(ctx, "12345", "newHashedPassword").
+		Return(assert.AnError).
+		Times(1)
+
+	// Call AuthenticateUser
+	user, err := userService.AuthenticateUser(ctx, testUsername, "password", "")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, string(outdatedHash), user.HashedPassword)
+}
+
+// TestUserProto_HasNoCredentialFields guards the public User message against regaining credential fields.
+func TestUserProto_HasNoCredentialFields(t *testing.T) {
+	fields := (&userservice.User{}).ProtoReflect().Descriptor().Fields()
+
+	for i := 0; i < fields.Len(); i++ {
+		assert.NotContains(t, string(fields.Get(i).Name()), "password")
+	}
+}
+
+func TestUserServiceImpl_GetUserById_CredentialsProjection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	expectedUser := &model.User{ID: "12345", Username: "testuser", Email: "test@example.com", HashedPassword: "hashedPassword", Status: model.UserStatusActive}
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(expectedUser, nil).
+		Times(1)
+
+	// Call GetUserById
+	user, err := userService.GetUserById(ctx, "12345")
+
+	// Only the internal projection carries the hash
+	assert.NoError(t, err)
+	assert.Equal(t, "hashedPassword", user.ConvertToCredentialsProto().GetHashedPassword())
+}
+
+// assertNoCredentialMaterial fails the test if the serialized message contains the given hash.
+func assertNoCredentialMaterial(t *testing.T, msg proto.Message, hashedPassword string) {
+	t.Helper()
+
+	wire, err := proto.Marshal(msg)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(wire), hashedPassword)
+
+	json, err := protojson.Marshal(msg)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(json), hashedPassword)
+}
+
+func TestUserServiceImpl_UpdateUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	storedUser := &model.User{ID: "12345", Username: "testuser", Email: "test@example.com", HashedPassword: "hashedPassword", Version: 3}
+	newEmail := "new@example.com"
+
+	mockRepo.EXPECT().
+		GetUserById(repository.WithCredentials(ctx), "12345").
+		Return(storedUser, nil).
+		Times(1)
+
+	// Only the masked field changes
+	mockRepo.EXPECT().
+		UpdateUser(ctx, gomock.Any(), int64(3), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, u *model.User, expectedVersion int64, emailChanged bool) error {
+			assert.Equal(t, "testuser", u.Username)
+			assert.Equal(t, newEmail, u.Email)
+			u.Version = expectedVersion + 1
+			return nil
+		}).
+		Times(1)
+
+	// Call UpdateUser
+	user, err := userService.UpdateUser(ctx, "12345", model.UserUpdate{Email: &newEmail}, 3)
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, newEmail, user.Email)
+	assert.Equal(t, int64(4), user.Version)
+}
+
+func TestUserServiceImpl_UpdateUser_StaleVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	newUsername := "renamed"
+
+	mockRepo.EXPECT().
+		GetUserById(repository.WithCredentials(ctx), "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Email: "test@example.com", HashedPassword: "hashedPassword", Version: 4}, nil).
+		Times(1)
+
+	// Call UpdateUser with an outdated version
+	user, err := userService.UpdateUser(ctx, "12345", model.UserUpdate{Username: &newUsername}, 3)
+
+	// Assertions
+	assert.ErrorIs(t, err, repository.ErrVersionConflict)
+	assert.Nil(t, user)
+}
+
+func TestUserServiceImpl_UpdateUser_ValidationFail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	invalidEmail := "invalidemail"
+
+	mockRepo.EXPECT().
+		GetUserById(repository.WithCredentials(ctx), "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Email: "test@example.com", HashedPassword: "hashedPassword", Version: 1}, nil).
+		Times(1)
+
+	// Call UpdateUser with an invalid email
+	user, err := userService.UpdateUser(ctx, "12345", model.UserUpdate{Email: &invalidEmail}, 1)
+
+	// Assertions
+	assert.Error(t, err)
+	assert.Nil(t, user)
+}
+
+func TestUserServiceImpl_UpdateUser_ConcurrentWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	newUsername := "renamed"
+
+	mockRepo.EXPECT().
+		GetUserById(repository.WithCredentials(ctx), "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Email: "test@example.com", HashedPassword: "hashedPassword", Version: 1}, nil).
+		Times(1)
+
+	// Another writer wins between read and write
+	mockRepo.EXPECT().
+		UpdateUser(ctx, gomock.Any(), int64(1), gomock.Any()).
+		Return(repository.ErrVersionConflict).
+		Times(1)
+
+	// Call UpdateUser
+	user, err := userService.UpdateUser(ctx, "12345", model.UserUpdate{Username: &newUsername}, 1)
+
+	// Assertions
+	assert.ErrorIs(t, err, repository.ErrVersionConflict)
+	assert.Nil(t, user)
+}
+
+func TestUserServiceImpl_ChangePassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(repository.WithCredentials(ctx), "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", HashedPassword: "hashedPassword"}, nil).
+		Times(1)
+
+	// Mock verification of the old password and hashing of the new one
+	mockHasher.EXPECT().
+		ComparePassword("oldPassword", "hashedPassword").
+		Return(nil).
+		Times(1)
+
+	mockHasher.EXPECT().
+		HashPassword("newPassword").
+		Return("newHashedPassword", nil).
+		Times(1)
+
+	mockRepo.EXPECT().
+		UpdatePassword(ctx, "12345", "newHashedPassword", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id, hashedPassword string, changedAt time.Time) error {
+			assert.WithinDuration(t, time.Now(), changedAt, time.Minute)
+			return nil
+		}).
+		Times(1)
+
+	// Call ChangePassword
+	err := userService.ChangePassword(ctx, "12345", "oldPassword", "newPassword")
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+func TestUserServiceImpl_ChangePassword_WrongOldPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(repository.WithCredentials(ctx), "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", HashedPassword: "hashedPassword"}, nil).
+		Times(1)
+
+	// Mock failed verification of the old password
+	mockHasher.EXPECT().
+		ComparePassword("wrong", "hashedPassword").
+		Return(assert.AnError).
+		Times(1)
+
+	// Call ChangePassword
+	err := userService.ChangePassword(ctx, "12345", "wrong", "newPassword")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+}
+
+func TestUserServiceImpl_ResetPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", HashedPassword: "hashedPassword"}, nil).
+		Times(1)
+
+	// No old password is checked on reset
+	mockHasher.EXPECT().
+		HashPassword("newPassword").
+		Return("newHashedPassword", nil).
+		Times(1)
+
+	mockRepo.EXPECT().
+		UpdatePassword(ctx, "12345", "newHashedPassword", gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	// Call ResetPassword
+	err := userService.ResetPassword(ctx, "12345", "newPassword")
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+func TestUserServiceImpl_ResetPassword_UnknownUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(nil, repository.ErrUserNotFound).
+		Times(1)
+
+	// Call ResetPassword
+	err := userService.ResetPassword(ctx, "12345", "newPassword")
+
+	// Assertions
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestUserServiceImpl_DeleteUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	// Mock soft deletion
+	mockRepo.EXPECT().
+		DeleteUser(ctx, "12345", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id string, deletedAt time.Time) error {
+			assert.WithinDuration(t, time.Now(), deletedAt, time.Minute)
+			return nil
+		}).
+		Times(1)
+
+	// Call DeleteUser
+	err := userService.DeleteUser(ctx, "12345")
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+func TestUserServiceImpl_RestoreUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	expectedUser := &model.User{ID: "12345", Username: "testuser", Email: "test@example.com", Status: model.UserStatusSuspended}
+
+	// Mock restoration of a user suspended before deletion, followed by a lookup of the restored user
+	mockRepo.EXPECT().
+		GetDeletedUser(ctx, "12345").
+		Return(&model.User{ID: "12345", Status: model.UserStatusDeleted, StatusBeforeDeletion: model.UserStatusSuspended}, nil).
+		Times(1)
+
+	mockRepo.EXPECT().
+		RestoreUser(ctx, "12345", model.UserStatusSuspended, gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(expectedUser, nil).
+		Times(1)
+
+	// Call RestoreUser
+	user, err := userService.RestoreUser(ctx, "12345")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, expectedUser, user)
+}
+
+func TestUserServiceImpl_RestoreUser_NotDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetDeletedUser(ctx, "12345").
+		Return(nil, repository.ErrUserNotFound).
+		Times(1)
+
+	// Call RestoreUser
+	user, err := userService.RestoreUser(ctx, "12345")
+
+	// Assertions
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+	assert.Nil(t, user)
+}
+
+func TestUserServiceImpl_PurgeUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		PurgeUser(ctx, "12345").
+		Return(nil).
+		Times(1)
+
+	// Call PurgeUser
+	err := userService.PurgeUser(ctx, "12345")
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+func TestUserServiceImpl_ListUsers_PageSizeLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	// Unset page sizes use the default and oversized ones are capped
+	mockRepo.EXPECT().
+		ListUsers(ctx, repository.ListUsersQuery{PageSize: service.DefaultPageSize}).
+		Return(&repository.UserPage{}, nil).
+		Times(1)
+
+	mockRepo.EXPECT().
+		ListUsers(ctx, repository.ListUsersQuery{PageSize: service.MaxPageSize}).
+		Return(&repository.UserPage{}, nil).
+		Times(1)
+
+	_, err := userService.ListUsers(ctx, repository.ListUsersQuery{})
+	assert.NoError(t, err)
+
+	_, err = userService.ListUsers(ctx, repository.ListUsersQuery{PageSize: 10000})
+	assert.NoError(t, err)
+
+	// Negative page sizes are rejected
+	_, err = userService.ListUsers(ctx, repository.ListUsersQuery{PageSize: -1})
+	assert.ErrorIs(t, err, repository.ErrInvalidPageSize)
+}
+
+func TestUserServiceImpl_CreateUser_ReportsEveryViolation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	mockHasher.EXPECT().
+		HashPassword(gomock.Any()).
+		Return("hashedPassword", nil).
+		Times(1)
+
+	// Call CreateUser with both an empty username and a malformed email
+	_, err := userService.CreateUser(context.Background(), "", "invalidemail", "correct-horse-battery")
+
+	// Assertions
+	var validationErr *model.ValidationError
+	assert.ErrorIs(t, err, model.ErrInvalidArgument)
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Equal(t, []model.FieldViolation{
+			{Field: "username", Description: "username is required"},
+			{Field: "email", Description: "invalid email format"},
+		}, validationErr.Violations)
+	}
+}
+
+func TestUserServiceImpl_AuthenticateUser_SuspendedUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserByUsername(repository.WithCredentials(ctx), "testuser").
+		Return(&model.User{ID: "12345", Username: "testuser", HashedPassword: "hashedPassword", Status: model.UserStatusSuspended}, nil).
+		Times(1)
+
+	mockHasher.EXPECT().
+		ComparePassword("password", "hashedPassword").
+		Return(nil).
+		Times(1)
+
+	// Call AuthenticateUser
+	user, err := userService.AuthenticateUser(ctx, "testuser", "password", "")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrAccountDisabled)
+	assert.Nil(t, user)
+}
+
+func TestUserServiceImpl_SuspendUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Status: model.UserStatusActive}, nil).
+		Times(1)
+
+	// The transition is conditioned on the status that was read
+	mockRepo.EXPECT().
+		UpdateStatus(ctx, "12345", model.UserStatusActive, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id string, from model.UserStatus, change model.StatusChange) error {
+			assert.Equal(t, model.UserStatusSuspended, change.Status)
+			assert.Equal(t, "abuse", change.Reason)
+			assert.Equal(t, "trust-and-safety", change.Actor)
+			return nil
+		}).
+		Times(1)
+
+	// Call SuspendUser
+	user, err := userService.SuspendUser(ctx, "12345", "abuse", "trust-and-safety")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, model.UserStatusSuspended, user.Status)
+	assert.Equal(t, "abuse", user.LastStatusChange.Reason)
+}
+
+func TestUserServiceImpl_SuspendUser_RequiresReasonAndActor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	// Call SuspendUser without reason and actor
+	_, err := userService.SuspendUser(context.Background(), "12345", "", "")
+
+	// Assertions
+	var validationErr *model.ValidationError
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Len(t, validationErr.Violations, 2)
+	}
+}
+
+func TestUserServiceImpl_SuspendUser_AlreadySuspended(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Status: model.UserStatusSuspended}, nil).
+		Times(1)
+
+	// Call SuspendUser
+	_, err := userService.SuspendUser(ctx, "12345", "abuse", "trust-and-safety")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidStatusTransition)
+}
+
+func TestUserServiceImpl_ReactivateUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Status: model.UserStatusLocked}, nil).
+		Times(1)
+
+	mockRepo.EXPECT().
+		UpdateStatus(ctx, "12345", model.UserStatusLocked, gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	// Call ReactivateUser
+	user, err := userService.ReactivateUser(ctx, "12345", "appeal accepted", "support")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, model.UserStatusActive, user.Status)
+}
+
+func TestUserServiceImpl_ReactivateUser_PendingUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	// Pending users must verify their email instead of being reactivated
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Status: model.UserStatusPending}, nil).
+		Times(1)
+
+	// Call ReactivateUser
+	_, err := userService.ReactivateUser(ctx, "12345", "appeal accepted", "support")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidStatusTransition)
+}
+
+func TestUserServiceImpl_CreateUser_SendsVerificationEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	memoryMailer := mailer.NewMemoryMailer()
+	userService := service.NewUserService(mockRepo, mockHasher,
+		service.WithMailer(memoryMailer),
+		service.WithVerificationURL("https://berrytracer.test/verify"),
+	)
+
+	ctx := context.Background()
+
+	mockHasher.EXPECT().
+		HashPassword("correct-horse-battery").
+		Return("hashedPassword", nil).
+		Times(1)
+
+	// Only the hash of the token is persisted
+	var stored *model.EmailVerification
+	mockRepo.EXPECT().
+		CreateUser(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, u *model.User) error {
+			stored = u.EmailVerification
+			return nil
+		}).
+		Times(1)
+
+	// Call CreateUser
+	user, err := userService.CreateUser(ctx, "testuser", "testuser@example.com", "correct-horse-battery")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, model.UserStatusPending, user.Status)
+	if assert.NotNil(t, stored) {
+		assert.WithinDuration(t, time.Now().Add(service.DefaultVerificationTTL), stored.ExpiresAt, time.Minute)
+	}
+
+	messages := memoryMailer.Messages()
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "testuser@example.com", messages[0].To)
+		assert.Contains(t, messages[0].Body, "https://berrytracer.test/verify?token=")
+
+		token := messages[0].Body[strings.Index(messages[0].Body, "token=")+len("token="):]
+		token = strings.Fields(token)[0]
+		assert.Equal(t, stored.TokenHash, model.HashVerificationToken(token))
+	}
+}
+
+// TestUserServiceImpl_UpdateUser_ChangedEmailIsUnverified tests that a new email starts unverified with a fresh token
+func TestUserServiceImpl_UpdateUser_ChangedEmailIsUnverified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	memoryMailer := mailer.NewMemoryMailer()
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithMailer(memoryMailer))
+
+	ctx := context.Background()
+	newEmail := "new@example.com"
+	storedUser := &model.User{
+		ID:              "12345",
+		Username:        "testuser",
+		Email:           "old@example.com",
+		EmailCanonical:  "old@example.com",
+		HashedPassword:  "hashedPassword",
+		Status:          model.UserStatusActive,
+		EmailVerifiedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Version:         1,
+	}
+
+	mockRepo.EXPECT().GetUserById(repository.WithCredentials(ctx), "12345").Return(storedUser, nil).Times(1)
+
+	var stored *model.EmailVerification
+	mockRepo.EXPECT().
+		UpdateUser(ctx, gomock.Any(), int64(1), true).
+		DoAndReturn(func(ctx context.Context, u *model.User, expectedVersion int64, emailChanged bool) error {
+			assert.True(t, u.EmailVerifiedAt.IsZero())
+			stored = u.EmailVerification
+			return nil
+		}).
+		Times(1)
+
+	// Call UpdateUser
+	user, err := userService.UpdateUser(ctx, "12345", model.UserUpdate{Email: &newEmail}, 1)
+
+	// Assertions
+	require.NoError(t, err)
+	assert.False(t, user.IsEmailVerified())
+	require.NotNil(t, stored)
+
+	messages := memoryMailer.Messages()
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, newEmail, messages[0].To)
+
+		token := messages[0].Body[strings.Index(messages[0].Body, "address: ")+len("address: "):]
+		token = strings.Fields(token)[0]
+		assert.Equal(t, stored.TokenHash, model.HashVerificationToken(token))
+	}
+
+	// Changing the username only keeps the email verified
+	storedUser = &model.User{ID: "12345", Username: "testuser", Email: newEmail, EmailCanonical: newEmail, HashedPassword: "hashedPassword", EmailVerifiedAt: time.Now(), Version: 2}
+	newUsername := "renamed"
+	mockRepo.EXPECT().GetUserById(repository.WithCredentials(ctx), "12345").Return(storedUser, nil).Times(1)
+	mockRepo.EXPECT().UpdateUser(ctx, gomock.Any(), int64(2), false).Return(nil).Times(1)
+
+	user, err = userService.UpdateUser(ctx, "12345", model.UserUpdate{Username: &newUsername}, 2)
+
+	require.NoError(t, err)
+	assert.True(t, user.IsEmailVerified())
+	assert.Len(t, memoryMailer.Messages(), 1)
+}
+
+func TestUserServiceImpl_VerifyEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	tokenHash := model.HashVerificationToken("token")
+
+	mockRepo.EXPECT().
+		GetUserByVerificationToken(ctx, tokenHash).
+		Return(&model.User{
+			ID:                "12345",
+			Status:            model.UserStatusPending,
+			EmailVerification: &model.EmailVerification{TokenHash: tokenHash, ExpiresAt: time.Now().Add(time.Hour)},
+		}, nil).
+		Times(1)
+
+	// Verifying activates a pending user
+	mockRepo.EXPECT().
+		MarkEmailVerified(ctx, "12345", tokenHash, gomock.Any(), model.UserStatusActive).
+		Return(nil).
+		Times(1)
+
+	// Call VerifyEmail
+	user, err := userService.VerifyEmail(ctx, "token")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, model.UserStatusActive, user.Status)
+	assert.True(t, user.IsEmailVerified())
+	assert.Nil(t, user.EmailVerification)
+}
+
+func TestUserServiceImpl_VerifyEmail_ExpiredToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	tokenHash := model.HashVerificationToken("token")
+
+	mockRepo.EXPECT().
+		GetUserByVerificationToken(ctx, tokenHash).
+		Return(&model.User{
+			ID:                "12345",
+			Status:            model.UserStatusPending,
+			EmailVerification: &model.EmailVerification{TokenHash: tokenHash, ExpiresAt: time.Now().Add(-time.Minute)},
+		}, nil).
+		Times(1)
+
+	// Call VerifyEmail
+	_, err := userService.VerifyEmail(ctx, "token")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidVerificationToken)
+}
+
+func TestUserServiceImpl_VerifyEmail_UnknownToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserByVerificationToken(ctx, model.HashVerificationToken("token")).
+		Return(nil, repository.ErrUserNotFound).
+		Times(1)
+
+	// Call VerifyEmail
+	_, err := userService.VerifyEmail(ctx, "token")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrInvalidVerificationToken)
+}
+
+func TestUserServiceImpl_ResendVerification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	memoryMailer := mailer.NewMemoryMailer()
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithMailer(memoryMailer))
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Email: "testuser@example.com", Status: model.UserStatusPending}, nil).
+		Times(1)
+
+	mockRepo.EXPECT().
+		SetEmailVerification(ctx, "12345", gomock.Any()).
+		Return(nil).
+		Times(1)
+
+	// Call ResendVerification
+	err := userService.ResendVerification(ctx, "12345")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Len(t, memoryMailer.Messages(), 1)
+}
+
+func TestUserServiceImpl_ResendVerification_AlreadyVerified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	memoryMailer := mailer.NewMemoryMailer()
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithMailer(memoryMailer))
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(&model.User{ID: "12345", Status: model.UserStatusActive, EmailVerifiedAt: time.Now()}, nil).
+		Times(1)
+
+	// Call ResendVerification
+	err := userService.ResendVerification(ctx, "12345")
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrEmailAlreadyVerified)
+	assert.Empty(t, memoryMailer.Messages())
+}
+
+func TestUserServiceImpl_CreateUser_WeakPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	// An empty password is rejected before it is hashed
+	_, err := userService.CreateUser(context.Background(), "testuser", "testuser@example.com", "")
+
+	// Assertions
+	var validationErr *model.ValidationError
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Equal(t, []model.FieldViolation{
+			{Field: "password", Description: "must be at least 8 characters long"},
+		}, validationErr.Violations)
+	}
+}
+
+func TestUserServiceImpl_ChangePassword_PolicyViolation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(repository.WithCredentials(ctx), "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Email: "testuser@example.com", HashedPassword: "hashedPassword"}, nil).
+		Times(1)
+
+	mockHasher.EXPECT().
+		ComparePassword("oldPassword", "hashedPassword").
+		Return(nil).
+		Times(1)
+
+	// Call ChangePassword with a password derived from the username
+	err := userService.ChangePassword(ctx, "12345", "oldPassword", "testuser123")
+
+	// Assertions
+	var validationErr *model.ValidationError
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Equal(t, []model.FieldViolation{
+			{Field: "new_password", Description: "must not contain the username or email"},
+		}, validationErr.Violations)
+	}
+}
+
+func TestUserServiceImpl_GetUserByEmail_Canonical(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	// Lookups use the canonical form of the email
+	mockRepo.EXPECT().
+		GetUserByEmail(ctx, "alice@xn--bcher-kva.example").
+		Return(&model.User{ID: "12345", Email: "Alice@Bücher.example"}, nil).
+		Times(1)
+
+	// Call GetUserByEmail
+	user, err := userService.GetUserByEmail(ctx, "ALICE@bücher.EXAMPLE")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice@Bücher.example", user.Email)
+}
+
+func TestUserServiceImpl_CreateUser_StoresCanonicalForms(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockHasher.EXPECT().
+		HashPassword(gomock.Any()).
+		Return("hashedPassword", nil).
+		Times(1)
+
+	// Display forms are kept as typed next to the canonical forms
+	mockRepo.EXPECT().
+		CreateUser(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, u *model.User) error {
+			assert.Equal(t, "Alice", u.Username)
+			assert.Equal(t, "Alice@Example.COM", u.Email)
+			assert.Equal(t, "alice", u.UsernameCanonical)
+			assert.Equal(t, "alice@example.com", u.EmailCanonical)
+			return nil
+		}).
+		Times(1)
+
+	// Call CreateUser
+	_, err := userService.CreateUser(ctx, "Alice", "Alice@Example.COM", "correct-horse-battery")
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+func TestUserServiceImpl_CreateUser_CanonicalUsernameTaken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	mockHasher.EXPECT().
+		HashPassword(gomock.Any()).
+		Return("hashedPassword", nil).
+		Times(1)
+
+	// The unique index on the canonical username rejects "ALICE" when "alice" exists
+	mockRepo.EXPECT().
+		CreateUser(ctx, gomock.Any()).
+		Return(repository.ErrUsernameTaken).
+		Times(1)
+
+	// Call CreateUser
+	_, err := userService.CreateUser(ctx, "ALICE", "alice2@example.com", "correct-horse-battery")
+
+	// Assertions
+	assert.ErrorIs(t, err, repository.ErrUsernameTaken)
+}
+
+func TestUserServiceImpl_CheckUsernameAvailability_Available(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	// The username and the alternatives are checked in a single lookup
+	mockRepo.EXPECT().
+		FindTakenUsernames(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, usernames []string) ([]string, error) {
+			assert.Equal(t, "alice", usernames[0])
+			return nil, nil
+		}).
+		Times(1)
+
+	// Call CheckUsernameAvailability
+	availability, err := userService.CheckUsernameAvailability(ctx, "Alice")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.True(t, availability.Available)
+	assert.Empty(t, availability.Reasons)
+	assert.Empty(t, availability.Suggestions)
+}
+
+func TestUserServiceImpl_CheckUsernameAvailability_Taken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	// Every other candidate is taken as well
+	var taken []string
+	mockRepo.EXPECT().
+		FindTakenUsernames(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, usernames []string) ([]string, error) {
+			for i, username := range usernames {
+				if i%2 == 0 {
+					taken = append(taken, username)
+				}
+			}
+			return taken, nil
+		}).
+		Times(1)
+
+	// Call CheckUsernameAvailability
+	availability, err := userService.CheckUsernameAvailability(ctx, "alice")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.False(t, availability.Available)
+	assert.Equal(t, []string{"is already taken"}, availability.Reasons)
+	assert.NotEmpty(t, availability.Suggestions)
+	assert.LessOrEqual(t, len(availability.Suggestions), service.MaxUsernameSuggestions)
+	for _, suggestion := range availability.Suggestions {
+		assert.NotContains(t, taken, suggestion)
+		assert.Empty(t, model.UsernameViolations(suggestion, model.DefaultUsernamePolicy()))
+	}
+}
+
+func TestUserServiceImpl_CheckUsernameAvailability_Reserved(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+
+	// Only the alternatives are looked up
+	mockRepo.EXPECT().
+		FindTakenUsernames(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, usernames []string) ([]string, error) {
+			assert.NotContains(t, usernames, "admin")
+			return nil, nil
+		}).
+		Times(1)
+
+	// Call CheckUsernameAvailability
+	availability, err := userService.CheckUsernameAvailability(ctx, "Admin")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.False(t, availability.Available)
+	assert.Equal(t, []string{"is reserved"}, availability.Reasons)
+	assert.Len(t, availability.Suggestions, service.MaxUsernameSuggestions)
+}
+
+func TestUserServiceImpl_CreateUser_ReservedUsername(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	mockHasher.EXPECT().
+		HashPassword(gomock.Any()).
+		Return("hashedPassword", nil).
+		Times(1)
+
+	// Call CreateUser with a reserved username
+	_, err := userService.CreateUser(context.Background(), "support", "support@example.com", "correct-horse-battery")
+
+	// Assertions
+	var validationErr *model.ValidationError
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Equal(t, []model.FieldViolation{{Field: "username", Description: "is reserved"}}, validationErr.Violations)
+	}
+}
+
+// TestUserServiceImpl_CreateUser_RecordsEvent tests that creating a user records a created event in the outbox
+func TestUserServiceImpl_CreateUser_RecordsEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOutbox := mockrepository.NewMockOutboxRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithOutbox(mockOutbox, nil))
+
+	ctx := context.Background()
+
+	mockHasher.EXPECT().HashPassword("correct-horse-battery").Return("hashedPassword", nil).Times(1)
+	mockRepo.EXPECT().CreateUser(ctx, gomock.Any()).Return(nil).Times(1)
+	mockOutbox.EXPECT().
+		Append(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, events ...*model.Event) error {
+			if assert.Len(t, events, 1) {
+				assert.Equal(t, model.EventUserCreated, events[0].Type)
+				assert.Equal(t, "testuser", events[0].User.Username)
+			}
+			return nil
+		}).
+		Times(1)
+
+	// Call CreateUser
+	user, err := userService.CreateUser(ctx, "testuser", "testuser@example.com", "correct-horse-battery")
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.NotNil(t, user)
+}
+
+// TestUserServiceImpl_CreateUser_OutboxError tests that a user write fails when its event cannot be recorded
+func TestUserServiceImpl_CreateUser_OutboxError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOutbox := mockrepository.NewMockOutboxRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithOutbox(mockOutbox, nil))
+
+	ctx := context.Background()
+	outboxErr := errors.New("outbox unavailable")
+
+	mockHasher.EXPECT().HashPassword(gomock.Any()).Return("hashedPassword", nil).Times(1)
+	mockRepo.EXPECT().CreateUser(ctx, gomock.Any()).Return(nil).Times(1)
+	mockOutbox.EXPECT().Append(ctx, gomock.Any()).Return(outboxErr).Times(1)
+
+	// Call CreateUser
+	user, err := userService.CreateUser(ctx, "testuser", "testuser@example.com", "correct-horse-battery")
+
+	// Assertions
+	assert.ErrorIs(t, err, outboxErr)
+	assert.Nil(t, user)
+}
+
+// TestUserServiceImpl_UpdateUser_RecordsEmailChange tests that changing the email records the previous one
+func TestUserServiceImpl_UpdateUser_RecordsEmailChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOutbox := mockrepository.NewMockOutboxRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithOutbox(mockOutbox, nil))
+
+	ctx := context.Background()
+	newEmail := "new@example.com"
+
+	mockRepo.EXPECT().
+		GetUserById(repository.WithCredentials(ctx), "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Email: "old@example.com", EmailCanonical: "old@example.com", HashedPassword: "hashedPassword", Version: 1}, nil).
+		Times(1)
+	mockRepo.EXPECT().UpdateUser(ctx, gomock.Any(), int64(1), gomock.Any()).Return(nil).Times(1)
+	mockOutbox.EXPECT().
+		Append(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, events ...*model.Event) error {
+			if assert.Len(t, events, 2) {
+				assert.Equal(t, model.EventUserUpdated, events[0].Type)
+				assert.Equal(t, model.EventUserEmailChanged, events[1].Type)
+				assert.Equal(t, "old@example.com", events[1].PreviousEmail)
+				assert.Equal(t, newEmail, events[1].User.Email)
+			}
+			return nil
+		}).
+		Times(1)
+
+	// Call UpdateUser
+	_, err := userService.UpdateUser(ctx, "12345", model.UserUpdate{Email: &newEmail}, 1)
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+// TestUserServiceImpl_SuspendUser_RecordsEvent tests that status changes record their reason and actor
+func TestUserServiceImpl_SuspendUser_RecordsEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockOutbox := mockrepository.NewMockOutboxRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithOutbox(mockOutbox, nil))
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().
+		GetUserById(ctx, "12345").
+		Return(&model.User{ID: "12345", Username: "testuser", Status: model.UserStatusActive}, nil).
+		Times(1)
+	mockRepo.EXPECT().UpdateStatus(ctx, "12345", model.UserStatusActive, gomock.Any()).Return(nil).Times(1)
+	mockOutbox.EXPECT().
+		Append(ctx, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, events ...*model.Event) error {
+			if assert.Len(t, events, 1) {
+				assert.Equal(t, model.EventUserStatusChanged, events[0].Type)
+				assert.Equal(t, model.UserStatusSuspended, events[0].User.Status)
+				assert.Equal(t, "abuse", events[0].Reason)
+				assert.Equal(t, "trust-and-safety", events[0].Actor)
+			}
+			return nil
+		}).
+		Times(1)
+
+	// Call SuspendUser
+	_, err := userService.SuspendUser(ctx, "12345", "abuse", "trust-and-safety")
+
+	// Assertions
+	assert.NoError(t, err)
+}
+
+// TestUserServiceImpl_WatchUsers tests that changes are handed to the callback until the stream ends
+func TestUserServiceImpl_WatchUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockWatcher := mockrepository.NewMockUserWatcher(ctrl)
+	mockStream := mockrepository.NewMockUserChangeStream(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithUserWatcher(mockWatcher))
+
+	ctx := context.Background()
+	created := &model.UserChange{Type: model.UserChangeCreated, UserID: "12345", ResumeToken: "token-1"}
+	purged := &model.UserChange{Type: model.UserChangePurged, UserID: "12345", ResumeToken: "token-2"}
+
+	mockWatcher.EXPECT().WatchUsers(ctx, "token-0").Return(mockStream, nil).Times(1)
+	gomock.InOrder(
+		mockStream.EXPECT().Next(ctx).Return(created, nil),
+		mockStream.EXPECT().Next(ctx).Return(purged, nil),
+		mockStream.EXPECT().Next(ctx).Return(nil, io.EOF),
+	)
+	mockStream.EXPECT().Close(gomock.Any()).Return(nil).Times(1)
+
+	// Call WatchUsers
+	var received []*model.UserChange
+	err := userService.WatchUsers(ctx, "token-0", func(change *model.UserChange) error {
+		received = append(received, change)
+		return nil
+	})
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.UserChange{created, purged}, received)
+}
+
+// TestUserServiceImpl_WatchUsers_CallbackError tests that the stream is closed when the callback fails
+func TestUserServiceImpl_WatchUsers_CallbackError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	mockWatcher := mockrepository.NewMockUserWatcher(ctrl)
+	mockStream := mockrepository.NewMockUserChangeStream(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher, service.WithUserWatcher(mockWatcher))
+
+	ctx := context.Background()
+	sendErr := errors.New("client went away")
+
+	mockWatcher.EXPECT().WatchUsers(ctx, "").Return(mockStream, nil).Times(1)
+	mockStream.EXPECT().Next(ctx).Return(&model.UserChange{Type: model.UserChangeCreated}, nil).Times(1)
+	mockStream.EXPECT().Close(gomock.Any()).Return(nil).Times(1)
+
+	// Call WatchUsers
+	err := userService.WatchUsers(ctx, "", func(change *model.UserChange) error {
+		return sendErr
+	})
+
+	// Assertions
+	assert.ErrorIs(t, err, sendErr)
+}
+
+// TestUserServiceImpl_WatchUsers_Unavailable tests that watching fails without a watcher
+func TestUserServiceImpl_WatchUsers_Unavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userService := service.NewUserService(mockrepository.NewMockUserRepository(ctrl), mockcrypto.NewMockPasswordHasher(ctrl))
+
+	// Call WatchUsers
+	err := userService.WatchUsers(context.Background(), "", func(change *model.UserChange) error { return nil })
+
+	// Assertions
+	assert.ErrorIs(t, err, service.ErrWatchUnavailable)
+}
+
+// TestUserServiceImpl_BatchGetUsers tests that results follow the request order and mark missing users
+func TestUserServiceImpl_BatchGetUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	ctx := context.Background()
+	alice := &model.User{ID: "1", Username: "Alice", UsernameCanonical: "alice", Email: "alice@example.com", EmailCanonical: "alice@example.com"}
+	bob := &model.User{ID: "2", Username: "bob", UsernameCanonical: "bob", Email: "bob@example.com", EmailCanonical: "bob@example.com"}
+
+	// Lookups are canonicalized and unparseable emails are left out
+	mockRepo.EXPECT().
+		BatchGetUsers(ctx, []string{"2", "3", "1"}, []string{"bob@example.com"}, []string{"alice"}).
+		Return([]*model.User{alice, bob}, nil).
+		Times(1)
+
+	// Call BatchGetUsers
+	batch, err := userService.BatchGetUsers(ctx, []string{"2", "3", "1"}, []string{"Bob@Example.com", "not an email"}, []string{"ALICE"})
+
+	// Assertions
+	assert.NoError(t, err)
+	assert.Equal(t, []service.UserLookupResult{{Key: "2", User: bob}, {Key: "3"}, {Key: "1", User: alice}}, batch.IDs)
+	assert.Equal(t, []service.UserLookupResult{{Key: "Bob@Example.com", User: bob}, {Key: "not an email"}}, batch.Emails)
+	assert.Equal(t, []service.UserLookupResult{{Key: "ALICE", User: alice}}, batch.Usernames)
+}
+
+// TestUserServiceImpl_BatchGetUsers_TooLarge tests that oversized batches are rejected
+func TestUserServiceImpl_BatchGetUsers_TooLarge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mockrepository.NewMockUserRepository(ctrl)
+	mockHasher := mockcrypto.NewMockPasswordHasher(ctrl)
+	userService := service.NewUserService(mockRepo, mockHasher)
+
+	// Call BatchGetUsers
+	_, err := userService.BatchGetUsers(context.Background(), make([]string, service.MaxBatchSize+1), nil, nil)
+
+	// Assertions
+	var validationErr *model.ValidationError
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Equal(t, "ids", validationErr.Violations[0].Field)
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/BerryTracer/user-service/model"
+)
+
+// MaxUsernameSuggestions caps the number of alternatives offered for an unavailable username.
+const MaxUsernameSuggestions = 5
+
+// usernameCandidates is how many alternatives are generated, and checked in a
+// single lookup, to find MaxUsernameSuggestions available ones.
+const usernameCandidates = 20
+
+// UsernameAvailability tells whether a username can be registered. When it
+// cannot, Reasons explains why and Suggestions offers available alternatives.
+type UsernameAvailability struct {
+	Available   bool
+	Reasons     []string
+	Suggestions []string
+}
+
+// WithUsernamePolicy replaces the default policy for usernames chosen by users.
+func WithUsernamePolicy(policy *model.UsernamePolicy) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.UsernamePolicy = policy
+	}
+}
+
+// CheckUsernameAvailability implements UserService.
+func (s *UserServiceImpl) CheckUsernameAvailability(ctx context.Context, username string) (*UsernameAvailability, error) {
+	availability := &UsernameAvailability{Reasons: model.UsernameViolations(username, s.UsernamePolicy)}
+
+	candidates := s.usernameCandidates(username)
+	if len(availability.Reasons) == 0 {
+		// The requested username is checked in the same lookup as the alternatives.
+		candidates = append([]string{username}, candidates...)
+	}
+
+	taken, err := s.takenUsernames(ctx, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(availability.Reasons) == 0 {
+		if !taken[s.Normalizer.Username(username)] {
+			availability.Available = true
+			return availability, nil
+		}
+		availability.Reasons = append(availability.Reasons, "is already taken")
+		candidates = candidates[1:]
+	}
+
+	for _, candidate := range candidates {
+		if len(availability.Suggestions) == MaxUsernameSuggestions {
+			break
+		}
+		if !taken[s.Normalizer.Username(candidate)] {
+			availability.Suggestions = append(availability.Suggestions, candidate)
+		}
+	}
+
+	return availability, nil
+}
+
+// usernameCandidates derives alternatives to username that satisfy the username policy.
+func (s *UserServiceImpl) usernameCandidates(username string) []string {
+	policy := s.UsernamePolicy
+	if policy == nil {
+		policy = model.DefaultUsernamePolicy()
+	}
+
+	base := policy.Sanitize(username)
+	if base == "" {
+		base = "user"
+	}
+
+	seen := map[string]bool{}
+	var candidates []string
+	for attempt := 0; attempt < 4*usernameCandidates && len(candidates) < usernameCandidates; attempt++ {
+		// Two-digit suffixes first, longer ones once those keep colliding.
+		limit := 99
+		if attempt >= usernameCandidates {
+			limit = 9999
+		}
+		candidate := withSuffix(base, strconv.Itoa(1+rand.Intn(limit)), policy.MaxLength)
+
+		canonical := s.Normalizer.Username(candidate)
+		if seen[canonical] {
+			continue
+		}
+		seen[canonical] = true
+
+		if len(model.UsernameViolations(candidate, policy)) == 0 {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	return candidates
+}
+
+// takenUsernames looks up which of the usernames are in use, keyed by canonical form.
+func (s *UserServiceImpl) takenUsernames(ctx context.Context, usernames []string) (map[string]bool, error) {
+	canonical := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		canonical = append(canonical, s.Normalizer.Username(username))
+	}
+
+	found, err := s.UserRepository.FindTakenUsernames(ctx, canonical)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make(map[string]bool, len(found))
+	for _, username := range found {
+		taken[username] = true
+	}
+	return taken, nil
+}
+
+// withSuffix appends suffix to base, shortening base if the result would exceed maxLength characters.
+func withSuffix(base, suffix string, maxLength int) string {
+	if maxLength > 0 {
+		if keep := maxLength - len(suffix); utf8.RuneCountInString(base) > keep && keep > 0 {
+			base = string([]rune(base)[:keep])
+		}
+	}
+	return base + suffix
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/repository"
+)
+
+// ErrWatchUnavailable is returned by WatchUsers when no user watcher is configured.
+var ErrWatchUnavailable = errors.New("watching users is not available")
+
+// WithUserWatcher enables WatchUsers.
+func WithUserWatcher(watcher repository.UserWatcher) UserServiceOption {
+	return func(s *UserServiceImpl) {
+		s.Watcher = watcher
+	}
+}
+
+// WatchUsers implements UserService. It calls fn with every change to a user
+// after the one identified by resumeToken, or from now on when resumeToken is
+// empty, until ctx is done, fn fails or the stream ends. Callers that lose the
+// stream resume from the ResumeToken of the last change they handled.
+func (s *UserServiceImpl) WatchUsers(ctx context.Context, resumeToken string, fn func(*model.UserChange) error) error {
+	if s.Watcher == nil {
+		return ErrWatchUnavailable
+	}
+
+	stream, err := s.Watcher.WatchUsers(ctx, resumeToken)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := stream.Close(context.Background()); err != nil {
+			log.Printf("failed to close user change stream: %v\n", err)
+		}
+	}()
+
+	for {
+		change, err := stream.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Purged users cannot be told apart by organization, so calls scoped
+		// to a tenant only see changes to its current members.
+		if tenant, ok := repository.TenantFromContext(ctx); ok && (change.User == nil || !change.User.IsMember(tenant)) {
+			continue
+		}
+
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+}
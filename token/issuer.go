@@ -0,0 +1,107 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidToken is returned when an access token is malformed, expired, or
+// not signed by a key of the set.
+var ErrInvalidToken = errors.New("invalid access token")
+
+// DefaultAccessTokenTTL is how long access tokens are valid by default.
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+// AccessClaims are the claims of an access token.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	// SessionID identifies the sign-in the token was issued for.
+	SessionID string `json:"sid,omitempty"`
+	Username  string `json:"preferred_username,omitempty"`
+}
+
+// Issuer signs and verifies access tokens, which are JWTs naming the user as subject.
+type Issuer struct {
+	Keys           *KeySet
+	Issuer         string
+	Audience       string
+	AccessTokenTTL time.Duration
+}
+
+// NewIssuer returns a new Issuer with the default access token TTL.
+func NewIssuer(keys *KeySet, issuer, audience string) *Issuer {
+	return &Issuer{Keys: keys, Issuer: issuer, Audience: audience, AccessTokenTTL: DefaultAccessTokenTTL}
+}
+
+// IssueAccessToken returns a signed access token for user, issued at time now,
+// and the time it expires.
+func (i *Issuer) IssueAccessToken(user *model.User, sessionID string, now time.Time) (string, time.Time, error) {
+	key, err := i.Keys.SigningKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := now.Add(i.AccessTokenTTL)
+	claims := AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			Issuer:    i.Issuer,
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		SessionID: sessionID,
+		Username:  user.Username,
+	}
+	if i.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{i.Audience}
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken verifies an access token and returns its claims.
+func (i *Issuer) ParseAccessToken(accessToken string) (*AccessClaims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}),
+		jwt.WithIssuer(i.Issuer),
+		jwt.WithExpirationRequired(),
+	}
+	if i.Audience != "" {
+		opts = append(opts, jwt.WithAudience(i.Audience))
+	}
+
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, func(t *jwt.Token) (interface{}, error) {
+		id, _ := t.Header["kid"].(string)
+		key, public, ok := i.Keys.PublicKey(id)
+		if !ok || t.Method.Alg() != key.Algorithm {
+			return nil, ErrInvalidToken
+		}
+		return public, nil
+	}, opts...)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
@@ -0,0 +1,201 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoSigningKey is returned when a token must be signed but no key is loaded.
+var ErrNoSigningKey = errors.New("no token signing key")
+
+const (
+	// AlgorithmRS256 signs tokens with RSASSA-PKCS1-v1_5 and SHA-256.
+	AlgorithmRS256 = "RS256"
+	// AlgorithmEdDSA signs tokens with Ed25519.
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key is a private key tokens are signed with. Its ID is put in the header of
+// the tokens it signs, so verifiers can pick the matching public key.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+}
+
+// ParseKey parses a PEM encoded RSA or Ed25519 private key, in PKCS #8 or, for
+// RSA, PKCS #1 form.
+func ParseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data", id)
+	}
+
+	var private interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must have at least 2048 bits", id)
+		}
+		return &Key{ID: id, Algorithm: AlgorithmRS256, Private: private}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Algorithm: AlgorithmEdDSA, Private: private}, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, private)
+	}
+}
+
+// KeySet holds the keys tokens are signed and verified with. New tokens are
+// signed with the signing key only, but every key in the set verifies tokens,
+// so tokens signed with a retired key stay valid until they expire. KeySet is
+// safe for concurrent use and can be replaced while in use.
+type KeySet struct {
+	mu      sync.RWMutex
+	keys    map[string]*Key
+	signing *Key
+}
+
+// NewKeySet returns a KeySet holding keys, signing with the last one.
+func NewKeySet(keys ...*Key) *KeySet {
+	s := &KeySet{keys: map[string]*Key{}}
+	if len(keys) > 0 {
+		_ = s.Replace(keys, keys[len(keys)-1].ID)
+	}
+	return s
+}
+
+// Replace swaps the keys of the set, signing with the key with ID signingID.
+func (s *KeySet) Replace(keys []*Key, signingID string) error {
+	byID := make(map[string]*Key, len(keys))
+	for _, key := range keys {
+		byID[key.ID] = key
+	}
+
+	signing, ok := byID[signingID]
+	if !ok {
+		return fmt.Errorf("signing key %q is not loaded", signingID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = byID
+	s.signing = signing
+	return nil
+}
+
+// SigningKey returns the key new tokens are signed with.
+func (s *KeySet) SigningKey() (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.signing == nil {
+		return nil, ErrNoSigningKey
+	}
+	return s.signing, nil
+}
+
+// PublicKey returns the public key verifying tokens signed with the key with the given ID.
+func (s *KeySet) PublicKey(id string) (*Key, crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, nil, false
+	}
+	return key, key.Private.Public(), true
+}
+
+// Keys returns the keys of the set, ordered by ID.
+func (s *KeySet) Keys() []*Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// LoadKeyDir loads every *.pem file in dir into set, with the file name without
+// extension as key ID. Unless signingID is given, the key whose ID sorts last
+// signs, so keys named after their creation date, e.g. "2024-06-01.pem", rotate
+// as soon as a newer one is added. Publishing the next key ahead of time under
+// a fixed signingID lets verifiers fetch it before it signs anything.
+func LoadKeyDir(dir, signingID string, set *KeySet) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		key, err := ParseKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("no *.pem keys in %s", dir)
+	}
+	if signingID == "" {
+		signingID = keys[len(keys)-1].ID
+	}
+
+	return set.Replace(keys, signingID)
+}
+
+// WatchKeyDir reloads the keys in dir into set every interval until ctx is done.
+// Failed reloads are logged and keep the previously loaded keys.
+func WatchKeyDir(ctx context.Context, dir, signingID string, set *KeySet, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := LoadKeyDir(dir, signingID, set); err != nil {
+				log.Printf("failed to reload token keys from %s: %v\n", dir, err)
+			}
+		}
+	}
+}
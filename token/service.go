@@ -0,0 +1,178 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidServiceToken is returned when a service token is malformed,
+// expired, meant for another audience, or not signed by the service it names.
+var ErrInvalidServiceToken = errors.New("invalid service token")
+
+// MaxServiceTokenTTL is the longest lifetime a service token may have, so that
+// a leaked token is of little use.
+const MaxServiceTokenTTL = time.Hour
+
+// ServiceKey is the public key of a service calling this one. The service signs
+// short-lived tokens naming itself as issuer with the matching private key.
+type ServiceKey struct {
+	Service   string
+	Algorithm string
+	Public    crypto.PublicKey
+}
+
+// ParseServiceKey parses a PEM encoded RSA or Ed25519 public key in PKIX form.
+func ParseServiceKey(service string, data []byte) (*ServiceKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("service key %s: no PEM data", service)
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("service key %s: unsupported PEM block %q", service, block.Type)
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("service key %s: %w", service, err)
+	}
+
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("service key %s: RSA keys must have at least 2048 bits", service)
+		}
+		return &ServiceKey{Service: service, Algorithm: AlgorithmRS256, Public: public}, nil
+	case ed25519.PublicKey:
+		return &ServiceKey{Service: service, Algorithm: AlgorithmEdDSA, Public: public}, nil
+	default:
+		return nil, fmt.Errorf("service key %s: unsupported key type %T", service, public)
+	}
+}
+
+// ServiceVerifier verifies service tokens: JWTs a service signs with its own
+// key, naming itself as issuer and subject and this service as audience.
+// Its keys can be replaced while in use.
+type ServiceVerifier struct {
+	Audience string
+
+	mu   sync.RWMutex
+	keys map[string]*ServiceKey
+}
+
+// NewServiceVerifier returns a ServiceVerifier accepting tokens for audience
+// signed with one of keys.
+func NewServiceVerifier(audience string, keys ...*ServiceKey) *ServiceVerifier {
+	v := &ServiceVerifier{Audience: audience}
+	v.Replace(keys)
+	return v
+}
+
+// Replace swaps the keys of the verifier.
+func (v *ServiceVerifier) Replace(keys []*ServiceKey) {
+	byService := make(map[string]*ServiceKey, len(keys))
+	for _, key := range keys {
+		byService[key.Service] = key
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.keys = byService
+}
+
+func (v *ServiceVerifier) key(service string) (*ServiceKey, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	key, ok := v.keys[service]
+	return key, ok
+}
+
+// VerifyServiceToken verifies a service token and returns the name of the
+// service that signed it.
+func (v *ServiceVerifier) VerifyServiceToken(serviceToken string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(serviceToken, claims, func(t *jwt.Token) (interface{}, error) {
+		key, ok := v.key(claims.Issuer)
+		if !ok || t.Method.Alg() != key.Algorithm {
+			return nil, ErrInvalidServiceToken
+		}
+		return key.Public, nil
+	},
+		jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}),
+		jwt.WithAudience(v.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return "", ErrInvalidServiceToken
+	}
+
+	if claims.Subject != claims.Issuer || claims.IssuedAt == nil ||
+		claims.ExpiresAt.Sub(claims.IssuedAt.Time) > MaxServiceTokenTTL {
+		return "", ErrInvalidServiceToken
+	}
+	return claims.Issuer, nil
+}
+
+// LoadServiceKeyDir loads every *.pem file in dir into v, with the file name
+// without extension as the name of the service the key belongs to.
+func LoadServiceKeyDir(dir string, v *ServiceVerifier) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*ServiceKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		key, err := ParseServiceKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("no *.pem service keys in %s", dir)
+	}
+
+	v.Replace(keys)
+	return nil
+}
+
+// WatchServiceKeyDir reloads the keys in dir into v every interval until ctx
+// is done. Failed reloads are logged and keep the previously loaded keys.
+func WatchServiceKeyDir(ctx context.Context, dir string, v *ServiceVerifier, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := LoadServiceKeyDir(dir, v); err != nil {
+				log.Printf("failed to reload service keys from %s: %v\n", dir, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package token_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BerryTracer/user-service/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signServiceToken(t *testing.T, private ed25519.PrivateKey, claims jwt.RegisteredClaims) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(private)
+	require.NoError(t, err)
+	return signed
+}
+
+func serviceClaims(service, audience string, issuedAt time.Time, ttl time.Duration) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    service,
+		Subject:   service,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(issuedAt),
+		ExpiresAt: jwt.NewNumericDate(issuedAt.Add(ttl)),
+	}
+}
+
+func TestServiceVerifier_VerifyServiceToken(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	verifier := token.NewServiceVerifier("user-service", &token.ServiceKey{Service: "auth-gateway", Algorithm: token.AlgorithmEdDSA, Public: public})
+	now := time.Now()
+
+	service, err := verifier.VerifyServiceToken(signServiceToken(t, private, serviceClaims("auth-gateway", "user-service", now, time.Minute)))
+	require.NoError(t, err)
+	assert.Equal(t, "auth-gateway", service)
+
+	impersonating := serviceClaims("auth-gateway", "user-service", now, time.Minute)
+	impersonating.Subject = "admin-tool"
+
+	rejected := map[string]string{
+		"expired":          signServiceToken(t, private, serviceClaims("auth-gateway", "user-service", now.Add(-time.Hour), time.Minute)),
+		"other audience":   signServiceToken(t, private, serviceClaims("auth-gateway", "billing", now, time.Minute)),
+		"too long-lived":   signServiceToken(t, private, serviceClaims("auth-gateway", "user-service", now, 2*time.Hour)),
+		"unknown service":  signServiceToken(t, private, serviceClaims("admin-tool", "user-service", now, time.Minute)),
+		"wrong key":        signServiceToken(t, otherPrivate, serviceClaims("auth-gateway", "user-service", now, time.Minute)),
+		"subject mismatch": signServiceToken(t, private, impersonating),
+	}
+	for name, serviceToken := range rejected {
+		_, err := verifier.VerifyServiceToken(serviceToken)
+		assert.ErrorIs(t, err, token.ErrInvalidServiceToken, name)
+	}
+}
+
+func TestLoadServiceKeyDir(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "auth-gateway.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	verifier := token.NewServiceVerifier("user-service")
+	require.NoError(t, token.LoadServiceKeyDir(dir, verifier))
+
+	service, err := verifier.VerifyServiceToken(signServiceToken(t, private, serviceClaims("auth-gateway", "user-service", time.Now(), time.Minute)))
+	require.NoError(t, err)
+	assert.Equal(t, "auth-gateway", service)
+
+	assert.Error(t, token.LoadServiceKeyDir(t.TempDir(), verifier))
+}
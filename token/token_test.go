@@ -0,0 +1,135 @@
+package token_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BerryTracer/user-service/model"
+	"github.com/BerryTracer/user-service/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRSAKey(t *testing.T, id string) *token.Key {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return &token.Key{ID: id, Algorithm: token.AlgorithmRS256, Private: private}
+}
+
+func newEd25519Key(t *testing.T, id string) *token.Key {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &token.Key{ID: id, Algorithm: token.AlgorithmEdDSA, Private: private}
+}
+
+func TestIssuer_IssueAccessToken(t *testing.T) {
+	user := &model.User{ID: "12345", Username: "alice"}
+	now := time.Now().UTC()
+
+	for _, key := range []*token.Key{newRSAKey(t, "rsa"), newEd25519Key(t, "ed")} {
+		issuer := token.NewIssuer(token.NewKeySet(key), "user-service", "berrytracer")
+
+		accessToken, expiresAt, err := issuer.IssueAccessToken(user, "session-1", now)
+		require.NoError(t, err, key.ID)
+		assert.Equal(t, now.Add(token.DefaultAccessTokenTTL), expiresAt, key.ID)
+
+		claims, err := issuer.ParseAccessToken(accessToken)
+		if assert.NoError(t, err, key.ID) {
+			assert.Equal(t, "12345", claims.Subject)
+			assert.Equal(t, "alice", claims.Username)
+			assert.Equal(t, "session-1", claims.SessionID)
+		}
+	}
+}
+
+func TestIssuer_ParseAccessToken_Rejects(t *testing.T) {
+	user := &model.User{ID: "12345"}
+	keys := token.NewKeySet(newEd25519Key(t, "current"))
+	issuer := token.NewIssuer(keys, "user-service", "")
+
+	expired, _, err := issuer.IssueAccessToken(user, "", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = issuer.ParseAccessToken(expired)
+	assert.ErrorIs(t, err, token.ErrInvalidToken)
+
+	other := token.NewIssuer(token.NewKeySet(newEd25519Key(t, "current")), "user-service", "")
+	forged, _, err := other.IssueAccessToken(user, "", time.Now())
+	require.NoError(t, err)
+	_, err = issuer.ParseAccessToken(forged)
+	assert.ErrorIs(t, err, token.ErrInvalidToken)
+
+	otherIssuer := token.NewIssuer(keys, "someone-else", "")
+	foreign, _, err := otherIssuer.IssueAccessToken(user, "", time.Now())
+	require.NoError(t, err)
+	_, err = issuer.ParseAccessToken(foreign)
+	assert.ErrorIs(t, err, token.ErrInvalidToken)
+}
+
+// TestKeySet_Rotation tests that tokens signed with a retired key verify until the key is removed
+func TestKeySet_Rotation(t *testing.T) {
+	user := &model.User{ID: "12345"}
+	oldKey, newKey := newEd25519Key(t, "2024-01"), newRSAKey(t, "2024-06")
+	keys := token.NewKeySet(oldKey)
+	issuer := token.NewIssuer(keys, "user-service", "")
+
+	oldToken, _, err := issuer.IssueAccessToken(user, "", time.Now())
+	require.NoError(t, err)
+
+	require.NoError(t, keys.Replace([]*token.Key{oldKey, newKey}, newKey.ID))
+	signing, err := keys.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, newKey.ID, signing.ID)
+	_, err = issuer.ParseAccessToken(oldToken)
+	assert.NoError(t, err)
+
+	require.NoError(t, keys.Replace([]*token.Key{newKey}, newKey.ID))
+	_, err = issuer.ParseAccessToken(oldToken)
+	assert.ErrorIs(t, err, token.ErrInvalidToken)
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	keys := token.NewKeySet(newRSAKey(t, "a"), newEd25519Key(t, "b"))
+
+	jwks := keys.JWKS()
+	if assert.Len(t, jwks.Keys, 2) {
+		assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+		assert.Equal(t, "AQAB", jwks.Keys[0].E)
+		assert.Equal(t, "OKP", jwks.Keys[1].KeyType)
+		assert.Equal(t, "Ed25519", jwks.Keys[1].Curve)
+		assert.NotEmpty(t, jwks.Keys[1].X)
+	}
+}
+
+func TestLoadKeyDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"2024-01", "2024-06"} {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		require.NoError(t, err)
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".pem"), data, 0o600))
+	}
+
+	keys := token.NewKeySet()
+	require.NoError(t, token.LoadKeyDir(dir, "", keys))
+
+	signing, err := keys.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06", signing.ID)
+	assert.Len(t, keys.Keys(), 2)
+
+	require.NoError(t, token.LoadKeyDir(dir, "2024-01", keys))
+	signing, err = keys.SigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01", signing.ID)
+
+	assert.Error(t, token.LoadKeyDir(dir, "2025-01", keys))
+}